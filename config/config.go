@@ -15,6 +15,9 @@ type Config struct {
 	SMTP     SMTPConfig
 	Server   ServerConfig
 	CORS     CORSConfig
+	Storage  StorageConfig
+	Stats    StatsConfig
+	Reminder ReminderConfig
 }
 
 type DatabaseConfig struct {
@@ -66,6 +69,32 @@ type CORSConfig struct {
 	MaxAge         int
 }
 
+type StorageConfig struct {
+	Driver        string
+	LocalPath     string
+	S3Endpoint    string
+	S3Bucket      string
+	S3Region      string
+	S3AccessKey   string
+	S3SecretKey   string
+	SigningKey    string
+	URLTTL        time.Duration
+	MaxUploadSize int64
+	UserQuota     int64
+}
+
+type StatsConfig struct {
+	CacheTTL time.Duration
+}
+
+type ReminderConfig struct {
+	PollInterval   time.Duration
+	Lease          time.Duration
+	MaxAttempts    int
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+}
+
 func Load() (*Config, error) {
 	dbPort, _ := strconv.Atoi(getEnv("DB_PORT", "5432"))
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
@@ -83,6 +112,32 @@ func Load() (*Config, error) {
 	otpTTL, _ := strconv.Atoi(getEnv("OTP_TTL_MINUTES", "5"))
 	otpMaxAttempts, _ := strconv.Atoi(getEnv("OTP_MAX_ATTEMPTS", "5"))
 
+	storageURLTTL, err := time.ParseDuration(getEnv("STORAGE_URL_TTL", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid STORAGE_URL_TTL: %w", err)
+	}
+	maxUploadMB, _ := strconv.ParseInt(getEnv("STORAGE_MAX_UPLOAD_MB", "25"), 10, 64)
+	userQuotaMB, _ := strconv.ParseInt(getEnv("STORAGE_USER_QUOTA_MB", "500"), 10, 64)
+
+	statsCacheTTL, err := time.ParseDuration(getEnv("STATS_CACHE_TTL", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid STATS_CACHE_TTL: %w", err)
+	}
+
+	reminderPoll, err := time.ParseDuration(getEnv("REMINDER_POLL_INTERVAL", "15s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMINDER_POLL_INTERVAL: %w", err)
+	}
+	reminderLease, err := time.ParseDuration(getEnv("REMINDER_LEASE", "2m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMINDER_LEASE: %w", err)
+	}
+	reminderMaxAttempts, _ := strconv.Atoi(getEnv("REMINDER_MAX_ATTEMPTS", "5"))
+	webhookTimeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+	}
+
 	return &Config{
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -126,6 +181,29 @@ func Load() (*Config, error) {
 			AllowedHeaders: getEnv("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-Requested-With"),
 			MaxAge:         86400,
 		},
+		Storage: StorageConfig{
+			Driver:        getEnv("STORAGE_DRIVER", "local"),
+			LocalPath:     getEnv("STORAGE_LOCAL_PATH", "./uploads"),
+			S3Endpoint:    getEnv("STORAGE_S3_ENDPOINT", ""),
+			S3Bucket:      getEnv("STORAGE_S3_BUCKET", ""),
+			S3Region:      getEnv("STORAGE_S3_REGION", "us-east-1"),
+			S3AccessKey:   getEnv("STORAGE_S3_ACCESS_KEY", ""),
+			S3SecretKey:   getEnv("STORAGE_S3_SECRET_KEY", ""),
+			SigningKey:    getEnv("STORAGE_SIGNING_KEY", "default-signing-key-change-me"),
+			URLTTL:        storageURLTTL,
+			MaxUploadSize: maxUploadMB << 20,
+			UserQuota:     userQuotaMB << 20,
+		},
+		Stats: StatsConfig{
+			CacheTTL: statsCacheTTL,
+		},
+		Reminder: ReminderConfig{
+			PollInterval:   reminderPoll,
+			Lease:          reminderLease,
+			MaxAttempts:    reminderMaxAttempts,
+			WebhookSecret:  getEnv("WEBHOOK_SIGNING_SECRET", ""),
+			WebhookTimeout: webhookTimeout,
+		},
 	}, nil
 }
 
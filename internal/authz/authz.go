@@ -0,0 +1,81 @@
+// Package authz describes who a note or note group is accessed for and what
+// they may do with it. Repositories of shareable data take a Principal instead
+// of a bare user ID and refuse writes the principal's role does not allow.
+package authz
+
+import "errors"
+
+// ErrForbidden is returned when a principal may see an item but not perform
+// the requested action on it
+var ErrForbidden = errors.New("permission denied")
+
+// Roles a user can have on an item. Owner is implied for the user who created
+// it; the others are granted by sharing.
+const (
+	RoleViewer    = "viewer"
+	RoleCommenter = "commenter"
+	RoleEditor    = "editor"
+	RoleOwner     = "owner"
+)
+
+// Action is something done with an item; each role allows every action up to
+// its own
+type Action int
+
+const (
+	// ActionView reads an item
+	ActionView Action = iota
+	// ActionComment adds comments to an item
+	ActionComment
+	// ActionEdit changes an item's content
+	ActionEdit
+	// ActionManage deletes, pins, regroups or shares an item
+	ActionManage
+)
+
+var roleActions = map[string]Action{
+	RoleViewer:    ActionView,
+	RoleCommenter: ActionComment,
+	RoleEditor:    ActionEdit,
+	RoleOwner:     ActionManage,
+}
+
+// Principal is the user a repository call is made for. OwnerID is whose data
+// is accessed: the user's own, or the owner of an item shared with them.
+type Principal struct {
+	UserID  string
+	OwnerID string
+	Role    string
+}
+
+// Owner is the principal of a user working on their own data
+func Owner(userID string) Principal {
+	return Principal{UserID: userID, OwnerID: userID, Role: RoleOwner}
+}
+
+// Can reports whether the principal's role allows an action
+func (p Principal) Can(action Action) bool {
+	allowed, ok := roleActions[p.Role]
+	return ok && p.OwnerID != "" && action <= allowed
+}
+
+// IsOwner reports whether the principal works on their own data
+func (p Principal) IsOwner() bool {
+	return p.Role == RoleOwner && p.UserID == p.OwnerID
+}
+
+// ValidShareRole reports whether a role can be granted to another user
+func ValidShareRole(role string) bool {
+	return role == RoleViewer || role == RoleCommenter || role == RoleEditor
+}
+
+// Higher returns the role allowing more of two roles
+func Higher(a, b string) string {
+	if _, ok := roleActions[a]; !ok {
+		return b
+	}
+	if roleActions[b] > roleActions[a] {
+		return b
+	}
+	return a
+}
@@ -92,6 +92,7 @@ func RunMigrations(db *sql.DB) error {
 			updated_at TIMESTAMPTZ DEFAULT now()
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_profiles_user_id ON profiles(user_id)`,
+		`ALTER TABLE profiles ADD COLUMN IF NOT EXISTS avatar_attachment_id TEXT`,
 	}
 
 	for _, migration := range migrations {
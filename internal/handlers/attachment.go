@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// multipartOverhead leaves room for the multipart envelope around the file
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	service *service.AttachmentService
+}
+
+func NewAttachmentHandler(service *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{service: service}
+}
+
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.service.MaxUploadSize()+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid upload, expected multipart form with a file field")
+		return
+	}
+
+	// Stream the file part instead of buffering the whole form to disk
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid upload, expected multipart form with a file field")
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := h.service.Upload(r.Context(), claims.UserID.String(), part.FileName(), part)
+		part.Close()
+		if err != nil {
+			writeAttachmentError(w, err, "Failed to upload attachment")
+			return
+		}
+
+		WriteJSON(w, http.StatusCreated, attachment)
+		return
+	}
+
+	WriteError(w, http.StatusBadRequest, "File is required")
+}
+
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	attachments, err := h.service.GetUserAttachments(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch attachments")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	attachmentID := chi.URLParam(r, "id")
+
+	attachment, err := h.service.GetAttachment(r.Context(), attachmentID, claims.UserID.String())
+	if err != nil {
+		writeAttachmentError(w, err, "Failed to fetch attachment")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, attachment)
+}
+
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	attachmentID := chi.URLParam(r, "id")
+
+	if err := h.service.DeleteAttachment(r.Context(), attachmentID, claims.UserID.String()); err != nil {
+		writeAttachmentError(w, err, "Failed to delete attachment")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Attachment deleted"})
+}
+
+func (h *AttachmentHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	usage, err := h.service.GetUsage(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch storage usage")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, usage)
+}
+
+// DownloadAttachment serves a blob through a signed link; the signature takes
+// the place of authentication so links work in <img> tags
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID := chi.URLParam(r, "id")
+	query := r.URL.Query()
+
+	attachment, body, err := h.service.Open(r.Context(), attachmentID, query.Get("variant"), query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		writeAttachmentError(w, err, "Failed to download attachment")
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(cacheSeconds(query.Get("expires"))))
+	if query.Get("variant") != service.VariantThumbnail {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", attachment.Size))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// cacheSeconds lets clients cache a download until its link expires
+func cacheSeconds(expires string) int {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return 0
+	}
+	remaining := unix - time.Now().Unix()
+	if remaining < 0 {
+		return 0
+	}
+	return int(remaining)
+}
+
+func writeAttachmentError(w http.ResponseWriter, err error, fallback string) {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, service.ErrAttachmentNotFound):
+		WriteError(w, http.StatusNotFound, "Attachment not found")
+	case errors.Is(err, service.ErrInvalidAttachmentID):
+		WriteError(w, http.StatusBadRequest, "Invalid attachment ID")
+	case errors.Is(err, service.ErrInvalidDownloadLink):
+		WriteError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrEmptyUpload):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrUploadTooLarge), errors.As(err, &maxBytesErr):
+		WriteError(w, http.StatusRequestEntityTooLarge, "Uploaded file is too large")
+	case errors.Is(err, service.ErrQuotaExceeded):
+		WriteError(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
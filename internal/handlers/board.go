@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type BoardHandler struct {
+	service *service.BoardService
+}
+
+func NewBoardHandler(service *service.BoardService) *BoardHandler {
+	return &BoardHandler{service: service}
+}
+
+type BoardColumnRequest struct {
+	ID       *string `json:"id,omitempty"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	WIPLimit *int    `json:"wip_limit,omitempty"`
+}
+
+type CreateBoardRequest struct {
+	Name    string               `json:"name"`
+	Tag     *string              `json:"tag,omitempty"`
+	Columns []BoardColumnRequest `json:"columns,omitempty"`
+}
+
+// UpdateBoardRequest changes a board; an empty tag clears it and columns,
+// when given, replace all columns
+type UpdateBoardRequest struct {
+	Name    *string              `json:"name,omitempty"`
+	Tag     *string              `json:"tag,omitempty"`
+	Columns []BoardColumnRequest `json:"columns,omitempty"`
+}
+
+type MoveBoardTaskRequest struct {
+	TaskID   string  `json:"task_id"`
+	ColumnID string  `json:"column_id"`
+	AfterID  *string `json:"after_id,omitempty"`
+	BeforeID *string `json:"before_id,omitempty"`
+}
+
+func boardColumns(columns []BoardColumnRequest) []service.BoardColumnInput {
+	if columns == nil {
+		return nil
+	}
+	result := make([]service.BoardColumnInput, len(columns))
+	for i, column := range columns {
+		result[i] = service.BoardColumnInput{ID: column.ID, Name: column.Name, Status: column.Status, WIPLimit: column.WIPLimit}
+	}
+	return result
+}
+
+func (h *BoardHandler) GetBoards(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	boards, err := h.service.ListBoards(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch boards")
+		return
+	}
+
+	// Ensure we return empty array instead of null
+	if boards == nil {
+		boards = []models.Board{}
+	}
+
+	WriteJSON(w, http.StatusOK, boards)
+}
+
+func (h *BoardHandler) CreateBoard(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateBoardRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	board, err := h.service.CreateBoard(r.Context(), claims.UserID.String(), req.Name, req.Tag, boardColumns(req.Columns))
+	if err != nil {
+		writeBoardError(w, err, "Failed to create board")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, board)
+}
+
+// GetBoard returns a board with the tasks of every column, for drag and drop
+func (h *BoardHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	board, err := h.service.GetBoard(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeBoardError(w, err, "Failed to fetch board")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, board)
+}
+
+func (h *BoardHandler) UpdateBoard(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req UpdateBoardRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == nil && req.Tag == nil && req.Columns == nil {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	board, err := h.service.UpdateBoard(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Name, req.Tag, boardColumns(req.Columns))
+	if err != nil {
+		writeBoardError(w, err, "Failed to update board")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, board)
+}
+
+func (h *BoardHandler) DeleteBoard(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteBoard(r.Context(), claims.UserID.String(), chi.URLParam(r, "id")); err != nil {
+		writeBoardError(w, err, "Failed to delete board")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Board deleted"})
+}
+
+// MoveTask moves a task to a column and place on the board, changing its
+// status
+func (h *BoardHandler) MoveTask(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MoveBoardTaskRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.TaskID == "" || req.ColumnID == "" {
+		WriteError(w, http.StatusBadRequest, "task_id and column_id are required")
+		return
+	}
+
+	move := service.BoardMove{TaskID: req.TaskID, ColumnID: req.ColumnID, AfterID: req.AfterID, BeforeID: req.BeforeID}
+	task, err := h.service.MoveTask(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), move)
+	if err != nil {
+		writeBoardError(w, err, "Failed to move task")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+func writeBoardError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrBoardNotFound):
+		WriteError(w, http.StatusNotFound, "Board not found")
+	case errors.Is(err, service.ErrBoardColumnNotFound):
+		WriteError(w, http.StatusNotFound, "Board column not found")
+	case errors.Is(err, service.ErrInvalidBoardID),
+		errors.Is(err, service.ErrBoardNameRequired),
+		errors.Is(err, service.ErrBoardNameTooLong),
+		errors.Is(err, service.ErrTooManyBoards),
+		errors.Is(err, service.ErrBoardColumnsRequired),
+		errors.Is(err, service.ErrTooManyBoardColumns),
+		errors.Is(err, service.ErrBoardColumnNameRequired),
+		errors.Is(err, service.ErrBoardColumnNameTooLong),
+		errors.Is(err, service.ErrDuplicateBoardStatus),
+		errors.Is(err, service.ErrInvalidWIPLimit),
+		errors.Is(err, service.ErrTaskNotOnBoard):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeTaskError(w, err, fallback)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// CollabSubprotocol is the WebSocket subprotocol of live note editing
+const CollabSubprotocol = "journal-collab"
+
+const (
+	// collabMaxMessageSize bounds a single message from a client
+	collabMaxMessageSize = 1 << 20
+	// collabWriteWait bounds writing a message to a client
+	collabWriteWait = 10 * time.Second
+	// collabPongWait is how long a silent client is kept; pings are sent
+	// often enough for a live client to answer in time
+	collabPongWait   = 60 * time.Second
+	collabPingPeriod = collabPongWait * 9 / 10
+)
+
+type CollabHandler struct {
+	service  *service.CollabService
+	upgrader websocket.Upgrader
+}
+
+// NewCollabHandler accepts WebSocket connections from the origins allowed by
+// the CORS configuration: "*" or a comma separated list
+func NewCollabHandler(service *service.CollabService, allowedOrigins string) *CollabHandler {
+	return &CollabHandler{
+		service: service,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{CollabSubprotocol},
+			CheckOrigin: func(r *http.Request) bool {
+				return originAllowed(r.Header.Get("Origin"), allowedOrigins)
+			},
+		},
+	}
+}
+
+// Connect joins the live editing session of a note. The connection first
+// receives a snapshot of the note and then the operations of everyone
+// editing it; see docs/COLLABORATIVE_EDITING.md for the protocol.
+func (h *CollabHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	client, err := h.service.Join(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), claims.Email)
+	if err != nil {
+		switch {
+		case service.IsNotFound(err):
+			WriteError(w, http.StatusNotFound, "Note not found")
+		case errors.Is(err, service.ErrInvalidNoteID):
+			WriteError(w, http.StatusBadRequest, "Invalid note ID")
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to join note")
+		}
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the request
+		client.Leave()
+		return
+	}
+
+	// The connection outlives the request, so it is served in the background
+	go writeCollab(conn, client)
+	go readCollab(conn, client)
+}
+
+// readCollab hands the client's messages to its session until the
+// connection drops
+func readCollab(conn *websocket.Conn, client *service.CollabClient) {
+	defer client.Leave()
+
+	conn.SetReadLimit(collabMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg service.CollabClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			// Answered with a reject like any other malformed message
+			msg = service.CollabClientMessage{}
+		}
+		client.Submit(msg)
+	}
+}
+
+// writeCollab sends the session's messages to the client and keeps the
+// connection alive, closing it once the client left the session
+func writeCollab(conn *websocket.Conn, client *service.CollabClient) {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				client.Leave()
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				client.Leave()
+				return
+			}
+		}
+	}
+}
+
+func originAllowed(origin, allowedOrigins string) bool {
+	if origin == "" || allowedOrigins == "*" {
+		return true
+	}
+	for _, allowed := range strings.Split(allowedOrigins, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), origin) {
+			return true
+		}
+	}
+	return false
+}
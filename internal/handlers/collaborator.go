@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CollaboratorHandler struct {
+	service *service.CollaboratorService
+}
+
+func NewCollaboratorHandler(service *service.CollaboratorService) *CollaboratorHandler {
+	return &CollaboratorHandler{service: service}
+}
+
+type AddCollaboratorRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type UpdateCollaboratorRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *CollaboratorHandler) GetSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	items, err := h.service.SharedWithMe(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch shared items")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, items)
+}
+
+func (h *CollaboratorHandler) GetNoteCollaborators(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, models.ShareResourceNote)
+}
+
+func (h *CollaboratorHandler) AddNoteCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.add(w, r, models.ShareResourceNote)
+}
+
+func (h *CollaboratorHandler) UpdateNoteCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, models.ShareResourceNote)
+}
+
+func (h *CollaboratorHandler) RemoveNoteCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.remove(w, r, models.ShareResourceNote)
+}
+
+func (h *CollaboratorHandler) GetGroupCollaborators(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, models.ShareResourceGroup)
+}
+
+func (h *CollaboratorHandler) AddGroupCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.add(w, r, models.ShareResourceGroup)
+}
+
+func (h *CollaboratorHandler) UpdateGroupCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, models.ShareResourceGroup)
+}
+
+func (h *CollaboratorHandler) RemoveGroupCollaborator(w http.ResponseWriter, r *http.Request) {
+	h.remove(w, r, models.ShareResourceGroup)
+}
+
+func (h *CollaboratorHandler) list(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	collaborators, err := h.service.ListCollaborators(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"))
+	if err != nil {
+		writeCollaboratorError(w, err, "Failed to fetch collaborators")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, collaborators)
+}
+
+func (h *CollaboratorHandler) add(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req AddCollaboratorRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// The response is the same whether or not the email has an account
+	if _, err := h.service.AddCollaborator(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"), req.Email, req.Role); err != nil {
+		writeCollaboratorError(w, err, "Failed to add collaborator")
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, map[string]string{"message": "If the email belongs to a registered user, they now have access"})
+}
+
+func (h *CollaboratorHandler) update(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req UpdateCollaboratorRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	collaborator, err := h.service.UpdateCollaborator(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"), chi.URLParam(r, "userId"), req.Role)
+	if err != nil {
+		writeCollaboratorError(w, err, "Failed to update collaborator")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, collaborator)
+}
+
+func (h *CollaboratorHandler) remove(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.RemoveCollaborator(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"), chi.URLParam(r, "userId")); err != nil {
+		writeCollaboratorError(w, err, "Failed to remove collaborator")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Collaborator removed successfully"})
+}
+
+func writeCollaboratorError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, authz.ErrForbidden):
+		WriteError(w, http.StatusForbidden, "Only the owner can manage collaborators")
+	case errors.Is(err, service.ErrCollaboratorNotFound):
+		WriteError(w, http.StatusNotFound, "Collaborator not found")
+	case errors.Is(err, service.ErrCollaboratorEmailRequired),
+		errors.Is(err, service.ErrInvalidCollaboratorRole),
+		errors.Is(err, service.ErrCannotShareWithSelf):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNoteNotFound):
+		WriteError(w, http.StatusNotFound, "Note not found")
+	case errors.Is(err, service.ErrGroupNotFound):
+		WriteError(w, http.StatusNotFound, "Note group not found")
+	case errors.Is(err, service.ErrInvalidNoteID):
+		WriteError(w, http.StatusBadRequest, "Invalid note ID")
+	case errors.Is(err, service.ErrInvalidGroupID):
+		WriteError(w, http.StatusBadRequest, "Invalid group ID")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
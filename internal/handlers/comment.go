@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CommentHandler struct {
+	service *service.CommentService
+}
+
+func NewCommentHandler(service *service.CommentService) *CommentHandler {
+	return &CommentHandler{service: service}
+}
+
+type CreateCommentRequest struct {
+	Body     string  `json:"body"`
+	BlockID  *string `json:"block_id"`
+	ParentID *string `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var filter service.CommentFilter
+	if blockID := r.URL.Query().Get("block_id"); blockID != "" {
+		filter.BlockID = &blockID
+	}
+	if r.URL.Query().Get("resolved") != "" {
+		val := r.URL.Query().Get("resolved") == "true"
+		filter.Resolved = &val
+	}
+	if r.URL.Query().Get("orphaned") != "" {
+		val := r.URL.Query().Get("orphaned") == "true"
+		filter.Orphaned = &val
+	}
+
+	threads, err := h.service.ListThreads(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), filter)
+	if err != nil {
+		writeCommentError(w, err, "Failed to fetch comments")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, threads)
+}
+
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateCommentRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	comment, err := h.service.CreateComment(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), claims.Email, req.Body, req.BlockID, req.ParentID)
+	if err != nil {
+		writeCommentError(w, err, "Failed to create comment")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, comment)
+}
+
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req UpdateCommentRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	comment, err := h.service.EditComment(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), chi.URLParam(r, "commentId"), req.Body)
+	if err != nil {
+		writeCommentError(w, err, "Failed to update comment")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, comment)
+}
+
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteComment(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), chi.URLParam(r, "commentId")); err != nil {
+		writeCommentError(w, err, "Failed to delete comment")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Comment deleted successfully"})
+}
+
+func (h *CommentHandler) ResolveComment(w http.ResponseWriter, r *http.Request) {
+	h.setResolved(w, r, true)
+}
+
+func (h *CommentHandler) UnresolveComment(w http.ResponseWriter, r *http.Request) {
+	h.setResolved(w, r, false)
+}
+
+func (h *CommentHandler) setResolved(w http.ResponseWriter, r *http.Request, resolved bool) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	comment, err := h.service.SetResolved(r.Context(), chi.URLParam(r, "id"), claims.UserID.String(), chi.URLParam(r, "commentId"), resolved)
+	if err != nil {
+		writeCommentError(w, err, "Failed to update comment")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, comment)
+}
+
+func writeCommentError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, authz.ErrForbidden):
+		WriteError(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, service.ErrCommentNotAuthor):
+		WriteError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrCommentNotFound):
+		WriteError(w, http.StatusNotFound, "Comment not found")
+	case errors.Is(err, service.ErrBlockNotFound):
+		WriteError(w, http.StatusNotFound, "Block not found")
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Note not found")
+	case errors.Is(err, service.ErrInvalidNoteID):
+		WriteError(w, http.StatusBadRequest, "Invalid note ID")
+	case errors.Is(err, service.ErrInvalidCommentID),
+		errors.Is(err, service.ErrCommentBodyRequired),
+		errors.Is(err, service.ErrCommentTooLong),
+		errors.Is(err, service.ErrInvalidMention),
+		errors.Is(err, service.ErrCommentIsReply):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DependencyRequest struct {
+	TaskID string `json:"task_id"`
+}
+
+// GetDependencies returns the tasks a task is blocked by and the tasks it
+// blocks
+func (h *TaskHandler) GetDependencies(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	dependencies, err := h.service.GetDependencies(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to fetch dependencies")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, dependencies)
+}
+
+// AddDependency marks a task as blocked by the task in the body
+func (h *TaskHandler) AddDependency(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req DependencyRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.TaskID == "" {
+		WriteError(w, http.StatusBadRequest, "task_id is required")
+		return
+	}
+
+	task, err := h.service.AddDependency(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.TaskID)
+	if err != nil {
+		writeTaskError(w, err, "Failed to add dependency")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, task)
+}
+
+func (h *TaskHandler) RemoveDependency(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	task, err := h.service.RemoveDependency(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "prerequisiteId"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to remove dependency")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+// GetDependencyGraph returns the dependency graph around the comma separated
+// task ids in ?ids
+func (h *TaskHandler) GetDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	graph, err := h.service.DependencyGraph(r.Context(), claims.UserID.String(), ids)
+	if err != nil {
+		writeTaskError(w, err, "Failed to build dependency graph")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, graph)
+}
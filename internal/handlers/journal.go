@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type JournalHandler struct {
+	service *service.JournalService
+}
+
+func NewJournalHandler(service *service.JournalService) *JournalHandler {
+	return &JournalHandler{service: service}
+}
+
+type PutJournalEntryRequest struct {
+	Title      *string  `json:"title,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	TemplateID string   `json:"template_id,omitempty"`
+}
+
+func (h *JournalHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	date := chi.URLParam(r, "date")
+
+	note, err := h.service.GetEntry(r.Context(), claims.UserID.String(), date, r.URL.Query().Get("template_id"))
+	if err != nil {
+		writeJournalError(w, err, "Failed to fetch journal entry")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, note)
+}
+
+func (h *JournalHandler) PutEntry(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	date := chi.URLParam(r, "date")
+
+	var req PutJournalEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	note, err := h.service.PutEntry(r.Context(), claims.UserID.String(), date, req.Title, req.Tags, req.TemplateID)
+	if err != nil {
+		writeJournalError(w, err, "Failed to save journal entry")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, note)
+}
+
+func (h *JournalHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	query := r.URL.Query()
+
+	calendar, err := h.service.Calendar(r.Context(), claims.UserID.String(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeJournalError(w, err, "Failed to fetch journal calendar")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, calendar)
+}
+
+func writeJournalError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidJournalDate), errors.Is(err, service.ErrInvalidJournalRange):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrTemplateNotFound):
+		WriteError(w, http.StatusNotFound, "Template not found")
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Journal entry not found")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/markdown"
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/service"
 	"backend-journaling/pkg/jwt"
@@ -20,8 +24,9 @@ func NewNoteHandler(service *service.NoteService) *NoteHandler {
 }
 
 type CreateNoteRequest struct {
-	Title string   `json:"title"`
-	Tags  []string `json:"tags"`
+	Title      string   `json:"title"`
+	Tags       []string `json:"tags"`
+	TemplateID string   `json:"template_id,omitempty"`
 }
 
 type UpdateNoteRequest struct {
@@ -31,18 +36,36 @@ type UpdateNoteRequest struct {
 }
 
 type AddBlockRequest struct {
-	Type      string            `json:"type"`
-	ContentMD string            `json:"content_md,omitempty"`
-	Items     []models.TodoItem `json:"items,omitempty"`
+	Type         string            `json:"type"`
+	ContentMD    string            `json:"content_md,omitempty"`
+	Items        []models.TodoItem `json:"items,omitempty"`
+	AttachmentID *string           `json:"attachment_id,omitempty"`
+	ParentID     *string           `json:"parent_id,omitempty"`
+	Position     *int              `json:"position,omitempty"`
 }
 
 type UpdateBlockRequest struct {
-	ContentMD *string           `json:"content_md,omitempty"`
-	Items     []models.TodoItem `json:"items,omitempty"`
+	ContentMD    *string           `json:"content_md,omitempty"`
+	Items        []models.TodoItem `json:"items,omitempty"`
+	AttachmentID *string           `json:"attachment_id,omitempty"`
 }
 
 type ReorderBlocksRequest struct {
-	Order []string `json:"order"`
+	ParentID *string  `json:"parent_id,omitempty"`
+	Order    []string `json:"order"`
+}
+
+type TransferBlocksRequest struct {
+	TargetNoteID string   `json:"target_note_id"`
+	BlockIDs     []string `json:"block_ids"`
+	ParentID     *string  `json:"parent_id,omitempty"`
+	Position     *int     `json:"position,omitempty"`
+	Mode         string   `json:"mode"`
+}
+
+type MoveBlockRequest struct {
+	ParentID *string `json:"parent_id"`
+	Position *int    `json:"position,omitempty"`
 }
 
 func (h *NoteHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
@@ -54,12 +77,16 @@ func (h *NoteHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Title == "" {
+	if req.Title == "" && req.TemplateID == "" {
 		WriteError(w, http.StatusBadRequest, "Title is required")
 		return
 	}
 
-	note, err := h.service.CreateNote(r.Context(), claims.UserID.String(), req.Title, req.Tags)
+	note, err := h.service.CreateNote(r.Context(), claims.UserID.String(), req.Title, req.Tags, req.TemplateID)
+	if errors.Is(err, service.ErrTemplateNotFound) {
+		WriteError(w, http.StatusNotFound, "Template not found")
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to create note")
 		return
@@ -133,6 +160,10 @@ func (h *NoteHandler) UpdateNote(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusNotFound, "Note not found")
 			return
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to update note")
 		return
 	}
@@ -149,6 +180,10 @@ func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusNotFound, "Note not found")
 			return
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to delete note")
 		return
 	}
@@ -171,13 +206,14 @@ func (h *NoteHandler) AddBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	block, err := h.service.AddBlock(r.Context(), noteID, claims.UserID.String(), req.Type, req.ContentMD, req.Items)
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	block, err := h.service.AddBlock(r.Context(), noteID, claims.UserID.String(), req.Type, req.ContentMD, req.Items, req.AttachmentID, req.ParentID, position)
 	if err != nil {
-		if service.IsNotFound(err) {
-			WriteError(w, http.StatusNotFound, "Note not found")
-			return
-		}
-		WriteError(w, http.StatusInternalServerError, "Failed to add block")
+		writeBlockError(w, err, "Failed to add block")
 		return
 	}
 
@@ -202,6 +238,9 @@ func (h *NoteHandler) UpdateBlock(w http.ResponseWriter, r *http.Request) {
 	if req.Items != nil {
 		updates["items"] = req.Items
 	}
+	if req.AttachmentID != nil {
+		updates["attachment_id"] = *req.AttachmentID
+	}
 
 	if len(updates) == 0 {
 		WriteError(w, http.StatusBadRequest, "No fields to update")
@@ -213,6 +252,18 @@ func (h *NoteHandler) UpdateBlock(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusNotFound, "Note or block not found")
 			return
 		}
+		if errors.Is(err, authz.ErrForbidden) {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
+		if errors.Is(err, service.ErrBlockNotImage) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrAttachmentNotFound) || errors.Is(err, service.ErrInvalidAttachmentID) || errors.Is(err, service.ErrNotAnImage) {
+			WriteError(w, http.StatusBadRequest, "Attachment must be an uploaded image")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to update block")
 		return
 	}
@@ -226,11 +277,7 @@ func (h *NoteHandler) DeleteBlock(w http.ResponseWriter, r *http.Request) {
 	blockID := chi.URLParam(r, "blockId")
 
 	if err := h.service.DeleteBlock(r.Context(), noteID, claims.UserID.String(), blockID); err != nil {
-		if service.IsNotFound(err) {
-			WriteError(w, http.StatusNotFound, "Note or block not found")
-			return
-		}
-		WriteError(w, http.StatusInternalServerError, "Failed to delete block")
+		writeBlockError(w, err, "Failed to delete block")
 		return
 	}
 
@@ -252,14 +299,266 @@ func (h *NoteHandler) ReorderBlocks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.ReorderBlocks(r.Context(), noteID, claims.UserID.String(), req.Order); err != nil {
+	if err := h.service.ReorderBlocks(r.Context(), noteID, claims.UserID.String(), req.ParentID, req.Order); err != nil {
+		writeBlockError(w, err, "Failed to reorder blocks")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Blocks reordered"})
+}
+
+func (h *NoteHandler) MoveBlock(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+	blockID := chi.URLParam(r, "blockId")
+
+	var req MoveBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	if err := h.service.MoveBlock(r.Context(), noteID, claims.UserID.String(), blockID, req.ParentID, position); err != nil {
+		writeBlockError(w, err, "Failed to move block")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Block moved"})
+}
+
+func (h *NoteHandler) IndentBlock(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+	blockID := chi.URLParam(r, "blockId")
+
+	if err := h.service.IndentBlock(r.Context(), noteID, claims.UserID.String(), blockID); err != nil {
+		writeBlockError(w, err, "Failed to indent block")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Block indented"})
+}
+
+func (h *NoteHandler) OutdentBlock(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+	blockID := chi.URLParam(r, "blockId")
+
+	if err := h.service.OutdentBlock(r.Context(), noteID, claims.UserID.String(), blockID); err != nil {
+		writeBlockError(w, err, "Failed to outdent block")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Block outdented"})
+}
+
+func (h *NoteHandler) GetBlockTree(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+
+	tree, err := h.service.GetBlockTree(r.Context(), noteID, claims.UserID.String())
+	if err != nil {
+		writeBlockError(w, err, "Failed to fetch block tree")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tree)
+}
+
+func (h *NoteHandler) TransferBlocks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+
+	var req TransferBlocksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.TargetNoteID == "" {
+		WriteError(w, http.StatusBadRequest, "Target note ID is required")
+		return
+	}
+
+	if len(req.BlockIDs) == 0 {
+		WriteError(w, http.StatusBadRequest, "Block IDs are required")
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = "move"
+	}
+	if req.Mode != "move" && req.Mode != "copy" {
+		WriteError(w, http.StatusBadRequest, "Mode must be move or copy")
+		return
+	}
+
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	blocks, err := h.service.TransferBlocks(r.Context(), noteID, req.TargetNoteID, claims.UserID.String(), req.BlockIDs, req.ParentID, position, req.Mode == "copy")
+	if err != nil {
+		writeBlockError(w, err, "Failed to transfer blocks")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"target_note_id": req.TargetNoteID,
+		"blocks":         blocks,
+	})
+}
+
+// maxImportUploadSize limits the size of an uploaded Markdown file or zip
+const maxImportUploadSize = 20 << 20
+
+func (h *NoteHandler) ExportNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+
+	var (
+		note    *models.Note
+		content []byte
+		err     error
+	)
+	switch format {
+	case "md":
+		var text string
+		note, text, err = h.service.ExportMarkdown(r.Context(), noteID, claims.UserID.String())
+		content = []byte(text)
+	case "html":
+		note, content, err = h.service.ExportHTML(r.Context(), noteID, claims.UserID.String())
+	case "pdf":
+		note, content, err = h.service.ExportPDF(r.Context(), noteID, claims.UserID.String())
+	default:
+		WriteError(w, http.StatusBadRequest, "Unsupported export format")
+		return
+	}
+
+	if err != nil {
 		if service.IsNotFound(err) {
 			WriteError(w, http.StatusNotFound, "Note not found")
 			return
 		}
-		WriteError(w, http.StatusInternalServerError, "Failed to reorder blocks")
+		WriteError(w, http.StatusInternalServerError, "Failed to export note")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]string{"message": "Blocks reordered"})
+	WriteExport(w, note.Title, format, content)
+}
+
+func (h *NoteHandler) ImportNotes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportUploadSize)
+	if err := r.ParseMultipartForm(maxImportUploadSize); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid upload, expected multipart form with a file field")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "File is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Failed to read uploaded file")
+		return
+	}
+
+	notes, err := h.service.ImportMarkdown(r.Context(), claims.UserID.String(), header.Filename, data)
+	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedImport) || errors.Is(err, service.ErrImportTooLarge) || errors.Is(err, markdown.ErrEmptyDocument) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to import notes")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, notes)
+}
+
+func (h *NoteHandler) GetBacklinks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+
+	backlinks, err := h.service.GetBacklinks(r.Context(), noteID, claims.UserID.String())
+	if err != nil {
+		if service.IsNotFound(err) {
+			WriteError(w, http.StatusNotFound, "Note not found")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch backlinks")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, backlinks)
+}
+
+func (h *NoteHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	noteID := chi.URLParam(r, "id")
+
+	links, err := h.service.GetOutgoingLinks(r.Context(), noteID, claims.UserID.String())
+	if err != nil {
+		if service.IsNotFound(err) {
+			WriteError(w, http.StatusNotFound, "Note not found")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch links")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, links)
+}
+
+func (h *NoteHandler) GetDanglingLinks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	links, err := h.service.GetDanglingLinks(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch dangling links")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, links)
+}
+
+// writeBlockError maps block tree errors to HTTP responses
+func writeBlockError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Note not found")
+	case errors.Is(err, authz.ErrForbidden):
+		WriteError(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, service.ErrBlockNotFound):
+		WriteError(w, http.StatusNotFound, "Block not found")
+	case errors.Is(err, service.ErrInvalidBlockMove):
+		WriteError(w, http.StatusBadRequest, "Invalid block move")
+	case errors.Is(err, service.ErrInvalidBlockOrder):
+		WriteError(w, http.StatusBadRequest, "Invalid block order")
+	case errors.Is(err, service.ErrBlockConflict):
+		WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrAttachmentNotFound), errors.Is(err, service.ErrInvalidAttachmentID):
+		WriteError(w, http.StatusBadRequest, "Image blocks need an attachment_id of an uploaded image")
+	case errors.Is(err, service.ErrNotAnImage):
+		WriteError(w, http.StatusBadRequest, "Attachment is not an image")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
 	"backend-journaling/internal/service"
 	"backend-journaling/pkg/jwt"
 
@@ -147,6 +149,10 @@ func (h *NoteGroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to update group")
 		return
 	}
@@ -170,6 +176,10 @@ func (h *NoteGroupHandler) PinGroup(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusNotFound, "Group not found")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to pin group")
 		return
 	}
@@ -196,6 +206,10 @@ func (h *NoteGroupHandler) ArchiveGroup(w http.ResponseWriter, r *http.Request)
 			WriteError(w, http.StatusNotFound, "Group not found")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to archive group")
 		return
 	}
@@ -218,6 +232,10 @@ func (h *NoteGroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusNotFound, "Group not found")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to delete group")
 		return
 	}
@@ -252,6 +270,10 @@ func (h *NoteGroupHandler) AddNoteToGroup(w http.ResponseWriter, r *http.Request
 			WriteError(w, http.StatusNotFound, "Note not found")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to add note to group")
 		return
 	}
@@ -271,6 +293,10 @@ func (h *NoteGroupHandler) RemoveNoteFromGroup(w http.ResponseWriter, r *http.Re
 			WriteError(w, http.StatusNotFound, "Note not found")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to remove note from group")
 		return
 	}
@@ -305,6 +331,10 @@ func (h *NoteGroupHandler) MoveNotesToGroup(w http.ResponseWriter, r *http.Reque
 			WriteError(w, http.StatusBadRequest, "Invalid note ID")
 			return
 		}
+		if err == authz.ErrForbidden {
+			WriteError(w, http.StatusForbidden, "Permission denied")
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to move notes to group")
 		return
 	}
@@ -331,3 +361,40 @@ func (h *NoteGroupHandler) GetNotesInGroup(w http.ResponseWriter, r *http.Reques
 
 	WriteJSON(w, http.StatusOK, notes)
 }
+
+// ExportGroup renders a note group with all of its notes as HTML or PDF
+func (h *NoteGroupHandler) ExportGroup(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	groupID := chi.URLParam(r, "id")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+
+	var (
+		group   *models.NoteGroup
+		content []byte
+		err     error
+	)
+	switch format {
+	case "html":
+		group, content, err = h.service.ExportHTML(r.Context(), groupID, claims.UserID.String())
+	case "pdf":
+		group, content, err = h.service.ExportPDF(r.Context(), groupID, claims.UserID.String())
+	default:
+		WriteError(w, http.StatusBadRequest, "Unsupported export format")
+		return
+	}
+
+	if err != nil {
+		if err == service.ErrGroupNotFound || err == service.ErrInvalidGroupID {
+			WriteError(w, http.StatusNotFound, "Group not found")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to export group")
+		return
+	}
+
+	WriteExport(w, group.Name, format, content)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// notificationStreamLifetime ends a stream before the router's request
+	// timeout; EventSource reconnects on its own and resumes from the last
+	// event it received
+	notificationStreamLifetime = 50 * time.Second
+	// notificationStreamPoll picks up notifications created by other server
+	// instances, which do not wake streams on this one
+	notificationStreamPoll      = 5 * time.Second
+	notificationStreamHeartbeat = 25 * time.Second
+	notificationStreamRetry     = 2 * time.Second
+	notificationStreamBatch     = 50
+)
+
+type NotificationHandler struct {
+	service *service.NotificationService
+}
+
+func NewNotificationHandler(service *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{service: service}
+}
+
+type NotificationReadRequest struct {
+	Read *bool `json:"read"`
+}
+
+// GetNotifications lists the user's in-app notifications, newest first
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, service.ErrInvalidNotificationLimit.Error())
+			return
+		}
+		limit = parsed
+	}
+
+	unreadOnly := false
+	if value := query.Get("unread"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "unread must be true or false")
+			return
+		}
+		unreadOnly = parsed
+	}
+
+	notifications, err := h.service.ListNotifications(r.Context(), claims.UserID.String(), unreadOnly, query.Get("before"), limit)
+	if err != nil {
+		writeNotificationError(w, err, "Failed to fetch notifications")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, notifications)
+}
+
+func (h *NotificationHandler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	count, err := h.service.UnreadCount(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to count notifications")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]int64{"unread": count})
+}
+
+// UpdateNotification marks a notification read or unread
+func (h *NotificationHandler) UpdateNotification(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req NotificationReadRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Read == nil {
+		WriteError(w, http.StatusBadRequest, "read is required")
+		return
+	}
+
+	notification, err := h.service.SetRead(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), *req.Read)
+	if err != nil {
+		writeNotificationError(w, err, "Failed to update notification")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, notification)
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.MarkAllRead(r.Context(), claims.UserID.String()); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "All notifications marked as read"})
+}
+
+func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteNotification(r.Context(), claims.UserID.String(), chi.URLParam(r, "id")); err != nil {
+		writeNotificationError(w, err, "Failed to delete notification")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Notification deleted successfully"})
+}
+
+// Stream pushes the user's new notifications and unread count as
+// Server-Sent Events. A reconnecting client resumes after the notification
+// in Last-Event-ID; see docs/NOTIFICATIONS_API.md for the events.
+func (h *NotificationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	userID := claims.UserID.String()
+
+	// Subscribe before reading anything so no change slips in between
+	changed, unsubscribe := h.service.Subscribe(userID)
+	defer unsubscribe()
+
+	ctx := r.Context()
+	cursor, err := h.streamStart(ctx, r, userID)
+	if err != nil {
+		writeNotificationError(w, err, "Failed to open notification stream")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", notificationStreamRetry.Milliseconds()); err != nil {
+		return
+	}
+
+	poll := time.NewTicker(notificationStreamPoll)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(notificationStreamHeartbeat)
+	defer heartbeat.Stop()
+	lifetime := time.NewTimer(notificationStreamLifetime)
+	defer lifetime.Stop()
+
+	unread := int64(-1)
+	for {
+		if cursor, err = h.pushNotifications(ctx, w, userID, cursor); err != nil {
+			return
+		}
+		count, err := h.service.UnreadCount(ctx, userID)
+		if err != nil {
+			return
+		}
+		if count != unread {
+			if err := writeEvent(w, "unread", "", map[string]int64{"unread": count}); err != nil {
+				return
+			}
+			unread = count
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-lifetime.C:
+			return
+		case <-changed:
+		case <-poll.C:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamStart is the notification a stream continues after: the one named
+// by Last-Event-ID, or else the newest one so only new notifications are sent
+func (h *NotificationHandler) streamStart(ctx context.Context, r *http.Request, userID string) (primitive.ObjectID, error) {
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if id, err := primitive.ObjectIDFromHex(lastID); err == nil {
+			return id, nil
+		}
+	}
+
+	newest, err := h.service.ListNotifications(ctx, userID, false, "", 1)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if len(newest) == 0 {
+		return primitive.NilObjectID, nil
+	}
+	return newest[0].ID, nil
+}
+
+// pushNotifications writes the notifications created after cursor and
+// returns the id of the last one written
+func (h *NotificationHandler) pushNotifications(ctx context.Context, w http.ResponseWriter, userID string, cursor primitive.ObjectID) (primitive.ObjectID, error) {
+	for {
+		notifications, err := h.service.NotificationsSince(ctx, userID, cursor, notificationStreamBatch)
+		if err != nil {
+			return cursor, err
+		}
+		for i := range notifications {
+			if err := writeEvent(w, "notification", notifications[i].ID.Hex(), notifications[i]); err != nil {
+				return cursor, err
+			}
+			cursor = notifications[i].ID
+		}
+		if len(notifications) < notificationStreamBatch {
+			return cursor, nil
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func writeNotificationError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrNotificationNotFound):
+		WriteError(w, http.StatusNotFound, "Notification not found")
+	case errors.Is(err, service.ErrInvalidNotificationID):
+		WriteError(w, http.StatusBadRequest, "Invalid notification ID")
+	case errors.Is(err, service.ErrInvalidNotificationLimit),
+		errors.Is(err, service.ErrInvalidNotificationCursor):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+	"backend-journaling/pkg/rrule"
+)
+
+type RecurrenceHandler struct {
+	service *service.RecurrenceService
+}
+
+func NewRecurrenceHandler(service *service.RecurrenceService) *RecurrenceHandler {
+	return &RecurrenceHandler{service: service}
+}
+
+type PreviewRecurrenceRequest struct {
+	RRule    string `json:"rrule"`
+	Timezone string `json:"timezone"`
+	Start    string `json:"start"`
+	After    string `json:"after"`
+	Count    int    `json:"count"`
+}
+
+// Preview lists the upcoming occurrences of a rule before it is saved
+func (h *RecurrenceHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req PreviewRecurrenceRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	preview, err := h.service.Preview(claims.UserID.String(), req.RRule, req.Timezone, req.Start, req.After, req.Count)
+	if err != nil {
+		if isRecurrenceError(err) || errors.Is(err, service.ErrInvalidDueDate) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to preview occurrences")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, preview)
+}
+
+func isRecurrenceError(err error) bool {
+	return errors.Is(err, rrule.ErrInvalidRule) ||
+		errors.Is(err, rrule.ErrUnsupportedRule) ||
+		errors.Is(err, service.ErrInvalidTimezone) ||
+		errors.Is(err, service.ErrRecurrenceNeedsDate) ||
+		errors.Is(err, service.ErrRecurrenceEnded) ||
+		errors.Is(err, service.ErrRecurrenceNeverOccurs) ||
+		errors.Is(err, service.ErrNotRecurring) ||
+		errors.Is(err, service.ErrInvalidPreviewCount) ||
+		errors.Is(err, service.ErrPreviewStartRequired)
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReminderHandler struct {
+	service *service.ReminderService
+}
+
+func NewReminderHandler(service *service.ReminderService) *ReminderHandler {
+	return &ReminderHandler{service: service}
+}
+
+// ReminderRequest creates or changes a reminder. Exactly one of remind_at and
+// before_minutes is set on create; the item can only be set on create.
+type ReminderRequest struct {
+	TargetType    string   `json:"target_type"`
+	TargetID      string   `json:"target_id"`
+	Date          string   `json:"date"`
+	RemindAt      *string  `json:"remind_at"`
+	BeforeMinutes *int     `json:"before_minutes"`
+	Message       *string  `json:"message"`
+	Channels      []string `json:"channels"`
+	WebhookURL    *string  `json:"webhook_url"`
+}
+
+func (req ReminderRequest) input() service.ReminderInput {
+	return service.ReminderInput{
+		TargetType:    req.TargetType,
+		TargetID:      req.TargetID,
+		Date:          req.Date,
+		RemindAt:      req.RemindAt,
+		BeforeMinutes: req.BeforeMinutes,
+		Message:       req.Message,
+		Channels:      req.Channels,
+		WebhookURL:    req.WebhookURL,
+	}
+}
+
+func (h *ReminderHandler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	query := r.URL.Query()
+	filter := service.ReminderFilter{
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Date:       query.Get("date"),
+		Status:     query.Get("status"),
+	}
+
+	reminders, err := h.service.ListReminders(r.Context(), claims.UserID.String(), filter)
+	if err != nil {
+		writeReminderError(w, err, "Failed to fetch reminders")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, reminders)
+}
+
+func (h *ReminderHandler) GetReminder(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	reminder, err := h.service.GetReminder(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeReminderError(w, err, "Failed to fetch reminder")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, reminder)
+}
+
+func (h *ReminderHandler) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req ReminderRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	reminder, err := h.service.CreateReminder(r.Context(), claims.UserID.String(), req.input())
+	if err != nil {
+		writeReminderError(w, err, "Failed to create reminder")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, reminder)
+}
+
+func (h *ReminderHandler) UpdateReminder(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req ReminderRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	reminder, err := h.service.UpdateReminder(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.input())
+	if err != nil {
+		writeReminderError(w, err, "Failed to update reminder")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, reminder)
+}
+
+func (h *ReminderHandler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteReminder(r.Context(), claims.UserID.String(), chi.URLParam(r, "id")); err != nil {
+		writeReminderError(w, err, "Failed to delete reminder")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Reminder deleted successfully"})
+}
+
+func writeReminderError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrReminderNotFound):
+		WriteError(w, http.StatusNotFound, "Reminder not found")
+	case errors.Is(err, service.ErrReminderTargetNotFound):
+		WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidReminderID),
+		errors.Is(err, service.ErrInvalidReminderTarget),
+		errors.Is(err, service.ErrReminderTargetRequired),
+		errors.Is(err, service.ErrReminderDateRequired),
+		errors.Is(err, service.ErrReminderTimeRequired),
+		errors.Is(err, service.ErrInvalidReminderTime),
+		errors.Is(err, service.ErrInvalidReminderOffset),
+		errors.Is(err, service.ErrReminderInPast),
+		errors.Is(err, service.ErrInvalidReminderChannel),
+		errors.Is(err, service.ErrReminderWebhookRequired),
+		errors.Is(err, service.ErrReminderWebhookAddress),
+		errors.Is(err, service.ErrReminderMessageTooLong),
+		errors.Is(err, service.ErrTooManyReminders),
+		errors.Is(err, service.ErrReminderTargetImmutable),
+		errors.Is(err, service.ErrReminderFilterNeedsType):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
+
+	"backend-journaling/internal/render"
 )
 
 type Response struct {
@@ -59,3 +63,35 @@ func GetUserAgent(r *http.Request) *string {
 	ua := r.Header.Get("User-Agent")
 	return &ua
 }
+
+var exportContentTypes = map[string]string{
+	"md":   "text/markdown; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+	"pdf":  "application/pdf",
+	"csv":  "text/csv; charset=utf-8",
+}
+
+// WriteExport sends a rendered document as a file download named after title
+func WriteExport(w http.ResponseWriter, title, format string, content []byte) {
+	if format == "html" {
+		w.Header().Set("Content-Security-Policy", render.HTMLContentSecurityPolicy)
+	}
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(title, format)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// exportFilename turns a title into a safe download filename
+func exportFilename(title, ext string) string {
+	name := strings.Trim(unsafeFilenameChars.ReplaceAllString(title, "-"), "-.")
+	if name == "" {
+		name = "export"
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return name + "." + ext
+}
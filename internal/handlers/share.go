@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/render"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxSharePasswordBody bounds the body of a password submitted to a share link
+const maxSharePasswordBody = 4 << 10
+
+type ShareHandler struct {
+	service *service.ShareService
+}
+
+func NewShareHandler(service *service.ShareService) *ShareHandler {
+	return &ShareHandler{service: service}
+}
+
+// PutShareRequest replaces the settings of a link. A null expires_at never
+// expires; password is left unchanged when omitted and removed when empty.
+type PutShareRequest struct {
+	ExpiresAt *models.FlexibleTime `json:"expires_at"`
+	Password  *string              `json:"password"`
+}
+
+func (h *ShareHandler) GetShares(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	shares, err := h.service.ListShares(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch shared items")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, shares)
+}
+
+func (h *ShareHandler) GetNoteShare(w http.ResponseWriter, r *http.Request) {
+	h.getShare(w, r, models.ShareResourceNote)
+}
+
+func (h *ShareHandler) PutNoteShare(w http.ResponseWriter, r *http.Request) {
+	h.putShare(w, r, models.ShareResourceNote)
+}
+
+func (h *ShareHandler) DeleteNoteShare(w http.ResponseWriter, r *http.Request) {
+	h.deleteShare(w, r, models.ShareResourceNote)
+}
+
+func (h *ShareHandler) GetGroupShare(w http.ResponseWriter, r *http.Request) {
+	h.getShare(w, r, models.ShareResourceGroup)
+}
+
+func (h *ShareHandler) PutGroupShare(w http.ResponseWriter, r *http.Request) {
+	h.putShare(w, r, models.ShareResourceGroup)
+}
+
+func (h *ShareHandler) DeleteGroupShare(w http.ResponseWriter, r *http.Request) {
+	h.deleteShare(w, r, models.ShareResourceGroup)
+}
+
+func (h *ShareHandler) getShare(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	share, err := h.service.GetShare(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"))
+	if err != nil {
+		writeShareError(w, err, "Failed to fetch share link")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, share)
+}
+
+func (h *ShareHandler) putShare(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req PutShareRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings := service.ShareSettings{Password: req.Password}
+	if req.ExpiresAt != nil && !req.ExpiresAt.IsZero() {
+		settings.ExpiresAt = &req.ExpiresAt.Time
+	}
+
+	share, created, err := h.service.PutShare(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id"), settings)
+	if err != nil {
+		writeShareError(w, err, "Failed to share")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	WriteJSON(w, status, share)
+}
+
+func (h *ShareHandler) deleteShare(w http.ResponseWriter, r *http.Request, resourceType string) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.RevokeShare(r.Context(), claims.UserID.String(), resourceType, chi.URLParam(r, "id")); err != nil {
+		writeShareError(w, err, "Failed to revoke share link")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Share link revoked successfully"})
+}
+
+// ViewShare serves a shared note or group without authentication, as an HTML
+// page or, with ?format=json, as JSON. The password of a protected link is
+// sent in the X-Share-Password header or posted as a password field.
+func (h *ShareHandler) ViewShare(w http.ResponseWriter, r *http.Request) {
+	shareToken := chi.URLParam(r, "token")
+	asJSON := r.URL.Query().Get("format") == "json"
+
+	pass := r.Header.Get("X-Share-Password")
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSharePasswordBody)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var req struct {
+				Password string `json:"password"`
+			}
+			if err := DecodeJSON(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			pass = req.Password
+		} else {
+			if err := r.ParseForm(); err != nil {
+				WriteError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			pass = r.PostForm.Get("password")
+		}
+	}
+
+	// Shared pages must not be cached, indexed or leak their URL onwards
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if asJSON {
+		item, err := h.service.View(r.Context(), shareToken, pass)
+		if err != nil {
+			writeShareError(w, err, "Failed to open share link")
+			return
+		}
+		WriteJSON(w, http.StatusOK, item)
+		return
+	}
+
+	content, err := h.service.ViewHTML(r.Context(), shareToken, pass)
+	if errors.Is(err, service.ErrSharePasswordRequired) || errors.Is(err, service.ErrInvalidSharePassword) {
+		content, err = render.PasswordHTML(errors.Is(err, service.ErrInvalidSharePassword))
+		if err == nil {
+			writeHTML(w, http.StatusUnauthorized, content)
+			return
+		}
+	}
+	if err != nil {
+		writeShareError(w, err, "Failed to open share link")
+		return
+	}
+
+	writeHTML(w, http.StatusOK, content)
+}
+
+func writeHTML(w http.ResponseWriter, status int, content []byte) {
+	w.Header().Set("Content-Security-Policy", render.HTMLContentSecurityPolicy)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func writeShareError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrShareNotFound):
+		WriteError(w, http.StatusNotFound, "Share link not found")
+	case errors.Is(err, service.ErrShareExpired):
+		WriteError(w, http.StatusGone, "Share link has expired")
+	case errors.Is(err, service.ErrSharePasswordRequired):
+		WriteError(w, http.StatusUnauthorized, "Password required")
+	case errors.Is(err, service.ErrInvalidSharePassword):
+		WriteError(w, http.StatusUnauthorized, "Invalid password")
+	case errors.Is(err, service.ErrInvalidShareExpiry),
+		errors.Is(err, service.ErrSharePasswordTooLong):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNoteNotFound):
+		WriteError(w, http.StatusNotFound, "Note not found")
+	case errors.Is(err, service.ErrGroupNotFound):
+		WriteError(w, http.StatusNotFound, "Note group not found")
+	case errors.Is(err, service.ErrInvalidNoteID):
+		WriteError(w, http.StatusBadRequest, "Invalid note ID")
+	case errors.Is(err, service.ErrInvalidGroupID):
+		WriteError(w, http.StatusBadRequest, "Invalid group ID")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
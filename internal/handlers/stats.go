@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+)
+
+type StatsHandler struct {
+	service *service.StatsService
+}
+
+func NewStatsHandler(service *service.StatsService) *StatsHandler {
+	return &StatsHandler{service: service}
+}
+
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	query := r.URL.Query()
+
+	stats, err := h.service.GetStats(r.Context(), claims.UserID.String(), query.Get("group_by"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidStatsGrouping),
+			errors.Is(err, service.ErrInvalidJournalDate),
+			errors.Is(err, service.ErrInvalidJournalRange):
+			WriteError(w, http.StatusBadRequest, err.Error())
+		default:
+			WriteError(w, http.StatusInternalServerError, "Failed to compute stats")
+		}
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MoveSubtaskRequest struct {
+	AfterID  *string `json:"after_id,omitempty"`
+	BeforeID *string `json:"before_id,omitempty"`
+}
+
+// TaskOrderRequest lists every subtask or checklist item of a task in its
+// new order
+type TaskOrderRequest struct {
+	Order []string `json:"order"`
+}
+
+type ChecklistItemRequest struct {
+	Text string `json:"text"`
+}
+
+type UpdateChecklistItemRequest struct {
+	Text *string `json:"text,omitempty"`
+	Done *bool   `json:"done,omitempty"`
+}
+
+func (h *TaskHandler) GetSubtasks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	subtasks, err := h.service.ListSubtasks(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to fetch subtasks")
+		return
+	}
+
+	// Ensure we return empty array instead of null
+	if subtasks == nil {
+		subtasks = []models.Task{}
+	}
+
+	WriteJSON(w, http.StatusOK, subtasks)
+}
+
+// CreateSubtask adds a subtask at the end of a task's subtasks
+func (h *TaskHandler) CreateSubtask(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateTaskRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Title == "" {
+		WriteError(w, http.StatusBadRequest, "Title is required")
+		return
+	}
+
+	if req.Priority == "" {
+		req.Priority = "medium"
+	}
+
+	var deadline time.Time
+	if req.Deadline != nil {
+		deadline = req.Deadline.Time
+	}
+	repeat := service.RecurrenceInput{RRule: req.RRule, Timezone: req.Timezone}
+
+	task, err := h.service.CreateSubtask(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Title, req.DescriptionMD, req.Priority, deadline, req.Tags, req.AutoComplete, repeat)
+	if err != nil {
+		writeTaskError(w, err, "Failed to create subtask")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, task)
+}
+
+func (h *TaskHandler) ReorderSubtasks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req TaskOrderRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Order) == 0 {
+		WriteError(w, http.StatusBadRequest, "Order is required")
+		return
+	}
+
+	subtasks, err := h.service.ReorderSubtasks(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Order)
+	if err != nil {
+		writeTaskError(w, err, "Failed to reorder subtasks")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, subtasks)
+}
+
+// MoveSubtask drags one subtask to another place among its siblings
+func (h *TaskHandler) MoveSubtask(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MoveSubtaskRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	task, err := h.service.MoveSubtask(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "subtaskId"), req.AfterID, req.BeforeID)
+	if err != nil {
+		writeTaskError(w, err, "Failed to move subtask")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+func (h *TaskHandler) AddChecklistItem(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req ChecklistItemRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	task, err := h.service.AddChecklistItem(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Text)
+	if err != nil {
+		writeTaskError(w, err, "Failed to add checklist item")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, task)
+}
+
+// UpdateChecklistItem edits or ticks a checklist item
+func (h *TaskHandler) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req UpdateChecklistItemRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Text == nil && req.Done == nil {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	task, err := h.service.UpdateChecklistItem(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "itemId"), req.Text, req.Done)
+	if err != nil {
+		writeTaskError(w, err, "Failed to update checklist item")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+func (h *TaskHandler) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	task, err := h.service.DeleteChecklistItem(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "itemId"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to delete checklist item")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+func (h *TaskHandler) ReorderChecklist(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req TaskOrderRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Order) == 0 {
+		WriteError(w, http.StatusBadRequest, "Order is required")
+		return
+	}
+
+	task, err := h.service.ReorderChecklist(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Order)
+	if err != nil {
+		writeTaskError(w, err, "Failed to reorder checklist")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, task)
+}
+
+func writeTaskError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Task not found")
+	case errors.Is(err, service.ErrSubtaskNotFound):
+		WriteError(w, http.StatusNotFound, "Subtask not found")
+	case errors.Is(err, service.ErrChecklistItemNotFound):
+		WriteError(w, http.StatusNotFound, "Checklist item not found")
+	case errors.Is(err, service.ErrDependencyNotFound):
+		WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidTaskID):
+		WriteError(w, http.StatusBadRequest, "Invalid task ID")
+	case errors.Is(err, service.ErrInvalidTransition),
+		errors.Is(err, service.ErrTaskMoved),
+		errors.Is(err, service.ErrWIPLimitReached),
+		errors.Is(err, service.ErrDependencyCycle):
+		WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidTaskStatus),
+		errors.Is(err, service.ErrTaskTooDeep),
+		errors.Is(err, service.ErrTooManySubtasks),
+		errors.Is(err, service.ErrInvalidSubtaskOrder),
+		errors.Is(err, service.ErrChecklistTextRequired),
+		errors.Is(err, service.ErrChecklistTextTooLong),
+		errors.Is(err, service.ErrChecklistFull),
+		errors.Is(err, service.ErrInvalidChecklistOrder),
+		errors.Is(err, service.ErrTooManyDependencies),
+		errors.Is(err, service.ErrGraphTasksRequired),
+		errors.Is(err, service.ErrInvalidEstimate),
+		errors.Is(err, service.ErrAmbiguousPlacement),
+		errors.Is(err, service.ErrInvalidPlacement),
+		errors.Is(err, service.ErrInvalidJournalDate),
+		errors.Is(err, service.ErrInvalidJournalRange),
+		isRecurrenceError(err):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
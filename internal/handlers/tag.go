@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TagHandler struct {
+	service *service.TagService
+}
+
+func NewTagHandler(service *service.TagService) *TagHandler {
+	return &TagHandler{service: service}
+}
+
+type UpdateTagRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Color *string `json:"color,omitempty"`
+}
+
+type MergeTagsRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			WriteError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	tags, err := h.service.ListTags(r.Context(), claims.UserID.String(), r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch tags")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tags)
+}
+
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid tag name")
+		return
+	}
+
+	var req UpdateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == nil && req.Color == nil {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	tag, err := h.service.UpdateTag(r.Context(), claims.UserID.String(), name, req.Name, req.Color)
+	if err != nil {
+		writeTagError(w, err, "Failed to update tag")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tag)
+}
+
+func (h *TagHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MergeTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Sources) == 0 || req.Target == "" {
+		WriteError(w, http.StatusBadRequest, "Sources and target are required")
+		return
+	}
+
+	tag, err := h.service.MergeTags(r.Context(), claims.UserID.String(), req.Sources, req.Target)
+	if err != nil {
+		writeTagError(w, err, "Failed to merge tags")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tag)
+}
+
+func writeTagError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTagNotFound):
+		WriteError(w, http.StatusNotFound, "Tag not found")
+	case errors.Is(err, service.ErrTagExists):
+		WriteError(w, http.StatusConflict, "Tag already exists, merge the tags instead")
+	case errors.Is(err, service.ErrInvalidTagName):
+		WriteError(w, http.StatusBadRequest, "Invalid tag name")
+	case errors.Is(err, service.ErrInvalidTagColor):
+		WriteError(w, http.StatusBadRequest, "Invalid tag color, use #RGB or #RRGGBB")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
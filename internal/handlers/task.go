@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/service"
@@ -20,20 +22,30 @@ func NewTaskHandler(service *service.TaskService) *TaskHandler {
 }
 
 type CreateTaskRequest struct {
-	Title         string      `json:"title"`
-	DescriptionMD string      `json:"description_md,omitempty"`
-	Priority      string      `json:"priority"`
-	Deadline      interface{} `json:"deadline,omitempty"`
-	Tags          []string    `json:"tags"`
+	Title         string               `json:"title"`
+	DescriptionMD string               `json:"description_md,omitempty"`
+	Priority      string               `json:"priority"`
+	Deadline      *models.FlexibleTime `json:"deadline,omitempty"`
+	Tags          []string             `json:"tags"`
+	AutoComplete  bool                 `json:"auto_complete,omitempty"`
+	RRule         *string              `json:"rrule,omitempty"`
+	Timezone      *string              `json:"timezone,omitempty"`
 }
 
+// UpdateTaskRequest changes a task; an empty deadline clears it and an empty
+// rrule stops the task repeating
 type UpdateTaskRequest struct {
-	Title         *string     `json:"title,omitempty"`
-	DescriptionMD *string     `json:"description_md,omitempty"`
-	Status        *string     `json:"status,omitempty"`
-	Priority      *string     `json:"priority,omitempty"`
-	Deadline      interface{} `json:"deadline,omitempty"`
-	Tags          []string    `json:"tags,omitempty"`
+	Title         *string              `json:"title,omitempty"`
+	DescriptionMD *string              `json:"description_md,omitempty"`
+	Status        *string              `json:"status,omitempty"`
+	Priority      *string              `json:"priority,omitempty"`
+	Deadline      *models.FlexibleTime `json:"deadline,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	AutoComplete  *bool                `json:"auto_complete,omitempty"`
+	// EstimateMinutes of 0 clears the estimate
+	EstimateMinutes *int    `json:"estimate_minutes,omitempty"`
+	RRule           *string `json:"rrule,omitempty"`
+	Timezone        *string `json:"timezone,omitempty"`
 }
 
 func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
@@ -56,7 +68,17 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 
 	status := "todo"
 
-	task, err := h.service.CreateTask(r.Context(), claims.UserID.String(), req.Title, req.DescriptionMD, status, req.Priority, req.Tags)
+	var deadline time.Time
+	if req.Deadline != nil {
+		deadline = req.Deadline.Time
+	}
+	repeat := service.RecurrenceInput{RRule: req.RRule, Timezone: req.Timezone}
+
+	task, err := h.service.CreateTask(r.Context(), claims.UserID.String(), req.Title, req.DescriptionMD, status, req.Priority, deadline, req.Tags, req.AutoComplete, repeat)
+	if isRecurrenceError(err) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to create task")
 		return
@@ -68,7 +90,17 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value("user").(*jwt.Claims)
 
-	tasks, err := h.service.GetUserTasks(r.Context(), claims.UserID.String())
+	includeSubtasks := false
+	if value := r.URL.Query().Get("include_subtasks"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "include_subtasks must be true or false")
+			return
+		}
+		includeSubtasks = parsed
+	}
+
+	tasks, err := h.service.GetUserTasks(r.Context(), claims.UserID.String(), includeSubtasks)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -123,27 +155,80 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		updates["priority"] = *req.Priority
 	}
 	if req.Deadline != nil {
-		updates["deadline"] = req.Deadline
+		updates["deadline"] = req.Deadline.Time
 	}
 	if req.Tags != nil {
 		updates["tags"] = req.Tags
 	}
+	if req.AutoComplete != nil {
+		updates["auto_complete"] = *req.AutoComplete
+	}
+	if req.EstimateMinutes != nil {
+		updates["estimate_minutes"] = *req.EstimateMinutes
+	}
 
-	if len(updates) == 0 {
+	repeat := service.RecurrenceInput{RRule: req.RRule, Timezone: req.Timezone}
+
+	if len(updates) == 0 && req.RRule == nil && req.Timezone == nil {
 		WriteError(w, http.StatusBadRequest, "No fields to update")
 		return
 	}
 
-	if err := h.service.UpdateTask(r.Context(), taskID, claims.UserID.String(), updates); err != nil {
+	if err := h.service.UpdateTask(r.Context(), taskID, claims.UserID.String(), updates, repeat); err != nil {
+		writeTaskError(w, err, "Failed to update task")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Task updated"})
+}
+
+// GetTaskActivity returns a task's status changes with its lead and cycle
+// time
+func (h *TaskHandler) GetTaskActivity(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	history, err := h.service.GetHistory(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to fetch task activity")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, history)
+}
+
+// GetFlowReport sums up the lead and cycle times of recently completed tasks
+func (h *TaskHandler) GetFlowReport(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	query := r.URL.Query()
+
+	report, err := h.service.FlowReport(r.Context(), claims.UserID.String(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeTaskError(w, err, "Failed to build flow report")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, report)
+}
+
+// SkipTaskOccurrence moves a repeating task on to its next occurrence
+func (h *TaskHandler) SkipTaskOccurrence(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	task, err := h.service.SkipOccurrence(r.Context(), chi.URLParam(r, "id"), claims.UserID.String())
+	if err != nil {
 		if service.IsNotFound(err) {
 			WriteError(w, http.StatusNotFound, "Task not found")
 			return
 		}
-		WriteError(w, http.StatusInternalServerError, "Failed to update task")
+		if isRecurrenceError(err) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to skip occurrence")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]string{"message": "Task updated"})
+	WriteJSON(w, http.StatusOK, task)
 }
 
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TemplateHandler struct {
+	service *service.TemplateService
+}
+
+func NewTemplateHandler(service *service.TemplateService) *TemplateHandler {
+	return &TemplateHandler{service: service}
+}
+
+type CreateTemplateRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Blocks      []models.Block `json:"blocks,omitempty"`
+	NoteID      string         `json:"note_id,omitempty"`
+}
+
+type UpdateTemplateRequest struct {
+	Name        *string        `json:"name,omitempty"`
+	Description *string        `json:"description,omitempty"`
+	Title       *string        `json:"title,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Blocks      []models.Block `json:"blocks,omitempty"`
+}
+
+func (h *TemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	templates, err := h.service.ListTemplates(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch templates")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, templates)
+}
+
+func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	templateID := chi.URLParam(r, "id")
+
+	template, err := h.service.GetTemplate(r.Context(), templateID, claims.UserID.String())
+	if err != nil {
+		writeTemplateError(w, err, "Failed to fetch template")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, template)
+}
+
+func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, err := h.service.CreateTemplate(r.Context(), claims.UserID.String(), service.TemplateInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Title:       req.Title,
+		Tags:        req.Tags,
+		Blocks:      req.Blocks,
+		NoteID:      req.NoteID,
+	})
+	if err != nil {
+		writeTemplateError(w, err, "Failed to create template")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, template)
+}
+
+func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	templateID := chi.URLParam(r, "id")
+
+	var req UpdateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, err := h.service.UpdateTemplate(r.Context(), templateID, claims.UserID.String(), service.TemplateUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		Title:       req.Title,
+		Tags:        req.Tags,
+		Blocks:      req.Blocks,
+	})
+	if err != nil {
+		writeTemplateError(w, err, "Failed to update template")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, template)
+}
+
+func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	templateID := chi.URLParam(r, "id")
+
+	if err := h.service.DeleteTemplate(r.Context(), templateID, claims.UserID.String()); err != nil {
+		writeTemplateError(w, err, "Failed to delete template")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Template deleted successfully"})
+}
+
+func writeTemplateError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		WriteError(w, http.StatusNotFound, "Template not found")
+	case errors.Is(err, service.ErrInvalidTemplateName):
+		WriteError(w, http.StatusBadRequest, "Template name is required")
+	case errors.Is(err, service.ErrBuiltInTemplate):
+		WriteError(w, http.StatusForbidden, "Built-in templates cannot be changed")
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Note not found")
+	case errors.Is(err, service.ErrInvalidNoteID):
+		WriteError(w, http.StatusBadRequest, "Invalid note ID")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TimeHandler struct {
+	service *service.TimeService
+}
+
+func NewTimeHandler(service *service.TimeService) *TimeHandler {
+	return &TimeHandler{service: service}
+}
+
+type StartTimerRequest struct {
+	Note *string `json:"note,omitempty"`
+}
+
+// TimeEntryRequest sets the span of an entry as started_at with either
+// ended_at or duration_minutes; an empty note clears it
+type TimeEntryRequest struct {
+	StartedAt       *models.FlexibleTime `json:"started_at,omitempty"`
+	EndedAt         *models.FlexibleTime `json:"ended_at,omitempty"`
+	DurationMinutes *int                 `json:"duration_minutes,omitempty"`
+	Note            *string              `json:"note,omitempty"`
+}
+
+func (req TimeEntryRequest) input() service.TimeEntryInput {
+	in := service.TimeEntryInput{DurationMinutes: req.DurationMinutes, Note: req.Note}
+	if req.StartedAt != nil {
+		in.StartedAt = &req.StartedAt.Time
+	}
+	if req.EndedAt != nil {
+		in.EndedAt = &req.EndedAt.Time
+	}
+	return in
+}
+
+// GetTaskTime returns the time entries of a task with its tracked time
+// against its estimate
+func (h *TimeHandler) GetTaskTime(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	taskTime, err := h.service.GetTaskTime(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTimeError(w, err, "Failed to fetch time entries")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, taskTime)
+}
+
+// StartTimer starts a timer on a task, stopping the user's timer on any
+// other task
+func (h *TimeHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req StartTimerRequest
+	if r.ContentLength != 0 {
+		if err := DecodeJSON(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	entry, err := h.service.StartTimer(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Note)
+	if err != nil {
+		writeTimeError(w, err, "Failed to start timer")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, entry)
+}
+
+func (h *TimeHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	entry, err := h.service.StopTimer(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTimeError(w, err, "Failed to stop timer")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, entry)
+}
+
+// AddTimeEntry records time spent on a task by hand
+func (h *TimeHandler) AddTimeEntry(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req TimeEntryRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	entry, err := h.service.AddEntry(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.input())
+	if err != nil {
+		writeTimeError(w, err, "Failed to add time entry")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, entry)
+}
+
+func (h *TimeHandler) UpdateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req TimeEntryRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.StartedAt == nil && req.EndedAt == nil && req.DurationMinutes == nil && req.Note == nil {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	entry, err := h.service.UpdateEntry(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "entryId"), req.input())
+	if err != nil {
+		writeTimeError(w, err, "Failed to update time entry")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, entry)
+}
+
+func (h *TimeHandler) DeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteEntry(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), chi.URLParam(r, "entryId")); err != nil {
+		writeTimeError(w, err, "Failed to delete time entry")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Time entry deleted"})
+}
+
+// GetTimer returns the user's running timer, null when none runs
+func (h *TimeHandler) GetTimer(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	entry, err := h.service.GetTimer(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch timer")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]*models.TimeEntry{"timer": entry})
+}
+
+// GetTimesheet sums up the tracked time of the week around ?week
+func (h *TimeHandler) GetTimesheet(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	sheet, err := h.service.Timesheet(r.Context(), claims.UserID.String(), r.URL.Query().Get("week"))
+	if err != nil {
+		writeTimeError(w, err, "Failed to build timesheet")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, sheet)
+}
+
+// ExportTimesheet sends the timesheet of the week around ?week as CSV
+func (h *TimeHandler) ExportTimesheet(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	sheet, err := h.service.Timesheet(r.Context(), claims.UserID.String(), r.URL.Query().Get("week"))
+	if err != nil {
+		writeTimeError(w, err, "Failed to export timesheet")
+		return
+	}
+
+	content, err := service.TimesheetCSV(sheet)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to export timesheet")
+		return
+	}
+
+	WriteExport(w, "timesheet-"+sheet.WeekStart, "csv", content)
+}
+
+func writeTimeError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTimeEntryNotFound):
+		WriteError(w, http.StatusNotFound, "Time entry not found")
+	case errors.Is(err, service.ErrInvalidTimeEntryID):
+		WriteError(w, http.StatusBadRequest, "Invalid time entry ID")
+	case errors.Is(err, service.ErrTimerRunning),
+		errors.Is(err, service.ErrNoRunningTimer),
+		errors.Is(err, service.ErrTimerNotStopped):
+		WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrTimeEntryStartRequired),
+		errors.Is(err, service.ErrTimeEntryEndRequired),
+		errors.Is(err, service.ErrInvalidTimeEntrySpan),
+		errors.Is(err, service.ErrTimeEntryTooLong),
+		errors.Is(err, service.ErrTimeEntryInFuture),
+		errors.Is(err, service.ErrTimeEntryNoteTooLong):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeTaskError(w, err, fallback)
+	}
+}
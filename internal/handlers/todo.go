@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"backend-journaling/internal/models"
@@ -20,16 +21,40 @@ func NewTodoHandler(service *service.TodoService) *TodoHandler {
 }
 
 type CreateTodoRequest struct {
-	Title    string      `json:"title"`
-	Priority string      `json:"priority"`
-	DueDate  interface{} `json:"due_date,omitempty"`
+	Title    string  `json:"title"`
+	Priority string  `json:"priority"`
+	ListID   *string `json:"list_id,omitempty"`
+	DueDate  *string `json:"due_date,omitempty"`
+	DueTime  *string `json:"due_time,omitempty"`
+	AllDay   *bool   `json:"all_day,omitempty"`
+	RRule    *string `json:"rrule,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
 }
 
+// MoveTodosRequest moves todos to a list, after or before another todo; see
+// service.TodoPlacement
+type MoveTodosRequest struct {
+	TodoIDs  []string `json:"todo_ids"`
+	ListID   *string  `json:"list_id,omitempty"`
+	AfterID  *string  `json:"after_id,omitempty"`
+	BeforeID *string  `json:"before_id,omitempty"`
+}
+
+func (req MoveTodosRequest) placement() service.TodoPlacement {
+	return service.TodoPlacement{ListID: req.ListID, AfterID: req.AfterID, BeforeID: req.BeforeID}
+}
+
+// UpdateTodoRequest changes a todo; an empty due_date clears the due date and
+// an empty rrule stops the todo repeating
 type UpdateTodoRequest struct {
-	Title    *string     `json:"title,omitempty"`
-	Done     *bool       `json:"done,omitempty"`
-	Priority *string     `json:"priority,omitempty"`
-	DueDate  interface{} `json:"due_date,omitempty"`
+	Title    *string `json:"title,omitempty"`
+	Done     *bool   `json:"done,omitempty"`
+	Priority *string `json:"priority,omitempty"`
+	DueDate  *string `json:"due_date,omitempty"`
+	DueTime  *string `json:"due_time,omitempty"`
+	AllDay   *bool   `json:"all_day,omitempty"`
+	RRule    *string `json:"rrule,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
 }
 
 func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +75,17 @@ func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
 		req.Priority = "medium"
 	}
 
-	todo, err := h.service.CreateTodo(r.Context(), claims.UserID.String(), req.Title, req.Priority, req.DueDate)
+	due := service.TodoDue{Date: req.DueDate, Time: req.DueTime, AllDay: req.AllDay}
+	repeat := service.RecurrenceInput{RRule: req.RRule, Timezone: req.Timezone}
+	todo, err := h.service.CreateTodo(r.Context(), claims.UserID.String(), req.Title, req.Priority, req.ListID, due, repeat)
+	if isDueError(err) || isRecurrenceError(err) || errors.Is(err, service.ErrInvalidTodoListID) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrTodoListNotFound) {
+		WriteError(w, http.StatusNotFound, "Todo list not found")
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to create todo")
 		return
@@ -96,20 +131,23 @@ func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
 	if req.Priority != nil {
 		updates["priority"] = *req.Priority
 	}
-	if req.DueDate != nil {
-		updates["due_date"] = req.DueDate
-	}
+	due := service.TodoDue{Date: req.DueDate, Time: req.DueTime, AllDay: req.AllDay}
+	repeat := service.RecurrenceInput{RRule: req.RRule, Timezone: req.Timezone}
 
-	if len(updates) == 0 {
+	if len(updates) == 0 && req.DueDate == nil && req.DueTime == nil && req.AllDay == nil && req.RRule == nil && req.Timezone == nil {
 		WriteError(w, http.StatusBadRequest, "No fields to update")
 		return
 	}
 
-	if err := h.service.UpdateTodo(r.Context(), todoID, claims.UserID.String(), updates); err != nil {
+	if err := h.service.UpdateTodo(r.Context(), todoID, claims.UserID.String(), updates, due, repeat); err != nil {
 		if service.IsNotFound(err) {
 			WriteError(w, http.StatusNotFound, "Todo not found")
 			return
 		}
+		if isDueError(err) || isRecurrenceError(err) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, "Failed to update todo")
 		return
 	}
@@ -132,3 +170,106 @@ func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Todo deleted"})
 }
+
+// SkipTodoOccurrence moves a repeating todo on to its next occurrence
+func (h *TodoHandler) SkipTodoOccurrence(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	todo, err := h.service.SkipOccurrence(r.Context(), chi.URLParam(r, "id"), claims.UserID.String())
+	if err != nil {
+		if service.IsNotFound(err) {
+			WriteError(w, http.StatusNotFound, "Todo not found")
+			return
+		}
+		if isRecurrenceError(err) {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Failed to skip occurrence")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, todo)
+}
+
+// MoveTodo drags a single todo within its list or into another one
+func (h *TodoHandler) MoveTodo(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MoveTodosRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	todos, err := h.service.MoveTodos(r.Context(), claims.UserID.String(), []string{chi.URLParam(r, "id")}, req.placement())
+	if err != nil {
+		writeTodoMoveError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, todos[0])
+}
+
+// MoveTodos moves several todos at once, keeping the order they are given in
+func (h *TodoHandler) MoveTodos(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MoveTodosRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	todos, err := h.service.MoveTodos(r.Context(), claims.UserID.String(), req.TodoIDs, req.placement())
+	if err != nil {
+		writeTodoMoveError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, todos)
+}
+
+func writeTodoMoveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTodoNotFound):
+		WriteError(w, http.StatusNotFound, "Todo not found")
+	case errors.Is(err, service.ErrTodoListNotFound):
+		WriteError(w, http.StatusNotFound, "Todo list not found")
+	case errors.Is(err, service.ErrInvalidTodoID),
+		errors.Is(err, service.ErrInvalidTodoListID),
+		errors.Is(err, service.ErrTodoIDsRequired),
+		errors.Is(err, service.ErrTooManyTodos),
+		errors.Is(err, service.ErrTodoListNeeded),
+		errors.Is(err, service.ErrAmbiguousPlacement),
+		errors.Is(err, service.ErrInvalidPlacement):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, "Failed to move todos")
+	}
+}
+
+// GetTodoView returns one of the smart views: today, overdue, upcoming or
+// no_date
+func (h *TodoHandler) GetTodoView(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	view, err := h.service.GetView(r.Context(), claims.UserID.String(), chi.URLParam(r, "view"))
+	if errors.Is(err, service.ErrInvalidTodoView) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch todos")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, view)
+}
+
+func isDueError(err error) bool {
+	return errors.Is(err, service.ErrInvalidDueDate) ||
+		errors.Is(err, service.ErrInvalidDueTime) ||
+		errors.Is(err, service.ErrDueTimeAllDay) ||
+		errors.Is(err, service.ErrDueDateRequired)
+}
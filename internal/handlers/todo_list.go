@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TodoListHandler struct {
+	service *service.TodoListService
+}
+
+func NewTodoListHandler(service *service.TodoListService) *TodoListHandler {
+	return &TodoListHandler{service: service}
+}
+
+type CreateTodoListRequest struct {
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+}
+
+// UpdateTodoListRequest changes a list; an empty color clears it
+type UpdateTodoListRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Color *string `json:"color,omitempty"`
+}
+
+// MoveTodoListRequest puts a list after or before another one, or last
+type MoveTodoListRequest struct {
+	AfterID  *string `json:"after_id,omitempty"`
+	BeforeID *string `json:"before_id,omitempty"`
+}
+
+func (h *TodoListHandler) GetLists(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	lists, err := h.service.ListLists(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch todo lists")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, lists)
+}
+
+func (h *TodoListHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateTodoListRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	list, err := h.service.CreateList(r.Context(), claims.UserID.String(), req.Name, req.Color)
+	if err != nil {
+		writeTodoListError(w, err, "Failed to create todo list")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, list)
+}
+
+func (h *TodoListHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	list, err := h.service.GetList(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTodoListError(w, err, "Failed to fetch todo list")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, list)
+}
+
+func (h *TodoListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req UpdateTodoListRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name == nil && req.Color == nil {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	list, err := h.service.UpdateList(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.Name, req.Color)
+	if err != nil {
+		writeTodoListError(w, err, "Failed to update todo list")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, list)
+}
+
+func (h *TodoListHandler) MoveList(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req MoveTodoListRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	list, err := h.service.MoveList(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"), req.AfterID, req.BeforeID)
+	if err != nil {
+		writeTodoListError(w, err, "Failed to move todo list")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// DeleteList deletes a list; its todos move to the default list
+func (h *TodoListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	if err := h.service.DeleteList(r.Context(), claims.UserID.String(), chi.URLParam(r, "id")); err != nil {
+		writeTodoListError(w, err, "Failed to delete todo list")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Todo list deleted"})
+}
+
+// GetListTodos returns the todos of a list in their manual order
+func (h *TodoListHandler) GetListTodos(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	todos, err := h.service.ListTodos(r.Context(), claims.UserID.String(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeTodoListError(w, err, "Failed to fetch todos")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, todos)
+}
+
+func writeTodoListError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTodoListNotFound):
+		WriteError(w, http.StatusNotFound, "Todo list not found")
+	case errors.Is(err, service.ErrInvalidTodoListID),
+		errors.Is(err, service.ErrTodoListNameRequired),
+		errors.Is(err, service.ErrTodoListNameTooLong),
+		errors.Is(err, service.ErrInvalidTodoListColor),
+		errors.Is(err, service.ErrDefaultTodoList),
+		errors.Is(err, service.ErrAmbiguousPlacement),
+		errors.Is(err, service.ErrInvalidPlacement):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"backend-journaling/internal/service"
+	"backend-journaling/pkg/jwt"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TrackingHandler struct {
+	service *service.TrackingService
+}
+
+func NewTrackingHandler(service *service.TrackingService) *TrackingHandler {
+	return &TrackingHandler{service: service}
+}
+
+type CreateHabitRequest struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind"`
+	Unit   *string  `json:"unit,omitempty"`
+	Target *float64 `json:"target,omitempty"`
+}
+
+type UpdateHabitRequest struct {
+	Name       *string  `json:"name,omitempty"`
+	Unit       *string  `json:"unit,omitempty"`
+	Target     *float64 `json:"target,omitempty"`
+	IsArchived *bool    `json:"is_archived,omitempty"`
+}
+
+type PutDailyLogRequest struct {
+	Mood       *int                   `json:"mood,omitempty"`
+	Emotions   []string               `json:"emotions,omitempty"`
+	Energy     *int                   `json:"energy,omitempty"`
+	SleepHours *float64               `json:"sleep_hours,omitempty"`
+	Habits     map[string]interface{} `json:"habits,omitempty"`
+}
+
+func (h *TrackingHandler) GetHabits(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	habits, err := h.service.GetHabits(r.Context(), claims.UserID.String())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch habits")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, habits)
+}
+
+func (h *TrackingHandler) CreateHabit(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+
+	var req CreateHabitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	habit, err := h.service.CreateHabit(r.Context(), claims.UserID.String(), req.Name, req.Kind, req.Unit, req.Target)
+	if err != nil {
+		writeTrackingError(w, err, "Failed to create habit")
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, habit)
+}
+
+func (h *TrackingHandler) UpdateHabit(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	habitID := chi.URLParam(r, "id")
+
+	var req UpdateHabitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Unit != nil {
+		updates["unit"] = *req.Unit
+	}
+	if req.Target != nil {
+		updates["target"] = *req.Target
+	}
+	if req.IsArchived != nil {
+		updates["is_archived"] = *req.IsArchived
+	}
+
+	if len(updates) == 0 {
+		WriteError(w, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	habit, err := h.service.UpdateHabit(r.Context(), habitID, claims.UserID.String(), updates)
+	if err != nil {
+		writeTrackingError(w, err, "Failed to update habit")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, habit)
+}
+
+func (h *TrackingHandler) DeleteHabit(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	habitID := chi.URLParam(r, "id")
+
+	if err := h.service.DeleteHabit(r.Context(), habitID, claims.UserID.String()); err != nil {
+		writeTrackingError(w, err, "Failed to delete habit")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Habit deleted successfully"})
+}
+
+func (h *TrackingHandler) GetDays(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	query := r.URL.Query()
+
+	series, err := h.service.GetSeries(r.Context(), claims.UserID.String(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeTrackingError(w, err, "Failed to fetch daily logs")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, series)
+}
+
+func (h *TrackingHandler) GetDay(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	date := chi.URLParam(r, "date")
+
+	day, err := h.service.GetDay(r.Context(), claims.UserID.String(), date)
+	if err != nil {
+		writeTrackingError(w, err, "Failed to fetch daily log")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, day)
+}
+
+func (h *TrackingHandler) PutDay(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	date := chi.URLParam(r, "date")
+
+	var req PutDailyLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	day, err := h.service.PutDay(r.Context(), claims.UserID.String(), date, service.DailyLogInput{
+		Mood:       req.Mood,
+		Emotions:   req.Emotions,
+		Energy:     req.Energy,
+		SleepHours: req.SleepHours,
+		Habits:     req.Habits,
+	})
+	if err != nil {
+		writeTrackingError(w, err, "Failed to save daily log")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, day)
+}
+
+func (h *TrackingHandler) DeleteDay(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	date := chi.URLParam(r, "date")
+
+	if err := h.service.DeleteDay(r.Context(), claims.UserID.String(), date); err != nil {
+		writeTrackingError(w, err, "Failed to delete daily log")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Daily log deleted successfully"})
+}
+
+func (h *TrackingHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("user").(*jwt.Claims)
+	query := r.URL.Query()
+
+	summary, err := h.service.GetSummary(r.Context(), claims.UserID.String(), query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeTrackingError(w, err, "Failed to compute summary")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, summary)
+}
+
+func writeTrackingError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrHabitNotFound):
+		WriteError(w, http.StatusNotFound, "Habit not found")
+	case errors.Is(err, service.ErrInvalidHabit),
+		errors.Is(err, service.ErrInvalidHabitValue),
+		errors.Is(err, service.ErrInvalidMood),
+		errors.Is(err, service.ErrInvalidEnergy),
+		errors.Is(err, service.ErrInvalidSleep),
+		errors.Is(err, service.ErrTooManyEmotions),
+		errors.Is(err, service.ErrInvalidJournalDate),
+		errors.Is(err, service.ErrInvalidJournalRange):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	case service.IsNotFound(err):
+		WriteError(w, http.StatusNotFound, "Daily log not found")
+	default:
+		WriteError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
 
+	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
 	"backend-journaling/internal/service"
 	"backend-journaling/pkg/jwt"
@@ -14,16 +16,18 @@ import (
 )
 
 type UserHandler struct {
-	userRepo    *repository.UserRepository
-	profileRepo *repository.ProfileRepository
-	authService *service.AuthService
+	userRepo          *repository.UserRepository
+	profileRepo       *repository.ProfileRepository
+	authService       *service.AuthService
+	attachmentService *service.AttachmentService
 }
 
-func NewUserHandler(userRepo *repository.UserRepository, profileRepo *repository.ProfileRepository, authService *service.AuthService) *UserHandler {
+func NewUserHandler(userRepo *repository.UserRepository, profileRepo *repository.ProfileRepository, authService *service.AuthService, attachmentService *service.AttachmentService) *UserHandler {
 	return &UserHandler{
-		userRepo:    userRepo,
-		profileRepo: profileRepo,
-		authService: authService,
+		userRepo:          userRepo,
+		profileRepo:       profileRepo,
+		authService:       authService,
+		attachmentService: attachmentService,
 	}
 }
 
@@ -41,6 +45,7 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	profile, _ := h.profileRepo.GetOrCreate(claims.UserID)
+	h.withAvatarURL(r.Context(), profile)
 
 	response := map[string]interface{}{
 		"user":    user,
@@ -133,6 +138,7 @@ func (h *UserHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := h.userRepo.FindByID(claims.UserID)
 	updatedProfile, _ := h.profileRepo.FindByUserID(claims.UserID)
+	h.withAvatarURL(r.Context(), updatedProfile)
 
 	response := map[string]interface{}{
 		"user":    user,
@@ -215,6 +221,7 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := h.userRepo.FindByID(claims.UserID)
 	updatedProfile, _ := h.profileRepo.FindByUserID(claims.UserID)
+	h.withAvatarURL(r.Context(), updatedProfile)
 
 	response := map[string]interface{}{
 		"user":    user,
@@ -224,8 +231,11 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	WriteSuccess(w, http.StatusOK, "Profile updated successfully", response)
 }
 
+// UpdateAvatarRequest sets the avatar either to an uploaded image attachment
+// or, for older clients, to an external URL
 type UpdateAvatarRequest struct {
-	AvatarURL string `json:"avatar_url" validate:"required"`
+	AttachmentID string `json:"attachment_id,omitempty"`
+	AvatarURL    string `json:"avatar_url,omitempty"`
 }
 
 func (h *UserHandler) UpdateAvatar(w http.ResponseWriter, r *http.Request) {
@@ -237,7 +247,31 @@ func (h *UserHandler) UpdateAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.profileRepo.UpdateAvatar(claims.UserID, req.AvatarURL); err != nil {
+	if req.AttachmentID == "" && req.AvatarURL == "" {
+		WriteError(w, http.StatusBadRequest, "attachment_id or avatar_url is required")
+		return
+	}
+
+	if _, err := h.profileRepo.GetOrCreate(claims.UserID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to get profile")
+		return
+	}
+
+	if req.AttachmentID != "" {
+		if _, err := h.attachmentService.GetImage(r.Context(), req.AttachmentID, claims.UserID.String()); err != nil {
+			if errors.Is(err, service.ErrAttachmentNotFound) || errors.Is(err, service.ErrInvalidAttachmentID) || errors.Is(err, service.ErrNotAnImage) {
+				WriteError(w, http.StatusBadRequest, "Avatar must be an uploaded image")
+				return
+			}
+			WriteError(w, http.StatusInternalServerError, "Failed to update avatar")
+			return
+		}
+
+		if err := h.profileRepo.UpdateAvatarAttachment(claims.UserID, req.AttachmentID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to update avatar")
+			return
+		}
+	} else if err := h.profileRepo.UpdateAvatar(claims.UserID, req.AvatarURL); err != nil {
 		WriteError(w, http.StatusInternalServerError, "Failed to update avatar")
 		return
 	}
@@ -245,6 +279,25 @@ func (h *UserHandler) UpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	WriteSuccess(w, http.StatusOK, "Avatar updated successfully", nil)
 }
 
+// withAvatarURL fills in a signed link for an avatar that references an
+// uploaded image, preferring its thumbnail
+func (h *UserHandler) withAvatarURL(ctx context.Context, profile *models.Profile) {
+	if profile == nil || profile.AvatarAttachmentID == nil {
+		return
+	}
+
+	attachment, err := h.attachmentService.GetImage(ctx, *profile.AvatarAttachmentID, profile.UserID.String())
+	if err != nil {
+		return
+	}
+
+	url := attachment.URL
+	if attachment.ThumbnailURL != "" {
+		url = attachment.ThumbnailURL
+	}
+	profile.Avatar = &url
+}
+
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required"`
 	NewPassword string `json:"new_password" validate:"required,min=8"`
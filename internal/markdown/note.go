@@ -0,0 +1,482 @@
+// Package markdown converts notes to and from standalone Markdown documents.
+//
+// A document starts with a front-matter section carrying the note title and
+// tags, followed by one chunk per block separated by blank lines. Headings,
+// paragraphs and todo lists are written as plain Markdown and recognised again
+// on import. Blocks that plain Markdown cannot describe faithfully (nested
+// blocks, blocks whose content contains blank lines, or content that would be
+// read back as a different block type) are wrapped in invisible HTML comment
+// markers carrying their line count so that exporting and re-importing a note
+// is lossless.
+package markdown
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend-journaling/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Document is a note parsed from Markdown
+type Document struct {
+	Title  string
+	Tags   []string
+	Blocks []models.Block
+}
+
+var ErrEmptyDocument = errors.New("markdown document is empty")
+
+const (
+	blockEndMarker  = "<!-- /block -->"
+	frontMatterRule = "---"
+	// todoContinuation prefixes the further lines of a multi-line todo item
+	todoContinuation = "  "
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^#{1,6}(\s|$)`)
+	todoItemPattern    = regexp.MustCompile(`^[-*] \[([ xX])\](?: (.*))?$`)
+	blockMarkerPattern = regexp.MustCompile(`^<!-- block((?:\s+[a-z]+=\S+)*)\s*-->$`)
+)
+
+// Render writes a note as a Markdown document
+func Render(note *models.Note) string {
+	var b strings.Builder
+
+	title, _ := json.Marshal(note.Title)
+	tags := note.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	tagList, _ := json.Marshal(tags)
+
+	b.WriteString(frontMatterRule + "\n")
+	fmt.Fprintf(&b, "title: %s\n", title)
+	fmt.Fprintf(&b, "tags: %s\n", tagList)
+	b.WriteString(frontMatterRule + "\n")
+
+	hasChildren := make(map[string]bool)
+	for _, block := range note.Blocks {
+		if block.ParentID != nil {
+			hasChildren[*block.ParentID] = true
+		}
+	}
+
+	refs := make(map[string]string)
+	for i, block := range treeOrder(note.Blocks) {
+		b.WriteString("\n")
+
+		content := blockContent(block)
+		if !needsMarker(block, content, hasChildren[block.ID]) {
+			b.WriteString(content + "\n")
+			continue
+		}
+
+		ref := fmt.Sprintf("b%d", i+1)
+		refs[block.ID] = ref
+
+		lineCount := 0
+		if content != "" {
+			lineCount = strings.Count(content, "\n") + 1
+		}
+
+		attrs := fmt.Sprintf("id=%s type=%s", ref, markerValue(block.Type))
+		if block.ParentID != nil {
+			if parent, ok := refs[*block.ParentID]; ok {
+				attrs += " parent=" + parent
+			}
+		}
+		attrs += fmt.Sprintf(" lines=%d", lineCount)
+
+		fmt.Fprintf(&b, "<!-- block %s -->\n", attrs)
+		if content != "" {
+			b.WriteString(content + "\n")
+		}
+		b.WriteString(blockEndMarker + "\n")
+	}
+
+	return b.String()
+}
+
+// treeOrder lists blocks depth first, every parent before its children and
+// siblings by their order, so that parent references always point backwards
+func treeOrder(blocks []models.Block) []models.Block {
+	present := make(map[string]bool, len(blocks))
+	for _, block := range blocks {
+		present[block.ID] = true
+	}
+
+	children := make(map[string][]models.Block)
+	var roots []models.Block
+	for _, block := range blocks {
+		if block.ParentID != nil && present[*block.ParentID] {
+			children[*block.ParentID] = append(children[*block.ParentID], block)
+		} else {
+			roots = append(roots, block)
+		}
+	}
+
+	byOrder := func(list []models.Block) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Order < list[j].Order })
+	}
+
+	ordered := make([]models.Block, 0, len(blocks))
+	visited := make(map[string]bool, len(blocks))
+	var visit func(list []models.Block)
+	visit = func(list []models.Block) {
+		byOrder(list)
+		for _, block := range list {
+			if visited[block.ID] {
+				continue
+			}
+			visited[block.ID] = true
+			ordered = append(ordered, block)
+			visit(children[block.ID])
+		}
+	}
+	visit(roots)
+
+	// Blocks caught in a parent cycle are unreachable from the roots; keep
+	// them rather than dropping their content
+	for _, block := range blocks {
+		if !visited[block.ID] {
+			visited[block.ID] = true
+			ordered = append(ordered, block)
+		}
+	}
+
+	return ordered
+}
+
+// blockContent is the Markdown body of a single block
+func blockContent(block models.Block) string {
+	if block.Type == "todo" {
+		lines := make([]string, 0, len(block.Items))
+		for _, item := range block.Items {
+			check := " "
+			if item.Done {
+				check = "x"
+			}
+			// Further lines of the text are indented as a continuation of
+			// the list item
+			text := strings.Split(item.Text, "\n")
+			line := "- [" + check + "]"
+			if text[0] != "" {
+				line += " " + text[0]
+			}
+			lines = append(lines, line)
+			for _, rest := range text[1:] {
+				lines = append(lines, todoContinuation+rest)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	if block.ContentMD == nil {
+		return ""
+	}
+	return *block.ContentMD
+}
+
+// needsMarker reports whether a block would not survive a round trip as
+// plain Markdown
+func needsMarker(block models.Block, content string, hasChildren bool) bool {
+	if block.ParentID != nil || hasChildren {
+		return true
+	}
+	if strings.TrimSpace(content) == "" {
+		return true
+	}
+	for _, item := range block.Items {
+		if strings.Contains(item.Text, "\n") {
+			return true
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" || line == blockEndMarker || blockMarkerPattern.MatchString(line) {
+			return true
+		}
+	}
+	return inferType(lines) != block.Type
+}
+
+// markerValue keeps marker attributes free of whitespace
+func markerValue(s string) string {
+	if s == "" {
+		return "paragraph"
+	}
+	return strings.Join(strings.Fields(s), "_")
+}
+
+// inferType classifies an unmarked chunk of lines
+func inferType(lines []string) string {
+	if len(lines) == 1 && headingPattern.MatchString(lines[0]) {
+		return "heading"
+	}
+
+	for _, line := range lines {
+		if !todoItemPattern.MatchString(line) {
+			return "paragraph"
+		}
+	}
+	return "todo"
+}
+
+// Parse reads a Markdown document into a note. fallbackTitle is used when the
+// document has neither a front-matter title nor a leading heading.
+func Parse(data []byte, fallbackTitle string) (*Document, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrEmptyDocument
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(text)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Tags: []string{}}
+	lines, hasTitle := parseFrontMatter(lines, doc)
+
+	refs := make(map[string]string)
+	orders := make(map[string]int)
+	addBlock := func(block models.Block) {
+		key := ""
+		if block.ParentID != nil {
+			key = *block.ParentID
+		}
+		block.Order = orders[key]
+		orders[key]++
+		doc.Blocks = append(doc.Blocks, block)
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		if match := blockMarkerPattern.FindStringSubmatch(line); match != nil {
+			attrs := parseMarkerAttrs(match[1])
+			i++
+
+			// Marked blocks carry their line count so that content looking
+			// like an end marker is kept; hand-written markers without one
+			// run up to the first end marker
+			var content []string
+			if count, err := strconv.Atoi(attrs["lines"]); err == nil && count >= 0 {
+				end := min(i+count, len(lines))
+				content = append(content, lines[i:end]...)
+				i = end
+				if i < len(lines) && lines[i] == blockEndMarker {
+					i++
+				}
+			} else {
+				for i < len(lines) && lines[i] != blockEndMarker {
+					content = append(content, lines[i])
+					i++
+				}
+				i++ // skip end marker
+			}
+
+			blockType := attrs["type"]
+			if blockType == "" {
+				blockType = inferType(content)
+			}
+
+			block := newBlock(blockType, content)
+			if ref := attrs["id"]; ref != "" {
+				refs[ref] = block.ID
+			}
+			if parent, ok := refs[attrs["parent"]]; ok {
+				block.ParentID = &parent
+			}
+			addBlock(block)
+			continue
+		}
+
+		var chunk []string
+		fence := ""
+		for i < len(lines) {
+			current := lines[i]
+			if fence == "" && strings.TrimSpace(current) == "" {
+				break
+			}
+			if fence == "" && len(chunk) > 0 && blockMarkerPattern.MatchString(current) {
+				break
+			}
+
+			trimmed := strings.TrimSpace(current)
+			if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+				fence = trimmed[:3]
+			} else if fence != "" && strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+
+			chunk = append(chunk, current)
+			i++
+		}
+
+		addBlock(newBlock(inferType(chunk), chunk))
+	}
+
+	// An empty front-matter title is kept as it is, the note had none
+	if !hasTitle {
+		doc.Title = titleFromBlocks(doc.Blocks)
+		if doc.Title == "" {
+			doc.Title = fallbackTitle
+		}
+	}
+
+	return doc, nil
+}
+
+// parseFrontMatter consumes a leading front-matter section, if any, and
+// returns the remaining lines and whether it set the title
+func parseFrontMatter(lines []string, doc *Document) ([]string, bool) {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != frontMatterRule {
+		return lines, false
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == frontMatterRule {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return lines, false
+	}
+
+	hasTitle := false
+	listKey := ""
+	for _, line := range lines[1:end] {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "- ") && listKey == "tags" {
+			doc.Tags = append(doc.Tags, unquote(strings.TrimSpace(trimmed[2:])))
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		listKey = ""
+
+		switch key {
+		case "title":
+			doc.Title = unquote(value)
+			hasTitle = true
+		case "tags":
+			if value == "" {
+				listKey = "tags"
+				continue
+			}
+			doc.Tags = parseInlineList(value)
+		}
+	}
+
+	return lines[end+1:], hasTitle
+}
+
+func parseInlineList(value string) []string {
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err == nil {
+		return list
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	list = []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func unquote(value string) string {
+	if strings.HasPrefix(value, `"`) {
+		var s string
+		if err := json.Unmarshal([]byte(value), &s); err == nil {
+			return s
+		}
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+func parseMarkerAttrs(raw string) map[string]string {
+	attrs := make(map[string]string)
+	for _, field := range strings.Fields(raw) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
+
+// newBlock builds a block of the given type from its Markdown lines
+func newBlock(blockType string, lines []string) models.Block {
+	block := models.Block{
+		ID:   uuid.New().String(),
+		Type: blockType,
+	}
+
+	if blockType == "todo" {
+		block.Items = []models.TodoItem{}
+		for _, line := range lines {
+			match := todoItemPattern.FindStringSubmatch(line)
+			if match == nil {
+				if last := len(block.Items) - 1; last >= 0 && strings.HasPrefix(line, todoContinuation) {
+					block.Items[last].Text += "\n" + strings.TrimPrefix(line, todoContinuation)
+				}
+				continue
+			}
+			block.Items = append(block.Items, models.TodoItem{
+				ID:   uuid.New().String(),
+				Text: match[2],
+				Done: match[1] != " ",
+			})
+		}
+		return block
+	}
+
+	content := strings.Join(lines, "\n")
+	block.ContentMD = &content
+	return block
+}
+
+// titleFromBlocks uses the first top-level heading as the title
+func titleFromBlocks(blocks []models.Block) string {
+	for _, block := range blocks {
+		if block.Type == "heading" && block.ParentID == nil && block.ContentMD != nil {
+			return strings.TrimSpace(strings.TrimLeft(*block.ContentMD, "#"))
+		}
+	}
+	return ""
+}
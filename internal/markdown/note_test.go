@@ -0,0 +1,139 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+
+	"backend-journaling/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+// blockShape is a block without its generated IDs, with its parent named by
+// content so that two notes can be compared
+type blockShape struct {
+	Type    string
+	Parent  string
+	Order   int
+	Content string
+	Items   []models.TodoItem
+}
+
+func shapes(blocks []models.Block) []blockShape {
+	names := make(map[string]string, len(blocks))
+	for _, block := range blocks {
+		names[block.ID] = blockName(block)
+	}
+
+	out := make([]blockShape, 0, len(blocks))
+	for _, block := range treeOrder(blocks) {
+		shape := blockShape{Type: block.Type, Order: block.Order}
+		if block.ParentID != nil {
+			shape.Parent = names[*block.ParentID]
+		}
+		if block.ContentMD != nil {
+			shape.Content = *block.ContentMD
+		}
+		for _, item := range block.Items {
+			shape.Items = append(shape.Items, models.TodoItem{Text: item.Text, Done: item.Done})
+		}
+		out = append(out, shape)
+	}
+	return out
+}
+
+func blockName(block models.Block) string {
+	if block.ContentMD != nil {
+		return *block.ContentMD
+	}
+	if len(block.Items) > 0 {
+		return block.Items[0].Text
+	}
+	return block.ID
+}
+
+func TestRoundTrip(t *testing.T) {
+	parent := "p"
+	note := &models.Note{
+		Title: "",
+		Tags:  []string{"work", "draft"},
+		Blocks: []models.Block{
+			// Stored out of tree order: the child comes before its parent
+			// and the second top-level block before the first
+			{ID: "c", Type: "paragraph", ParentID: &parent, Order: 0, ContentMD: strPtr("nested child")},
+			{ID: "h", Type: "heading", Order: 1, ContentMD: strPtr("# Heading that must not become the title")},
+			{ID: parent, Type: "paragraph", Order: 0, ContentMD: strPtr("parent paragraph")},
+			{ID: "e", Type: "paragraph", Order: 2, ContentMD: strPtr("before\n" + blockEndMarker + "\n<!-- block id=b9 type=heading -->\nafter")},
+			{ID: "t", Type: "todo", Order: 3, Items: []models.TodoItem{
+				{ID: "1", Text: "first line\nsecond line\n\n  indented", Done: true},
+				{ID: "2", Text: "", Done: false},
+				{ID: "3", Text: "- [ ] not an item", Done: false},
+			}},
+			{ID: "s", Type: "todo", Order: 4, Items: []models.TodoItem{
+				{ID: "4", Text: "plain", Done: false},
+			}},
+			{ID: "b", Type: "paragraph", Order: 5, ContentMD: strPtr("")},
+		},
+	}
+
+	doc, err := Parse([]byte(Render(note)), "fallback")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if doc.Title != "" {
+		t.Errorf("title = %q, want empty", doc.Title)
+	}
+	if !reflect.DeepEqual(doc.Tags, note.Tags) {
+		t.Errorf("tags = %v, want %v", doc.Tags, note.Tags)
+	}
+
+	got, want := shapes(doc.Blocks), shapes(note.Blocks)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks differ\n got: %#v\nwant: %#v", got, want)
+	}
+
+	// Parents must come before their children in the parsed list
+	seen := make(map[string]bool)
+	for _, block := range doc.Blocks {
+		if block.ParentID != nil && !seen[*block.ParentID] {
+			t.Errorf("block %q parsed before its parent", blockName(block))
+		}
+		seen[block.ID] = true
+	}
+}
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"front matter", "---\ntitle: \"Plan\"\n---\n\n# Heading\n", "Plan"},
+		{"empty front matter title", "---\ntitle: \"\"\n---\n\n# Heading\n", ""},
+		{"leading heading", "# Heading\n\ntext\n", "Heading"},
+		{"fallback", "just text\n", "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.doc), "fallback")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc.Title != tt.want {
+				t.Errorf("title = %q, want %q", doc.Title, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkerWithoutLineCount(t *testing.T) {
+	doc, err := Parse([]byte("<!-- block type=paragraph -->\none\n\ntwo\n<!-- /block -->\n"), "x")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(doc.Blocks) != 1 || *doc.Blocks[0].ContentMD != "one\n\ntwo" {
+		t.Fatalf("blocks = %#v", doc.Blocks)
+	}
+}
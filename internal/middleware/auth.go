@@ -41,6 +41,48 @@ func Authenticate(jwtManager *jwt.Manager) func(http.Handler) http.Handler {
 	}
 }
 
+// AuthenticateWebSocket is Authenticate for WebSocket handshakes. Browsers
+// cannot set headers on a WebSocket, so the access token may instead be
+// offered as a "bearer.<token>" entry of Sec-WebSocket-Protocol.
+func AuthenticateWebSocket(jwtManager *jwt.Manager) func(http.Handler) http.Handler {
+	authenticate := Authenticate(jwtManager)
+	return func(next http.Handler) http.Handler {
+		withHeader := authenticate(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				for _, protocol := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+					protocol = strings.TrimSpace(protocol)
+					if strings.HasPrefix(protocol, "bearer.") {
+						r.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(protocol, "bearer."))
+						break
+					}
+				}
+			}
+
+			withHeader.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuthenticateEventStream is Authenticate for Server-Sent Events. EventSource
+// cannot set headers, so the access token may instead be passed as the
+// access_token query parameter.
+func AuthenticateEventStream(jwtManager *jwt.Manager) func(http.Handler) http.Handler {
+	authenticate := Authenticate(jwtManager)
+	return func(next http.Handler) http.Handler {
+		withHeader := authenticate(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				if token := r.URL.Query().Get("access_token"); token != "" {
+					r.Header.Set("Authorization", "Bearer "+token)
+				}
+			}
+
+			withHeader.ServeHTTP(w, r)
+		})
+	}
+}
+
 func RequireRole(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
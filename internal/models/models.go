@@ -52,21 +52,24 @@ type AuthEvent struct {
 }
 
 type Profile struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
-	FullName    *string    `json:"full_name,omitempty" db:"full_name"`
-	Bio         *string    `json:"bio,omitempty" db:"bio"`
-	Avatar      *string    `json:"avatar,omitempty" db:"avatar"`
-	DateOfBirth *time.Time `json:"date_of_birth,omitempty" db:"date_of_birth"`
-	Gender      *string    `json:"gender,omitempty" db:"gender"`
-	PhoneNumber *string    `json:"phone_number,omitempty" db:"phone_number"`
-	Country     *string    `json:"country,omitempty" db:"country"`
-	City        *string    `json:"city,omitempty" db:"city"`
-	Timezone    *string    `json:"timezone,omitempty" db:"timezone"`
-	Language    string     `json:"language" db:"language"`
-	Theme       string     `json:"theme" db:"theme"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	ID       uuid.UUID `json:"id" db:"id"`
+	UserID   uuid.UUID `json:"user_id" db:"user_id"`
+	FullName *string   `json:"full_name,omitempty" db:"full_name"`
+	Bio      *string   `json:"bio,omitempty" db:"bio"`
+	Avatar   *string   `json:"avatar,omitempty" db:"avatar"`
+	// AvatarAttachmentID references an uploaded image; when set, Avatar is
+	// filled with a signed link to it in responses
+	AvatarAttachmentID *string    `json:"avatar_attachment_id,omitempty" db:"avatar_attachment_id"`
+	DateOfBirth        *time.Time `json:"date_of_birth,omitempty" db:"date_of_birth"`
+	Gender             *string    `json:"gender,omitempty" db:"gender"`
+	PhoneNumber        *string    `json:"phone_number,omitempty" db:"phone_number"`
+	Country            *string    `json:"country,omitempty" db:"country"`
+	City               *string    `json:"city,omitempty" db:"city"`
+	Timezone           *string    `json:"timezone,omitempty" db:"timezone"`
+	Language           string     `json:"language" db:"language"`
+	Theme              string     `json:"theme" db:"theme"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type UserWithProfile struct {
@@ -109,23 +109,41 @@ func (ft FlexibleTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
 }
 
 type Note struct {
-	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	UserID    string              `bson:"user_id" json:"user_id"`
-	GroupID   *primitive.ObjectID `bson:"group_id,omitempty" json:"group_id,omitempty"`
-	Title     string              `bson:"title" json:"title"`
-	Blocks    []Block             `bson:"blocks" json:"blocks"`
-	Tags      []string            `bson:"tags" json:"tags"`
-	IsPinned  bool                `bson:"is_pinned" json:"is_pinned"`
-	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+	ID       primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID   string              `bson:"user_id" json:"user_id"`
+	GroupID  *primitive.ObjectID `bson:"group_id,omitempty" json:"group_id,omitempty"`
+	Title    string              `bson:"title" json:"title"`
+	Blocks   []Block             `bson:"blocks" json:"blocks"`
+	Tags     []string            `bson:"tags" json:"tags"`
+	IsPinned bool                `bson:"is_pinned" json:"is_pinned"`
+	// JournalDate marks the note as the journal entry of a calendar day
+	// (yyyy-mm-dd); a user has at most one entry per day
+	JournalDate *string   `bson:"journal_date,omitempty" json:"journal_date,omitempty"`
+	Version     int64     `bson:"version" json:"version"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// Block is stored flat inside Note.Blocks. ParentID links a block to its
+// parent block (nil for top-level blocks) and Order is the position among
+// siblings sharing the same parent.
 type Block struct {
 	ID        string     `bson:"id" json:"id"`
 	Type      string     `bson:"type" json:"type"`
+	ParentID  *string    `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
 	Order     int        `bson:"order" json:"order"`
 	ContentMD *string    `bson:"content_md,omitempty" json:"content_md,omitempty"`
 	Items     []TodoItem `bson:"items,omitempty" json:"items,omitempty"`
+	// AttachmentID references the uploaded image of an image block;
+	// ContentMD then holds the optional caption
+	AttachmentID *string `bson:"attachment_id,omitempty" json:"attachment_id,omitempty"`
+}
+
+// BlockNode is a block together with its nested children, used when
+// returning a note's blocks as a tree
+type BlockNode struct {
+	Block
+	Children []BlockNode `json:"children"`
 }
 
 type TodoItem struct {
@@ -135,12 +153,35 @@ type TodoItem struct {
 }
 
 type Todo struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID string             `bson:"user_id" json:"user_id"`
+	// ListID is the todo list the todo belongs to. Todos created before
+	// lists existed have none until the user's lists are first used.
+	ListID *primitive.ObjectID `bson:"list_id,omitempty" json:"list_id,omitempty"`
+	// Position orders the todo within its list
+	Position string `bson:"position,omitempty" json:"position"`
+	Title    string `bson:"title" json:"title"`
+	Done     bool   `bson:"done" json:"done"`
+	Priority string `bson:"priority" json:"priority"`
+	// DueDate is the moment a timed todo is due. For an all-day todo it is
+	// midnight UTC of the due day, so the day stays the same in every zone.
+	DueDate    *FlexibleTime `bson:"due_date,omitempty" json:"due_date"`
+	AllDay     bool          `bson:"all_day" json:"all_day"`
+	Recurrence *Recurrence   `bson:"recurrence,omitempty" json:"recurrence,omitempty"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// TodoList groups todos, such as Personal, Work or Groceries. Every user has
+// one default list, which new todos go to unless another is chosen and which
+// cannot be deleted.
+type TodoList struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID    string             `bson:"user_id" json:"user_id"`
-	Title     string             `bson:"title" json:"title"`
-	Done      bool               `bson:"done" json:"done"`
-	Priority  string             `bson:"priority" json:"priority"`
-	DueDate   time.Time          `bson:"due_date,omitempty" json:"due_date,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Color     *string            `bson:"color,omitempty" json:"color,omitempty"`
+	Position  string             `bson:"position" json:"position"`
+	IsDefault bool               `bson:"is_default" json:"is_default"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
@@ -154,8 +195,112 @@ type Task struct {
 	Priority      string             `bson:"priority" json:"priority"`
 	Deadline      time.Time          `bson:"deadline" json:"deadline,omitempty"`
 	Tags          []string           `bson:"tags" json:"tags"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	Recurrence    *Recurrence        `bson:"recurrence,omitempty" json:"recurrence,omitempty"`
+	// ParentID makes the task a subtask; Ancestors lists every task above
+	// it, nearest last, so a whole subtree can be found at once
+	ParentID  *primitive.ObjectID  `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Ancestors []primitive.ObjectID `bson:"ancestors,omitempty" json:"-"`
+	// Position orders a subtask among its siblings
+	Position  string     `bson:"position,omitempty" json:"position,omitempty"`
+	Checklist []TodoItem `bson:"checklist,omitempty" json:"checklist,omitempty"`
+	// AutoComplete completes the task once all of its subtasks and
+	// checklist items are done
+	AutoComplete bool          `bson:"auto_complete" json:"auto_complete"`
+	Progress     *TaskProgress `bson:"-" json:"progress,omitempty"`
+	// BlockedBy lists the tasks that must be done before this one; Blocked
+	// is set while any of them is not
+	BlockedBy []primitive.ObjectID `bson:"blocked_by,omitempty" json:"blocked_by,omitempty"`
+	Blocked   bool                 `bson:"blocked,omitempty" json:"blocked"`
+	// EstimateMinutes is how long the task is expected to take, to compare
+	// with the time tracked on it
+	EstimateMinutes *int `bson:"estimate_minutes,omitempty" json:"estimate_minutes,omitempty"`
+	// CompletedAt is when the task last moved to done; reopening clears it
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// TaskActivity is an entry in a task's activity log
+type TaskActivity struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TaskID primitive.ObjectID `bson:"task_id" json:"task_id"`
+	UserID string             `bson:"user_id" json:"user_id"`
+	// ActorID is the user whose request made the change
+	ActorID string `bson:"actor_id" json:"actor_id"`
+	Type    string `bson:"type" json:"type"`
+	From    string `bson:"from" json:"from"`
+	To      string `bson:"to" json:"to"`
+	// Automatic marks changes made on the user's behalf, such as a parent
+	// completed by its last subtask
+	Automatic bool      `bson:"automatic,omitempty" json:"automatic,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+const TaskActivityStatusChanged = "status_changed"
+
+// TimeEntry is time spent on a task, tracked with a timer or entered by
+// hand. A running timer has no end yet.
+type TimeEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	TaskID    primitive.ObjectID `bson:"task_id" json:"task_id"`
+	StartedAt time.Time          `bson:"started_at" json:"started_at"`
+	EndedAt   *time.Time         `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	// Running is only stored while the timer runs, which lets an index keep
+	// a user to one running timer
+	Running         bool      `bson:"running,omitempty" json:"running"`
+	DurationSeconds int64     `bson:"duration_seconds" json:"duration_seconds"`
+	Manual          bool      `bson:"manual,omitempty" json:"manual"`
+	Note            *string   `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TaskProgress rolls up a task's direct subtasks and checklist items, e.g.
+// 3 of 5 done
+type TaskProgress struct {
+	Done           int `json:"done"`
+	Total          int `json:"total"`
+	SubtasksDone   int `json:"subtasks_done"`
+	SubtasksTotal  int `json:"subtasks_total"`
+	ChecklistDone  int `json:"checklist_done"`
+	ChecklistTotal int `json:"checklist_total"`
+}
+
+// Board shows the user's top-level tasks as columns, one per status. A tag
+// limits the board to the tasks carrying it.
+type Board struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Name      string             `bson:"name" json:"name"`
+	Tag       *string            `bson:"tag,omitempty" json:"tag,omitempty"`
+	Columns   []BoardColumn      `bson:"columns" json:"columns"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// BoardColumn holds the tasks with Status. WIPLimit caps how many tasks can
+// be moved into the column.
+type BoardColumn struct {
+	ID       string `bson:"id" json:"id"`
+	Name     string `bson:"name" json:"name"`
+	Status   string `bson:"status" json:"status"`
+	WIPLimit *int   `bson:"wip_limit,omitempty" json:"wip_limit,omitempty"`
+}
+
+// Recurrence makes a todo or task repeat. Every occurrence is its own item;
+// completing one creates the item of the next occurrence.
+type Recurrence struct {
+	// RRule is an RFC 5545 recurrence rule, e.g. FREQ=WEEKLY;BYDAY=MO,WE
+	RRule    string `bson:"rrule" json:"rrule"`
+	Timezone string `bson:"timezone" json:"timezone"`
+	// Start is the first occurrence of the series (DTSTART); its local time
+	// of day is the time of every occurrence
+	Start time.Time `bson:"start" json:"start"`
+	// Occurrence is the scheduled time of this item. Rescheduling the item
+	// leaves it unchanged so the series stays on its schedule.
+	Occurrence time.Time          `bson:"occurrence" json:"occurrence"`
+	SeriesID   primitive.ObjectID `bson:"series_id" json:"series_id"`
 }
 
 type NoteGroup struct {
@@ -171,3 +316,246 @@ type NoteGroup struct {
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 }
+
+// NoteLink is one [[wiki link]] found in a note's blocks. TargetNoteID is nil
+// while the link is dangling, i.e. no note with that title or ID exists.
+type NoteLink struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID       string              `bson:"user_id" json:"user_id"`
+	SourceNoteID primitive.ObjectID  `bson:"source_note_id" json:"source_note_id"`
+	BlockID      string              `bson:"block_id" json:"block_id"`
+	Target       string              `bson:"target" json:"target"`
+	TargetKey    string              `bson:"target_key" json:"-"`
+	TargetNoteID *primitive.ObjectID `bson:"target_note_id,omitempty" json:"target_note_id,omitempty"`
+	Snippet      string              `bson:"snippet" json:"snippet"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// Tag holds the metadata of a tag. Notes and tasks still reference tags by
+// name; a Tag document only exists once a tag has been given a colour.
+type Tag struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Name      string             `bson:"name" json:"name"`
+	Color     *string            `bson:"color,omitempty" json:"color,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Attachment is an uploaded file. The blob lives in the configured storage
+// under StorageKey; images also get a JPEG thumbnail under ThumbnailKey.
+type Attachment struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       string             `bson:"user_id" json:"user_id"`
+	Filename     string             `bson:"filename" json:"filename"`
+	ContentType  string             `bson:"content_type" json:"content_type"`
+	Size         int64              `bson:"size" json:"size"`
+	Width        int                `bson:"width,omitempty" json:"width,omitempty"`
+	Height       int                `bson:"height,omitempty" json:"height,omitempty"`
+	StorageKey   string             `bson:"storage_key" json:"-"`
+	ThumbnailKey *string            `bson:"thumbnail_key,omitempty" json:"-"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NoteTemplate is a reusable note structure. Title, block content and todo
+// item texts may contain {{variables}} that are filled in when a note is
+// created from the template.
+type NoteTemplate struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      string             `bson:"user_id" json:"user_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Title       string             `bson:"title" json:"title"`
+	Tags        []string           `bson:"tags" json:"tags"`
+	Blocks      []Block            `bson:"blocks" json:"blocks"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// DailyLog holds the structured fields a user tracks for one calendar day,
+// next to the journal entry of that day. Habits maps habit IDs to the day's
+// value; boolean habits are stored as 1 or 0.
+type DailyLog struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Date       string             `bson:"date" json:"date"`
+	Mood       *int               `bson:"mood,omitempty" json:"mood,omitempty"`
+	Emotions   []string           `bson:"emotions,omitempty" json:"emotions,omitempty"`
+	Energy     *int               `bson:"energy,omitempty" json:"energy,omitempty"`
+	SleepHours *float64           `bson:"sleep_hours,omitempty" json:"sleep_hours,omitempty"`
+	Habits     map[string]float64 `bson:"habits,omitempty" json:"habits,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	HabitKindBoolean = "boolean"
+	HabitKindNumeric = "numeric"
+)
+
+// Habit is a custom habit a user tracks in their daily logs. A numeric habit
+// counts as done on a day when its value reaches Target (or is positive when
+// no target is set).
+type Habit struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Unit       *string            `bson:"unit,omitempty" json:"unit,omitempty"`
+	Target     *float64           `bson:"target,omitempty" json:"target,omitempty"`
+	IsArchived bool               `bson:"is_archived" json:"is_archived"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	ShareResourceNote  = "note"
+	ShareResourceGroup = "group"
+)
+
+// ShareLink publishes a note or note group at an unguessable public URL. A
+// resource has at most one link; revoking it deletes the link.
+type ShareLink struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       string             `bson:"user_id" json:"-"`
+	ResourceType string             `bson:"resource_type" json:"resource_type"`
+	ResourceID   primitive.ObjectID `bson:"resource_id" json:"resource_id"`
+	Token        string             `bson:"token" json:"token"`
+	PasswordHash *string            `bson:"password_hash,omitempty" json:"-"`
+	ExpiresAt    *time.Time         `bson:"expires_at,omitempty" json:"expires_at"`
+	Views        int64              `bson:"views" json:"views"`
+	LastViewedAt *time.Time         `bson:"last_viewed_at,omitempty" json:"last_viewed_at"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Collaborator grants a registered user a role on a note or note group owned
+// by someone else. A role on a group applies to every note in it.
+type Collaborator struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OwnerID      string             `bson:"owner_id" json:"-"`
+	ResourceType string             `bson:"resource_type" json:"resource_type"`
+	ResourceID   primitive.ObjectID `bson:"resource_id" json:"resource_id"`
+	UserID       string             `bson:"user_id" json:"user_id"`
+	Email        string             `bson:"email" json:"email"`
+	Role         string             `bson:"role" json:"role"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Comment is a remark on a note, anchored to one of its blocks when BlockID
+// is set. Replies point at the first comment of their thread through
+// ParentID; only that comment carries the thread's resolved state.
+type Comment struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	NoteID      primitive.ObjectID  `bson:"note_id" json:"note_id"`
+	OwnerID     string              `bson:"owner_id" json:"-"`
+	UserID      string              `bson:"user_id" json:"user_id"`
+	AuthorEmail string              `bson:"author_email" json:"author_email"`
+	BlockID     *string             `bson:"block_id,omitempty" json:"block_id,omitempty"`
+	ParentID    *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Body        string              `bson:"body" json:"body"`
+	Mentions    []CommentMention    `bson:"mentions" json:"mentions"`
+	Resolved    bool                `bson:"resolved" json:"resolved"`
+	ResolvedBy  *string             `bson:"resolved_by,omitempty" json:"resolved_by,omitempty"`
+	ResolvedAt  *time.Time          `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+	// Orphaned is set when the anchored block was deleted; the comment is
+	// kept and shows up again should the block come back
+	Orphaned  bool          `bson:"orphaned" json:"orphaned"`
+	History   []CommentEdit `bson:"history" json:"history"`
+	EditedAt  *time.Time    `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// CommentMention is a user with access to the note mentioned as @email
+type CommentMention struct {
+	UserID string `bson:"user_id" json:"user_id"`
+	Email  string `bson:"email" json:"email"`
+}
+
+// CommentEdit is an earlier body of an edited comment
+type CommentEdit struct {
+	Body     string    `bson:"body" json:"body"`
+	EditedAt time.Time `bson:"edited_at" json:"edited_at"`
+}
+
+const (
+	ReminderTargetTodo    = "todo"
+	ReminderTargetTask    = "task"
+	ReminderTargetJournal = "journal"
+)
+
+// Delivery channels of a reminder
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+const (
+	ReminderPending   = "pending"
+	ReminderSending   = "sending"
+	ReminderSent      = "sent"
+	ReminderFailed    = "failed"
+	ReminderCancelled = "cancelled"
+)
+
+// Reminder notifies a user about a todo, task or journal day, either at
+// RemindAt or BeforeMinutes before the item is due. FireAt is when it fires
+// next; it is unset while a relative reminder's item has no due date.
+type Reminder struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID        string              `bson:"user_id" json:"-"`
+	TargetType    string              `bson:"target_type" json:"target_type"`
+	TargetID      *primitive.ObjectID `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Date          string              `bson:"date,omitempty" json:"date,omitempty"`
+	RemindAt      *time.Time          `bson:"remind_at,omitempty" json:"remind_at,omitempty"`
+	BeforeMinutes *int                `bson:"before_minutes,omitempty" json:"before_minutes,omitempty"`
+	Message       string              `bson:"message,omitempty" json:"message,omitempty"`
+	Channels      []string            `bson:"channels" json:"channels"`
+	WebhookURL    string              `bson:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	FireAt        *time.Time          `bson:"fire_at,omitempty" json:"fire_at"`
+	Status        string              `bson:"status" json:"status"`
+	// Delivered lists the channels that already got the current firing, so
+	// a retry only sends to the others
+	Delivered []string   `bson:"delivered" json:"delivered"`
+	Attempts  int        `bson:"attempts" json:"attempts"`
+	LastError string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	SentAt    *time.Time `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	// Fired counts completed firings; with the ID it names the current one
+	Fired int `bson:"fired" json:"-"`
+	// LockedBy and LockedUntil lease a firing reminder to one server
+	// instance; a lease that runs out is picked up again
+	LockedBy    string     `bson:"locked_by,omitempty" json:"-"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"-"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// Kinds of in-app notifications
+const (
+	NotificationReminder  = "reminder"
+	NotificationShare     = "share"
+	NotificationComment   = "comment"
+	NotificationMention   = "mention"
+	NotificationSecurity  = "security"
+	NotificationTaskReady = "task_ready"
+)
+
+// Notification is an in-app notification of a user
+type Notification struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       string             `bson:"user_id" json:"-"`
+	Type         string             `bson:"type" json:"type"`
+	Title        string             `bson:"title" json:"title"`
+	Body         string             `bson:"body" json:"body"`
+	ResourceType string             `bson:"resource_type,omitempty" json:"resource_type,omitempty"`
+	ResourceID   string             `bson:"resource_id,omitempty" json:"resource_id,omitempty"`
+	Read         bool               `bson:"read" json:"read"`
+	ReadAt       *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	// Key identifies the event behind the notification so a retried
+	// delivery does not add it twice
+	Key       string    `bson:"key,omitempty" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
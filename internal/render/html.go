@@ -0,0 +1,203 @@
+// Package render turns notes and note groups into standalone documents that
+// can be shared outside the app: sanitized HTML pages and PDF files.
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"backend-journaling/internal/models"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// NoteView is a note with its blocks arranged as a tree
+type NoteView struct {
+	Note   *models.Note
+	Blocks []models.BlockNode
+}
+
+// GroupView is a note group with the notes it contains, in reading order
+type GroupView struct {
+	Group *models.NoteGroup
+	Notes []NoteView
+}
+
+// HTMLContentSecurityPolicy is the policy rendered pages should be served
+// with: no scripts, inline styles only, images from anywhere over https.
+const HTMLContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:"
+
+// md renders block Markdown. goldmark's default renderer drops raw HTML and
+// dangerous link targets such as javascript: URLs, which keeps the output safe
+// to embed.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+)
+
+func markdownHTML(content *string) template.HTML {
+	if content == nil || strings.TrimSpace(*content) == "" {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(*content), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(*content))
+	}
+	return template.HTML(buf.String())
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"markdown": markdownHTML,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; line-height: 1.6; color: #222; max-width: 760px; margin: 0 auto; padding: 32px 20px; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.25; }
+.note { margin-bottom: 48px; }
+.note + .note { border-top: 1px solid #e5e7eb; padding-top: 32px; }
+.note-title { font-size: 2em; margin: 0 0 8px; }
+.meta { color: #6b7280; font-size: 0.875em; margin: 0 0 24px; }
+.tag { display: inline-block; background: #f3f4f6; border-radius: 4px; padding: 0 6px; margin-right: 4px; }
+.children { margin-left: 24px; }
+.todo { list-style: none; padding-left: 0; }
+.todo li.done span { text-decoration: line-through; color: #6b7280; }
+pre { background: #f6f8fa; padding: 12px; overflow-x: auto; border-radius: 6px; }
+code { font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: 0.9em; }
+blockquote { border-left: 4px solid #e5e7eb; margin-left: 0; padding-left: 16px; color: #4b5563; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #e5e7eb; padding: 4px 8px; }
+img { max-width: 100%; }
+.toc { background: #f9fafb; border-radius: 6px; padding: 16px 24px; margin-bottom: 40px; }
+</style>
+</head>
+<body>
+{{- if .Group}}
+<header>
+<h1>{{.Group.Name}}</h1>
+{{- if .Group.Description}}
+<p class="meta">{{.Group.Description}}</p>
+{{- end}}
+</header>
+<nav class="toc">
+<h2>Contents</h2>
+<ol>
+{{- range .Notes}}
+<li><a href="#note-{{.Index}}">{{.Note.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+{{- end}}
+{{- range .Notes}}
+{{template "note" .}}
+{{- end}}
+</body>
+</html>
+{{define "note"}}<article class="note" id="note-{{.Index}}">
+<h1 class="note-title">{{.Note.Title}}</h1>
+<p class="meta">{{.Note.UpdatedAt.Format "January 2, 2006"}}{{range .Note.Tags}} <span class="tag">#{{.}}</span>{{end}}</p>
+{{template "blocks" .Blocks}}
+</article>{{end}}
+{{define "blocks"}}{{range .}}<div class="block block-{{.Type}}">
+{{- if eq .Type "todo"}}
+<ul class="todo">
+{{- range .Items}}
+<li{{if .Done}} class="done"{{end}}><input type="checkbox" disabled{{if .Done}} checked{{end}}> <span>{{.Text}}</span></li>
+{{- end}}
+</ul>
+{{- else}}
+{{markdown .ContentMD}}
+{{- end}}
+{{- if .Children}}
+<div class="children">
+{{template "blocks" .Children}}
+</div>
+{{- end}}
+</div>
+{{end}}{{end}}`))
+
+type pageData struct {
+	Title string
+	Group *models.NoteGroup
+	Notes []pageNote
+}
+
+// pageNote is a note on a page. Its anchor is its place on the page, so that
+// shared pages do not publish note IDs.
+type pageNote struct {
+	NoteView
+	Index int
+}
+
+func pageNotes(views []NoteView) []pageNote {
+	notes := make([]pageNote, len(views))
+	for i, view := range views {
+		notes[i] = pageNote{NoteView: view, Index: i + 1}
+	}
+	return notes
+}
+
+// NoteHTML renders a single note as a standalone HTML page
+func NoteHTML(view NoteView) ([]byte, error) {
+	return renderPage(pageData{
+		Title: view.Note.Title,
+		Notes: pageNotes([]NoteView{view}),
+	})
+}
+
+// GroupHTML renders a note group as one HTML page with a table of contents
+func GroupHTML(view GroupView) ([]byte, error) {
+	return renderPage(pageData{
+		Title: view.Group.Name,
+		Group: view.Group,
+		Notes: pageNotes(view.Notes),
+	})
+}
+
+func renderPage(data pageData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var passwordTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Password required</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; color: #222; max-width: 360px; margin: 80px auto; padding: 0 20px; }
+input { width: 100%; box-sizing: border-box; padding: 8px; margin: 8px 0; font-size: 1em; }
+button { padding: 8px 16px; font-size: 1em; }
+.error { color: #b91c1c; }
+</style>
+</head>
+<body>
+<h1>Password required</h1>
+{{- if .}}
+<p class="error">The password is incorrect.</p>
+{{- end}}
+<form method="post">
+<input type="password" name="password" autofocus required aria-label="Password">
+<button type="submit">View</button>
+</form>
+</body>
+</html>`))
+
+// PasswordHTML renders the page asking for the password of a protected share
+// link; it posts the password back to the same URL
+func PasswordHTML(invalid bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := passwordTemplate.Execute(&buf, invalid); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,288 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"backend-journaling/internal/models"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfMargin     = 20.0
+	pdfLineHeight = 5.5
+	pdfIndent     = 7.0
+)
+
+// pdfDocument wraps fpdf with the text translation needed by its built-in
+// fonts, which only cover the Windows-1252 character set
+type pdfDocument struct {
+	pdf *fpdf.Fpdf
+	tr  func(string) string
+}
+
+func newPDFDocument(title string) *pdfDocument {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("backend-journaling", true)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.AliasNbPages("")
+
+	d := &pdfDocument{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(140, 140, 140)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	return d
+}
+
+// NotePDF renders a single note as a PDF document
+func NotePDF(view NoteView) ([]byte, error) {
+	d := newPDFDocument(view.Note.Title)
+	d.pdf.AddPage()
+	d.writeNote(view)
+	return d.output()
+}
+
+// GroupPDF renders a note group as a PDF document that starts with a table of
+// contents linking to every note
+func GroupPDF(view GroupView) ([]byte, error) {
+	d := newPDFDocument(view.Group.Name)
+	pdf := d.pdf
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 22)
+	pdf.SetTextColor(20, 20, 20)
+	pdf.MultiCell(0, 10, d.tr(view.Group.Name), "", "L", false)
+	if view.Group.Description != nil && *view.Group.Description != "" {
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.MultiCell(0, pdfLineHeight, d.tr(*view.Group.Description), "", "L", false)
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetTextColor(20, 20, 20)
+	pdf.CellFormat(0, 8, "Contents", "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	// Page numbers are not known until the notes are laid out, so the table
+	// of contents uses aliases that fpdf replaces when the file is written
+	width, _ := pdf.GetPageSize()
+	usable := width - 2*pdfMargin
+	links := make([]int, len(view.Notes))
+	pdf.SetFont("Helvetica", "", 11)
+	for i, note := range view.Notes {
+		links[i] = pdf.AddLink()
+		pdf.CellFormat(usable-15, 7, d.tr(fmt.Sprintf("%d. %s", i+1, note.Note.Title)), "", 0, "L", false, links[i], "")
+		pdf.CellFormat(15, 7, tocAlias(i), "", 1, "R", false, links[i], "")
+	}
+
+	for i, note := range view.Notes {
+		pdf.AddPage()
+		pdf.SetLink(links[i], 0, -1)
+		pdf.Bookmark(d.tr(note.Note.Title), 0, -1)
+		pdf.RegisterAlias(tocAlias(i), strconv.Itoa(pdf.PageNo()))
+		d.writeNote(note)
+	}
+
+	return d.output()
+}
+
+func tocAlias(i int) string {
+	return fmt.Sprintf("{toc%d}", i)
+}
+
+func (d *pdfDocument) output() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *pdfDocument) writeNote(view NoteView) {
+	pdf := d.pdf
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.SetTextColor(20, 20, 20)
+	pdf.MultiCell(0, 9, d.tr(view.Note.Title), "", "L", false)
+
+	meta := view.Note.UpdatedAt.Format("January 2, 2006")
+	for _, tag := range view.Note.Tags {
+		meta += "  #" + tag
+	}
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.MultiCell(0, pdfLineHeight, d.tr(meta), "", "L", false)
+	pdf.Ln(4)
+
+	d.writeBlocks(view.Blocks, 0)
+}
+
+func (d *pdfDocument) writeBlocks(blocks []models.BlockNode, depth int) {
+	pdf := d.pdf
+	left := pdfMargin + float64(depth)*pdfIndent
+
+	for _, block := range blocks {
+		pdf.SetLeftMargin(left)
+		pdf.SetX(left)
+		pdf.SetTextColor(30, 30, 30)
+
+		switch {
+		case block.Type == "todo":
+			d.writeTodo(block)
+		case block.ContentMD != nil:
+			d.writeMarkdown(*block.ContentMD)
+		}
+
+		if len(block.Children) > 0 {
+			d.writeBlocks(block.Children, depth+1)
+		}
+	}
+
+	pdf.SetLeftMargin(pdfMargin)
+	pdf.SetX(pdfMargin)
+}
+
+func (d *pdfDocument) writeTodo(block models.BlockNode) {
+	pdf := d.pdf
+	pdf.SetFont("Helvetica", "", 11)
+
+	for _, item := range block.Items {
+		x, y := pdf.GetX(), pdf.GetY()
+		pdf.Rect(x, y+1.2, 3.2, 3.2, "D")
+		if item.Done {
+			pdf.Line(x+0.6, y+2.8, x+1.4, y+3.8)
+			pdf.Line(x+1.4, y+3.8, x+2.8, y+1.6)
+			pdf.SetTextColor(130, 130, 130)
+		} else {
+			pdf.SetTextColor(30, 30, 30)
+		}
+
+		left, _, _, _ := pdf.GetMargins()
+		pdf.SetLeftMargin(x + 5)
+		pdf.SetX(x + 5)
+		pdf.MultiCell(0, pdfLineHeight, d.tr(plainText(item.Text)), "", "L", false)
+		pdf.SetLeftMargin(left)
+		pdf.SetX(left)
+	}
+
+	pdf.SetTextColor(30, 30, 30)
+	pdf.Ln(2)
+}
+
+var (
+	headingLine  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listLine     = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	taskListLine = regexp.MustCompile(`^\[([ xX])\]\s*(.*)$`)
+)
+
+// writeMarkdown lays out block Markdown line by line: headings, list items,
+// quotes and code fences get their own styling and inline markup is reduced
+// to plain text
+func (d *pdfDocument) writeMarkdown(content string) {
+	pdf := d.pdf
+	inCode := false
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+
+		if inCode {
+			pdf.SetFont("Courier", "", 9.5)
+			pdf.SetFillColor(246, 248, 250)
+			pdf.MultiCell(0, 4.8, d.tr(line), "", "L", true)
+			continue
+		}
+
+		if trimmed == "" {
+			pdf.Ln(2)
+			continue
+		}
+
+		if match := headingLine.FindStringSubmatch(trimmed); match != nil {
+			sizes := []float64{18, 15, 13, 12, 11, 11}
+			size := sizes[len(match[1])-1]
+			pdf.Ln(2)
+			pdf.SetFont("Helvetica", "B", size)
+			pdf.MultiCell(0, size*0.5, d.tr(plainText(match[2])), "", "L", false)
+			pdf.Ln(1)
+			continue
+		}
+
+		pdf.SetFont("Helvetica", "", 11)
+
+		if strings.HasPrefix(trimmed, ">") {
+			pdf.SetTextColor(100, 100, 100)
+			pdf.MultiCell(0, pdfLineHeight, d.tr("    "+plainText(strings.TrimSpace(strings.TrimLeft(trimmed, ">")))), "", "L", false)
+			pdf.SetTextColor(30, 30, 30)
+			continue
+		}
+
+		if match := listLine.FindStringSubmatch(line); match != nil {
+			marker := "•"
+			if match[2] != "-" && match[2] != "*" && match[2] != "+" {
+				marker = match[2]
+			}
+			text := match[3]
+			if task := taskListLine.FindStringSubmatch(text); task != nil {
+				marker = "[ ]"
+				if task[1] != " " {
+					marker = "[x]"
+				}
+				text = task[2]
+			}
+			indent := strings.Repeat("    ", len(match[1])/2+1)
+			pdf.MultiCell(0, pdfLineHeight, d.tr(indent+marker+" "+plainText(text)), "", "L", false)
+			continue
+		}
+
+		pdf.MultiCell(0, pdfLineHeight, d.tr(plainText(trimmed)), "", "L", false)
+	}
+
+	pdf.Ln(2)
+}
+
+var (
+	imagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	linkPattern  = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	emphasis     = []*regexp.Regexp{
+		regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`),
+		regexp.MustCompile(`__(\S(?:.*?\S)?)__`),
+		regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`),
+		regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`),
+		regexp.MustCompile(`\b_(\S(?:.*?\S)?)_\b`),
+		regexp.MustCompile("`([^`]+)`"),
+	}
+	htmlTag       = regexp.MustCompile(`<[^>]+>`)
+	escapedSymbol = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!~])`)
+)
+
+// plainText strips inline Markdown so it can be printed as-is
+func plainText(s string) string {
+	s = imagePattern.ReplaceAllString(s, "[image: $1]")
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		match := linkPattern.FindStringSubmatch(m)
+		if match[1] == match[2] {
+			return match[1]
+		}
+		return match[1] + " (" + match[2] + ")"
+	})
+	for _, pattern := range emphasis {
+		s = pattern.ReplaceAllString(s, "$1")
+	}
+	s = htmlTag.ReplaceAllString(s, "")
+	return escapedSymbol.ReplaceAllString(s, "$1")
+}
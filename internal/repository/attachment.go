@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AttachmentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAttachmentRepository(db *mongo.Database) *AttachmentRepository {
+	return &AttachmentRepository{
+		collection: db.Collection("attachments"),
+	}
+}
+
+// Create stores the metadata of an attachment. The ID is expected to be set
+// by the caller because it is part of the storage key.
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	if attachment.ID.IsZero() {
+		attachment.ID = primitive.NewObjectID()
+	}
+	attachment.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, attachment)
+	return err
+}
+
+func (r *AttachmentRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// FindByIDForDownload looks an attachment up without an owner; callers must
+// have verified a signed download link first
+func (r *AttachmentRepository) FindByIDForDownload(ctx context.Context, id primitive.ObjectID) (*models.Attachment, error) {
+	var attachment models.Attachment
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+func (r *AttachmentRepository) FindByUserID(ctx context.Context, userID string) ([]models.Attachment, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var attachments []models.Attachment
+	if err := cursor.All(ctx, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (r *AttachmentRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// TotalSize sums the size of all attachments of a user
+func (r *AttachmentRepository) TotalSize(ctx context.Context, userID string) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].Total, nil
+}
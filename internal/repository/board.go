@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BoardRepository struct {
+	collection *mongo.Collection
+}
+
+func NewBoardRepository(db *mongo.Database) *BoardRepository {
+	return &BoardRepository{
+		collection: db.Collection("boards"),
+	}
+}
+
+func (r *BoardRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("user_created"),
+	})
+	return err
+}
+
+func (r *BoardRepository) Create(ctx context.Context, board *models.Board) error {
+	board.ID = primitive.NewObjectID()
+	board.CreatedAt = time.Now()
+	board.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, board)
+	return err
+}
+
+func (r *BoardRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Board, error) {
+	var board models.Board
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&board)
+	if err != nil {
+		return nil, err
+	}
+
+	return &board, nil
+}
+
+// FindByUserID lists a user's boards, oldest first
+func (r *BoardRepository) FindByUserID(ctx context.Context, userID string) ([]models.Board, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var boards []models.Board
+	if err := cursor.All(ctx, &boards); err != nil {
+		return nil, err
+	}
+
+	return boards, nil
+}
+
+func (r *BoardRepository) CountByUserID(ctx context.Context, userID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// Update applies set and unset to a board
+func (r *BoardRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
+	set["updated_at"] = time.Now()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *BoardRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CollaboratorRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCollaboratorRepository(db *mongo.Database) *CollaboratorRepository {
+	return &CollaboratorRepository{
+		collection: db.Collection("collaborators"),
+	}
+}
+
+// EnsureIndexes gives a user at most one role per item and serves the
+// "shared with me" listing
+func (r *CollaboratorRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "resource_type", Value: 1},
+				{Key: "resource_id", Value: 1},
+				{Key: "user_id", Value: 1},
+			},
+			Options: options.Index().SetName("resource_user").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("user_created"),
+		},
+	})
+	return err
+}
+
+// Upsert grants a user a role on an item, replacing the role they had, and
+// returns the stored grant
+func (r *CollaboratorRepository) Upsert(ctx context.Context, collaborator *models.Collaborator) (*models.Collaborator, error) {
+	now := time.Now()
+	filter := bson.M{
+		"resource_type": collaborator.ResourceType,
+		"resource_id":   collaborator.ResourceID,
+		"user_id":       collaborator.UserID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"owner_id":   collaborator.OwnerID,
+			"email":      collaborator.Email,
+			"role":       collaborator.Role,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var stored models.Collaborator
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost the race against a concurrent grant to the same user
+		err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// UpdateRole changes the role of an existing grant and returns it
+func (r *CollaboratorRepository) UpdateRole(ctx context.Context, resourceType string, resourceID primitive.ObjectID, userID, role string) (*models.Collaborator, error) {
+	filter := bson.M{"resource_type": resourceType, "resource_id": resourceID, "user_id": userID}
+	update := bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var collaborator models.Collaborator
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&collaborator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &collaborator, nil
+}
+
+// FindRoles lists the grants of a user on any of the given items of one type
+// or the other; used to resolve a note's role together with its group's
+func (r *CollaboratorRepository) FindRoles(ctx context.Context, userID string, resources map[string]primitive.ObjectID) ([]models.Collaborator, error) {
+	var items bson.A
+	for resourceType, resourceID := range resources {
+		items = append(items, bson.M{"resource_type": resourceType, "resource_id": resourceID})
+	}
+	filter := bson.M{"user_id": userID, "$or": items}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var collaborators []models.Collaborator
+	if err := cursor.All(ctx, &collaborators); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// FindByResource lists who an item is shared with, oldest grant first
+func (r *CollaboratorRepository) FindByResource(ctx context.Context, resourceType string, resourceID primitive.ObjectID) ([]models.Collaborator, error) {
+	filter := bson.M{"resource_type": resourceType, "resource_id": resourceID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var collaborators []models.Collaborator
+	if err := cursor.All(ctx, &collaborators); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// FindByUserID lists what is shared with a user, newest first
+func (r *CollaboratorRepository) FindByUserID(ctx context.Context, userID string) ([]models.Collaborator, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var collaborators []models.Collaborator
+	if err := cursor.All(ctx, &collaborators); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+func (r *CollaboratorRepository) Delete(ctx context.Context, resourceType string, resourceID primitive.ObjectID, userID string) error {
+	filter := bson.M{"resource_type": resourceType, "resource_id": resourceID, "user_id": userID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteForResource revokes every grant on a deleted item
+func (r *CollaboratorRepository) DeleteForResource(ctx context.Context, resourceType string, resourceID primitive.ObjectID) error {
+	filter := bson.M{"resource_type": resourceType, "resource_id": resourceID}
+
+	_, err := r.collection.DeleteMany(ctx, filter)
+	return err
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCommentRepository(db *mongo.Database) *CommentRepository {
+	return &CommentRepository{
+		collection: db.Collection("comments"),
+	}
+}
+
+// EnsureIndexes serves listing a note's comments in order
+func (r *CommentRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "note_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("note_created"),
+	})
+	return err
+}
+
+// commentScope is the base filter for the comments of a note a principal may
+// perform an action on
+func commentScope(p authz.Principal, action authz.Action, noteID primitive.ObjectID) (bson.M, error) {
+	if !p.Can(action) {
+		return nil, authz.ErrForbidden
+	}
+	return bson.M{"owner_id": p.OwnerID, "note_id": noteID}, nil
+}
+
+func (r *CommentRepository) Create(ctx context.Context, p authz.Principal, comment *models.Comment) error {
+	if !p.Can(authz.ActionComment) {
+		return authz.ErrForbidden
+	}
+
+	comment.ID = primitive.NewObjectID()
+	comment.OwnerID = p.OwnerID
+	comment.UserID = p.UserID
+	comment.CreatedAt = time.Now()
+	comment.UpdatedAt = time.Now()
+	if comment.Mentions == nil {
+		comment.Mentions = []models.CommentMention{}
+	}
+	if comment.History == nil {
+		comment.History = []models.CommentEdit{}
+	}
+
+	_, err := r.collection.InsertOne(ctx, comment)
+	return err
+}
+
+func (r *CommentRepository) FindByID(ctx context.Context, id, noteID primitive.ObjectID, p authz.Principal) (*models.Comment, error) {
+	filter, err := commentScope(p, authz.ActionView, noteID)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+
+	var comment models.Comment
+	err = r.collection.FindOne(ctx, filter).Decode(&comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// FindByNote lists every comment of a note, oldest first
+func (r *CommentRepository) FindByNote(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) ([]models.Comment, error) {
+	filter, err := commentScope(p, authz.ActionView, noteID)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// Edit replaces the body of a comment written by the principal, appending the
+// previous body to its history in the same write
+func (r *CommentRepository) Edit(ctx context.Context, id, noteID primitive.ObjectID, p authz.Principal, body string, mentions []models.CommentMention) (*models.Comment, error) {
+	filter, err := commentScope(p, authz.ActionComment, noteID)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+	filter["user_id"] = p.UserID
+
+	now := time.Now()
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"history": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$history", bson.A{}}},
+				bson.A{bson.M{"body": "$body", "edited_at": now}},
+			}},
+			"body":       body,
+			"mentions":   mentions,
+			"edited_at":  now,
+			"updated_at": now,
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var comment models.Comment
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// SetResolved resolves or reopens the thread started by a comment
+func (r *CommentRepository) SetResolved(ctx context.Context, id, noteID primitive.ObjectID, p authz.Principal, resolved bool) (*models.Comment, error) {
+	filter, err := commentScope(p, authz.ActionComment, noteID)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+	filter["parent_id"] = bson.M{"$exists": false}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"resolved": resolved, "updated_at": now}}
+	if resolved {
+		update["$set"].(bson.M)["resolved_by"] = p.UserID
+		update["$set"].(bson.M)["resolved_at"] = now
+	} else {
+		update["$unset"] = bson.M{"resolved_by": "", "resolved_at": ""}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var comment models.Comment
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// Delete removes a comment together with the replies to it. Principals that
+// may not manage the note only delete their own comments.
+func (r *CommentRepository) Delete(ctx context.Context, id, noteID primitive.ObjectID, p authz.Principal) error {
+	filter, err := commentScope(p, authz.ActionComment, noteID)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
+	if !p.Can(authz.ActionManage) {
+		filter["user_id"] = p.UserID
+	}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	_, err = r.collection.DeleteMany(ctx, bson.M{"note_id": noteID, "parent_id": id})
+	return err
+}
+
+// SyncOrphans marks the comments anchored to blocks a note no longer has as
+// orphaned, and clears the mark of those whose block is back
+func (r *CommentRepository) SyncOrphans(ctx context.Context, noteID primitive.ObjectID, blockIDs []string) error {
+	now := time.Now()
+
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"note_id": noteID, "orphaned": false, "block_id": bson.M{"$exists": true, "$nin": blockIDs}},
+		bson.M{"$set": bson.M{"orphaned": true, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"note_id": noteID, "orphaned": true, "block_id": bson.M{"$in": blockIDs}},
+		bson.M{"$set": bson.M{"orphaned": false, "updated_at": now}},
+	)
+	return err
+}
+
+// MoveToNote carries the comments of blocks moved to another note along
+func (r *CommentRepository) MoveToNote(ctx context.Context, fromNoteID, toNoteID primitive.ObjectID, ownerID string, blockIDs []string) error {
+	filter := bson.M{"note_id": fromNoteID, "block_id": bson.M{"$in": blockIDs}}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var roots []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &roots); err != nil {
+		return err
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	ids := make(bson.A, 0, len(roots))
+	for _, root := range roots {
+		ids = append(ids, root.ID)
+	}
+
+	// Replies follow their thread even though they carry no block of their own
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"note_id": fromNoteID, "$or": bson.A{
+			bson.M{"_id": bson.M{"$in": ids}},
+			bson.M{"parent_id": bson.M{"$in": ids}},
+		}},
+		bson.M{"$set": bson.M{"note_id": toNoteID, "owner_id": ownerID, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteForNote drops the comments of a deleted note
+func (r *CommentRepository) DeleteForNote(ctx context.Context, noteID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"note_id": noteID})
+	return err
+}
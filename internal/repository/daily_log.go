@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DailyLogRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDailyLogRepository(db *mongo.Database) *DailyLogRepository {
+	return &DailyLogRepository{
+		collection: db.Collection("daily_logs"),
+	}
+}
+
+// EnsureIndexes makes sure a user has at most one log per day and that date
+// range queries are served by an index
+func (r *DailyLogRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("user_date").SetUnique(true),
+	})
+	return err
+}
+
+func (r *DailyLogRepository) FindByDate(ctx context.Context, userID, date string) (*models.DailyLog, error) {
+	var log models.DailyLog
+	filter := bson.M{"user_id": userID, "date": date}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+// FindRange lists the logs of a user between two yyyy-mm-dd dates
+// (inclusive), oldest first. An empty from has no lower bound.
+func (r *DailyLogRepository) FindRange(ctx context.Context, userID, from, to string) ([]models.DailyLog, error) {
+	dates := bson.M{"$lte": to}
+	if from != "" {
+		dates["$gte"] = from
+	}
+	filter := bson.M{"user_id": userID, "date": dates}
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []models.DailyLog
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// Upsert applies set and unset to the log of a day, creating the log if the
+// day has none yet, and returns the stored log
+func (r *DailyLogRepository) Upsert(ctx context.Context, userID, date string, set, unset bson.M) (*models.DailyLog, error) {
+	now := time.Now()
+	set["updated_at"] = now
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": now,
+		},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"user_id": userID, "date": date}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var log models.DailyLog
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&log)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost the race against a concurrent insert of the same day; the
+		// log exists now so the update applies to it
+		err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&log)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+func (r *DailyLogRepository) Delete(ctx context.Context, userID, date string) error {
+	filter := bson.M{"user_id": userID, "date": date}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RemoveHabit drops the values of a deleted habit from all logs of the user
+func (r *DailyLogRepository) RemoveHabit(ctx context.Context, userID, habitID string) error {
+	filter := bson.M{"user_id": userID, "habits." + habitID: bson.M{"$exists": true}}
+	update := bson.M{"$unset": bson.M{"habits." + habitID: ""}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
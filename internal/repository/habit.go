@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type HabitRepository struct {
+	collection *mongo.Collection
+}
+
+func NewHabitRepository(db *mongo.Database) *HabitRepository {
+	return &HabitRepository{
+		collection: db.Collection("habits"),
+	}
+}
+
+func (r *HabitRepository) Create(ctx context.Context, habit *models.Habit) error {
+	habit.ID = primitive.NewObjectID()
+	habit.CreatedAt = time.Now()
+	habit.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, habit)
+	return err
+}
+
+func (r *HabitRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Habit, error) {
+	var habit models.Habit
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&habit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &habit, nil
+}
+
+func (r *HabitRepository) FindByUserID(ctx context.Context, userID string) ([]models.Habit, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var habits []models.Habit
+	if err := cursor.All(ctx, &habits); err != nil {
+		return nil, err
+	}
+
+	return habits, nil
+}
+
+func (r *HabitRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, update bson.M) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	update["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *HabitRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LockRepository keeps the documents transactions write to when they must
+// not run side by side, apart from the documents users see. A lock
+// document only carries a counter; writing it is what takes the lock.
+type LockRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLockRepository(db *mongo.Database) *LockRepository {
+	return &LockRepository{
+		collection: db.Collection("locks"),
+	}
+}
+
+// Lock writes to the lock document of scope inside the transaction of ctx.
+// Two transactions locking the same scope then conflict, and the one that
+// retries reads again what the lock guards.
+func (r *LockRepository) Lock(ctx context.Context, scope string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": scope},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
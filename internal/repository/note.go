@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"regexp"
 	"time"
 
+	"backend-journaling/internal/authz"
 	"backend-journaling/internal/models"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,6 +15,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrVersionConflict is returned when a note's blocks were changed by another
+// writer between reading the note and saving it
+var ErrVersionConflict = errors.New("note was modified concurrently")
+
 type NoteRepository struct {
 	collection *mongo.Collection
 }
@@ -38,11 +45,29 @@ func (r *NoteRepository) Create(ctx context.Context, note *models.Note) error {
 	return err
 }
 
-func (r *NoteRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Note, error) {
+func (r *NoteRepository) FindByID(ctx context.Context, id primitive.ObjectID, p authz.Principal) (*models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+
 	var note models.Note
-	filter := bson.M{"_id": id, "user_id": userID}
+	err = r.collection.FindOne(ctx, filter).Decode(&note)
+	if err != nil {
+		return nil, err
+	}
 
-	err := r.collection.FindOne(ctx, filter).Decode(&note)
+	return &note, nil
+}
+
+// FindForAccess loads only the owner and group of a note, whoever owns it.
+// It exists to resolve a principal and must not be used to return notes.
+func (r *NoteRepository) FindForAccess(ctx context.Context, id primitive.ObjectID) (*models.Note, error) {
+	var note models.Note
+	opts := options.FindOne().SetProjection(bson.M{"user_id": 1, "group_id": 1})
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&note)
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +75,11 @@ func (r *NoteRepository) FindByID(ctx context.Context, id primitive.ObjectID, us
 	return &note, nil
 }
 
-func (r *NoteRepository) FindByUserID(ctx context.Context, userID string) ([]models.Note, error) {
-	filter := bson.M{"user_id": userID}
+func (r *NoteRepository) FindByUserID(ctx context.Context, p authz.Principal) ([]models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
 	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
@@ -68,8 +96,53 @@ func (r *NoteRepository) FindByUserID(ctx context.Context, userID string) ([]mod
 	return notes, nil
 }
 
-func (r *NoteRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, update bson.M) error {
-	filter := bson.M{"_id": id, "user_id": userID}
+// FindByTitle finds the most recently updated note of a user whose title
+// matches case-insensitively
+func (r *NoteRepository) FindByTitle(ctx context.Context, p authz.Principal, title string) (*models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["title"] = bson.M{"$regex": "^" + regexp.QuoteMeta(title) + "$", "$options": "i"}
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	var note models.Note
+	err = r.collection.FindOne(ctx, filter, opts).Decode(&note)
+	if err != nil {
+		return nil, err
+	}
+
+	return &note, nil
+}
+
+// FindByIDs finds the notes of a user among the given IDs
+func (r *NoteRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID, p authz.Principal) ([]models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = bson.M{"$in": ids}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notes []models.Note
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (r *NoteRepository) Update(ctx context.Context, id primitive.ObjectID, p authz.Principal, update bson.M) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
 	update["updated_at"] = time.Now()
 
 	updateDoc := bson.M{"$set": update}
@@ -85,8 +158,13 @@ func (r *NoteRepository) Update(ctx context.Context, id primitive.ObjectID, user
 	return nil
 }
 
-func (r *NoteRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
-	filter := bson.M{"_id": id, "user_id": userID}
+func (r *NoteRepository) Delete(ctx context.Context, id primitive.ObjectID, p authz.Principal) error {
+	filter, err := scope(p, authz.ActionManage)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
+
 	result, err := r.collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
@@ -99,11 +177,16 @@ func (r *NoteRepository) Delete(ctx context.Context, id primitive.ObjectID, user
 	return nil
 }
 
-func (r *NoteRepository) AddBlock(ctx context.Context, id primitive.ObjectID, userID string, block models.Block) error {
-	filter := bson.M{"_id": id, "user_id": userID}
+func (r *NoteRepository) AddBlock(ctx context.Context, id primitive.ObjectID, p authz.Principal, block models.Block) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
 	update := bson.M{
 		"$push": bson.M{"blocks": block},
 		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"version": 1},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -118,14 +201,18 @@ func (r *NoteRepository) AddBlock(ctx context.Context, id primitive.ObjectID, us
 	return nil
 }
 
-func (r *NoteRepository) UpdateBlock(ctx context.Context, noteID primitive.ObjectID, userID, blockID string, updateData bson.M) error {
-	filter := bson.M{
-		"_id":       noteID,
-		"user_id":   userID,
-		"blocks.id": blockID,
+func (r *NoteRepository) UpdateBlock(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, blockID string, updateData bson.M) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
 	}
+	filter["_id"] = noteID
+	filter["blocks.id"] = blockID
 
-	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	update := bson.M{
+		"$set": bson.M{"updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
 	for key, value := range updateData {
 		update["$set"].(bson.M)["blocks.$."+key] = value
 	}
@@ -142,11 +229,16 @@ func (r *NoteRepository) UpdateBlock(ctx context.Context, noteID primitive.Objec
 	return nil
 }
 
-func (r *NoteRepository) DeleteBlock(ctx context.Context, noteID primitive.ObjectID, userID, blockID string) error {
-	filter := bson.M{"_id": noteID, "user_id": userID}
+func (r *NoteRepository) DeleteBlock(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, blockID string) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = noteID
 	update := bson.M{
 		"$pull": bson.M{"blocks": bson.M{"id": blockID}},
 		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"version": 1},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -161,13 +253,23 @@ func (r *NoteRepository) DeleteBlock(ctx context.Context, noteID primitive.Objec
 	return nil
 }
 
-func (r *NoteRepository) ReorderBlocks(ctx context.Context, noteID primitive.ObjectID, userID string, blocks []models.Block) error {
-	filter := bson.M{"_id": noteID, "user_id": userID}
+// ReplaceBlocks overwrites the whole block list, but only if the note is still
+// at the given version. Every block write bumps the version, so a caller that
+// read the note before a concurrent change gets ErrVersionConflict and can
+// retry against the fresh state.
+func (r *NoteRepository) ReplaceBlocks(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, version int64, blocks []models.Block) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = noteID
+	filter["version"] = versionMatch(version)
 	update := bson.M{
 		"$set": bson.M{
 			"blocks":     blocks,
 			"updated_at": time.Now(),
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -176,8 +278,123 @@ func (r *NoteRepository) ReorderBlocks(ctx context.Context, noteID primitive.Obj
 	}
 
 	if result.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
+		count, err := r.collection.CountDocuments(ctx, bson.M{"_id": noteID, "user_id": p.OwnerID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return ErrVersionConflict
 	}
 
 	return nil
 }
+
+// WithTransaction runs fn inside a MongoDB transaction so that writes to
+// several notes commit or roll back together. fn must use the context it is
+// given. Transactions require MongoDB to run as a replica set.
+func (r *NoteRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTransaction(ctx, r.collection.Database().Client(), fn)
+}
+
+// versionMatch builds the filter value for a note version. Notes written
+// before versioning was introduced have no version field and read back as 0.
+func versionMatch(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// EnsureJournalIndex makes sure a user cannot get two journal entries for the
+// same day, even when two requests create the entry at the same time
+func (r *NoteRepository) EnsureJournalIndex(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "journal_date", Value: 1}},
+		Options: options.Index().
+			SetName("user_journal_date").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"journal_date": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+func (r *NoteRepository) FindByJournalDate(ctx context.Context, p authz.Principal, date string) (*models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["journal_date"] = date
+
+	var note models.Note
+	err = r.collection.FindOne(ctx, filter).Decode(&note)
+	if err != nil {
+		return nil, err
+	}
+
+	return &note, nil
+}
+
+// CreateJournalEntry inserts the journal entry for note.JournalDate unless the
+// day already has one, and returns the stored entry either way
+func (r *NoteRepository) CreateJournalEntry(ctx context.Context, note *models.Note) (*models.Note, error) {
+	now := time.Now()
+	if note.Blocks == nil {
+		note.Blocks = []models.Block{}
+	}
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+
+	filter := bson.M{"user_id": note.UserID, "journal_date": *note.JournalDate}
+	update := bson.M{"$setOnInsert": bson.M{
+		"_id":        primitive.NewObjectID(),
+		"title":      note.Title,
+		"blocks":     note.Blocks,
+		"tags":       note.Tags,
+		"is_pinned":  false,
+		"version":    0,
+		"created_at": now,
+		"updated_at": now,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var stored models.Note
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost the race against a concurrent insert of the same day
+		return r.FindByJournalDate(ctx, authz.Owner(note.UserID), *note.JournalDate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// FindJournalEntries lists the journal entries of a user between two dates
+// (inclusive), oldest first, without their blocks
+func (r *NoteRepository) FindJournalEntries(ctx context.Context, p authz.Principal, from, to string) ([]models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["journal_date"] = bson.M{"$gte": from, "$lte": to}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "journal_date", Value: 1}}).
+		SetProjection(bson.M{"blocks": 0})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notes []models.Note
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
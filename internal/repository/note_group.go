@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"backend-journaling/internal/authz"
 	"backend-journaling/internal/models"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -35,12 +36,30 @@ func (r *NoteGroupRepository) Create(ctx context.Context, group *models.NoteGrou
 	return err
 }
 
-// FindByID finds a note group by ID for a specific user
-func (r *NoteGroupRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.NoteGroup, error) {
+// FindByID finds a note group by ID for a principal
+func (r *NoteGroupRepository) FindByID(ctx context.Context, id primitive.ObjectID, p authz.Principal) (*models.NoteGroup, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = id
+
 	var group models.NoteGroup
-	filter := bson.M{"_id": id, "user_id": userID}
+	err = r.collection.FindOne(ctx, filter).Decode(&group)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
 
-	err := r.collection.FindOne(ctx, filter).Decode(&group)
+// FindForAccess loads only the owner of a group, whoever owns it. It exists
+// to resolve a principal and must not be used to return groups.
+func (r *NoteGroupRepository) FindForAccess(ctx context.Context, id primitive.ObjectID) (*models.NoteGroup, error) {
+	var group models.NoteGroup
+	opts := options.FindOne().SetProjection(bson.M{"user_id": 1})
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&group)
 	if err != nil {
 		return nil, err
 	}
@@ -48,9 +67,12 @@ func (r *NoteGroupRepository) FindByID(ctx context.Context, id primitive.ObjectI
 	return &group, nil
 }
 
-// FindAll finds all note groups for a user with optional filters
-func (r *NoteGroupRepository) FindAll(ctx context.Context, userID string, isPinned *bool, isArchived *bool) ([]*models.NoteGroup, error) {
-	filter := bson.M{"user_id": userID}
+// FindAll finds all note groups of a principal's owner with optional filters
+func (r *NoteGroupRepository) FindAll(ctx context.Context, p authz.Principal, isPinned *bool, isArchived *bool) ([]*models.NoteGroup, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
 
 	if isPinned != nil {
 		filter["is_pinned"] = *isPinned
@@ -80,10 +102,13 @@ func (r *NoteGroupRepository) FindAll(ctx context.Context, userID string, isPinn
 }
 
 // Update updates a note group
-func (r *NoteGroupRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, updates bson.M) error {
+func (r *NoteGroupRepository) Update(ctx context.Context, id primitive.ObjectID, p authz.Principal, updates bson.M) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
 	updates["updated_at"] = time.Now()
-
-	filter := bson.M{"_id": id, "user_id": userID}
 	update := bson.M{"$set": updates}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -99,8 +124,12 @@ func (r *NoteGroupRepository) Update(ctx context.Context, id primitive.ObjectID,
 }
 
 // Delete deletes a note group
-func (r *NoteGroupRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
-	filter := bson.M{"_id": id, "user_id": userID}
+func (r *NoteGroupRepository) Delete(ctx context.Context, id primitive.ObjectID, p authz.Principal) error {
+	filter, err := scope(p, authz.ActionManage)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = id
 
 	result, err := r.collection.DeleteOne(ctx, filter)
 	if err != nil {
@@ -115,7 +144,12 @@ func (r *NoteGroupRepository) Delete(ctx context.Context, id primitive.ObjectID,
 }
 
 // AddNoteToGroup adds a note to a group
-func (r *NoteGroupRepository) AddNoteToGroup(ctx context.Context, noteID primitive.ObjectID, groupID primitive.ObjectID, userID string) error {
+func (r *NoteGroupRepository) AddNoteToGroup(ctx context.Context, noteID primitive.ObjectID, groupID primitive.ObjectID, p authz.Principal) error {
+	if !p.Can(authz.ActionManage) {
+		return authz.ErrForbidden
+	}
+	userID := p.OwnerID
+
 	// Update note with group_id
 	noteFilter := bson.M{"_id": noteID, "user_id": userID}
 	noteUpdate := bson.M{
@@ -146,7 +180,12 @@ func (r *NoteGroupRepository) AddNoteToGroup(ctx context.Context, noteID primiti
 }
 
 // RemoveNoteFromGroup removes a note from a group
-func (r *NoteGroupRepository) RemoveNoteFromGroup(ctx context.Context, noteID primitive.ObjectID, userID string) error {
+func (r *NoteGroupRepository) RemoveNoteFromGroup(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) error {
+	if !p.Can(authz.ActionManage) {
+		return authz.ErrForbidden
+	}
+	userID := p.OwnerID
+
 	// Get current note to check if it has a group
 	var note models.Note
 	noteFilter := bson.M{"_id": noteID, "user_id": userID}
@@ -186,7 +225,12 @@ func (r *NoteGroupRepository) RemoveNoteFromGroup(ctx context.Context, noteID pr
 }
 
 // MoveNotesToGroup moves multiple notes to a different group
-func (r *NoteGroupRepository) MoveNotesToGroup(ctx context.Context, noteIDs []primitive.ObjectID, newGroupID primitive.ObjectID, userID string) error {
+func (r *NoteGroupRepository) MoveNotesToGroup(ctx context.Context, noteIDs []primitive.ObjectID, newGroupID primitive.ObjectID, p authz.Principal) error {
+	if !p.Can(authz.ActionManage) {
+		return authz.ErrForbidden
+	}
+	userID := p.OwnerID
+
 	// Get all notes to calculate old groups
 	notesFilter := bson.M{
 		"_id":     bson.M{"$in": noteIDs},
@@ -247,22 +291,23 @@ func (r *NoteGroupRepository) MoveNotesToGroup(ctx context.Context, noteIDs []pr
 }
 
 // CountNotesInGroup counts notes in a group
-func (r *NoteGroupRepository) CountNotesInGroup(ctx context.Context, groupID primitive.ObjectID, userID string) (int64, error) {
-	filter := bson.M{
-		"group_id": groupID,
-		"user_id":  userID,
+func (r *NoteGroupRepository) CountNotesInGroup(ctx context.Context, groupID primitive.ObjectID, p authz.Principal) (int64, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return 0, err
 	}
+	filter["group_id"] = groupID
 
-	count, err := r.noteCollection.CountDocuments(ctx, filter)
-	return count, err
+	return r.noteCollection.CountDocuments(ctx, filter)
 }
 
 // GetNotesInGroup gets all notes in a group
-func (r *NoteGroupRepository) GetNotesInGroup(ctx context.Context, groupID primitive.ObjectID, userID string) ([]*models.Note, error) {
-	filter := bson.M{
-		"group_id": groupID,
-		"user_id":  userID,
+func (r *NoteGroupRepository) GetNotesInGroup(ctx context.Context, groupID primitive.ObjectID, p authz.Principal) ([]*models.Note, error) {
+	filter, err := scope(p, authz.ActionView)
+	if err != nil {
+		return nil, err
 	}
+	filter["group_id"] = groupID
 
 	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
 
@@ -281,13 +326,18 @@ func (r *NoteGroupRepository) GetNotesInGroup(ctx context.Context, groupID primi
 }
 
 // RecalculateNotesCount recalculates the notes_count for a group
-func (r *NoteGroupRepository) RecalculateNotesCount(ctx context.Context, groupID primitive.ObjectID, userID string) error {
-	count, err := r.CountNotesInGroup(ctx, groupID, userID)
+func (r *NoteGroupRepository) RecalculateNotesCount(ctx context.Context, groupID primitive.ObjectID, p authz.Principal) error {
+	filter, err := scope(p, authz.ActionEdit)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = groupID
+
+	count, err := r.CountNotesInGroup(ctx, groupID, p)
 	if err != nil {
 		return err
 	}
 
-	filter := bson.M{"_id": groupID, "user_id": userID}
 	update := bson.M{
 		"$set": bson.M{
 			"notes_count": count,
@@ -300,17 +350,18 @@ func (r *NoteGroupRepository) RecalculateNotesCount(ctx context.Context, groupID
 }
 
 // RemoveGroupFromAllNotes removes group_id from all notes in a specific group
-func (r *NoteGroupRepository) RemoveGroupFromAllNotes(ctx context.Context, groupID primitive.ObjectID, userID string) error {
-	filter := bson.M{
-		"group_id": groupID,
-		"user_id":  userID,
+func (r *NoteGroupRepository) RemoveGroupFromAllNotes(ctx context.Context, groupID primitive.ObjectID, p authz.Principal) error {
+	filter, err := scope(p, authz.ActionManage)
+	if err != nil {
+		return err
 	}
+	filter["group_id"] = groupID
 
 	update := bson.M{
 		"$unset": bson.M{"group_id": ""},
 		"$set":   bson.M{"updated_at": time.Now()},
 	}
 
-	_, err := r.noteCollection.UpdateMany(ctx, filter, update)
+	_, err = r.noteCollection.UpdateMany(ctx, filter, update)
 	return err
 }
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NoteLinkRepository struct {
+	collection *mongo.Collection
+}
+
+func NewNoteLinkRepository(db *mongo.Database) *NoteLinkRepository {
+	return &NoteLinkRepository{
+		collection: db.Collection("note_links"),
+	}
+}
+
+// ReplaceForNote swaps the indexed links of a note for a freshly parsed set
+func (r *NoteLinkRepository) ReplaceForNote(ctx context.Context, sourceNoteID primitive.ObjectID, userID string, links []models.NoteLink) error {
+	if err := r.DeleteForNote(ctx, sourceNoteID, userID); err != nil {
+		return err
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(links))
+	for i := range links {
+		links[i].ID = primitive.NewObjectID()
+		links[i].CreatedAt = time.Now()
+		docs[i] = links[i]
+	}
+
+	_, err := r.collection.InsertMany(ctx, docs)
+	return err
+}
+
+// DeleteForNote removes all links that originate from a note
+func (r *NoteLinkRepository) DeleteForNote(ctx context.Context, sourceNoteID primitive.ObjectID, userID string) error {
+	filter := bson.M{"source_note_id": sourceNoteID, "user_id": userID}
+	_, err := r.collection.DeleteMany(ctx, filter)
+	return err
+}
+
+// FindBySource finds the links going out of a note
+func (r *NoteLinkRepository) FindBySource(ctx context.Context, sourceNoteID primitive.ObjectID, userID string) ([]models.NoteLink, error) {
+	filter := bson.M{"source_note_id": sourceNoteID, "user_id": userID}
+	return r.find(ctx, filter)
+}
+
+// FindByTarget finds the links pointing at a note
+func (r *NoteLinkRepository) FindByTarget(ctx context.Context, targetNoteID primitive.ObjectID, userID string) ([]models.NoteLink, error) {
+	filter := bson.M{"target_note_id": targetNoteID, "user_id": userID}
+	return r.find(ctx, filter)
+}
+
+// FindDangling finds all links of a user that do not resolve to a note
+func (r *NoteLinkRepository) FindDangling(ctx context.Context, userID string) ([]models.NoteLink, error) {
+	filter := bson.M{"user_id": userID, "target_note_id": nil}
+	return r.find(ctx, filter)
+}
+
+// ResolveTitle points dangling links written as [[title]] at a note that now
+// carries that title
+func (r *NoteLinkRepository) ResolveTitle(ctx context.Context, userID, targetKey string, noteID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "target_key": targetKey, "target_note_id": nil}
+	update := bson.M{"$set": bson.M{"target_note_id": noteID}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// UnlinkTarget marks every link pointing at a note as dangling
+func (r *NoteLinkRepository) UnlinkTarget(ctx context.Context, targetNoteID primitive.ObjectID, userID string) error {
+	filter := bson.M{"target_note_id": targetNoteID, "user_id": userID}
+	update := bson.M{"$unset": bson.M{"target_note_id": ""}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *NoteLinkRepository) find(ctx context.Context, filter bson.M) ([]models.NoteLink, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var links []models.NoteLink
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NoteTemplateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewNoteTemplateRepository(db *mongo.Database) *NoteTemplateRepository {
+	return &NoteTemplateRepository{
+		collection: db.Collection("note_templates"),
+	}
+}
+
+func (r *NoteTemplateRepository) Create(ctx context.Context, template *models.NoteTemplate) error {
+	template.ID = primitive.NewObjectID()
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = time.Now()
+
+	if template.Blocks == nil {
+		template.Blocks = []models.Block{}
+	}
+	if template.Tags == nil {
+		template.Tags = []string{}
+	}
+
+	_, err := r.collection.InsertOne(ctx, template)
+	return err
+}
+
+func (r *NoteTemplateRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.NoteTemplate, error) {
+	var template models.NoteTemplate
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func (r *NoteTemplateRepository) FindByUserID(ctx context.Context, userID string) ([]models.NoteTemplate, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var templates []models.NoteTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (r *NoteTemplateRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, update bson.M) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	update["updated_at"] = time.Now()
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *NoteTemplateRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// unread matches notifications not read yet, including ones stored before
+// notifications had a read flag
+var unread = bson.M{"$ne": true}
+
+// NotificationRepository stores notifications together with a per-user
+// unread counter, moved in the same transaction as every write so reading
+// the count does not scan the inbox
+type NotificationRepository struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func NewNotificationRepository(db *mongo.Database) *NotificationRepository {
+	return &NotificationRepository{
+		collection: db.Collection("notifications"),
+		counters:   db.Collection("notification_counters"),
+	}
+}
+
+// EnsureIndexes serves listing a user's notifications and keeps an event to
+// a single notification
+func (r *NotificationRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_newest"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "read", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("user_read_newest"),
+		},
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetName("key").SetUnique(true).SetSparse(true),
+		},
+	})
+	return err
+}
+
+// Create stores an unread notification. It reports false when a
+// notification with the same key is already stored, so delivering an event
+// twice is harmless.
+func (r *NotificationRepository) Create(ctx context.Context, notification *models.Notification) (bool, error) {
+	notification.ID = primitive.NewObjectID()
+	notification.Read = false
+	notification.ReadAt = nil
+	notification.CreatedAt = time.Now()
+
+	created := false
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		inserted, err := r.insert(ctx, notification)
+		if err != nil || !inserted {
+			return err
+		}
+		created = true
+		return r.addUnread(ctx, notification.UserID, 1)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// insert stores a keyed notification through an upsert on its key, so a
+// repeated event leaves the stored one alone without raising an error that
+// would abort a surrounding transaction
+func (r *NotificationRepository) insert(ctx context.Context, notification *models.Notification) (bool, error) {
+	if notification.Key == "" {
+		_, err := r.collection.InsertOne(ctx, notification)
+		return err == nil, err
+	}
+
+	raw, err := bson.Marshal(notification)
+	if err != nil {
+		return false, err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return false, err
+	}
+	delete(fields, "key")
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"key": notification.Key},
+		bson.M{"$setOnInsert": fields},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.UpsertedCount == 1, nil
+}
+
+func (r *NotificationRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Notification, error) {
+	var notification models.Notification
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&notification)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+// FindByUserID lists up to limit notifications of a user, newest first,
+// starting after the notification before when set
+func (r *NotificationRepository) FindByUserID(ctx context.Context, userID string, unreadOnly bool, before *primitive.ObjectID, limit int64) ([]models.Notification, error) {
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read"] = unread
+	}
+	if before != nil {
+		filter["_id"] = bson.M{"$lt": *before}
+	}
+
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+}
+
+// FindAfter lists up to limit notifications of a user created after the
+// notification after, oldest first
+func (r *NotificationRepository) FindAfter(ctx context.Context, userID string, after primitive.ObjectID, limit int64) ([]models.Notification, error) {
+	filter := bson.M{"user_id": userID, "_id": bson.M{"$gt": after}}
+
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit))
+}
+
+func (r *NotificationRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Notification, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notifications []models.Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// SetRead marks a notification read or unread. It reports
+// mongo.ErrNoDocuments when the user has no such notification.
+func (r *NotificationRepository) SetRead(ctx context.Context, id primitive.ObjectID, userID string, read bool) error {
+	// Only a notification that changes state moves the counter
+	filter := bson.M{"_id": id, "user_id": userID, "read": unread}
+	if !read {
+		filter["read"] = true
+	}
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}}
+	delta := -1
+	if !read {
+		update = bson.M{"$set": bson.M{"read": false}, "$unset": bson.M{"read_at": ""}}
+		delta = 1
+	}
+
+	changed := false
+	err := r.withTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if changed = result.ModifiedCount > 0; !changed {
+			return nil
+		}
+		return r.addUnread(ctx, userID, delta)
+	})
+	if err != nil || changed {
+		return err
+	}
+
+	// Already in the requested state, or not there at all
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of a user read
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID string) error {
+	filter := bson.M{"user_id": userID, "read": unread}
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}}
+
+	return r.withTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return nil
+		}
+		return r.addUnread(ctx, userID, -int(result.ModifiedCount))
+	})
+}
+
+func (r *NotificationRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	return r.withTransaction(ctx, func(ctx context.Context) error {
+		var deleted models.Notification
+
+		err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&deleted)
+		if err != nil {
+			return err
+		}
+		if !deleted.Read {
+			return r.addUnread(ctx, userID, -1)
+		}
+		return nil
+	})
+}
+
+// UnreadCount returns the number of unread notifications of a user. The
+// counter is rebuilt from the notifications when it is missing or has
+// drifted below zero.
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	var counter struct {
+		Unread int64 `bson:"unread"`
+	}
+
+	err := r.counters.FindOne(ctx, bson.M{"_id": userID}).Decode(&counter)
+	if err == nil && counter.Unread >= 0 {
+		return counter.Unread, nil
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+
+	return r.recount(ctx, userID)
+}
+
+func (r *NotificationRepository) recount(ctx context.Context, userID string) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "read": unread})
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err = r.counters.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"unread": count}}, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// withTransaction writes a notification change and the counter move it
+// causes all or nothing, so the counter cannot drift from the inbox
+func (r *NotificationRepository) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTransaction(ctx, r.collection.Database().Client(), fn)
+}
+
+// addUnread moves the unread counter of a user; a user without a counter
+// gets one counted from their notifications
+func (r *NotificationRepository) addUnread(ctx context.Context, userID string, delta int) error {
+	result, err := r.counters.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"unread": delta}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		_, err = r.recount(ctx, userID)
+	}
+	return err
+}
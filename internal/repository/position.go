@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Placement puts a hand-ordered item at a position
+type Placement struct {
+	ID       primitive.ObjectID
+	Position string
+}
+
+// positionOrder sorts hand-ordered items; the id breaks ties between equal
+// positions left by concurrent moves
+var positionOrder = bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}
+
+// afterPosition matches the items that sort after an item
+func afterPosition(position string, id primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"position": bson.M{"$gt": position}},
+		bson.M{"position": position, "_id": bson.M{"$gt": id}},
+	}}
+}
+
+// beforePosition matches the items that sort before an item
+func beforePosition(position string, id primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"position": bson.M{"$lt": position}},
+		bson.M{"position": position, "_id": bson.M{"$lt": id}},
+	}}
+}
+
+// objectIDs keeps a nil id list from being stored as null, which $in and $nin
+// refuse
+func objectIDs(list []primitive.ObjectID) []primitive.ObjectID {
+	if list == nil {
+		return []primitive.ObjectID{}
+	}
+	return list
+}
+
+// place writes the positions of a user's items in one round trip, setting
+// set on each of them as well
+func place(ctx context.Context, collection *mongo.Collection, userID string, placements []Placement, set bson.M) error {
+	if len(placements) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(placements))
+	for _, placement := range placements {
+		fields := bson.M{"position": placement.Position, "updated_at": now}
+		for key, value := range set {
+			fields[key] = value
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": placement.ID, "user_id": userID}).
+			SetUpdate(bson.M{"$set": fields}))
+	}
+
+	_, err := collection.BulkWrite(ctx, writes)
+	return err
+}
@@ -24,12 +24,12 @@ func (r *ProfileRepository) Create(userID uuid.UUID) (*models.Profile, error) {
 	query := `
 		INSERT INTO profiles (user_id, language, theme, created_at, updated_at)
 		VALUES ($1, 'en', 'light', now(), now())
-		RETURNING id, user_id, full_name, bio, avatar, date_of_birth, gender,
+		RETURNING id, user_id, full_name, bio, avatar, avatar_attachment_id, date_of_birth, gender,
 		          phone_number, country, city, timezone, language, theme, created_at, updated_at
 	`
 	err := r.db.QueryRow(query, userID).Scan(
 		&profile.ID, &profile.UserID, &profile.FullName, &profile.Bio,
-		&profile.Avatar, &profile.DateOfBirth, &profile.Gender, &profile.PhoneNumber,
+		&profile.Avatar, &profile.AvatarAttachmentID, &profile.DateOfBirth, &profile.Gender, &profile.PhoneNumber,
 		&profile.Country, &profile.City, &profile.Timezone, &profile.Language,
 		&profile.Theme, &profile.CreatedAt, &profile.UpdatedAt,
 	)
@@ -42,13 +42,13 @@ func (r *ProfileRepository) Create(userID uuid.UUID) (*models.Profile, error) {
 func (r *ProfileRepository) FindByUserID(userID uuid.UUID) (*models.Profile, error) {
 	profile := &models.Profile{}
 	query := `
-		SELECT id, user_id, full_name, bio, avatar, date_of_birth, gender,
+		SELECT id, user_id, full_name, bio, avatar, avatar_attachment_id, date_of_birth, gender,
 		       phone_number, country, city, timezone, language, theme, created_at, updated_at
 		FROM profiles WHERE user_id = $1
 	`
 	err := r.db.QueryRow(query, userID).Scan(
 		&profile.ID, &profile.UserID, &profile.FullName, &profile.Bio,
-		&profile.Avatar, &profile.DateOfBirth, &profile.Gender, &profile.PhoneNumber,
+		&profile.Avatar, &profile.AvatarAttachmentID, &profile.DateOfBirth, &profile.Gender, &profile.PhoneNumber,
 		&profile.Country, &profile.City, &profile.Timezone, &profile.Language,
 		&profile.Theme, &profile.CreatedAt, &profile.UpdatedAt,
 	)
@@ -97,12 +97,21 @@ func (r *ProfileRepository) GetOrCreate(userID uuid.UUID) (*models.Profile, erro
 	return profile, nil
 }
 
+// UpdateAvatar sets an external avatar URL, replacing an uploaded avatar
 func (r *ProfileRepository) UpdateAvatar(userID uuid.UUID, avatarURL string) error {
-	query := `UPDATE profiles SET avatar = $1, updated_at = now() WHERE user_id = $2`
+	query := `UPDATE profiles SET avatar = $1, avatar_attachment_id = NULL, updated_at = now() WHERE user_id = $2`
 	_, err := r.db.Exec(query, avatarURL, userID)
 	return err
 }
 
+// UpdateAvatarAttachment sets an uploaded image as avatar, replacing an
+// external avatar URL
+func (r *ProfileRepository) UpdateAvatarAttachment(userID uuid.UUID, attachmentID string) error {
+	query := `UPDATE profiles SET avatar_attachment_id = $1, avatar = NULL, updated_at = now() WHERE user_id = $2`
+	_, err := r.db.Exec(query, attachmentID, userID)
+	return err
+}
+
 func (r *ProfileRepository) UpdateTheme(userID uuid.UUID, theme string) error {
 	query := `UPDATE profiles SET theme = $1, updated_at = now() WHERE user_id = $2`
 	_, err := r.db.Exec(query, theme, userID)
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReminderRepository struct {
+	collection *mongo.Collection
+}
+
+func NewReminderRepository(db *mongo.Database) *ReminderRepository {
+	return &ReminderRepository{
+		collection: db.Collection("reminders"),
+	}
+}
+
+// EnsureIndexes serves the scheduler's lookup of due reminders and the
+// lookup of an item's reminders
+func (r *ReminderRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "fire_at", Value: 1}},
+			Options: options.Index().SetName("status_fire_at"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "target_type", Value: 1},
+				{Key: "target_id", Value: 1},
+			},
+			Options: options.Index().SetName("user_target"),
+		},
+	})
+	return err
+}
+
+func (r *ReminderRepository) Create(ctx context.Context, reminder *models.Reminder) error {
+	reminder.ID = primitive.NewObjectID()
+	reminder.CreatedAt = time.Now()
+	reminder.UpdatedAt = time.Now()
+	if reminder.Delivered == nil {
+		reminder.Delivered = []string{}
+	}
+
+	_, err := r.collection.InsertOne(ctx, reminder)
+	return err
+}
+
+func (r *ReminderRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.Reminder, error) {
+	var reminder models.Reminder
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&reminder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
+
+// FindByUserID lists a user's reminders matching filter, soonest first;
+// reminders without a fire time come last
+func (r *ReminderRepository) FindByUserID(ctx context.Context, userID string, filter bson.M) ([]models.Reminder, error) {
+	query := bson.M{"user_id": userID}
+	for key, value := range filter {
+		query[key] = value
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "fire_at", Value: 1}, {Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reminders []models.Reminder
+	if err := cursor.All(ctx, &reminders); err != nil {
+		return nil, err
+	}
+
+	// MongoDB sorts a missing fire time first
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].FireAt != nil && reminders[j].FireAt == nil
+	})
+
+	return reminders, nil
+}
+
+// CountForTarget counts the reminders of a todo or task
+func (r *ReminderRepository) CountForTarget(ctx context.Context, userID, targetType string, targetID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "target_type": targetType, "target_id": targetID})
+}
+
+// FindRelative lists the reminders of a todo or task that are relative to
+// its due date
+func (r *ReminderRepository) FindRelative(ctx context.Context, userID, targetType string, targetID primitive.ObjectID) ([]models.Reminder, error) {
+	filter := bson.M{
+		"user_id":        userID,
+		"target_type":    targetType,
+		"target_id":      targetID,
+		"before_minutes": bson.M{"$exists": true},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reminders []models.Reminder
+	if err := cursor.All(ctx, &reminders); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+func (r *ReminderRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	set["updated_at"] = time.Now()
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// Retarget moves the reminders of a todo or task that are relative to its
+// due date along with it; a nil due date leaves them unscheduled. Reminders
+// whose new time is still ahead are armed again, even if they already fired.
+func (r *ReminderRepository) Retarget(ctx context.Context, userID, targetType string, targetID primitive.ObjectID, due *time.Time) error {
+	filter := bson.M{
+		"user_id":        userID,
+		"target_type":    targetType,
+		"target_id":      targetID,
+		"before_minutes": bson.M{"$exists": true},
+	}
+	now := time.Now()
+
+	if due == nil {
+		update := bson.M{
+			"$set":   bson.M{"updated_at": now},
+			"$unset": bson.M{"fire_at": ""},
+		}
+		_, err := r.collection.UpdateMany(ctx, filter, update)
+		return err
+	}
+
+	ahead := bson.M{"$gt": bson.A{"$fire_at", now}}
+	rearm := func(value, keep interface{}) bson.M {
+		return bson.M{"$cond": bson.A{ahead, value, keep}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"fire_at":    bson.M{"$subtract": bson.A{*due, bson.M{"$multiply": bson.A{"$before_minutes", 60 * 1000}}}},
+			"updated_at": now,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"status":       rearm(models.ReminderPending, "$status"),
+			"attempts":     rearm(0, "$attempts"),
+			"delivered":    rearm(bson.A{}, "$delivered"),
+			"last_error":   rearm("$$REMOVE", "$last_error"),
+			"locked_by":    rearm("$$REMOVE", "$locked_by"),
+			"locked_until": rearm("$$REMOVE", "$locked_until"),
+		}}},
+	}
+
+	_, err := r.collection.UpdateMany(ctx, filter, pipeline)
+	return err
+}
+
+func (r *ReminderRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteForTarget removes the reminders of a deleted todo or task
+func (r *ReminderRepository) DeleteForTarget(ctx context.Context, userID, targetType string, targetID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "target_type": targetType, "target_id": targetID})
+	return err
+}
+
+// Claim leases the earliest due reminder to owner until the lease runs out.
+// Claiming is atomic, so each firing goes to a single server instance; a
+// reminder whose lease expired, e.g. because its instance stopped, is
+// claimed again. It returns mongo.ErrNoDocuments when nothing is due.
+func (r *ReminderRepository) Claim(ctx context.Context, owner string, now time.Time, lease time.Duration) (*models.Reminder, error) {
+	filter := bson.M{
+		"fire_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"status": models.ReminderPending},
+			bson.M{"status": models.ReminderSending, "locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":       models.ReminderSending,
+		"locked_by":    owner,
+		"locked_until": now.Add(lease),
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "fire_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var reminder models.Reminder
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&reminder); err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
+
+// Renew extends owner's lease on a reminder to lease from now. It reports
+// false when the lease was lost.
+func (r *ReminderRepository) Renew(ctx context.Context, id primitive.ObjectID, owner string, lease time.Duration) (bool, error) {
+	filter := bson.M{"_id": id, "status": models.ReminderSending, "locked_by": owner}
+	update := bson.M{"$set": bson.M{"locked_until": time.Now().Add(lease)}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// RecordDelivery notes that a channel got the current firing of a reminder
+// leased to owner. It reports false when the lease was lost.
+func (r *ReminderRepository) RecordDelivery(ctx context.Context, id primitive.ObjectID, owner, channel string) (bool, error) {
+	filter := bson.M{"_id": id, "status": models.ReminderSending, "locked_by": owner}
+	update := bson.M{"$addToSet": bson.M{"delivered": channel}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// Release ends owner's lease on a reminder and applies set. It reports false
+// when the lease was lost, e.g. because the reminder was changed meanwhile.
+func (r *ReminderRepository) Release(ctx context.Context, id primitive.ObjectID, owner string, set, unset bson.M) (bool, error) {
+	filter := bson.M{"_id": id, "status": models.ReminderSending, "locked_by": owner}
+	set["updated_at"] = time.Now()
+	if unset == nil {
+		unset = bson.M{}
+	}
+	unset["locked_by"] = ""
+	unset["locked_until"] = ""
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"backend-journaling/internal/authz"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scope is the base filter for the items a principal may perform an action
+// on. Callers add the item's own criteria to it.
+func scope(p authz.Principal, action authz.Action) (bson.M, error) {
+	if !p.Can(action) {
+		return nil, authz.ErrForbidden
+	}
+	return bson.M{"user_id": p.OwnerID}, nil
+}
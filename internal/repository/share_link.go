@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ShareLinkRepository struct {
+	collection *mongo.Collection
+}
+
+func NewShareLinkRepository(db *mongo.Database) *ShareLinkRepository {
+	return &ShareLinkRepository{
+		collection: db.Collection("share_links"),
+	}
+}
+
+// EnsureIndexes makes tokens unique and keeps a resource to a single link
+func (r *ShareLinkRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetName("token").SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "resource_type", Value: 1},
+				{Key: "resource_id", Value: 1},
+			},
+			Options: options.Index().SetName("user_resource").SetUnique(true),
+		},
+	})
+	return err
+}
+
+func (r *ShareLinkRepository) Create(ctx context.Context, link *models.ShareLink) error {
+	link.ID = primitive.NewObjectID()
+	link.CreatedAt = time.Now()
+	link.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, link)
+	return err
+}
+
+// FindByToken looks a link up without an owner; it backs the public route
+func (r *ShareLinkRepository) FindByToken(ctx context.Context, token string) (*models.ShareLink, error) {
+	var link models.ShareLink
+
+	err := r.collection.FindOne(ctx, bson.M{"token": token}).Decode(&link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func (r *ShareLinkRepository) FindByResource(ctx context.Context, userID, resourceType string, resourceID primitive.ObjectID) (*models.ShareLink, error) {
+	var link models.ShareLink
+	filter := bson.M{"user_id": userID, "resource_type": resourceType, "resource_id": resourceID}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// FindByUserID lists a user's links, newest first
+func (r *ShareLinkRepository) FindByUserID(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var links []models.ShareLink
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+func (r *ShareLinkRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	set["updated_at"] = time.Now()
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RecordView counts a view of a link
+func (r *ShareLinkRepository) RecordView(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.M{
+		"$inc": bson.M{"views": 1},
+		"$set": bson.M{"last_viewed_at": at},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *ShareLinkRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DayWords is how many words were written in the notes of one day
+type DayWords struct {
+	Date  string `bson:"_id"`
+	Words int    `bson:"words"`
+	Notes int    `bson:"notes"`
+}
+
+// GroupCount is how many notes a group holds; GroupID is nil for notes that
+// are not in a group
+type GroupCount struct {
+	GroupID *primitive.ObjectID `bson:"_id" json:"group_id"`
+	Name    string              `bson:"name" json:"name"`
+	Count   int                 `bson:"count" json:"count"`
+}
+
+// CompletionCounts counts the open, done and overdue items of a collection
+type CompletionCounts struct {
+	Total   int `bson:"total"`
+	Done    int `bson:"done"`
+	Overdue int `bson:"overdue"`
+}
+
+// StatsRepository runs the aggregations behind the statistics dashboard
+type StatsRepository struct {
+	notes *mongo.Collection
+	tasks *mongo.Collection
+	todos *mongo.Collection
+}
+
+func NewStatsRepository(db *mongo.Database) *StatsRepository {
+	return &StatsRepository{
+		notes: db.Collection("notes"),
+		tasks: db.Collection("tasks"),
+		todos: db.Collection("todos"),
+	}
+}
+
+// noteDay is the calendar day a note belongs to: its journal date, or the day
+// it was created in the given time zone
+func noteDay(timezone string) bson.M {
+	return bson.M{"$ifNull": bson.A{
+		"$journal_date",
+		bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at", "timezone": timezone}},
+	}}
+}
+
+// WordsPerDay sums the words in the notes of each day between two yyyy-mm-dd
+// dates (inclusive). Paragraphs, headings, captions and todo items count.
+func (r *StatsRepository) WordsPerDay(ctx context.Context, userID, from, to, timezone string, start, end time.Time) ([]DayWords, error) {
+	blockText := bson.M{"$reduce": bson.M{
+		"input":        bson.M{"$ifNull": bson.A{"$blocks", bson.A{}}},
+		"initialValue": "",
+		"in": bson.M{"$concat": bson.A{
+			"$$value", " ",
+			bson.M{"$ifNull": bson.A{"$$this.content_md", ""}}, " ",
+			bson.M{"$reduce": bson.M{
+				"input":        bson.M{"$ifNull": bson.A{"$$this.items", bson.A{}}},
+				"initialValue": "",
+				"in":           bson.M{"$concat": bson.A{"$$value", " ", bson.M{"$ifNull": bson.A{"$$this.text", ""}}}},
+			}},
+		}},
+	}}
+
+	// Newlines and tabs are turned into spaces so that splitting on spaces
+	// separates every word
+	spaced := blockText
+	for _, whitespace := range []string{"\n", "\r", "\t"} {
+		spaced = bson.M{"$replaceAll": bson.M{"input": spaced, "find": whitespace, "replacement": " "}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id": userID,
+			"$or": bson.A{
+				bson.M{"journal_date": bson.M{"$gte": from, "$lte": to}},
+				bson.M{"created_at": bson.M{"$gte": start, "$lt": end}},
+			},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"day": noteDay(timezone),
+			"words": bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": bson.M{"$split": bson.A{spaced, " "}},
+				"cond":  bson.M{"$ne": bson.A{"$$this", ""}},
+			}}},
+		}}},
+		{{Key: "$match", Value: bson.M{"day": bson.M{"$gte": from, "$lte": to}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$day",
+			"words": bson.M{"$sum": "$words"},
+			"notes": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.notes.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var days []DayWords
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+// ActiveDays lists, oldest first, the days on which the user wrote a note or
+// has a journal entry
+func (r *StatsRepository) ActiveDays(ctx context.Context, userID, timezone string) ([]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": noteDay(timezone)}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.notes.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Day string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	days := make([]string, 0, len(results))
+	for _, result := range results {
+		days = append(days, result.Day)
+	}
+	return days, nil
+}
+
+// NotesPerGroup counts the notes in each group, largest first
+func (r *StatsRepository) NotesPerGroup(ctx context.Context, userID string) ([]GroupCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$group_id", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "note_groups",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "group",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"count": 1,
+			"name":  bson.M{"$ifNull": bson.A{bson.M{"$first": "$group.name"}, ""}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "name", Value: 1}}}},
+	}
+
+	cursor, err := r.notes.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []GroupCount
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// TaskCounts counts the user's tasks; a task is overdue when its deadline has
+// passed and it is not done
+func (r *StatsRepository) TaskCounts(ctx context.Context, userID string, now time.Time) (*CompletionCounts, error) {
+	done := bson.M{"$eq": bson.A{"$status", "done"}}
+	return r.completion(ctx, r.tasks, userID, done, "$deadline", now)
+}
+
+// TodoCounts counts the user's todos; a todo is overdue when its due date has
+// passed and it is not done. All-day todos, due at midnight UTC of their day,
+// become overdue once the user's today (as midnight UTC) is past that day.
+func (r *StatsRepository) TodoCounts(ctx context.Context, userID string, now, today time.Time) (*CompletionCounts, error) {
+	done := bson.M{"$eq": bson.A{"$done", true}}
+	cutoff := bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$all_day", true}}, today, now}}
+	return r.completion(ctx, r.todos, userID, done, "$due_date", cutoff)
+}
+
+// completion counts documents as done and overdue; now is the moment or the
+// expression due dates are compared against
+func (r *StatsRepository) completion(ctx context.Context, collection *mongo.Collection, userID string, done bson.M, due string, now interface{}) (*CompletionCounts, error) {
+	// Unset dates are stored as the zero time, which must not count as past
+	overdue := bson.M{"$and": bson.A{
+		bson.M{"$not": bson.A{done}},
+		bson.M{"$gt": bson.A{due, time.Time{}}},
+		bson.M{"$lt": bson.A{due, now}},
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"total":   bson.M{"$sum": 1},
+			"done":    bson.M{"$sum": bson.M{"$cond": bson.A{done, 1, 0}}},
+			"overdue": bson.M{"$sum": bson.M{"$cond": bson.A{overdue, 1, 0}}},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var counts []CompletionCounts
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return &CompletionCounts{}, nil
+	}
+
+	return &counts[0], nil
+}
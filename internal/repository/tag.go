@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TagUsage is how often a raw tag value occurs in one collection
+type TagUsage struct {
+	Name  string `bson:"_id"`
+	Count int    `bson:"count"`
+}
+
+// TagRepository stores tag metadata and rewrites the tag lists of the notes
+// and tasks that reference a tag
+type TagRepository struct {
+	collection *mongo.Collection
+	notes      *mongo.Collection
+	tasks      *mongo.Collection
+}
+
+func NewTagRepository(db *mongo.Database) *TagRepository {
+	return &TagRepository{
+		collection: db.Collection("tags"),
+		notes:      db.Collection("notes"),
+		tasks:      db.Collection("tasks"),
+	}
+}
+
+func (r *TagRepository) FindByUserID(ctx context.Context, userID string) ([]models.Tag, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tags []models.Tag
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (r *TagRepository) FindByName(ctx context.Context, userID, name string) (*models.Tag, error) {
+	var tag models.Tag
+	filter := bson.M{"user_id": userID, "name": name}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// SetColor creates the tag's metadata if needed and sets its colour; a nil
+// colour clears it
+func (r *TagRepository) SetColor(ctx context.Context, userID, name string, color *string) (*models.Tag, error) {
+	now := time.Now()
+	filter := bson.M{"user_id": userID, "name": name}
+
+	set := bson.M{"updated_at": now}
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": now},
+	}
+	if color != nil {
+		set["color"] = *color
+	} else {
+		update["$unset"] = bson.M{"color": ""}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var tag models.Tag
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&tag); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// Rename moves the metadata of the given tags onto target. The first colour
+// found is kept when target has none.
+func (r *TagRepository) Rename(ctx context.Context, userID string, from []string, target string) error {
+	existing, err := r.FindByName(ctx, userID, target)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID, "name": bson.M{"$in": from}})
+	if err != nil {
+		return err
+	}
+	var sources []models.Tag
+	if err := cursor.All(ctx, &sources); err != nil {
+		return err
+	}
+
+	var color *string
+	if existing != nil {
+		color = existing.Color
+	}
+	for _, tag := range sources {
+		if color == nil && tag.Color != nil {
+			color = tag.Color
+		}
+	}
+
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "name": bson.M{"$in": from}}); err != nil {
+		return err
+	}
+
+	if color == nil {
+		return nil
+	}
+	_, err = r.SetColor(ctx, userID, target, color)
+	return err
+}
+
+// NoteUsage counts the raw tag values used by a user's notes
+func (r *TagRepository) NoteUsage(ctx context.Context, userID string) ([]TagUsage, error) {
+	return r.usage(ctx, r.notes, userID)
+}
+
+// TaskUsage counts the raw tag values used by a user's tasks
+func (r *TagRepository) TaskUsage(ctx context.Context, userID string) ([]TagUsage, error) {
+	return r.usage(ctx, r.tasks, userID)
+}
+
+func (r *TagRepository) usage(ctx context.Context, collection *mongo.Collection, userID string) ([]TagUsage, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var usage []TagUsage
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// ReplaceInDocuments replaces every tag in from with target in all notes and
+// tasks of a user, keeping the position of the first replaced tag and
+// dropping duplicates
+func (r *TagRepository) ReplaceInDocuments(ctx context.Context, userID string, from []string, target string) error {
+	filter := bson.M{"user_id": userID, "tags": bson.M{"$in": from}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tags": bson.M{"$reduce": bson.M{
+				"input": bson.M{"$map": bson.M{
+					"input": "$tags",
+					"as":    "tag",
+					"in":    bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$$tag", from}}, target, "$$tag"}},
+				}},
+				"initialValue": bson.A{},
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$in": bson.A{"$$this", "$$value"}},
+					"$$value",
+					bson.M{"$concatArrays": bson.A{"$$value", bson.A{"$$this"}}},
+				}},
+			}},
+			"updated_at": "$$NOW",
+		}}},
+	}
+
+	if _, err := r.notes.UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+	_, err := r.tasks.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// WithTransaction runs fn inside a MongoDB transaction so that a rename
+// rewrites notes, tasks and tag metadata all or nothing
+func (r *TagRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTransaction(ctx, r.collection.Database().Client(), fn)
+}
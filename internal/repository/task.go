@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"regexp"
 	"time"
 
 	"backend-journaling/internal/models"
@@ -22,6 +23,45 @@ func NewTaskRepository(db *mongo.Database) *TaskRepository {
 	}
 }
 
+// WithTransaction runs fn inside a MongoDB transaction so that a status
+// change and the writes that follow from it happen all or nothing
+func (r *TaskRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTransaction(ctx, r.collection.Database().Client(), fn)
+}
+
+// SubtaskCount is how many of a task's direct subtasks there are and how many
+// of them are done
+type SubtaskCount struct {
+	Done  int `bson:"done"`
+	Total int `bson:"total"`
+}
+
+func (r *TaskRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "position", Value: 1}},
+			Options: options.Index().SetName("user_parent_position"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "ancestors", Value: 1}},
+			Options: options.Index().SetName("user_ancestors"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "position", Value: 1}},
+			Options: options.Index().SetName("user_status_position"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "completed_at", Value: 1}},
+			Options: options.Index().SetName("user_completed"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "blocked_by", Value: 1}},
+			Options: options.Index().SetName("user_blocked_by"),
+		},
+	})
+	return err
+}
+
 func (r *TaskRepository) Create(ctx context.Context, task *models.Task) error {
 	task.ID = primitive.NewObjectID()
 	task.CreatedAt = time.Now()
@@ -47,10 +87,27 @@ func (r *TaskRepository) FindByID(ctx context.Context, id primitive.ObjectID, us
 	return &task, nil
 }
 
-func (r *TaskRepository) FindByUserID(ctx context.Context, userID string) ([]models.Task, error) {
+// FindByUserID returns the user's tasks, newest first; subtasks only when
+// includeSubtasks is set
+func (r *TaskRepository) FindByUserID(ctx context.Context, userID string, includeSubtasks bool) ([]models.Task, error) {
 	filter := bson.M{"user_id": userID}
+	if !includeSubtasks {
+		filter["parent_id"] = nil
+	}
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
 
+	return r.find(ctx, filter, opts)
+}
+
+// FindSubtasks returns the direct subtasks of a task in their order
+func (r *TaskRepository) FindSubtasks(ctx context.Context, userID string, parentID primitive.ObjectID) ([]models.Task, error) {
+	filter := bson.M{"user_id": userID, "parent_id": parentID}
+	opts := options.Find().SetSort(positionOrder)
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *TaskRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Task, error) {
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
@@ -65,11 +122,112 @@ func (r *TaskRepository) FindByUserID(ctx context.Context, userID string) ([]mod
 	return tasks, nil
 }
 
-func (r *TaskRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, update bson.M) error {
+// FindByIDs returns those of ids that are the user's tasks
+func (r *TaskRepository) FindByIDs(ctx context.Context, userID string, ids []primitive.ObjectID) ([]models.Task, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{"user_id": userID, "_id": bson.M{"$in": ids}}
+
+	return r.find(ctx, filter, options.Find())
+}
+
+// FindDependents returns the tasks blocked by any of ids
+func (r *TaskRepository) FindDependents(ctx context.Context, userID string, ids []primitive.ObjectID) ([]models.Task, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{"user_id": userID, "blocked_by": bson.M{"$in": ids}}
+
+	return r.find(ctx, filter, options.Find())
+}
+
+// SubtaskCounts counts the direct subtasks of each of parentIDs; parents
+// without subtasks are left out
+func (r *TaskRepository) SubtaskCounts(ctx context.Context, userID string, parentIDs []primitive.ObjectID) (map[primitive.ObjectID]SubtaskCount, error) {
+	counts := make(map[primitive.ObjectID]SubtaskCount)
+	if len(parentIDs) == 0 {
+		return counts, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "parent_id": bson.M{"$in": parentIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$parent_id",
+			"total": bson.M{"$sum": 1},
+			"done": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "done"}}, 1, 0},
+			}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			SubtaskCount `bson:",inline"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		counts[row.ID] = row.SubtaskCount
+	}
+
+	return counts, cursor.Err()
+}
+
+// boardOrder sorts the tasks of a board column. Tasks that were never placed
+// on a board have no position and come first, newest first.
+var boardOrder = bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: -1}}
+
+// columnFilter matches the top-level tasks with a status, only those tagged
+// tag when it is set
+func columnFilter(userID, status string, tag *string) bson.M {
+	filter := bson.M{"user_id": userID, "parent_id": nil, "status": status}
+	if tag != nil {
+		filter["tags"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(*tag) + "$", Options: "i"}
+	}
+	return filter
+}
+
+// FindColumn returns the top-level tasks with a status in board order, at
+// most limit of them when limit is positive
+func (r *TaskRepository) FindColumn(ctx context.Context, userID, status string, tag *string, limit int64) ([]models.Task, error) {
+	opts := options.Find().SetSort(boardOrder)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	return r.find(ctx, columnFilter(userID, status, tag), opts)
+}
+
+// CountColumn counts the top-level tasks with a status, leaving out exclude
+func (r *TaskRepository) CountColumn(ctx context.Context, userID, status string, tag *string, exclude primitive.ObjectID) (int64, error) {
+	filter := columnFilter(userID, status, tag)
+	filter["_id"] = bson.M{"$ne": exclude}
+
+	return r.collection.CountDocuments(ctx, filter)
+}
+
+// Place writes new positions for subtasks or for the tasks of a board column
+func (r *TaskRepository) Place(ctx context.Context, userID string, placements []Placement) error {
+	return place(ctx, r.collection, userID, placements, nil)
+}
+
+// Update applies set and unset to a task
+func (r *TaskRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
 	filter := bson.M{"_id": id, "user_id": userID}
-	update["updated_at"] = time.Now()
+	set["updated_at"] = time.Now()
 
-	updateDoc := bson.M{"$set": update}
+	updateDoc := bson.M{"$set": set}
+	if len(unset) > 0 {
+		updateDoc["$unset"] = unset
+	}
 	result, err := r.collection.UpdateOne(ctx, filter, updateDoc)
 	if err != nil {
 		return err
@@ -82,6 +240,183 @@ func (r *TaskRepository) Update(ctx context.Context, id primitive.ObjectID, user
 	return nil
 }
 
+// SetStatus applies set and unset to a task, provided its status is still
+// from, and reports whether it did; the caller puts the new status in set.
+// A concurrent change of status is thereby only acted on once.
+func (r *TaskRepository) SetStatus(ctx context.Context, id primitive.ObjectID, userID, from string, set, unset bson.M) (bool, error) {
+	filter := bson.M{"_id": id, "user_id": userID, "status": from}
+	set["updated_at"] = time.Now()
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// FindCompleted returns the user's done tasks completed in [from, to),
+// oldest completion first
+func (r *TaskRepository) FindCompleted(ctx context.Context, userID string, from, to time.Time) ([]models.Task, error) {
+	filter := bson.M{
+		"user_id":      userID,
+		"status":       "done",
+		"completed_at": bson.M{"$gte": from, "$lt": to},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "completed_at", Value: 1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+// AddBlocker records that a task is blocked by another one
+func (r *TaskRepository) AddBlocker(ctx context.Context, id primitive.ObjectID, userID string, blockerID primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	update := bson.M{
+		"$addToSet": bson.M{"blocked_by": blockerID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RemoveBlocker drops one of the tasks blocking a task; mongo.ErrNoDocuments
+// means the task is not blocked by it
+func (r *TaskRepository) RemoveBlocker(ctx context.Context, id primitive.ObjectID, userID string, blockerID primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "user_id": userID, "blocked_by": blockerID}
+	update := bson.M{
+		"$pull": bson.M{"blocked_by": blockerID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// PullBlockers drops ids from the blockers of every task, e.g. once they are
+// deleted
+func (r *TaskRepository) PullBlockers(ctx context.Context, userID string, ids []primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "blocked_by": bson.M{"$in": ids}}
+	update := bson.M{"$pull": bson.M{"blocked_by": bson.M{"$in": ids}}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// SetBlocked marks tasks as blocked or not
+func (r *TaskRepository) SetBlocked(ctx context.Context, userID string, ids []primitive.ObjectID, blocked bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	filter := bson.M{"user_id": userID, "_id": bson.M{"$in": ids}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"blocked": blocked}})
+	return err
+}
+
+// AddChecklistItem appends an item to a task's checklist
+func (r *TaskRepository) AddChecklistItem(ctx context.Context, id primitive.ObjectID, userID string, item models.TodoItem) error {
+	filter := bson.M{"_id": id, "user_id": userID}
+	update := bson.M{
+		"$push": bson.M{"checklist": item},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// UpdateChecklistItem sets fields, such as text or done, on one checklist
+// item
+func (r *TaskRepository) UpdateChecklistItem(ctx context.Context, id primitive.ObjectID, userID, itemID string, set bson.M) error {
+	filter := bson.M{"_id": id, "user_id": userID, "checklist.id": itemID}
+	fields := bson.M{"updated_at": time.Now()}
+	for key, value := range set {
+		fields["checklist.$."+key] = value
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RemoveChecklistItem deletes one checklist item
+func (r *TaskRepository) RemoveChecklistItem(ctx context.Context, id primitive.ObjectID, userID, itemID string) error {
+	filter := bson.M{"_id": id, "user_id": userID, "checklist.id": itemID}
+	update := bson.M{
+		"$pull": bson.M{"checklist": bson.M{"id": itemID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// ReplaceChecklist stores a reordered checklist, provided the checklist
+// still holds exactly the same items; otherwise nothing changes and
+// mongo.ErrNoDocuments is returned
+func (r *TaskRepository) ReplaceChecklist(ctx context.Context, id primitive.ObjectID, userID string, checklist []models.TodoItem) error {
+	itemIDs := make([]string, len(checklist))
+	for i, item := range checklist {
+		itemIDs[i] = item.ID
+	}
+	filter := bson.M{
+		"_id":          id,
+		"user_id":      userID,
+		"checklist":    bson.M{"$size": len(checklist)},
+		"checklist.id": bson.M{"$all": itemIDs},
+	}
+	update := bson.M{"$set": bson.M{"checklist": checklist, "updated_at": time.Now()}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
 func (r *TaskRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
 	filter := bson.M{"_id": id, "user_id": userID}
 	result, err := r.collection.DeleteOne(ctx, filter)
@@ -95,3 +430,25 @@ func (r *TaskRepository) Delete(ctx context.Context, id primitive.ObjectID, user
 
 	return nil
 }
+
+// DeleteDescendants deletes every subtask below a task, at any depth, and
+// returns their ids
+func (r *TaskRepository) DeleteDescendants(ctx context.Context, id primitive.ObjectID, userID string) ([]primitive.ObjectID, error) {
+	filter := bson.M{"user_id": userID, "ancestors": id}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	descendants, err := r.find(ctx, filter, opts)
+	if err != nil || len(descendants) == 0 {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(descendants))
+	for i, task := range descendants {
+		ids[i] = task.ID
+	}
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TaskActivityRepository struct {
+	collection *mongo.Collection
+}
+
+func NewTaskActivityRepository(db *mongo.Database) *TaskActivityRepository {
+	return &TaskActivityRepository{
+		collection: db.Collection("task_activity"),
+	}
+}
+
+func (r *TaskActivityRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "task_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("user_task_created"),
+	})
+	return err
+}
+
+func (r *TaskActivityRepository) Create(ctx context.Context, activity *models.TaskActivity) error {
+	activity.ID = primitive.NewObjectID()
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+
+	_, err := r.collection.InsertOne(ctx, activity)
+	return err
+}
+
+// FindByTask returns the activity of a task, oldest first
+func (r *TaskActivityRepository) FindByTask(ctx context.Context, userID string, taskID primitive.ObjectID) ([]models.TaskActivity, error) {
+	filter := bson.M{"user_id": userID, "task_id": taskID}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var activity []models.TaskActivity
+	if err := cursor.All(ctx, &activity); err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// FirstMoves returns, for each of taskIDs, when its status first changed to
+// one outside skip; tasks that never did are left out
+func (r *TaskActivityRepository) FirstMoves(ctx context.Context, userID string, taskIDs []primitive.ObjectID, skip []string) (map[primitive.ObjectID]time.Time, error) {
+	moves := make(map[primitive.ObjectID]time.Time)
+	if len(taskIDs) == 0 {
+		return moves, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id": userID,
+			"task_id": bson.M{"$in": taskIDs},
+			"type":    models.TaskActivityStatusChanged,
+			"to":      bson.M{"$nin": skip},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$task_id", "at": bson.M{"$min": "$created_at"}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			ID primitive.ObjectID `bson:"_id"`
+			At time.Time          `bson:"at"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		moves[row.ID] = row.At
+	}
+
+	return moves, cursor.Err()
+}
+
+// DeleteByTasks removes the activity of deleted tasks
+func (r *TaskActivityRepository) DeleteByTasks(ctx context.Context, userID string, taskIDs []primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "task_id": bson.M{"$in": objectIDs(taskIDs)}})
+	return err
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTimerRunning = errors.New("a timer is already running")
+
+type TimeEntryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewTimeEntryRepository(db *mongo.Database) *TimeEntryRepository {
+	return &TimeEntryRepository{
+		collection: db.Collection("time_entries"),
+	}
+}
+
+// EnsureIndexes serves listing the entries of a task or a week and keeps a
+// user to a single running timer
+func (r *TimeEntryRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "task_id", Value: 1}, {Key: "started_at", Value: -1}},
+			Options: options.Index().SetName("user_task_started"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "started_at", Value: 1}},
+			Options: options.Index().SetName("user_started"),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_running").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"running": true}),
+		},
+	})
+	return err
+}
+
+// Create stores an entry; a running one is refused with ErrTimerRunning
+// while the user has another timer running
+func (r *TimeEntryRepository) Create(ctx context.Context, entry *models.TimeEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTimerRunning
+	}
+	return err
+}
+
+func (r *TimeEntryRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.TimeEntry, error) {
+	var entry models.TimeEntry
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// FindRunning returns the user's running timer
+func (r *TimeEntryRepository) FindRunning(ctx context.Context, userID string) (*models.TimeEntry, error) {
+	var entry models.TimeEntry
+
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "running": true}).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// FindByTask returns the entries of a task, latest first
+func (r *TimeEntryRepository) FindByTask(ctx context.Context, userID string, taskID primitive.ObjectID) ([]models.TimeEntry, error) {
+	filter := bson.M{"user_id": userID, "task_id": taskID}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+// FindBetween returns the entries that overlap [from, to), running timers
+// included, oldest first
+func (r *TimeEntryRepository) FindBetween(ctx context.Context, userID string, from, to time.Time) ([]models.TimeEntry, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"started_at": bson.M{"$lt": to},
+		"$or": bson.A{
+			bson.M{"ended_at": bson.M{"$gt": from}},
+			bson.M{"running": true},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *TimeEntryRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.TimeEntry, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.TimeEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Stop ends a running timer and reports whether it was still running
+func (r *TimeEntryRepository) Stop(ctx context.Context, id primitive.ObjectID, userID string, endedAt time.Time, durationSeconds int64) (bool, error) {
+	filter := bson.M{"_id": id, "user_id": userID, "running": true}
+	update := bson.M{
+		"$set": bson.M{
+			"ended_at":         endedAt,
+			"duration_seconds": durationSeconds,
+			"updated_at":       time.Now(),
+		},
+		"$unset": bson.M{"running": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// Update applies set and unset to an entry
+func (r *TimeEntryRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
+	set["updated_at"] = time.Now()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *TimeEntryRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteByTasks removes the entries of deleted tasks
+func (r *TimeEntryRepository) DeleteByTasks(ctx context.Context, userID string, taskIDs []primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "task_id": bson.M{"$in": objectIDs(taskIDs)}})
+	return err
+}
@@ -22,6 +22,28 @@ func NewTodoRepository(db *mongo.Database) *TodoRepository {
 	}
 }
 
+// WithTransaction runs fn inside a MongoDB transaction so that completing a
+// repeating todo and creating its next occurrence happen all or nothing
+func (r *TodoRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withTransaction(ctx, r.collection.Database().Client(), fn)
+}
+
+// EnsureIndexes serves listing the todos of a list in order
+func (r *TodoRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "list_id", Value: 1},
+				{Key: "position", Value: 1},
+				{Key: "_id", Value: 1},
+			},
+			Options: options.Index().SetName("user_list_position"),
+		},
+	})
+	return err
+}
+
 func (r *TodoRepository) Create(ctx context.Context, todo *models.Todo) error {
 	todo.ID = primitive.NewObjectID()
 	todo.CreatedAt = time.Now()
@@ -61,11 +83,72 @@ func (r *TodoRepository) FindByUserID(ctx context.Context, userID string) ([]mod
 	return todos, nil
 }
 
-func (r *TodoRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, update bson.M) error {
+// FindByIDs loads the todos of a user with the given ids, in no particular
+// order
+func (r *TodoRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID, userID string) ([]models.Todo, error) {
+	return r.findSorted(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID}, nil)
+}
+
+// FindByList lists the todos of a list in their order
+func (r *TodoRepository) FindByList(ctx context.Context, userID string, listID primitive.ObjectID) ([]models.Todo, error) {
+	return r.findSorted(ctx, bson.M{"user_id": userID, "list_id": listID}, positionOrder)
+}
+
+// FindUnlisted lists the todos of a user that belong to no list yet, oldest
+// first
+func (r *TodoRepository) FindUnlisted(ctx context.Context, userID string) ([]models.Todo, error) {
+	filter := bson.M{"user_id": userID, "list_id": nil}
+	return r.findSorted(ctx, filter, bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+}
+
+// Neighbour returns the todo of a list right after todo, or right before it
+// when before is set, skipping the todos in exclude. A todo without one
+// gives mongo.ErrNoDocuments.
+func (r *TodoRepository) Neighbour(ctx context.Context, userID string, listID primitive.ObjectID, todo *models.Todo, before bool, exclude []primitive.ObjectID) (*models.Todo, error) {
+	filter := afterPosition(todo.Position, todo.ID)
+	sort := positionOrder
+	if before {
+		filter = beforePosition(todo.Position, todo.ID)
+		sort = bson.D{{Key: "position", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	filter["user_id"] = userID
+	filter["list_id"] = listID
+	filter["_id"] = bson.M{"$nin": objectIDs(exclude)}
+
+	return r.findOne(ctx, filter, sort)
+}
+
+// Last returns the last todo of a list, skipping the todos in exclude
+func (r *TodoRepository) Last(ctx context.Context, userID string, listID primitive.ObjectID, exclude []primitive.ObjectID) (*models.Todo, error) {
+	filter := bson.M{"user_id": userID, "list_id": listID, "_id": bson.M{"$nin": objectIDs(exclude)}}
+	return r.findOne(ctx, filter, bson.D{{Key: "position", Value: -1}, {Key: "_id", Value: -1}})
+}
+
+func (r *TodoRepository) findOne(ctx context.Context, filter bson.M, sort bson.D) (*models.Todo, error) {
+	var todo models.Todo
+
+	err := r.collection.FindOne(ctx, filter, options.FindOne().SetSort(sort)).Decode(&todo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+// Place moves todos of a user into a list at new positions
+func (r *TodoRepository) Place(ctx context.Context, userID string, listID primitive.ObjectID, placements []Placement) error {
+	return place(ctx, r.collection, userID, placements, bson.M{"list_id": listID})
+}
+
+// Update applies set and unset to a todo
+func (r *TodoRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
 	filter := bson.M{"_id": id, "user_id": userID}
-	update["updated_at"] = time.Now()
+	set["updated_at"] = time.Now()
 
-	updateDoc := bson.M{"$set": update}
+	updateDoc := bson.M{"$set": set}
+	if len(unset) > 0 {
+		updateDoc["$unset"] = unset
+	}
 	result, err := r.collection.UpdateOne(ctx, filter, updateDoc)
 	if err != nil {
 		return err
@@ -78,6 +161,76 @@ func (r *TodoRepository) Update(ctx context.Context, id primitive.ObjectID, user
 	return nil
 }
 
+// MarkDone completes an open todo and reports whether it was open, so a
+// concurrent completion is only acted on once
+func (r *TodoRepository) MarkDone(ctx context.Context, id primitive.ObjectID, userID string) (bool, error) {
+	filter := bson.M{"_id": id, "user_id": userID, "done": false}
+	update := bson.M{"$set": bson.M{"done": true, "updated_at": time.Now()}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// FindOpenDue lists the open todos due in [from, to). Timed todos are compared
+// by instant and all-day todos by their day, [dayFrom, dayTo) as midnight UTC.
+// A zero bound leaves that side open.
+func (r *TodoRepository) FindOpenDue(ctx context.Context, userID string, from, to, dayFrom, dayTo time.Time) ([]models.Todo, error) {
+	filter := bson.M{
+		"user_id": userID,
+		"done":    false,
+		"$or": bson.A{
+			bson.M{"all_day": bson.M{"$ne": true}, "due_date": dueRange(from, to)},
+			bson.M{"all_day": true, "due_date": dueRange(dayFrom, dayTo)},
+		},
+	}
+
+	return r.find(ctx, filter)
+}
+
+// FindOpenUndated lists the open todos without a due date
+func (r *TodoRepository) FindOpenUndated(ctx context.Context, userID string) ([]models.Todo, error) {
+	return r.find(ctx, bson.M{"user_id": userID, "done": false, "due_date": nil})
+}
+
+func (r *TodoRepository) find(ctx context.Context, filter bson.M) ([]models.Todo, error) {
+	return r.findSorted(ctx, filter, bson.D{{Key: "due_date", Value: 1}, {Key: "created_at", Value: 1}})
+}
+
+func (r *TodoRepository) findSorted(ctx context.Context, filter bson.M, sort bson.D) ([]models.Todo, error) {
+	opts := options.Find()
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var todos []models.Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+func dueRange(from, to time.Time) bson.M {
+	cond := bson.M{"$type": "date"}
+	if !from.IsZero() {
+		cond["$gte"] = from
+	}
+	if !to.IsZero() {
+		cond["$lt"] = to
+	}
+	return cond
+}
+
 func (r *TodoRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
 	filter := bson.M{"_id": id, "user_id": userID}
 	result, err := r.collection.DeleteOne(ctx, filter)
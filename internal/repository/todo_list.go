@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TodoListRepository struct {
+	collection *mongo.Collection
+}
+
+func NewTodoListRepository(db *mongo.Database) *TodoListRepository {
+	return &TodoListRepository{
+		collection: db.Collection("todo_lists"),
+	}
+}
+
+// EnsureIndexes serves listing a user's lists in order and keeps a user to a
+// single default list
+func (r *TodoListRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "position", Value: 1}},
+			Options: options.Index().SetName("user_position"),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_default").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"is_default": true}),
+		},
+	})
+	return err
+}
+
+func (r *TodoListRepository) Create(ctx context.Context, list *models.TodoList) error {
+	list.ID = primitive.NewObjectID()
+	list.CreatedAt = time.Now()
+	list.UpdatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, list)
+	return err
+}
+
+// EnsureDefault returns the user's default list, creating it from list when
+// the user has none yet
+func (r *TodoListRepository) EnsureDefault(ctx context.Context, list *models.TodoList) (*models.TodoList, error) {
+	filter := bson.M{"user_id": list.UserID, "is_default": true}
+	now := time.Now()
+	update := bson.M{"$setOnInsert": bson.M{
+		"_id":        primitive.NewObjectID(),
+		"name":       list.Name,
+		"position":   list.Position,
+		"created_at": now,
+		"updated_at": now,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var stored models.TodoList
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent request created it first
+		err = r.collection.FindOne(ctx, filter).Decode(&stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+func (r *TodoListRepository) FindByID(ctx context.Context, id primitive.ObjectID, userID string) (*models.TodoList, error) {
+	var list models.TodoList
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// FindByUserID lists a user's lists in their order
+func (r *TodoListRepository) FindByUserID(ctx context.Context, userID string) ([]models.TodoList, error) {
+	opts := options.Find().SetSort(positionOrder)
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var lists []models.TodoList
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// Update applies set and unset to a list
+func (r *TodoListRepository) Update(ctx context.Context, id primitive.ObjectID, userID string, set, unset bson.M) error {
+	set["updated_at"] = time.Now()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// Place moves lists of a user to new positions
+func (r *TodoListRepository) Place(ctx context.Context, userID string, placements []Placement) error {
+	return place(ctx, r.collection, userID, placements, nil)
+}
+
+// Delete removes a list that is not the default one
+func (r *TodoListRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	filter := bson.M{"_id": id, "user_id": userID, "is_default": false}
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
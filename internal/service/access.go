@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AccessService is the single place that decides what a user may do with a
+// note or note group. It resolves the principal that repository calls for the
+// item are made with: the owner, or a collaborator with the highest role
+// granted on the item or, for a note, on its group.
+type AccessService struct {
+	notes         *repository.NoteRepository
+	groups        *repository.NoteGroupRepository
+	collaborators *repository.CollaboratorRepository
+}
+
+func NewAccessService(notes *repository.NoteRepository, groups *repository.NoteGroupRepository, collaborators *repository.CollaboratorRepository) *AccessService {
+	return &AccessService{
+		notes:         notes,
+		groups:        groups,
+		collaborators: collaborators,
+	}
+}
+
+// Note resolves the principal of a user for an action on a note. Notes the
+// user cannot see are reported as not found; notes they can see but not
+// change return authz.ErrForbidden.
+func (a *AccessService) Note(ctx context.Context, userID string, noteID primitive.ObjectID, action authz.Action) (authz.Principal, error) {
+	note, err := a.notes.FindForAccess(ctx, noteID)
+	if err != nil {
+		return authz.Principal{}, err
+	}
+	if note.UserID == userID {
+		return authz.Owner(userID), nil
+	}
+
+	resources := map[string]primitive.ObjectID{models.ShareResourceNote: noteID}
+	if note.GroupID != nil {
+		resources[models.ShareResourceGroup] = *note.GroupID
+	}
+	return a.resolve(ctx, userID, note.UserID, resources, action)
+}
+
+// Group resolves the principal of a user for an action on a note group
+func (a *AccessService) Group(ctx context.Context, userID string, groupID primitive.ObjectID, action authz.Action) (authz.Principal, error) {
+	group, err := a.groups.FindForAccess(ctx, groupID)
+	if err != nil {
+		return authz.Principal{}, err
+	}
+	if group.UserID == userID {
+		return authz.Owner(userID), nil
+	}
+
+	resources := map[string]primitive.ObjectID{models.ShareResourceGroup: groupID}
+	return a.resolve(ctx, userID, group.UserID, resources, action)
+}
+
+// Forget drops every grant on a deleted note or group
+func (a *AccessService) Forget(ctx context.Context, resourceType string, resourceID primitive.ObjectID) error {
+	return a.collaborators.DeleteForResource(ctx, resourceType, resourceID)
+}
+
+func (a *AccessService) resolve(ctx context.Context, userID, ownerID string, resources map[string]primitive.ObjectID, action authz.Action) (authz.Principal, error) {
+	grants, err := a.collaborators.FindRoles(ctx, userID, resources)
+	if err != nil {
+		return authz.Principal{}, err
+	}
+
+	var role string
+	for _, grant := range grants {
+		role = authz.Higher(role, grant.Role)
+	}
+	if role == "" {
+		return authz.Principal{}, mongo.ErrNoDocuments
+	}
+
+	principal := authz.Principal{UserID: userID, OwnerID: ownerID, Role: role}
+	if !principal.Can(action) {
+		return authz.Principal{}, authz.ErrForbidden
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-journaling/config"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrInvalidAttachmentID = errors.New("invalid attachment id")
+	ErrNotAnImage          = errors.New("attachment is not an image")
+	ErrEmptyUpload         = errors.New("uploaded file is empty")
+	ErrUploadTooLarge      = errors.New("uploaded file is too large")
+	ErrQuotaExceeded       = errors.New("storage quota exceeded")
+	ErrInvalidDownloadLink = errors.New("download link is invalid or expired")
+)
+
+// AttachmentDownloadPath is where signed download links point to
+const AttachmentDownloadPath = "/api/v1/attachments/%s/content"
+
+const (
+	VariantOriginal  = "original"
+	VariantThumbnail = "thumbnail"
+)
+
+// AttachmentView is an attachment together with short-lived download links
+type AttachmentView struct {
+	models.Attachment
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	URLExpiresAt time.Time `json:"url_expires_at"`
+}
+
+// StorageUsage is how much of the storage quota a user has used, in bytes
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+type AttachmentService struct {
+	repo       *repository.AttachmentRepository
+	storage    storage.Storage
+	signingKey []byte
+	urlTTL     time.Duration
+	maxSize    int64
+	quota      int64
+}
+
+func NewAttachmentService(repo *repository.AttachmentRepository, store storage.Storage, cfg *config.Config) *AttachmentService {
+	return &AttachmentService{
+		repo:       repo,
+		storage:    store,
+		signingKey: []byte(cfg.Storage.SigningKey),
+		urlTTL:     cfg.Storage.URLTTL,
+		maxSize:    cfg.Storage.MaxUploadSize,
+		quota:      cfg.Storage.UserQuota,
+	}
+}
+
+// MaxUploadSize is the largest file Upload accepts
+func (s *AttachmentService) MaxUploadSize() int64 {
+	return s.maxSize
+}
+
+// Upload stores a file for a user. The content type is sniffed from the data
+// rather than trusted from the client, and images get a thumbnail.
+func (s *AttachmentService) Upload(ctx context.Context, userID, filename string, body io.Reader) (*AttachmentView, error) {
+	data, err := io.ReadAll(io.LimitReader(body, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyUpload
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	used, err := s.repo.TotalSize(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if used+int64(len(data)) > s.quota {
+		return nil, ErrQuotaExceeded
+	}
+
+	attachment := &models.Attachment{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Filename:    cleanFilename(filename),
+		ContentType: sniffContentType(data),
+		Size:        int64(len(data)),
+	}
+	attachment.StorageKey = userID + "/" + attachment.ID.Hex()
+
+	var thumbnail []byte
+	if isImage(attachment.ContentType) {
+		if width, height, ok := imageSize(data); ok {
+			attachment.Width, attachment.Height = width, height
+			if thumb, err := makeThumbnail(data); err == nil {
+				thumbnail = thumb
+				key := attachment.StorageKey + "-thumb.jpg"
+				attachment.ThumbnailKey = &key
+			}
+		}
+	}
+
+	if err := s.storage.Put(ctx, attachment.StorageKey, bytes.NewReader(data), attachment.Size, attachment.ContentType); err != nil {
+		return nil, err
+	}
+	if thumbnail != nil {
+		if err := s.storage.Put(ctx, *attachment.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			s.removeBlobs(ctx, attachment)
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Create(ctx, attachment); err != nil {
+		s.removeBlobs(ctx, attachment)
+		return nil, err
+	}
+
+	// Concurrent uploads can all pass the check above, so the quota is
+	// verified again once this upload is counted
+	used, err = s.repo.TotalSize(ctx, userID)
+	if err == nil && used > s.quota {
+		s.repo.Delete(ctx, attachment.ID, userID)
+		s.removeBlobs(ctx, attachment)
+		return nil, ErrQuotaExceeded
+	}
+
+	return s.view(attachment), nil
+}
+
+func (s *AttachmentService) GetAttachment(ctx context.Context, attachmentID, userID string) (*AttachmentView, error) {
+	attachment, err := s.find(ctx, attachmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.view(attachment), nil
+}
+
+func (s *AttachmentService) GetUserAttachments(ctx context.Context, userID string) ([]AttachmentView, error) {
+	attachments, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]AttachmentView, 0, len(attachments))
+	for i := range attachments {
+		views = append(views, *s.view(&attachments[i]))
+	}
+	return views, nil
+}
+
+// GetImage returns an image attachment of the user, for image blocks and
+// avatars
+func (s *AttachmentService) GetImage(ctx context.Context, attachmentID, userID string) (*AttachmentView, error) {
+	attachment, err := s.find(ctx, attachmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isImage(attachment.ContentType) {
+		return nil, ErrNotAnImage
+	}
+
+	return s.view(attachment), nil
+}
+
+func (s *AttachmentService) GetUsage(ctx context.Context, userID string) (*StorageUsage, error) {
+	used, err := s.repo.TotalSize(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StorageUsage{Used: used, Quota: s.quota}, nil
+}
+
+// DeleteAttachment removes an attachment and its blobs. Image blocks or an
+// avatar still referencing it will no longer resolve.
+func (s *AttachmentService) DeleteAttachment(ctx context.Context, attachmentID, userID string) error {
+	attachment, err := s.find(ctx, attachmentID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, attachment.ID, userID); err != nil {
+		return err
+	}
+
+	s.removeBlobs(ctx, attachment)
+	return nil
+}
+
+// Open verifies a signed download link and opens the requested variant
+func (s *AttachmentService) Open(ctx context.Context, attachmentID, variant, expires, signature string) (*models.Attachment, io.ReadCloser, error) {
+	if variant == "" {
+		variant = VariantOriginal
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, nil, ErrInvalidDownloadLink
+	}
+
+	expected := s.sign(attachmentID, variant, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, nil, ErrInvalidDownloadLink
+	}
+
+	objID, err := primitive.ObjectIDFromHex(attachmentID)
+	if err != nil {
+		return nil, nil, ErrInvalidDownloadLink
+	}
+
+	attachment, err := s.repo.FindByIDForDownload(ctx, objID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := attachment.StorageKey
+	if variant == VariantThumbnail {
+		if attachment.ThumbnailKey == nil {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		key = *attachment.ThumbnailKey
+		attachment.ContentType = "image/jpeg"
+	}
+
+	body, err := s.storage.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachment, body, nil
+}
+
+// SignedURL builds a download link for an attachment that stays valid for
+// the configured TTL
+func (s *AttachmentService) SignedURL(attachmentID, variant string) (string, time.Time) {
+	expiresAt := time.Now().Add(s.urlTTL).Truncate(time.Second)
+
+	query := url.Values{}
+	if variant != VariantOriginal {
+		query.Set("variant", variant)
+	}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", s.sign(attachmentID, variant, expiresAt.Unix()))
+
+	return fmt.Sprintf(AttachmentDownloadPath, attachmentID) + "?" + query.Encode(), expiresAt
+}
+
+func (s *AttachmentService) sign(attachmentID, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s:%s:%d", attachmentID, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AttachmentService) view(attachment *models.Attachment) *AttachmentView {
+	view := &AttachmentView{Attachment: *attachment}
+	view.URL, view.URLExpiresAt = s.SignedURL(attachment.ID.Hex(), VariantOriginal)
+	if attachment.ThumbnailKey != nil {
+		view.ThumbnailURL, _ = s.SignedURL(attachment.ID.Hex(), VariantThumbnail)
+	}
+	return view
+}
+
+func (s *AttachmentService) find(ctx context.Context, attachmentID, userID string) (*models.Attachment, error) {
+	objID, err := primitive.ObjectIDFromHex(attachmentID)
+	if err != nil {
+		return nil, ErrInvalidAttachmentID
+	}
+
+	attachment, err := s.repo.FindByID(ctx, objID, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, err
+}
+
+func (s *AttachmentService) removeBlobs(ctx context.Context, attachment *models.Attachment) {
+	s.storage.Delete(ctx, attachment.StorageKey)
+	if attachment.ThumbnailKey != nil {
+		s.storage.Delete(ctx, *attachment.ThumbnailKey)
+	}
+}
+
+// sniffContentType detects the type from the file's first bytes. For text
+// types http.DetectContentType includes the charset it detected.
+func sniffContentType(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+func isImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+func cleanFilename(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "upload"
+	}
+	return name
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Register the decoders for the formats thumbnails are made from
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	thumbnailSize = 320
+	// maxImagePixels keeps thumbnailing from decoding huge images
+	maxImagePixels = 40_000_000
+)
+
+var errImageTooLarge = errors.New("image is too large to thumbnail")
+
+// imageSize reads the dimensions of an image without decoding it
+func imageSize(data []byte) (int, int, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// makeThumbnail scales an image down to fit a thumbnailSize square and
+// encodes it as JPEG. Pixels are averaged over the area they cover.
+func makeThumbnail(data []byte) ([]byte, error) {
+	width, height, ok := imageSize(data)
+	if !ok {
+		return nil, image.ErrFormat
+	}
+	if width*height > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	scale := float64(thumbnailSize) / float64(max(bounds.Dx(), bounds.Dy()))
+	if scale > 1 {
+		scale = 1
+	}
+	dstWidth := max(1, int(float64(bounds.Dx())*scale))
+	dstHeight := max(1, int(float64(bounds.Dy())*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// Flatten transparency onto white since JPEG has no alpha
+			alpha := a / n
+			white := uint64(0xffff) - alpha
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
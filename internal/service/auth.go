@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -36,9 +37,14 @@ type AuthService struct {
 	authEventRepo    *repository.AuthEventRepository
 	jwtManager       *jwt.Manager
 	emailSender      email.Sender
+	notifications    *NotificationService
 	config           *config.Config
 }
 
+// signInHistory is how many recent auth events a sign-in is compared with to
+// tell whether it comes from a new device
+const signInHistory = 100
+
 func NewAuthService(
 	userRepo *repository.UserRepository,
 	otpRepo *repository.OTPRepository,
@@ -46,6 +52,7 @@ func NewAuthService(
 	authEventRepo *repository.AuthEventRepository,
 	jwtManager *jwt.Manager,
 	emailSender email.Sender,
+	notifications *NotificationService,
 	config *config.Config,
 ) *AuthService {
 	return &AuthService{
@@ -55,6 +62,7 @@ func NewAuthService(
 		authEventRepo:    authEventRepo,
 		jwtManager:       jwtManager,
 		emailSender:      emailSender,
+		notifications:    notifications,
 		config:           config,
 	}
 }
@@ -161,6 +169,9 @@ func (s *AuthService) Login(email, pass string, ip, userAgent *string) (*LoginRe
 		return nil, ErrInvalidCredentials
 	}
 
+	if s.isNewDevice(user.ID, ip, userAgent) {
+		s.notifySecurity(user.ID, "New sign-in to your account", "Signed in from "+device(ip, userAgent)+". If this wasn't you, reset your password.")
+	}
 	s.authEventRepo.Create(&user.ID, "login", ip, userAgent, nil)
 
 	return s.generateTokens(user, ip, userAgent)
@@ -306,6 +317,7 @@ func (s *AuthService) ResetPassword(email, otpCode, newPassword string, ip, user
 	s.refreshTokenRepo.RevokeAllForUser(user.ID)
 
 	s.authEventRepo.Create(&user.ID, "password_reset", ip, userAgent, nil)
+	s.notifySecurity(user.ID, "Your password was reset", "Reset from "+device(ip, userAgent)+". All sessions were signed out. If this wasn't you, contact support.")
 
 	return nil
 }
@@ -367,10 +379,62 @@ func (s *AuthService) ChangePassword(userID uuid.UUID, oldPassword, newPassword
 	s.refreshTokenRepo.RevokeAllForUser(userID)
 
 	s.authEventRepo.Create(&userID, "password_changed", ip, userAgent, nil)
+	s.notifySecurity(userID, "Your password was changed", "Changed from "+device(ip, userAgent)+". Other sessions were signed out. If this wasn't you, reset your password.")
 
 	return nil
 }
 
+// isNewDevice reports whether a sign-in comes from an IP address and user
+// agent the user has not signed in from recently. A user's first sign-in is
+// not new.
+func (s *AuthService) isNewDevice(userID uuid.UUID, ip, userAgent *string) bool {
+	events, err := s.authEventRepo.FindByUserID(userID, signInHistory)
+	if err != nil {
+		return false
+	}
+
+	signedIn := false
+	for _, event := range events {
+		if event.EventType != "login" {
+			continue
+		}
+		signedIn = true
+		if sameValue(event.IP, ip) && sameValue(event.UserAgent, userAgent) {
+			return false
+		}
+	}
+	return signedIn
+}
+
+// notifySecurity adds a security alert to the user's notifications
+func (s *AuthService) notifySecurity(userID uuid.UUID, title, body string) {
+	s.notifications.Send(context.Background(), &models.Notification{
+		UserID: userID.String(),
+		Type:   models.NotificationSecurity,
+		Title:  title,
+		Body:   body,
+	})
+}
+
+// device describes where an auth event came from
+func device(ip, userAgent *string) string {
+	where := "an unknown device"
+	if userAgent != nil && *userAgent != "" {
+		where = *userAgent
+	}
+	if ip != nil && *ip != "" {
+		where += " (" + *ip + ")"
+	}
+	return where
+}
+
+func sameValue(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (s *AuthService) generateTokens(user *models.User, ip, userAgent *string) (*LoginResponse, error) {
 	accessToken, err := s.jwtManager.Generate(user.ID, user.Email, user.Role)
 	if err != nil {
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"sort"
+
+	"backend-journaling/internal/models"
+)
+
+// blockTree is an in-memory view of a note's flat block list, indexed by
+// parent so that structural edits can be applied before writing the list back
+type blockTree struct {
+	byID     map[string]*models.Block
+	children map[string][]string // keyed by parent ID, "" for top-level blocks
+}
+
+func newBlockTree(blocks []models.Block) *blockTree {
+	t := &blockTree{
+		byID:     make(map[string]*models.Block, len(blocks)),
+		children: make(map[string][]string),
+	}
+
+	for i := range blocks {
+		block := blocks[i]
+		t.byID[block.ID] = &block
+	}
+
+	sorted := make([]*models.Block, 0, len(blocks))
+	for _, block := range t.byID {
+		// Blocks whose parent no longer exists are lifted to the top level
+		if block.ParentID != nil {
+			if _, ok := t.byID[*block.ParentID]; !ok || *block.ParentID == block.ID {
+				block.ParentID = nil
+			}
+		}
+		sorted = append(sorted, block)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Order != sorted[j].Order {
+			return sorted[i].Order < sorted[j].Order
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	for _, block := range sorted {
+		parent := parentKey(block.ParentID)
+		t.children[parent] = append(t.children[parent], block.ID)
+	}
+
+	// Break any parent cycles left behind by older writes by detaching
+	// blocks that are not reachable from the top level
+	reachable := make(map[string]bool, len(blocks))
+	t.walk("", func(block *models.Block) { reachable[block.ID] = true })
+	for _, block := range sorted {
+		if !reachable[block.ID] {
+			t.detach(block.ID)
+			block.ParentID = nil
+			t.children[""] = append(t.children[""], block.ID)
+			t.walk(block.ID, func(child *models.Block) { reachable[child.ID] = true })
+			reachable[block.ID] = true
+		}
+	}
+
+	return t
+}
+
+func parentKey(parentID *string) string {
+	if parentID == nil {
+		return ""
+	}
+	return *parentID
+}
+
+func (t *blockTree) has(id string) bool {
+	_, ok := t.byID[id]
+	return ok
+}
+
+// walk visits every descendant of parent in depth-first order
+func (t *blockTree) walk(parent string, fn func(block *models.Block)) {
+	for _, id := range t.children[parent] {
+		fn(t.byID[id])
+		t.walk(id, fn)
+	}
+}
+
+// isDescendant reports whether id sits somewhere below ancestor
+func (t *blockTree) isDescendant(id, ancestor string) bool {
+	for current := t.byID[id]; current != nil && current.ParentID != nil; current = t.byID[*current.ParentID] {
+		if *current.ParentID == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// position returns the index of id among its siblings
+func (t *blockTree) position(id string) int {
+	for i, sibling := range t.children[parentKey(t.byID[id].ParentID)] {
+		if sibling == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// detach unlinks id from its parent's children, keeping its own subtree
+func (t *blockTree) detach(id string) {
+	parent := parentKey(t.byID[id].ParentID)
+	siblings := t.children[parent]
+	for i, sibling := range siblings {
+		if sibling == id {
+			t.children[parent] = append(siblings[:i:i], siblings[i+1:]...)
+			return
+		}
+	}
+}
+
+// attach links id under parent at position; out of range positions append
+func (t *blockTree) attach(id, parent string, position int) {
+	siblings := t.children[parent]
+	if position < 0 || position > len(siblings) {
+		position = len(siblings)
+	}
+
+	updated := make([]string, 0, len(siblings)+1)
+	updated = append(updated, siblings[:position]...)
+	updated = append(updated, id)
+	updated = append(updated, siblings[position:]...)
+	t.children[parent] = updated
+
+	if parent == "" {
+		t.byID[id].ParentID = nil
+	} else {
+		p := parent
+		t.byID[id].ParentID = &p
+	}
+}
+
+// insert adds a new block under parent at position
+func (t *blockTree) insert(block models.Block, parent string, position int) error {
+	if parent != "" && !t.has(parent) {
+		return ErrBlockNotFound
+	}
+	if t.has(block.ID) {
+		return ErrInvalidBlockMove
+	}
+
+	t.byID[block.ID] = &block
+	t.attach(block.ID, parent, position)
+	return nil
+}
+
+// move relocates id and its subtree under parent at position
+func (t *blockTree) move(id, parent string, position int) error {
+	if !t.has(id) {
+		return ErrBlockNotFound
+	}
+	if parent != "" {
+		if !t.has(parent) {
+			return ErrBlockNotFound
+		}
+		if parent == id || t.isDescendant(parent, id) {
+			return ErrInvalidBlockMove
+		}
+	}
+
+	t.detach(id)
+	t.attach(id, parent, position)
+	return nil
+}
+
+// indent makes id the last child of its previous sibling
+func (t *blockTree) indent(id string) error {
+	if !t.has(id) {
+		return ErrBlockNotFound
+	}
+
+	pos := t.position(id)
+	if pos <= 0 {
+		return ErrInvalidBlockMove
+	}
+
+	previous := t.children[parentKey(t.byID[id].ParentID)][pos-1]
+	return t.move(id, previous, -1)
+}
+
+// outdent moves id out of its parent, placing it right after the parent
+func (t *blockTree) outdent(id string) error {
+	if !t.has(id) {
+		return ErrBlockNotFound
+	}
+
+	block := t.byID[id]
+	if block.ParentID == nil {
+		return ErrInvalidBlockMove
+	}
+
+	parent := t.byID[*block.ParentID]
+	return t.move(id, parentKey(parent.ParentID), t.position(parent.ID)+1)
+}
+
+// reorder sets the order of parent's children; order must list each of them
+// exactly once
+func (t *blockTree) reorder(parent string, order []string) error {
+	if parent != "" && !t.has(parent) {
+		return ErrBlockNotFound
+	}
+
+	siblings := t.children[parent]
+	if len(order) != len(siblings) {
+		return ErrInvalidBlockOrder
+	}
+
+	expected := make(map[string]bool, len(siblings))
+	for _, id := range siblings {
+		expected[id] = true
+	}
+	for _, id := range order {
+		if !expected[id] {
+			return ErrInvalidBlockOrder
+		}
+		delete(expected, id)
+	}
+
+	t.children[parent] = append([]string(nil), order...)
+	return nil
+}
+
+// remove deletes id together with all of its descendants
+func (t *blockTree) remove(id string) error {
+	if !t.has(id) {
+		return ErrBlockNotFound
+	}
+
+	t.detach(id)
+
+	var drop func(id string)
+	drop = func(id string) {
+		for _, child := range t.children[id] {
+			drop(child)
+		}
+		delete(t.children, id)
+		delete(t.byID, id)
+	}
+	drop(id)
+
+	return nil
+}
+
+// subtree returns id followed by all of its descendants in depth-first order
+func (t *blockTree) subtree(id string) []models.Block {
+	blocks := []models.Block{*t.byID[id]}
+	t.walk(id, func(block *models.Block) {
+		blocks = append(blocks, *block)
+	})
+	return blocks
+}
+
+// graft inserts a detached subtree (root first, as returned by subtree) under
+// parent at position, keeping the parent links inside the subtree
+func (t *blockTree) graft(blocks []models.Block, parent string, position int) error {
+	if parent != "" && !t.has(parent) {
+		return ErrBlockNotFound
+	}
+	for _, block := range blocks {
+		if t.has(block.ID) {
+			return ErrInvalidBlockMove
+		}
+	}
+
+	root := blocks[0]
+	t.byID[root.ID] = &root
+	t.attach(root.ID, parent, position)
+
+	for _, block := range blocks[1:] {
+		block := block
+		t.byID[block.ID] = &block
+		p := parentKey(block.ParentID)
+		t.children[p] = append(t.children[p], block.ID)
+	}
+
+	return nil
+}
+
+// flatten serialises the tree back into Note.Blocks: depth-first, with Order
+// renumbered from zero within every parent
+func (t *blockTree) flatten() []models.Block {
+	blocks := make([]models.Block, 0, len(t.byID))
+
+	var visit func(parent string)
+	visit = func(parent string) {
+		for i, id := range t.children[parent] {
+			block := *t.byID[id]
+			block.Order = i
+			blocks = append(blocks, block)
+			visit(id)
+		}
+	}
+	visit("")
+
+	return blocks
+}
+
+// nodes builds the nested representation of parent's children
+func (t *blockTree) nodes(parent string) []models.BlockNode {
+	nodes := make([]models.BlockNode, 0, len(t.children[parent]))
+	for i, id := range t.children[parent] {
+		block := *t.byID[id]
+		block.Order = i
+		nodes = append(nodes, models.BlockNode{
+			Block:    block,
+			Children: t.nodes(id),
+		})
+	}
+	return nodes
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxBoards                = 50
+	maxBoardNameLength       = 100
+	maxBoardColumns          = 20
+	maxBoardColumnNameLength = 50
+	// maxBoardColumnTasks caps the tasks returned per column; count still
+	// has the full number
+	maxBoardColumnTasks = 200
+)
+
+var (
+	ErrBoardNotFound           = errors.New("board not found")
+	ErrInvalidBoardID          = errors.New("invalid board id")
+	ErrBoardNameRequired       = errors.New("board name is required")
+	ErrBoardNameTooLong        = errors.New("board name is too long")
+	ErrTooManyBoards           = errors.New("too many boards")
+	ErrBoardColumnsRequired    = errors.New("a board needs at least one column")
+	ErrTooManyBoardColumns     = errors.New("too many board columns")
+	ErrBoardColumnNameRequired = errors.New("column name is required")
+	ErrBoardColumnNameTooLong  = errors.New("column name is too long")
+	ErrDuplicateBoardStatus    = errors.New("each status can only have one column")
+	ErrInvalidWIPLimit         = errors.New("wip_limit must be at least 1")
+	ErrBoardColumnNotFound     = errors.New("board column not found")
+	ErrTaskNotOnBoard          = errors.New("task is not on this board")
+	// ErrWIPLimitReached rejects a move into a column that is already full
+	ErrWIPLimitReached = errors.New("column has reached its WIP limit")
+)
+
+// BoardColumnInput describes a column when creating or changing a board. An
+// ID of an existing column keeps that column's id.
+type BoardColumnInput struct {
+	ID       *string
+	Name     string
+	Status   string
+	WIPLimit *int
+}
+
+// BoardMove moves a task into a column, right after the task AfterID, right
+// before the task BeforeID, or last when neither is set
+type BoardMove struct {
+	TaskID   string
+	ColumnID string
+	AfterID  *string
+	BeforeID *string
+}
+
+// BoardView is a board with the tasks of each column in their order
+type BoardView struct {
+	models.Board
+	Columns []BoardColumnView `json:"columns"`
+}
+
+type BoardColumnView struct {
+	models.BoardColumn
+	Count     int64         `json:"count"`
+	OverLimit bool          `json:"over_limit"`
+	Tasks     []models.Task `json:"tasks"`
+}
+
+type BoardService struct {
+	repo  *repository.BoardRepository
+	tasks *TaskService
+}
+
+func NewBoardService(repo *repository.BoardRepository, tasks *TaskService) *BoardService {
+	return &BoardService{repo: repo, tasks: tasks}
+}
+
+func (s *BoardService) ListBoards(ctx context.Context, userID string) ([]models.Board, error) {
+	return s.repo.FindByUserID(ctx, userID)
+}
+
+// CreateBoard creates a board; without columns it gets To Do, In Progress
+// and Done
+func (s *BoardService) CreateBoard(ctx context.Context, userID, name string, tag *string, columns []BoardColumnInput) (*models.Board, error) {
+	name, err := boardName(name)
+	if err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		columns = defaultBoardColumns()
+	}
+	boardColumns, err := buildBoardColumns(columns, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxBoards {
+		return nil, ErrTooManyBoards
+	}
+
+	board := &models.Board{UserID: userID, Name: name, Tag: boardTag(tag), Columns: boardColumns}
+	if err := s.repo.Create(ctx, board); err != nil {
+		return nil, err
+	}
+
+	return board, nil
+}
+
+// GetBoard returns a board with its columns and their tasks
+func (s *BoardService) GetBoard(ctx context.Context, userID, boardID string) (*BoardView, error) {
+	board, err := s.find(ctx, userID, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &BoardView{Board: *board, Columns: make([]BoardColumnView, 0, len(board.Columns))}
+	for _, column := range board.Columns {
+		tasks, err := s.tasks.repo.FindColumn(ctx, userID, column.Status, board.Tag, maxBoardColumnTasks)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.tasks.withProgress(ctx, userID, taskPointers(tasks)); err != nil {
+			return nil, err
+		}
+		count, err := s.tasks.repo.CountColumn(ctx, userID, column.Status, board.Tag, primitive.NilObjectID)
+		if err != nil {
+			return nil, err
+		}
+
+		if tasks == nil {
+			tasks = []models.Task{}
+		}
+		view.Columns = append(view.Columns, BoardColumnView{
+			BoardColumn: column,
+			Count:       count,
+			OverLimit:   column.WIPLimit != nil && count > int64(*column.WIPLimit),
+			Tasks:       tasks,
+		})
+	}
+
+	return view, nil
+}
+
+// UpdateBoard renames a board, changes its tag or replaces its columns. An
+// empty tag shows all tasks again; nil columns keep the columns as they are.
+func (s *BoardService) UpdateBoard(ctx context.Context, userID, boardID string, name, tag *string, columns []BoardColumnInput) (*models.Board, error) {
+	board, err := s.find(ctx, userID, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	if name != nil {
+		value, err := boardName(*name)
+		if err != nil {
+			return nil, err
+		}
+		set["name"] = value
+	}
+	if tag != nil {
+		if value := boardTag(tag); value != nil {
+			set["tag"] = *value
+		} else {
+			unset["tag"] = ""
+		}
+	}
+	if columns != nil {
+		value, err := buildBoardColumns(columns, board.Columns)
+		if err != nil {
+			return nil, err
+		}
+		set["columns"] = value
+	}
+
+	if err := s.repo.Update(ctx, board.ID, userID, set, unset); err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByID(ctx, board.ID, userID)
+}
+
+// DeleteBoard deletes a board; its tasks are left as they are
+func (s *BoardService) DeleteBoard(ctx context.Context, userID, boardID string) error {
+	board, err := s.find(ctx, userID, boardID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, board.ID, userID)
+}
+
+// MoveTask drops a task into a column of a board, changing its status and
+// its place in the column in a single write. Moving into a full column, or
+// against the task workflow, is refused; moving into the done column
+// completes the task.
+func (s *BoardService) MoveTask(ctx context.Context, userID, boardID string, move BoardMove) (*models.Task, error) {
+	if move.AfterID != nil && move.BeforeID != nil {
+		return nil, ErrAmbiguousPlacement
+	}
+
+	board, err := s.find(ctx, userID, boardID)
+	if err != nil {
+		return nil, err
+	}
+	var column *models.BoardColumn
+	for i := range board.Columns {
+		if board.Columns[i].ID == move.ColumnID {
+			column = &board.Columns[i]
+		}
+	}
+	if column == nil {
+		return nil, ErrBoardColumnNotFound
+	}
+
+	task, err := s.tasks.findTask(ctx, userID, move.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	if !onBoard(board, task) {
+		return nil, ErrTaskNotOnBoard
+	}
+	if err := checkTransition(task.Status, column.Status); err != nil {
+		return nil, err
+	}
+
+	// The WIP check, the placement and the move form one transaction. It
+	// may run more than once, each time on the task as it was read.
+	var after followUp
+	err = s.tasks.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		moving := *task
+		var err error
+		after, err = s.place(ctx, userID, column, &moving, move)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := after(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.tasks.GetTask(ctx, task.ID.Hex(), userID)
+}
+
+// place moves a task into a column at the place a move asks for, and returns
+// the follow-up on the move. The move goes through the task workflow, which
+// checks the column's WIP limit.
+func (s *BoardService) place(ctx context.Context, userID string, column *models.BoardColumn, task *models.Task, move BoardMove) (followUp, error) {
+	// Positions are shared by every board showing the status, so the task
+	// is placed among all of them, not only those tagged for this board
+	tasks, err := s.tasks.repo.FindColumn(ctx, userID, column.Status, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	others := make([]models.Task, 0, len(tasks))
+	for _, other := range tasks {
+		if other.ID != task.ID {
+			others = append(others, other)
+		}
+	}
+
+	at := len(others)
+	if anchor := firstNonNil(move.AfterID, move.BeforeID); anchor != nil {
+		at = -1
+		for i, other := range others {
+			if other.ID.Hex() == *anchor {
+				at = i
+			}
+		}
+		if at < 0 {
+			return nil, ErrInvalidPlacement
+		}
+		if move.AfterID != nil {
+			at++
+		}
+	}
+
+	position, err := s.tasks.slot(ctx, userID, others, at)
+	if err != nil {
+		return nil, err
+	}
+	set := bson.M{"position": position}
+	return s.tasks.transition(ctx, task, column.Status, false, set, nil)
+}
+
+func (s *BoardService) find(ctx context.Context, userID, boardID string) (*models.Board, error) {
+	objID, err := primitive.ObjectIDFromHex(boardID)
+	if err != nil {
+		return nil, ErrInvalidBoardID
+	}
+
+	board, err := s.repo.FindByID(ctx, objID, userID)
+	if IsNotFound(err) {
+		return nil, ErrBoardNotFound
+	}
+	return board, err
+}
+
+// onBoard reports whether a board shows a task: a top-level task carrying
+// the board's tag, if it has one
+func onBoard(board *models.Board, task *models.Task) bool {
+	if task.ParentID != nil {
+		return false
+	}
+	if board.Tag == nil {
+		return true
+	}
+	for _, tag := range task.Tags {
+		if normalizeTag(tag) == *board.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBoardColumns validates columns, keeping the ids of existing columns
+// that are named by id
+func buildBoardColumns(columns []BoardColumnInput, existing []models.BoardColumn) ([]models.BoardColumn, error) {
+	if len(columns) == 0 {
+		return nil, ErrBoardColumnsRequired
+	}
+	if len(columns) > maxBoardColumns {
+		return nil, ErrTooManyBoardColumns
+	}
+
+	known := make(map[string]bool, len(existing))
+	for _, column := range existing {
+		known[column.ID] = true
+	}
+
+	result := make([]models.BoardColumn, 0, len(columns))
+	statuses := make(map[string]bool, len(columns))
+	for _, in := range columns {
+		name := strings.TrimSpace(in.Name)
+		if name == "" {
+			return nil, ErrBoardColumnNameRequired
+		}
+		if utf8.RuneCountInString(name) > maxBoardColumnNameLength {
+			return nil, ErrBoardColumnNameTooLong
+		}
+		if !validTaskStatus(in.Status) {
+			return nil, ErrInvalidTaskStatus
+		}
+		if statuses[in.Status] {
+			return nil, ErrDuplicateBoardStatus
+		}
+		statuses[in.Status] = true
+		if in.WIPLimit != nil && *in.WIPLimit < 1 {
+			return nil, ErrInvalidWIPLimit
+		}
+
+		column := models.BoardColumn{ID: uuid.New().String(), Name: name, Status: in.Status, WIPLimit: in.WIPLimit}
+		if in.ID != nil && known[*in.ID] {
+			column.ID = *in.ID
+			delete(known, *in.ID)
+		}
+		result = append(result, column)
+	}
+
+	return result, nil
+}
+
+func defaultBoardColumns() []BoardColumnInput {
+	return []BoardColumnInput{
+		{Name: "To Do", Status: "todo"},
+		{Name: "In Progress", Status: "in_progress"},
+		{Name: "Done", Status: "done"},
+	}
+}
+
+func boardName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrBoardNameRequired
+	}
+	if utf8.RuneCountInString(name) > maxBoardNameLength {
+		return "", ErrBoardNameTooLong
+	}
+	return name, nil
+}
+
+// boardTag normalises a board's tag; an empty one means none
+func boardTag(tag *string) *string {
+	if tag == nil {
+		return nil
+	}
+	value := normalizeTag(*tag)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
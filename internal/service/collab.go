@@ -0,0 +1,797 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidCollabOp = errors.New("invalid operation")
+	ErrCollabResync    = errors.New("revision is too old, resync required")
+)
+
+// Kinds of CollabOp
+const (
+	CollabOpInsert = "insert"
+	CollabOpText   = "text"
+	CollabOpDelete = "delete"
+	CollabOpMove   = "move"
+)
+
+// Types of messages exchanged with collaborative editing clients
+const (
+	CollabMessageOp       = "op"
+	CollabMessageSync     = "sync"
+	CollabMessageSnapshot = "snapshot"
+	CollabMessageAck      = "ack"
+	CollabMessageReject   = "reject"
+	CollabMessagePresence = "presence"
+	CollabMessageClosed   = "closed"
+)
+
+const (
+	// collabPersistInterval is how often a live note is written back to
+	// MongoDB, and how often an idle one checks for changes made elsewhere
+	collabPersistInterval = 2 * time.Second
+	// collabLogSize bounds the operations kept to transform late operations;
+	// clients further behind must resync
+	collabLogSize = 1000
+	// collabSendBuffer is how many messages a client may fall behind before
+	// it is disconnected
+	collabSendBuffer = 256
+	// collabWriteTimeout bounds a single write back of a live note
+	collabWriteTimeout = 10 * time.Second
+)
+
+// CollabOp is an edit of a note's blocks. Blocks are addressed by ID, and new
+// positions by the sibling to place a block after, so only concurrent text
+// edits of the same block need to be transformed.
+//
+//   - insert adds block BlockID of Type under ParentID
+//   - text applies Text to the block's content_md
+//   - delete removes the block with all of its children
+//   - move places the block and its children under ParentID
+//
+// For insert and move, AfterID names the sibling to follow; an empty AfterID
+// places the block first and a missing one appends it.
+type CollabOp struct {
+	Kind      string            `json:"kind"`
+	BlockID   string            `json:"block_id"`
+	Type      string            `json:"type,omitempty"`
+	ContentMD *string           `json:"content_md,omitempty"`
+	Items     []models.TodoItem `json:"items,omitempty"`
+	ParentID  *string           `json:"parent_id,omitempty"`
+	AfterID   *string           `json:"after_id,omitempty"`
+	Text      TextOp            `json:"text,omitempty"`
+}
+
+// CollabClientMessage is sent by a client: an operation made on top of
+// Revision, or a request for a fresh snapshot
+type CollabClientMessage struct {
+	Type       string    `json:"type"`
+	ClientOpID string    `json:"client_op_id,omitempty"`
+	Revision   int64     `json:"revision"`
+	Op         *CollabOp `json:"op,omitempty"`
+}
+
+// CollabPresence is one connection to a live note
+type CollabPresence struct {
+	ClientID string    `json:"client_id"`
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// CollabMessage is sent to clients. Operations of other clients arrive as op
+// messages, the client's own as ack with the revision they were given.
+type CollabMessage struct {
+	Type       string           `json:"type"`
+	Revision   int64            `json:"revision"`
+	ClientOpID string           `json:"client_op_id,omitempty"`
+	UserID     string           `json:"user_id,omitempty"`
+	Op         *CollabOp        `json:"op,omitempty"`
+	Blocks     []models.Block   `json:"blocks,omitempty"`
+	Presence   []CollabPresence `json:"presence,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// CollabService keeps one live session per note being edited over
+// WebSocket. A session holds the merged blocks in memory, orders incoming
+// operations into revisions, transforms operations made on older revisions
+// and writes the result back to the note periodically.
+type CollabService struct {
+	notes collabNotes
+
+	mu       sync.Mutex
+	sessions map[primitive.ObjectID]*collabSession
+}
+
+func NewCollabService(notes *NoteService) *CollabService {
+	return newCollabService(noteStore{notes})
+}
+
+func newCollabService(notes collabNotes) *CollabService {
+	return &CollabService{
+		notes:    notes,
+		sessions: make(map[primitive.ObjectID]*collabSession),
+	}
+}
+
+// collabNotes is how live sessions check access to and read and write their
+// notes
+type collabNotes interface {
+	access(ctx context.Context, userID string, noteID primitive.ObjectID) (authz.Principal, error)
+	load(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) (*models.Note, error)
+	replaceBlocks(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, version int64, blocks []models.Block) error
+	blocksWritten(ctx context.Context, note *models.Note) error
+}
+
+// noteStore keeps live notes in MongoDB through the NoteService
+type noteStore struct {
+	notes *NoteService
+}
+
+func (s noteStore) access(ctx context.Context, userID string, noteID primitive.ObjectID) (authz.Principal, error) {
+	return s.notes.access.Note(ctx, userID, noteID, authz.ActionView)
+}
+
+func (s noteStore) load(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) (*models.Note, error) {
+	return s.notes.repo.FindByID(ctx, noteID, p)
+}
+
+func (s noteStore) replaceBlocks(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, version int64, blocks []models.Block) error {
+	return s.notes.repo.ReplaceBlocks(ctx, noteID, p, version, blocks)
+}
+
+func (s noteStore) blocksWritten(ctx context.Context, note *models.Note) error {
+	return s.notes.blocksWritten(ctx, note)
+}
+
+// CollabClient is one connection to a live note. Messages for it arrive on
+// Messages, which is closed when the client is disconnected.
+type CollabClient struct {
+	presence CollabPresence
+	canEdit  bool
+	send     chan CollabMessage
+	session  *collabSession
+}
+
+// Join connects a user to the live session of a note, starting it if needed.
+// The first message the client receives is a snapshot of the note.
+func (s *CollabService) Join(ctx context.Context, noteID, userID, email string) (*CollabClient, error) {
+	objID, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return nil, ErrInvalidNoteID
+	}
+
+	p, err := s.notes.access(ctx, userID, objID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &CollabClient{
+		presence: CollabPresence{
+			ClientID: uuid.New().String(),
+			UserID:   userID,
+			Email:    email,
+			Role:     p.Role,
+			JoinedAt: time.Now(),
+		},
+		canEdit: p.Can(authz.ActionEdit),
+		send:    make(chan CollabMessage, collabSendBuffer),
+	}
+
+	// The note is read without holding s.mu, so that starting one session
+	// does not stall every other note; a session started meanwhile wins
+	var note *models.Note
+	for {
+		s.mu.Lock()
+		session, ok := s.sessions[objID]
+		if !ok && note != nil {
+			session = newCollabSession(s, note)
+			s.sessions[objID] = session
+			go session.run()
+			ok = true
+		}
+		if ok {
+			// Adding under s.mu keeps closeIfIdle from dropping the session
+			// before the client is in it
+			client.session = session
+			session.add(client)
+			s.mu.Unlock()
+			return client, nil
+		}
+		s.mu.Unlock()
+
+		if note, err = s.notes.load(ctx, objID, p); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Reauthorize checks again what a user may do on the notes they edit live,
+// after their access changed. Clients that lost access are disconnected and
+// the others take their new role.
+func (s *CollabService) Reauthorize(ctx context.Context, userID string) {
+	s.mu.Lock()
+	sessions := make([]*collabSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		if err := session.reauthorize(ctx, userID); err != nil {
+			log.Printf("collab: re-authorizing note %s failed: %v", session.noteID.Hex(), err)
+		}
+	}
+}
+
+// Messages delivers what the client has to apply or show
+func (c *CollabClient) Messages() <-chan CollabMessage {
+	return c.send
+}
+
+// Submit hands a message of the client to its session. The outcome arrives
+// on Messages.
+func (c *CollabClient) Submit(msg CollabClientMessage) {
+	c.session.submit(c, msg)
+}
+
+// Leave disconnects the client
+func (c *CollabClient) Leave() {
+	c.session.remove(c)
+}
+
+type collabEntry struct {
+	revision int64
+	op       CollabOp
+}
+
+type collabSession struct {
+	service *CollabService
+	noteID  primitive.ObjectID
+	ownerID string
+
+	mu       sync.Mutex
+	tree     *blockTree
+	version  int64 // note version the tree was last written or read at
+	revision int64 // operations applied so far
+	floor    int64 // oldest revision an operation may still be made on
+	log      []collabEntry
+	// touched maps the blocks changed since the last write to the revision
+	// of their last change
+	touched map[string]int64
+	clients map[string]*CollabClient
+}
+
+func newCollabSession(service *CollabService, note *models.Note) *collabSession {
+	return &collabSession{
+		service: service,
+		noteID:  note.ID,
+		ownerID: note.UserID,
+		tree:    newBlockTree(note.Blocks),
+		version: note.Version,
+		touched: make(map[string]int64),
+		clients: make(map[string]*CollabClient),
+	}
+}
+
+// writer is the principal the session writes the note with. Every client's
+// role was checked before its operations were applied, and is checked again
+// before each write (see reauthorize).
+func (c *collabSession) writer() authz.Principal {
+	return authz.Principal{OwnerID: c.ownerID, Role: authz.RoleEditor}
+}
+
+func (c *collabSession) add(client *CollabClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clients[client.presence.ClientID] = client
+	c.deliver(client, c.snapshot())
+	c.broadcastPresence()
+}
+
+func (c *collabSession) remove(client *CollabClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.clients[client.presence.ClientID]; !ok {
+		return
+	}
+	delete(c.clients, client.presence.ClientID)
+	close(client.send)
+	c.broadcastPresence()
+}
+
+func (c *collabSession) submit(client *CollabClient, msg CollabClientMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.clients[client.presence.ClientID]; !ok {
+		return
+	}
+
+	switch msg.Type {
+	case CollabMessageSync:
+		c.deliver(client, c.snapshot())
+		return
+	case CollabMessageOp:
+	default:
+		c.reject(client, msg.ClientOpID, ErrInvalidCollabOp)
+		return
+	}
+
+	if !client.canEdit {
+		c.reject(client, msg.ClientOpID, authz.ErrForbidden)
+		return
+	}
+	if msg.Op == nil || msg.Revision > c.revision {
+		c.reject(client, msg.ClientOpID, ErrInvalidCollabOp)
+		return
+	}
+	if msg.Revision < c.floor {
+		c.reject(client, msg.ClientOpID, ErrCollabResync)
+		c.deliver(client, c.snapshot())
+		return
+	}
+
+	op, err := c.transform(*msg.Op, msg.Revision)
+	if err == nil {
+		err = c.apply(op)
+	}
+	if err != nil {
+		c.reject(client, msg.ClientOpID, err)
+		return
+	}
+
+	c.revision++
+	c.log = append(c.log, collabEntry{revision: c.revision, op: op})
+	if len(c.log) > collabLogSize {
+		c.floor = c.log[0].revision
+		c.log = c.log[1:]
+	}
+
+	c.deliver(client, CollabMessage{Type: CollabMessageAck, Revision: c.revision, ClientOpID: msg.ClientOpID})
+	for _, other := range c.clients {
+		if other != client {
+			c.deliver(other, CollabMessage{
+				Type:     CollabMessageOp,
+				Revision: c.revision,
+				UserID:   client.presence.UserID,
+				Op:       &op,
+			})
+		}
+	}
+}
+
+// transform rewrites an operation made on revision so that it applies on top
+// of every operation accepted since
+func (c *collabSession) transform(op CollabOp, revision int64) (CollabOp, error) {
+	if op.Kind != CollabOpText {
+		return op, nil
+	}
+
+	text, err := op.Text.normalize()
+	if err != nil {
+		return op, err
+	}
+
+	for _, entry := range c.log {
+		if entry.revision <= revision || entry.op.Kind != CollabOpText || entry.op.BlockID != op.BlockID {
+			continue
+		}
+		// The accepted operation came first, so its inserts stay in front
+		if _, text, err = transformText(entry.op.Text, text); err != nil {
+			return op, err
+		}
+	}
+
+	op.Text = text
+	return op, nil
+}
+
+// apply runs an operation on the session's blocks
+func (c *collabSession) apply(op CollabOp) error {
+	t := c.tree
+
+	switch op.Kind {
+	case CollabOpInsert:
+		if op.BlockID == "" || op.Type == "" || t.has(op.BlockID) {
+			return ErrInvalidCollabOp
+		}
+		// Image blocks need an uploaded attachment and go through the REST API
+		if op.Type == "image" {
+			return ErrInvalidCollabOp
+		}
+
+		block := models.Block{ID: op.BlockID, Type: op.Type}
+		if op.Type == "todo" {
+			block.Items = op.Items
+		} else {
+			content := ""
+			if op.ContentMD != nil {
+				content = *op.ContentMD
+			}
+			block.ContentMD = &content
+		}
+
+		parent := parentKey(op.ParentID)
+		if err := t.insert(block, parent, c.anchor(parent, op.AfterID, op.BlockID)); err != nil {
+			return err
+		}
+		c.touched[op.BlockID] = c.revision + 1
+
+	case CollabOpText:
+		block, ok := t.byID[op.BlockID]
+		if !ok {
+			return ErrBlockNotFound
+		}
+		if block.ContentMD == nil {
+			return ErrInvalidCollabOp
+		}
+
+		content, err := op.Text.apply(*block.ContentMD)
+		if err != nil {
+			return err
+		}
+		block.ContentMD = &content
+		c.touched[op.BlockID] = c.revision + 1
+
+	case CollabOpDelete:
+		if !t.has(op.BlockID) {
+			return ErrBlockNotFound
+		}
+		for _, block := range t.subtree(op.BlockID) {
+			c.touched[block.ID] = c.revision + 1
+		}
+		return t.remove(op.BlockID)
+
+	case CollabOpMove:
+		if !t.has(op.BlockID) {
+			return ErrBlockNotFound
+		}
+
+		parent := parentKey(op.ParentID)
+		if err := t.move(op.BlockID, parent, c.anchor(parent, op.AfterID, op.BlockID)); err != nil {
+			return err
+		}
+		c.touched[op.BlockID] = c.revision + 1
+
+	default:
+		return ErrInvalidCollabOp
+	}
+
+	return nil
+}
+
+// anchor turns the sibling a block is placed after into a position among
+// parent's children without the block itself. A sibling that is gone or was
+// moved elsewhere in the meantime appends the block instead.
+func (c *collabSession) anchor(parent string, afterID *string, self string) int {
+	if afterID == nil {
+		return -1
+	}
+	if *afterID == "" {
+		return 0
+	}
+
+	position := 0
+	for _, id := range c.tree.children[parent] {
+		if id == self {
+			continue
+		}
+		position++
+		if id == *afterID {
+			return position
+		}
+	}
+	return -1
+}
+
+func (c *collabSession) snapshot() CollabMessage {
+	return CollabMessage{
+		Type:     CollabMessageSnapshot,
+		Revision: c.revision,
+		Blocks:   c.tree.flatten(),
+		Presence: c.presence(),
+	}
+}
+
+func (c *collabSession) presence() []CollabPresence {
+	presence := make([]CollabPresence, 0, len(c.clients))
+	for _, client := range c.clients {
+		presence = append(presence, client.presence)
+	}
+	sort.Slice(presence, func(i, j int) bool {
+		return presence[i].JoinedAt.Before(presence[j].JoinedAt)
+	})
+	return presence
+}
+
+func (c *collabSession) broadcastPresence() {
+	msg := CollabMessage{Type: CollabMessagePresence, Revision: c.revision, Presence: c.presence()}
+	for _, client := range c.clients {
+		c.deliver(client, msg)
+	}
+}
+
+func (c *collabSession) reject(client *CollabClient, clientOpID string, err error) {
+	c.deliver(client, CollabMessage{
+		Type:       CollabMessageReject,
+		Revision:   c.revision,
+		ClientOpID: clientOpID,
+		Error:      err.Error(),
+	})
+}
+
+// deliver queues a message for a client, disconnecting clients that fell
+// too far behind. The caller holds c.mu.
+func (c *collabSession) deliver(client *CollabClient, msg CollabMessage) {
+	select {
+	case client.send <- msg:
+	default:
+		delete(c.clients, client.presence.ClientID)
+		close(client.send)
+	}
+}
+
+// reauthorize resolves the access of the session's clients again, of every
+// client when userID is empty. Clients that can no longer see the note are
+// disconnected and the others take their current role.
+func (c *collabSession) reauthorize(ctx context.Context, userID string) error {
+	c.mu.Lock()
+	users := make(map[string]bool)
+	for _, client := range c.clients {
+		if userID == "" || client.presence.UserID == userID {
+			users[client.presence.UserID] = true
+		}
+	}
+	c.mu.Unlock()
+
+	principals := make(map[string]authz.Principal, len(users))
+	revoked := make(map[string]bool)
+	for user := range users {
+		p, err := c.service.notes.access(ctx, user, c.noteID)
+		if IsNotFound(err) || errors.Is(err, authz.ErrForbidden) {
+			revoked[user] = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		principals[user] = p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	for _, client := range c.clients {
+		user := client.presence.UserID
+		if revoked[user] {
+			c.evict(client, "access to the note was revoked")
+			changed = true
+			continue
+		}
+		p, ok := principals[user]
+		if !ok {
+			continue
+		}
+		if client.presence.Role != p.Role || client.canEdit != p.Can(authz.ActionEdit) {
+			client.presence.Role = p.Role
+			client.canEdit = p.Can(authz.ActionEdit)
+			changed = true
+		}
+	}
+	if changed {
+		c.broadcastPresence()
+	}
+	return nil
+}
+
+// evict disconnects a client with a closed message. The caller holds c.mu.
+func (c *collabSession) evict(client *CollabClient, reason string) {
+	select {
+	case client.send <- CollabMessage{Type: CollabMessageClosed, Revision: c.revision, Error: reason}:
+	default:
+	}
+	delete(c.clients, client.presence.ClientID)
+	close(client.send)
+}
+
+// resetClients starts a new revision from the current blocks after they
+// changed outside of the operation log, and sends everyone a snapshot
+func (c *collabSession) resetClients() {
+	c.revision++
+	c.floor = c.revision
+	c.log = nil
+
+	msg := c.snapshot()
+	for _, client := range c.clients {
+		c.deliver(client, msg)
+	}
+}
+
+// run writes the note back until the session is closed
+func (c *collabSession) run() {
+	ticker := time.NewTicker(collabPersistInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), collabWriteTimeout)
+		err := c.sync(ctx)
+		cancel()
+
+		if IsNotFound(err) {
+			c.service.end(c, "note was deleted")
+			return
+		}
+		// Other errors are retried on the next tick
+		if c.service.closeIfIdle(c) {
+			return
+		}
+	}
+}
+
+// sync writes pending changes back to the note, or picks up changes made
+// through the REST API when there are none
+func (c *collabSession) sync(ctx context.Context) error {
+	c.mu.Lock()
+	dirty := len(c.touched) > 0
+	c.mu.Unlock()
+
+	if dirty {
+		// Pending changes are only written while their authors may still
+		// make them; clients whose access was revoked are dropped first
+		if err := c.reauthorize(ctx, ""); err != nil {
+			return err
+		}
+		return c.persist(ctx)
+	}
+	return c.refresh(ctx)
+}
+
+func (c *collabSession) persist(ctx context.Context) error {
+	notes := c.service.notes
+
+	for attempt := 0; attempt < maxBlockWriteAttempts; attempt++ {
+		c.mu.Lock()
+		blocks := c.tree.flatten()
+		version := c.version
+		revision := c.revision
+		c.mu.Unlock()
+
+		err := notes.replaceBlocks(ctx, c.noteID, c.writer(), version, blocks)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			fresh, err := notes.load(ctx, c.noteID, c.writer())
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.merge(fresh)
+			c.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.version = version + 1
+		for id, changed := range c.touched {
+			if changed <= revision {
+				delete(c.touched, id)
+			}
+		}
+		c.mu.Unlock()
+
+		// The blocks are stored at this point; a failed re-index is not
+		// retried by the next tick, so it is logged instead of returned
+		if err := notes.blocksWritten(ctx, &models.Note{ID: c.noteID, UserID: c.ownerID, Blocks: blocks}); err != nil {
+			log.Printf("collab: indexing note %s failed: %v", c.noteID.Hex(), err)
+		}
+		return nil
+	}
+
+	return ErrBlockConflict
+}
+
+// merge rebases the session on a note that was changed through the REST API
+// while it was live. Blocks changed in the session keep the session's
+// content and place; everything else takes the stored state.
+func (c *collabSession) merge(fresh *models.Note) {
+	merged := newBlockTree(fresh.Blocks)
+
+	for id := range c.touched {
+		if !c.tree.has(id) && merged.has(id) {
+			merged.remove(id)
+		}
+	}
+
+	c.tree.walk("", func(block *models.Block) {
+		if _, ok := c.touched[block.ID]; !ok {
+			return
+		}
+
+		parent := parentKey(block.ParentID)
+		if parent != "" && !merged.has(parent) {
+			parent = ""
+		}
+		position := c.tree.position(block.ID)
+
+		stored, ok := merged.byID[block.ID]
+		if !ok {
+			merged.insert(*block, parent, position)
+			return
+		}
+		stored.Type = block.Type
+		stored.ContentMD = block.ContentMD
+		stored.Items = block.Items
+		stored.AttachmentID = block.AttachmentID
+		// A move that would now create a cycle keeps the stored place
+		merged.move(block.ID, parent, position)
+	})
+
+	c.tree = merged
+	c.version = fresh.Version
+	c.resetClients()
+}
+
+func (c *collabSession) refresh(ctx context.Context) error {
+	fresh, err := c.service.notes.load(ctx, c.noteID, c.writer())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Operations that arrived meanwhile are merged on the next write instead
+	if fresh.Version != c.version && len(c.touched) == 0 {
+		c.tree = newBlockTree(fresh.Blocks)
+		c.version = fresh.Version
+		c.resetClients()
+	}
+	return nil
+}
+
+// closeIfIdle drops a session without clients once everything is written
+func (s *CollabService) closeIfIdle(c *collabSession) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.clients) > 0 || len(c.touched) > 0 {
+		return false
+	}
+	delete(s.sessions, c.noteID)
+	return true
+}
+
+// end disconnects every client of a session whose note is gone
+func (s *CollabService) end(c *collabSession, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(s.sessions, c.noteID)
+	for _, client := range c.clients {
+		c.evict(client, reason)
+	}
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memNotes keeps a single note in memory in place of MongoDB
+type memNotes struct {
+	mu      sync.Mutex
+	note    models.Note
+	roles   map[string]string
+	written int
+}
+
+func newMemNotes(ownerID string, blocks []models.Block) *memNotes {
+	return &memNotes{
+		note:  models.Note{ID: primitive.NewObjectID(), UserID: ownerID, Version: 1, Blocks: blocks},
+		roles: map[string]string{ownerID: authz.RoleOwner},
+	}
+}
+
+func (m *memNotes) setRole(userID, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if role == "" {
+		delete(m.roles, userID)
+		return
+	}
+	m.roles[userID] = role
+}
+
+func (m *memNotes) stored() models.Note {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	note := m.note
+	note.Blocks = append([]models.Block(nil), m.note.Blocks...)
+	return note
+}
+
+func (m *memNotes) access(ctx context.Context, userID string, noteID primitive.ObjectID) (authz.Principal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, ok := m.roles[userID]
+	if !ok || noteID != m.note.ID {
+		return authz.Principal{}, mongo.ErrNoDocuments
+	}
+	return authz.Principal{UserID: userID, OwnerID: m.note.UserID, Role: role}, nil
+}
+
+func (m *memNotes) load(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) (*models.Note, error) {
+	if noteID != m.note.ID {
+		return nil, mongo.ErrNoDocuments
+	}
+	note := m.stored()
+	return &note, nil
+}
+
+func (m *memNotes) replaceBlocks(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, version int64, blocks []models.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if version != m.note.Version {
+		return repository.ErrVersionConflict
+	}
+	m.note.Blocks = blocks
+	m.note.Version++
+	return nil
+}
+
+func (m *memNotes) blocksWritten(ctx context.Context, note *models.Note) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.written++
+	return nil
+}
+
+// collabServer serves live sessions over WebSocket the way CollabHandler
+// does, taking the user from the query string
+func collabServer(t *testing.T, svc *CollabService) *httptest.Server {
+	t.Helper()
+
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := svc.Join(r.Context(), r.URL.Query().Get("note"), r.URL.Query().Get("user"), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			client.Leave()
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			for msg := range client.Messages() {
+				if err := conn.WriteJSON(msg); err != nil {
+					client.Leave()
+					return
+				}
+			}
+		}()
+		go func() {
+			defer client.Leave()
+			for {
+				var msg CollabClientMessage
+				if err := conn.ReadJSON(&msg); err != nil {
+					return
+				}
+				client.Submit(msg)
+			}
+		}()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// editor is a WebSocket client that keeps one operation in flight, like a
+// real editor, and tracks the content of every block at the last revision
+// it knows
+type editor struct {
+	t        *testing.T
+	user     string
+	conn     *websocket.Conn
+	revision int64
+	content  map[string]string
+	inflight *CollabOp
+}
+
+func dialEditor(t *testing.T, server *httptest.Server, noteID primitive.ObjectID, user string) *editor {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?note=" + noteID.Hex() + "&user=" + user
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial as %s: %v", user, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	e := &editor{t: t, user: user, conn: conn}
+	snapshot := e.read(CollabMessageSnapshot)
+	e.revision = snapshot.Revision
+	e.content = contents(snapshot.Blocks)
+	return e
+}
+
+// fatalf fails the test and stops the editor; editors run on their own
+// goroutines, where t.Fatalf must not be used
+func (e *editor) fatalf(format string, args ...interface{}) {
+	e.t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func contents(blocks []models.Block) map[string]string {
+	content := make(map[string]string, len(blocks))
+	for _, block := range blocks {
+		if block.ContentMD != nil {
+			content[block.ID] = *block.ContentMD
+		}
+	}
+	return content
+}
+
+// read returns the next message of a type, applying operations of other
+// clients on the way
+func (e *editor) read(typ string) CollabMessage {
+	e.t.Helper()
+
+	for {
+		e.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg CollabMessage
+		if err := e.conn.ReadJSON(&msg); err != nil {
+			e.fatalf("%s: reading %s: %v", e.user, typ, err)
+		}
+
+		switch msg.Type {
+		case CollabMessageReject:
+			e.fatalf("%s: operation %s rejected: %s", e.user, msg.ClientOpID, msg.Error)
+		case CollabMessageOp:
+			e.applyRemote(*msg.Op)
+			e.revision = msg.Revision
+		}
+		if msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// applyRemote applies another client's operation and rebases the one in
+// flight on it, as the session did when it accepted it first
+func (e *editor) applyRemote(op CollabOp) {
+	if e.inflight != nil && e.inflight.Kind == CollabOpText && op.Kind == CollabOpText && op.BlockID == e.inflight.BlockID {
+		_, rebased, err := transformText(op.Text, e.inflight.Text)
+		if err != nil {
+			e.fatalf("%s: transform: %v", e.user, err)
+		}
+		e.inflight.Text = rebased
+	}
+	e.apply(op)
+}
+
+func (e *editor) apply(op CollabOp) {
+	switch op.Kind {
+	case CollabOpInsert:
+		e.content[op.BlockID] = *op.ContentMD
+	case CollabOpText:
+		text, err := op.Text.apply(e.content[op.BlockID])
+		if err != nil {
+			e.fatalf("%s: apply: %v", e.user, err)
+		}
+		e.content[op.BlockID] = text
+	}
+}
+
+// edit sends an operation on the revision the editor knows and waits for
+// its ack
+func (e *editor) edit(id string, op CollabOp) {
+	e.t.Helper()
+
+	e.inflight = &op
+	if err := e.conn.WriteJSON(CollabClientMessage{Type: CollabMessageOp, ClientOpID: id, Revision: e.revision, Op: &op}); err != nil {
+		e.fatalf("%s: send: %v", e.user, err)
+	}
+	for {
+		ack := e.read(CollabMessageAck)
+		if ack.ClientOpID != id {
+			continue
+		}
+		e.apply(*e.inflight)
+		e.inflight = nil
+		e.revision = ack.Revision
+		return
+	}
+}
+
+// waitFor reads until the editor has seen revision
+func (e *editor) waitFor(revision int64) {
+	for e.revision < revision {
+		e.read(CollabMessageOp)
+	}
+}
+
+func TestCollabClientsConverge(t *testing.T) {
+	const opsPerClient = 20
+
+	store := newMemNotes("alice", []models.Block{
+		{ID: "p", Type: "paragraph", ContentMD: strPtr("shared")},
+	})
+	store.setRole("bob", authz.RoleEditor)
+	svc := newCollabService(store)
+	server := collabServer(t, svc)
+
+	editors := []*editor{
+		dialEditor(t, server, store.note.ID, "alice"),
+		dialEditor(t, server, store.note.ID, "bob"),
+	}
+
+	// Both clients type into the same block and add blocks at the same
+	// place without waiting for each other
+	var wg sync.WaitGroup
+	for _, e := range editors {
+		wg.Add(1)
+		go func(e *editor) {
+			defer wg.Done()
+			for i := 0; i < opsPerClient; i++ {
+				id := fmt.Sprintf("%s-%d", e.user, i)
+				if i%3 == 2 {
+					after := "p"
+					e.edit(id, CollabOp{Kind: CollabOpInsert, BlockID: id, Type: "paragraph", ContentMD: strPtr(id), AfterID: &after})
+					continue
+				}
+				length := utf8.RuneCountInString(e.content["p"])
+				at := (i * 7) % (length + 1)
+				var text textBuilder
+				text.retain(at)
+				text.insert(e.user[:1])
+				text.retain(length - at)
+				e.edit(id, CollabOp{Kind: CollabOpText, BlockID: "p", Text: text.op})
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	total := int64(len(editors) * opsPerClient)
+	var snapshots []CollabMessage
+	for _, e := range editors {
+		e.waitFor(total)
+		if err := e.conn.WriteJSON(CollabClientMessage{Type: CollabMessageSync}); err != nil {
+			t.Fatalf("%s: sync: %v", e.user, err)
+		}
+		snapshots = append(snapshots, e.read(CollabMessageSnapshot))
+	}
+
+	for i, e := range editors {
+		if snapshots[i].Revision != total {
+			t.Errorf("%s: snapshot revision = %d, want %d", e.user, snapshots[i].Revision, total)
+		}
+		if !reflect.DeepEqual(e.content, contents(snapshots[i].Blocks)) {
+			t.Errorf("%s diverged from the session\n got: %v\nwant: %v", e.user, e.content, contents(snapshots[i].Blocks))
+		}
+	}
+	if !reflect.DeepEqual(snapshots[0].Blocks, snapshots[1].Blocks) {
+		t.Errorf("snapshots differ\n%v\n%v", snapshots[0].Blocks, snapshots[1].Blocks)
+	}
+	if got := utf8.RuneCountInString(editors[0].content["p"]); got != len("shared")+len(editors)*(opsPerClient-opsPerClient/3) {
+		t.Errorf("shared block has %d characters, text was lost: %q", got, editors[0].content["p"])
+	}
+
+	svc.mu.Lock()
+	session := svc.sessions[store.note.ID]
+	svc.mu.Unlock()
+	if err := session.sync(context.Background()); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	stored := store.stored()
+	if stored.Version != 2 {
+		t.Errorf("stored version = %d, want 2", stored.Version)
+	}
+	if !reflect.DeepEqual(contents(stored.Blocks), contents(snapshots[0].Blocks)) {
+		t.Errorf("stored blocks differ from the session\n got: %v\nwant: %v", contents(stored.Blocks), contents(snapshots[0].Blocks))
+	}
+}
+
+// next returns the next message of a type a client receives directly from
+// the service
+func next(t *testing.T, client *CollabClient, typ string) (CollabMessage, bool) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				return CollabMessage{}, false
+			}
+			if msg.Type == typ {
+				return msg, true
+			}
+		case <-timeout:
+			t.Fatalf("no %s message", typ)
+		}
+	}
+}
+
+func TestCollabReauthorize(t *testing.T) {
+	store := newMemNotes("alice", []models.Block{
+		{ID: "p", Type: "paragraph", ContentMD: strPtr("")},
+	})
+	store.setRole("bob", authz.RoleEditor)
+	store.setRole("carol", authz.RoleEditor)
+	svc := newCollabService(store)
+	ctx := context.Background()
+
+	bob, err := svc.Join(ctx, store.note.ID.Hex(), "bob", "bob@example.com")
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	carol, err := svc.Join(ctx, store.note.ID.Hex(), "carol", "carol@example.com")
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	// A downgraded collaborator stays connected but can no longer edit
+	store.setRole("bob", authz.RoleViewer)
+	svc.Reauthorize(ctx, "bob")
+
+	for downgraded := false; !downgraded; {
+		presence, ok := next(t, bob, CollabMessagePresence)
+		if !ok {
+			t.Fatal("bob was disconnected")
+		}
+		for _, p := range presence.Presence {
+			downgraded = downgraded || p.UserID == "bob" && p.Role == authz.RoleViewer
+		}
+	}
+	bob.Submit(CollabClientMessage{Type: CollabMessageOp, ClientOpID: "1", Op: &CollabOp{
+		Kind: CollabOpText, BlockID: "p", Text: TextOp{{Insert: "x"}},
+	}})
+	if reject, _ := next(t, bob, CollabMessageReject); reject.Error != authz.ErrForbidden.Error() {
+		t.Errorf("reject = %q, want %q", reject.Error, authz.ErrForbidden)
+	}
+
+	// A removed collaborator is disconnected
+	store.setRole("carol", "")
+	svc.Reauthorize(ctx, "carol")
+
+	if _, ok := next(t, carol, CollabMessageClosed); !ok {
+		t.Fatal("carol was not told the session closed")
+	}
+	if _, ok := next(t, carol, CollabMessageOp); ok {
+		t.Error("carol's messages were not closed")
+	}
+}
+
+func strPtr(s string) *string { return &s }
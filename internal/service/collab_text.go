@@ -0,0 +1,192 @@
+package service
+
+// TextComponent is one step of a text operation: keep Retain characters,
+// insert Insert, or remove Delete characters. Lengths count Unicode code
+// points, not bytes.
+type TextComponent struct {
+	Retain int    `json:"retain,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Delete int    `json:"delete,omitempty"`
+}
+
+// TextOp edits the content_md of a block. It walks the whole text it was
+// made for: retained and deleted lengths add up to that text's length, which
+// is how concurrent operations on the same block are transformed.
+type TextOp []TextComponent
+
+// textBuilder appends components to a TextOp, merging neighbours of the
+// same kind
+type textBuilder struct {
+	op TextOp
+}
+
+func (b *textBuilder) retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Retain > 0 {
+		b.op[last].Retain += n
+		return
+	}
+	b.op = append(b.op, TextComponent{Retain: n})
+}
+
+func (b *textBuilder) insert(s string) {
+	if s == "" {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Insert != "" {
+		b.op[last].Insert += s
+		return
+	}
+	b.op = append(b.op, TextComponent{Insert: s})
+}
+
+func (b *textBuilder) delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Delete > 0 {
+		b.op[last].Delete += n
+		return
+	}
+	b.op = append(b.op, TextComponent{Delete: n})
+}
+
+// normalize checks that every component does exactly one thing and merges
+// neighbours of the same kind
+func (op TextOp) normalize() (TextOp, error) {
+	var b textBuilder
+	for _, c := range op {
+		kinds := 0
+		if c.Retain != 0 {
+			kinds++
+		}
+		if c.Insert != "" {
+			kinds++
+		}
+		if c.Delete != 0 {
+			kinds++
+		}
+		if kinds != 1 || c.Retain < 0 || c.Delete < 0 {
+			return nil, ErrInvalidCollabOp
+		}
+
+		b.retain(c.Retain)
+		b.insert(c.Insert)
+		b.delete(c.Delete)
+	}
+	if len(b.op) == 0 {
+		return nil, ErrInvalidCollabOp
+	}
+	return b.op, nil
+}
+
+// baseLength is the length of the text the operation applies to
+func (op TextOp) baseLength() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// apply runs the operation on text
+func (op TextOp) apply(text string) (string, error) {
+	runes := []rune(text)
+	if op.baseLength() != len(runes) {
+		return "", ErrInvalidCollabOp
+	}
+
+	result := make([]rune, 0, len(runes))
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			result = append(result, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			result = append(result, []rune(c.Insert)...)
+		default:
+			pos += c.Delete
+		}
+	}
+
+	return string(result), nil
+}
+
+// transformText rewrites two operations made concurrently on the same text
+// so that a followed by b' and b followed by a' give the same result. Inserts
+// at the same position put a's text first.
+func transformText(a, b TextOp) (TextOp, TextOp, error) {
+	if a.baseLength() != b.baseLength() {
+		return nil, nil, ErrInvalidCollabOp
+	}
+
+	var aPrime, bPrime textBuilder
+	ia, ib := 0, 0
+	var ca, cb *TextComponent
+	next := func(op TextOp, i *int) *TextComponent {
+		if *i >= len(op) {
+			return nil
+		}
+		c := op[*i]
+		*i++
+		return &c
+	}
+	ca, cb = next(a, &ia), next(b, &ib)
+
+	for ca != nil || cb != nil {
+		if ca != nil && ca.Insert != "" {
+			aPrime.insert(ca.Insert)
+			bPrime.retain(len([]rune(ca.Insert)))
+			ca = next(a, &ia)
+			continue
+		}
+		if cb != nil && cb.Insert != "" {
+			aPrime.retain(len([]rune(cb.Insert)))
+			bPrime.insert(cb.Insert)
+			cb = next(b, &ib)
+			continue
+		}
+		if ca == nil || cb == nil {
+			return nil, nil, ErrInvalidCollabOp
+		}
+
+		la, lb := ca.Retain+ca.Delete, cb.Retain+cb.Delete
+		n := la
+		if lb < n {
+			n = lb
+		}
+
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime.retain(n)
+			bPrime.retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime.delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime.delete(n)
+		}
+		// Both deleting the same characters leaves nothing for either to do
+
+		if ca.Retain > 0 {
+			ca.Retain -= n
+		} else {
+			ca.Delete -= n
+		}
+		if cb.Retain > 0 {
+			cb.Retain -= n
+		} else {
+			cb.Delete -= n
+		}
+		if ca.Retain == 0 && ca.Delete == 0 {
+			ca = next(a, &ia)
+		}
+		if cb.Retain == 0 && cb.Delete == 0 {
+			cb = next(b, &ib)
+		}
+	}
+
+	return aPrime.op, bPrime.op, nil
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCollaboratorNotFound      = errors.New("collaborator not found")
+	ErrCollaboratorEmailRequired = errors.New("email is required")
+	ErrInvalidCollaboratorRole   = errors.New("role must be viewer, commenter or editor")
+	ErrCannotShareWithSelf       = errors.New("cannot share with yourself")
+)
+
+// SharedWithMeItem is a note or group someone else shared with the user, as
+// the collaborator sees it
+type SharedWithMeItem struct {
+	ResourceType string             `json:"resource_type"`
+	ResourceID   primitive.ObjectID `json:"resource_id"`
+	Title        string             `json:"title"`
+	Role         string             `json:"role"`
+	OwnerEmail   string             `json:"owner_email"`
+	SharedAt     time.Time          `json:"shared_at"`
+}
+
+// CollaboratorService shares notes and note groups with other registered
+// users. Only the owner manages who an item is shared with; a collaborator
+// can only leave it.
+type CollaboratorService struct {
+	repo          *repository.CollaboratorRepository
+	access        *AccessService
+	noteRepo      *repository.NoteRepository
+	groupRepo     *repository.NoteGroupRepository
+	userRepo      *repository.UserRepository
+	notifications *NotificationService
+	collab        *CollabService
+}
+
+func NewCollaboratorService(repo *repository.CollaboratorRepository, access *AccessService, noteRepo *repository.NoteRepository, groupRepo *repository.NoteGroupRepository, userRepo *repository.UserRepository, notifications *NotificationService, collab *CollabService) *CollaboratorService {
+	return &CollaboratorService{
+		repo:          repo,
+		access:        access,
+		noteRepo:      noteRepo,
+		groupRepo:     groupRepo,
+		userRepo:      userRepo,
+		notifications: notifications,
+		collab:        collab,
+	}
+}
+
+// ListCollaborators lists who a note or group is shared with. Everyone with
+// access to the item can see it.
+func (s *CollaboratorService) ListCollaborators(ctx context.Context, userID, resourceType, resourceID string) ([]models.Collaborator, error) {
+	objID, _, err := s.resolve(ctx, userID, resourceType, resourceID, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+
+	collaborators, err := s.repo.FindByResource(ctx, resourceType, objID)
+	if err != nil {
+		return nil, err
+	}
+	if collaborators == nil {
+		collaborators = []models.Collaborator{}
+	}
+
+	return collaborators, nil
+}
+
+// AddCollaborator shares a note or group with the registered user behind an
+// email. Sharing again with the same user changes their role. An email
+// without an account returns no collaborator and no error.
+func (s *CollaboratorService) AddCollaborator(ctx context.Context, userID, resourceType, resourceID, email, role string) (*models.Collaborator, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, ErrCollaboratorEmailRequired
+	}
+	if !authz.ValidShareRole(role) {
+		return nil, ErrInvalidCollaboratorRole
+	}
+
+	objID, p, err := s.resolve(ctx, userID, resourceType, resourceID, authz.ActionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	// An unknown email is not reported, so that sharing cannot be used to
+	// find out who has an account
+	user, err := s.userRepo.FindByEmail(email)
+	if err == repository.ErrUserNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.ID.String() == p.OwnerID {
+		return nil, ErrCannotShareWithSelf
+	}
+
+	collaborator, err := s.repo.Upsert(ctx, &models.Collaborator{
+		OwnerID:      p.OwnerID,
+		ResourceType: resourceType,
+		ResourceID:   objID,
+		UserID:       user.ID.String(),
+		Email:        user.Email,
+		Role:         role,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyShared(ctx, userID, collaborator, p)
+
+	return collaborator, nil
+}
+
+// notifyShared tells a user an item was shared with them
+func (s *CollaboratorService) notifyShared(ctx context.Context, sharerID string, collaborator *models.Collaborator, p authz.Principal) {
+	sharer := "Someone"
+	if id, err := uuid.Parse(sharerID); err == nil {
+		if user, err := s.userRepo.FindByID(id); err == nil {
+			sharer = user.Email
+		}
+	}
+
+	title, _ := s.title(ctx, collaborator.ResourceType, collaborator.ResourceID, p)
+	if title == "" {
+		title = "a " + collaborator.ResourceType
+	}
+
+	s.notifications.Send(ctx, &models.Notification{
+		UserID:       collaborator.UserID,
+		Type:         models.NotificationShare,
+		Title:        sharer + " shared " + title + " with you",
+		Body:         "You can now access it as " + collaborator.Role + ".",
+		ResourceType: collaborator.ResourceType,
+		ResourceID:   collaborator.ResourceID.Hex(),
+	})
+}
+
+// UpdateCollaborator changes the role of a collaborator
+func (s *CollaboratorService) UpdateCollaborator(ctx context.Context, userID, resourceType, resourceID, collaboratorID, role string) (*models.Collaborator, error) {
+	if !authz.ValidShareRole(role) {
+		return nil, ErrInvalidCollaboratorRole
+	}
+
+	objID, _, err := s.resolve(ctx, userID, resourceType, resourceID, authz.ActionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	collaborator, err := s.repo.UpdateRole(ctx, resourceType, objID, collaboratorID, role)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrCollaboratorNotFound
+		}
+		return nil, err
+	}
+
+	// Live editing sessions pick up the new role right away
+	s.collab.Reauthorize(ctx, collaboratorID)
+
+	return collaborator, nil
+}
+
+// RemoveCollaborator stops sharing an item with a user. The owner can remove
+// anyone; collaborators can remove themselves.
+func (s *CollaboratorService) RemoveCollaborator(ctx context.Context, userID, resourceType, resourceID, collaboratorID string) error {
+	action := authz.ActionManage
+	if collaboratorID == userID {
+		action = authz.ActionView
+	}
+
+	objID, _, err := s.resolve(ctx, userID, resourceType, resourceID, action)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, resourceType, objID, collaboratorID); err != nil {
+		if IsNotFound(err) {
+			return ErrCollaboratorNotFound
+		}
+		return err
+	}
+
+	// Disconnect the user from live editing sessions they can no longer see
+	s.collab.Reauthorize(ctx, collaboratorID)
+
+	return nil
+}
+
+// SharedWithMe lists the notes and groups shared with a user, newest first.
+// Grants on items deleted in the meantime are removed.
+func (s *CollaboratorService) SharedWithMe(ctx context.Context, userID string) ([]SharedWithMeItem, error) {
+	grants, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string)
+	items := make([]SharedWithMeItem, 0, len(grants))
+	for _, grant := range grants {
+		p := authz.Principal{UserID: userID, OwnerID: grant.OwnerID, Role: grant.Role}
+
+		title, err := s.title(ctx, grant.ResourceType, grant.ResourceID, p)
+		if IsNotFound(err) {
+			s.repo.Delete(ctx, grant.ResourceType, grant.ResourceID, userID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ownerEmail, ok := owners[grant.OwnerID]
+		if !ok {
+			if id, err := uuid.Parse(grant.OwnerID); err == nil {
+				if owner, err := s.userRepo.FindByID(id); err == nil {
+					ownerEmail = owner.Email
+				}
+			}
+			owners[grant.OwnerID] = ownerEmail
+		}
+
+		items = append(items, SharedWithMeItem{
+			ResourceType: grant.ResourceType,
+			ResourceID:   grant.ResourceID,
+			Title:        title,
+			Role:         grant.Role,
+			OwnerEmail:   ownerEmail,
+			SharedAt:     grant.CreatedAt,
+		})
+	}
+
+	return items, nil
+}
+
+// resolve parses the ID of a note or group and resolves what the user may do
+// with it
+func (s *CollaboratorService) resolve(ctx context.Context, userID, resourceType, resourceID string, action authz.Action) (primitive.ObjectID, authz.Principal, error) {
+	var objID primitive.ObjectID
+	var p authz.Principal
+	var err error
+
+	switch resourceType {
+	case models.ShareResourceNote:
+		if objID, err = primitive.ObjectIDFromHex(resourceID); err != nil {
+			return objID, p, ErrInvalidNoteID
+		}
+		p, err = s.access.Note(ctx, userID, objID, action)
+		if err == mongo.ErrNoDocuments {
+			return objID, p, ErrNoteNotFound
+		}
+	case models.ShareResourceGroup:
+		if objID, err = primitive.ObjectIDFromHex(resourceID); err != nil {
+			return objID, p, ErrInvalidGroupID
+		}
+		p, err = s.access.Group(ctx, userID, objID, action)
+		if err == mongo.ErrNoDocuments {
+			return objID, p, ErrGroupNotFound
+		}
+	default:
+		return objID, p, ErrInvalidShareResource
+	}
+
+	return objID, p, err
+}
+
+func (s *CollaboratorService) title(ctx context.Context, resourceType string, resourceID primitive.ObjectID, p authz.Principal) (string, error) {
+	if resourceType == models.ShareResourceNote {
+		note, err := s.noteRepo.FindByID(ctx, resourceID, p)
+		if err != nil {
+			return "", err
+		}
+		return note.Title, nil
+	}
+
+	group, err := s.groupRepo.FindByID(ctx, resourceID, p)
+	if err != nil {
+		return "", err
+	}
+	return group.Name, nil
+}
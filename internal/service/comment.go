@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCommentLength bounds the body of a comment, in characters
+const maxCommentLength = 10000
+
+var (
+	ErrCommentNotFound     = errors.New("comment not found")
+	ErrInvalidCommentID    = errors.New("invalid comment ID")
+	ErrCommentBodyRequired = errors.New("comment body is required")
+	ErrCommentTooLong      = errors.New("comment is too long")
+	ErrInvalidMention      = errors.New("mentioned user does not exist or cannot see the note")
+	ErrCommentNotAuthor    = errors.New("only the author can edit a comment")
+	ErrCommentIsReply      = errors.New("only the first comment of a thread can be resolved")
+)
+
+// mentionPattern matches @user@example.com mentions in a comment body
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.+-])@([\w.%+-]+@[\w-]+(?:\.[\w-]+)*\.[A-Za-z]{2,})`)
+
+// CommentThread is a comment with the replies to it, oldest first
+type CommentThread struct {
+	models.Comment
+	Replies []models.Comment `json:"replies"`
+}
+
+// CommentFilter narrows the threads of a note. Filters apply to the first
+// comment of a thread; its replies always come along.
+type CommentFilter struct {
+	BlockID  *string
+	Resolved *bool
+	Orphaned *bool
+}
+
+// CommentService handles discussions on notes. Everyone who can see a note
+// reads its comments; commenters, editors and the owner write them.
+type CommentService struct {
+	repo          *repository.CommentRepository
+	notes         *NoteService
+	access        *AccessService
+	userRepo      *repository.UserRepository
+	notifications *NotificationService
+}
+
+func NewCommentService(repo *repository.CommentRepository, notes *NoteService, access *AccessService, userRepo *repository.UserRepository, notifications *NotificationService) *CommentService {
+	return &CommentService{repo: repo, notes: notes, access: access, userRepo: userRepo, notifications: notifications}
+}
+
+// ListThreads returns the comment threads of a note, oldest first
+func (s *CommentService) ListThreads(ctx context.Context, noteID, userID string, filter CommentFilter) ([]CommentThread, error) {
+	objID, p, err := s.notes.principal(ctx, noteID, userID, authz.ActionView)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := s.repo.FindByNote(ctx, objID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := []CommentThread{}
+	index := make(map[primitive.ObjectID]int)
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			continue
+		}
+		if !filter.matches(comment) {
+			continue
+		}
+		index[comment.ID] = len(threads)
+		threads = append(threads, CommentThread{Comment: comment, Replies: []models.Comment{}})
+	}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			continue
+		}
+		if i, ok := index[*comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, comment)
+		}
+	}
+
+	return threads, nil
+}
+
+func (f CommentFilter) matches(comment models.Comment) bool {
+	if f.BlockID != nil && (comment.BlockID == nil || *comment.BlockID != *f.BlockID) {
+		return false
+	}
+	if f.Resolved != nil && comment.Resolved != *f.Resolved {
+		return false
+	}
+	if f.Orphaned != nil && comment.Orphaned != *f.Orphaned {
+		return false
+	}
+	return true
+}
+
+// CreateComment starts a thread on a note, anchored to a block when blockID
+// is set, or replies to a thread when parentID is set. Replies to a reply
+// join the thread of that reply and share its anchor.
+func (s *CommentService) CreateComment(ctx context.Context, noteID, userID, email, body string, blockID, parentID *string) (*models.Comment, error) {
+	body, err := commentBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	objID, p, err := s.notes.principal(ctx, noteID, userID, authz.ActionComment)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.Comment{
+		NoteID:      objID,
+		AuthorEmail: email,
+		Body:        body,
+	}
+
+	replyTo := ""
+	if parentID != nil {
+		parentObjID, err := primitive.ObjectIDFromHex(*parentID)
+		if err != nil {
+			return nil, ErrInvalidCommentID
+		}
+		parent, err := s.repo.FindByID(ctx, parentObjID, objID, p)
+		if err != nil {
+			if IsNotFound(err) {
+				return nil, ErrCommentNotFound
+			}
+			return nil, err
+		}
+		if parent.ParentID != nil {
+			parentObjID = *parent.ParentID
+		}
+		replyTo = parent.UserID
+		comment.ParentID = &parentObjID
+		comment.BlockID = parent.BlockID
+		comment.Orphaned = parent.Orphaned
+	} else if blockID != nil {
+		note, err := s.notes.repo.FindByID(ctx, objID, p)
+		if err != nil {
+			return nil, err
+		}
+		if !newBlockTree(note.Blocks).has(*blockID) {
+			return nil, ErrBlockNotFound
+		}
+		comment.BlockID = blockID
+	}
+
+	comment.Mentions, err = s.mentions(ctx, objID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, p, comment); err != nil {
+		return nil, err
+	}
+
+	s.notify(ctx, p, comment, replyTo, nil)
+
+	return comment, nil
+}
+
+// EditComment replaces the body of the user's own comment; the previous body
+// is kept in its history
+func (s *CommentService) EditComment(ctx context.Context, noteID, userID, commentID, body string) (*models.Comment, error) {
+	body, err := commentBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	objID, p, err := s.notes.principal(ctx, noteID, userID, authz.ActionComment)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.find(ctx, objID, p, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserID != userID {
+		return nil, ErrCommentNotAuthor
+	}
+
+	mentions, err := s.mentions(ctx, objID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.repo.Edit(ctx, existing.ID, objID, p, body, mentions)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	// Only people newly mentioned by the edit hear about it
+	s.notify(ctx, p, comment, "", existing.Mentions)
+
+	return comment, nil
+}
+
+// DeleteComment removes a comment and, for the first comment of a thread,
+// its replies. Authors delete their own comments; the owner deletes any.
+func (s *CommentService) DeleteComment(ctx context.Context, noteID, userID, commentID string) error {
+	objID, p, err := s.notes.principal(ctx, noteID, userID, authz.ActionComment)
+	if err != nil {
+		return err
+	}
+
+	comment, err := s.find(ctx, objID, p, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != userID && !p.Can(authz.ActionManage) {
+		return authz.ErrForbidden
+	}
+
+	if err := s.repo.Delete(ctx, comment.ID, objID, p); err != nil {
+		if IsNotFound(err) {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SetResolved resolves or reopens a thread
+func (s *CommentService) SetResolved(ctx context.Context, noteID, userID, commentID string, resolved bool) (*models.Comment, error) {
+	objID, p, err := s.notes.principal(ctx, noteID, userID, authz.ActionComment)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := s.find(ctx, objID, p, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ParentID != nil {
+		return nil, ErrCommentIsReply
+	}
+
+	comment, err = s.repo.SetResolved(ctx, comment.ID, objID, p, resolved)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (s *CommentService) find(ctx context.Context, noteID primitive.ObjectID, p authz.Principal, commentID string) (*models.Comment, error) {
+	id, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return nil, ErrInvalidCommentID
+	}
+
+	comment, err := s.repo.FindByID(ctx, id, noteID, p)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// mentions resolves the @email mentions of a body. Every mentioned user must
+// be registered and able to see the note.
+func (s *CommentService) mentions(ctx context.Context, noteID primitive.ObjectID, body string) ([]models.CommentMention, error) {
+	mentions := []models.CommentMention{}
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(match[1])
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+
+		user, err := s.userRepo.FindByEmail(email)
+		if err == repository.ErrUserNotFound {
+			return nil, ErrInvalidMention
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := s.access.Note(ctx, user.ID.String(), noteID, authz.ActionView); err != nil {
+			if IsNotFound(err) || errors.Is(err, authz.ErrForbidden) {
+				return nil, ErrInvalidMention
+			}
+			return nil, err
+		}
+
+		mentions = append(mentions, models.CommentMention{UserID: user.ID.String(), Email: user.Email})
+	}
+
+	return mentions, nil
+}
+
+// notify tells the people a comment concerns about it: those it mentions,
+// the author of the comment it replies to and the owner of the note. Each
+// hears once, under the most specific reason, and the commenter not at all.
+// Those in previous were mentioned before an edit and are skipped; an edit
+// only notifies new mentions.
+func (s *CommentService) notify(ctx context.Context, p authz.Principal, comment *models.Comment, replyTo string, previous []models.CommentMention) {
+	title := "a note"
+	if note, err := s.notes.repo.FindByID(ctx, comment.NoteID, p); err == nil && note.Title != "" {
+		title = note.Title
+	}
+
+	notified := map[string]bool{comment.UserID: true}
+	for _, mention := range previous {
+		notified[mention.UserID] = true
+	}
+
+	send := func(userID, kind, title string) {
+		if notified[userID] {
+			return
+		}
+		notified[userID] = true
+		s.notifications.Send(ctx, &models.Notification{
+			UserID:       userID,
+			Type:         kind,
+			Title:        title,
+			Body:         excerpt(comment.Body),
+			ResourceType: "note",
+			ResourceID:   comment.NoteID.Hex(),
+			Key:          "comment:" + comment.ID.Hex() + ":" + userID,
+		})
+	}
+
+	for _, mention := range comment.Mentions {
+		send(mention.UserID, models.NotificationMention, comment.AuthorEmail+" mentioned you in "+title)
+	}
+	if comment.EditedAt != nil {
+		return
+	}
+
+	// A reply author who has since lost access to the note is left out
+	if replyTo != "" {
+		if _, err := s.access.Note(ctx, replyTo, comment.NoteID, authz.ActionView); err == nil {
+			send(replyTo, models.NotificationComment, comment.AuthorEmail+" replied to your comment on "+title)
+		}
+	}
+	send(p.OwnerID, models.NotificationComment, comment.AuthorEmail+" commented on "+title)
+}
+
+func commentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", ErrCommentBodyRequired
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", ErrCommentTooLong
+	}
+	return body, nil
+}
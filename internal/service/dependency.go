@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxTaskDependencies caps how many tasks a task can be blocked by
+	maxTaskDependencies = 50
+	// maxGraphSeeds caps the tasks a dependency graph is asked for, and
+	// maxGraphTasks the tasks it grows to
+	maxGraphSeeds = 100
+	maxGraphTasks = 500
+)
+
+var (
+	ErrDependencyCycle     = errors.New("dependency would create a cycle")
+	ErrTooManyDependencies = errors.New("task is blocked by too many tasks")
+	ErrDependencyNotFound  = errors.New("task is not blocked by that task")
+	ErrGraphTasksRequired  = errors.New("ids must list 1-100 task ids")
+)
+
+// TaskDependencies are the tasks a task waits for and the tasks waiting for
+// it
+type TaskDependencies struct {
+	BlockedBy []models.Task `json:"blocked_by"`
+	Blocking  []models.Task `json:"blocking"`
+}
+
+// DependencyGraph holds a set of tasks with everything they depend on and
+// everything depending on them. Nodes are in dependency order, prerequisites
+// first; an edge runs from a prerequisite to the task it blocks.
+type DependencyGraph struct {
+	Nodes []DependencyNode `json:"nodes"`
+	Edges []DependencyEdge `json:"edges"`
+	// Truncated is set when the graph was cut off at its size limit
+	Truncated bool `json:"truncated"`
+}
+
+type DependencyNode struct {
+	ID       primitive.ObjectID  `json:"id"`
+	Title    string              `json:"title"`
+	Status   string              `json:"status"`
+	Blocked  bool                `json:"blocked"`
+	ParentID *primitive.ObjectID `json:"parent_id,omitempty"`
+}
+
+type DependencyEdge struct {
+	From primitive.ObjectID `json:"from"`
+	To   primitive.ObjectID `json:"to"`
+}
+
+// AddDependency marks a task as blocked by a prerequisite, which must not
+// itself wait for the task, directly or further down the chain
+func (s *TaskService) AddDependency(ctx context.Context, userID, taskID, prerequisiteID string) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	prerequisite, err := s.findTask(ctx, userID, prerequisiteID)
+	if err != nil {
+		return nil, err
+	}
+	if prerequisite.ID == task.ID {
+		return nil, ErrDependencyCycle
+	}
+
+	// The cycle check and the new edge form one transaction. The task and
+	// every task the check reads are locked, so two requests that would
+	// close a cycle together conflict and the one retried sees the other's
+	// edge.
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		blocked, err := s.repo.FindByID(ctx, task.ID, userID)
+		if err != nil {
+			return err
+		}
+		blocker, err := s.repo.FindByID(ctx, prerequisite.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range blocked.BlockedBy {
+			if id == blocker.ID {
+				return nil
+			}
+		}
+		if len(blocked.BlockedBy) >= maxTaskDependencies {
+			return ErrTooManyDependencies
+		}
+
+		cycle, chain, err := s.dependsOn(ctx, blocker, blocked.ID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrDependencyCycle
+		}
+		if err := s.lockDependencies(ctx, userID, append(chain, blocked.ID)); err != nil {
+			return err
+		}
+
+		return s.repo.AddBlocker(ctx, blocked.ID, userID, blocker.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.refreshBlocked(ctx, userID, []primitive.ObjectID{task.ID}); err != nil {
+		return nil, err
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// RemoveDependency stops a task waiting for a prerequisite
+func (s *TaskService) RemoveDependency(ctx context.Context, userID, taskID, prerequisiteID string) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	prerequisite, err := primitive.ObjectIDFromHex(prerequisiteID)
+	if err != nil {
+		return nil, ErrInvalidTaskID
+	}
+
+	err = s.repo.RemoveBlocker(ctx, task.ID, userID, prerequisite)
+	if IsNotFound(err) {
+		return nil, ErrDependencyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.refreshBlocked(ctx, userID, []primitive.ObjectID{task.ID}); err != nil {
+		return nil, err
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// GetDependencies returns the direct prerequisites and dependents of a task
+func (s *TaskService) GetDependencies(ctx context.Context, userID, taskID string) (*TaskDependencies, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedBy, err := s.repo.FindByIDs(ctx, userID, task.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+	blocking, err := s.repo.FindDependents(ctx, userID, []primitive.ObjectID{task.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := &TaskDependencies{BlockedBy: []models.Task{}, Blocking: []models.Task{}}
+	dependencies.BlockedBy = append(dependencies.BlockedBy, blockedBy...)
+	dependencies.Blocking = append(dependencies.Blocking, blocking...)
+	return dependencies, nil
+}
+
+// DependencyGraph returns the tasks of taskIDs with every task connected to
+// them through dependencies, in either direction. Unknown ids are left out.
+func (s *TaskService) DependencyGraph(ctx context.Context, userID string, taskIDs []string) (*DependencyGraph, error) {
+	if len(taskIDs) == 0 || len(taskIDs) > maxGraphSeeds {
+		return nil, ErrGraphTasksRequired
+	}
+	seeds := make([]primitive.ObjectID, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		id, err := primitive.ObjectIDFromHex(taskID)
+		if err != nil {
+			return nil, ErrInvalidTaskID
+		}
+		seeds = append(seeds, id)
+	}
+
+	graph := &DependencyGraph{Nodes: []DependencyNode{}, Edges: []DependencyEdge{}}
+	tasks := make(map[primitive.ObjectID]models.Task)
+	frontier, err := s.repo.FindByIDs(ctx, userID, seeds)
+	if err != nil {
+		return nil, err
+	}
+	for len(frontier) > 0 {
+		var ids, prerequisites []primitive.ObjectID
+		for _, task := range frontier {
+			if _, ok := tasks[task.ID]; ok {
+				continue
+			}
+			if len(tasks) == maxGraphTasks {
+				graph.Truncated = true
+				break
+			}
+			tasks[task.ID] = task
+			ids = append(ids, task.ID)
+			for _, id := range task.BlockedBy {
+				if _, ok := tasks[id]; !ok {
+					prerequisites = append(prerequisites, id)
+				}
+			}
+		}
+		if graph.Truncated {
+			break
+		}
+
+		up, err := s.repo.FindByIDs(ctx, userID, prerequisites)
+		if err != nil {
+			return nil, err
+		}
+		down, err := s.repo.FindDependents(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, task := range append(up, down...) {
+			if _, ok := tasks[task.ID]; !ok {
+				frontier = append(frontier, task)
+			}
+		}
+	}
+
+	for _, task := range dependencyOrder(tasks) {
+		graph.Nodes = append(graph.Nodes, DependencyNode{
+			ID:       task.ID,
+			Title:    task.Title,
+			Status:   task.Status,
+			Blocked:  task.Blocked,
+			ParentID: task.ParentID,
+		})
+		for _, id := range task.BlockedBy {
+			if _, ok := tasks[id]; ok {
+				graph.Edges = append(graph.Edges, DependencyEdge{From: id, To: task.ID})
+			}
+		}
+	}
+
+	return graph, nil
+}
+
+// dependsOn reports whether task waits for target, directly or through
+// other prerequisites. It also returns the tasks it looked at.
+func (s *TaskService) dependsOn(ctx context.Context, task *models.Task, target primitive.ObjectID) (bool, []primitive.ObjectID, error) {
+	seen := map[primitive.ObjectID]bool{task.ID: true}
+	next := task.BlockedBy
+	for len(next) > 0 {
+		var ids []primitive.ObjectID
+		for _, id := range next {
+			if id == target {
+				return true, nil, nil
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		prerequisites, err := s.repo.FindByIDs(ctx, task.UserID, ids)
+		if err != nil {
+			return false, nil, err
+		}
+		next = nil
+		for _, prerequisite := range prerequisites {
+			next = append(next, prerequisite.BlockedBy...)
+		}
+	}
+
+	chain := make([]primitive.ObjectID, 0, len(seen))
+	for id := range seen {
+		chain = append(chain, id)
+	}
+	return false, chain, nil
+}
+
+// lockDependencies locks the prerequisites of tasks inside the transaction
+// of ctx, so that a transaction adding to those of any of them conflicts
+// with this one
+func (s *TaskService) lockDependencies(ctx context.Context, userID string, ids []primitive.ObjectID) error {
+	for _, id := range ids {
+		if err := s.locks.Lock(ctx, "dependencies:"+userID+":"+id.Hex()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshBlocked marks each of ids as blocked while any of its prerequisites
+// is not done, and returns the tasks that are no longer blocked
+func (s *TaskService) refreshBlocked(ctx context.Context, userID string, ids []primitive.ObjectID) ([]models.Task, error) {
+	tasks, err := s.repo.FindByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var prerequisiteIDs []primitive.ObjectID
+	for _, task := range tasks {
+		prerequisiteIDs = append(prerequisiteIDs, task.BlockedBy...)
+	}
+	prerequisites, err := s.repo.FindByIDs(ctx, userID, prerequisiteIDs)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[primitive.ObjectID]bool)
+	for _, prerequisite := range prerequisites {
+		open[prerequisite.ID] = prerequisite.Status != "done"
+	}
+
+	var block, unblock []primitive.ObjectID
+	var unblocked []models.Task
+	for _, task := range tasks {
+		blocked := false
+		for _, id := range task.BlockedBy {
+			blocked = blocked || open[id]
+		}
+		switch {
+		case blocked && !task.Blocked:
+			block = append(block, task.ID)
+		case !blocked && task.Blocked:
+			unblock = append(unblock, task.ID)
+			task.Blocked = false
+			unblocked = append(unblocked, task)
+		}
+	}
+
+	if err := s.repo.SetBlocked(ctx, userID, block, true); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetBlocked(ctx, userID, unblock, false); err != nil {
+		return nil, err
+	}
+	return unblocked, nil
+}
+
+// prerequisiteChanged updates the tasks waiting for a task that was just
+// completed or reopened. Dependents a completion leaves unblocked are ready
+// to start, which their owner is told.
+func (s *TaskService) prerequisiteChanged(ctx context.Context, task *models.Task) error {
+	dependents, err := s.repo.FindDependents(ctx, task.UserID, []primitive.ObjectID{task.ID})
+	if err != nil || len(dependents) == 0 {
+		return err
+	}
+	ids := make([]primitive.ObjectID, len(dependents))
+	for i, dependent := range dependents {
+		ids[i] = dependent.ID
+	}
+
+	unblocked, err := s.refreshBlocked(ctx, task.UserID, ids)
+	if err != nil || task.Status != "done" || task.CompletedAt == nil {
+		return err
+	}
+	for _, dependent := range unblocked {
+		s.notifications.Send(ctx, &models.Notification{
+			UserID:       dependent.UserID,
+			Type:         models.NotificationTaskReady,
+			Title:        dependent.Title + " is ready to start",
+			Body:         task.Title + " is done",
+			ResourceType: "task",
+			ResourceID:   dependent.ID.Hex(),
+			Key:          "task_ready:" + dependent.ID.Hex() + ":" + strconv.FormatInt(task.CompletedAt.UnixNano(), 10),
+		})
+	}
+	return nil
+}
+
+// dropDependencies removes deleted tasks from the prerequisites of the
+// tasks waiting for them
+func (s *TaskService) dropDependencies(ctx context.Context, userID string, deleted []primitive.ObjectID) error {
+	dependents, err := s.repo.FindDependents(ctx, userID, deleted)
+	if err != nil || len(dependents) == 0 {
+		return err
+	}
+	if err := s.repo.PullBlockers(ctx, userID, deleted); err != nil {
+		return err
+	}
+
+	ids := make([]primitive.ObjectID, len(dependents))
+	for i, dependent := range dependents {
+		ids[i] = dependent.ID
+	}
+	_, err = s.refreshBlocked(ctx, userID, ids)
+	return err
+}
+
+// dependencyOrder sorts tasks so that every task comes after its
+// prerequisites, oldest first where the order is free
+func dependencyOrder(tasks map[primitive.ObjectID]models.Task) []models.Task {
+	waiting := make(map[primitive.ObjectID]int, len(tasks))
+	dependents := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, task := range tasks {
+		for _, id := range task.BlockedBy {
+			if _, ok := tasks[id]; ok {
+				waiting[task.ID]++
+				dependents[id] = append(dependents[id], task.ID)
+			}
+		}
+	}
+
+	older := func(a, b models.Task) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.Hex() < b.ID.Hex()
+	}
+	var ready []models.Task
+	for _, task := range tasks {
+		if waiting[task.ID] == 0 {
+			ready = append(ready, task)
+		}
+	}
+
+	ordered := make([]models.Task, 0, len(tasks))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return older(ready[i], ready[j]) })
+		task := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, task)
+		for _, id := range dependents[task.ID] {
+			waiting[id]--
+			if waiting[id] == 0 {
+				ready = append(ready, tasks[id])
+			}
+		}
+	}
+
+	// Tasks on a cycle, which only concurrent changes can leave behind, go
+	// last
+	if len(ordered) < len(tasks) {
+		var rest []models.Task
+		for _, task := range tasks {
+			if waiting[task.ID] > 0 {
+				rest = append(rest, task)
+			}
+		}
+		sort.Slice(rest, func(i, j int) bool { return older(rest[i], rest[j]) })
+		ordered = append(ordered, rest...)
+	}
+	return ordered
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidJournalDate  = errors.New("invalid date, expected yyyy-mm-dd")
+	ErrInvalidJournalRange = errors.New("invalid date range")
+)
+
+const (
+	journalDateLayout = "2006-01-02"
+	// maxCalendarDays bounds how many days one calendar request may cover
+	maxCalendarDays = 366
+)
+
+// JournalDay is a day that has a journal entry
+type JournalDay struct {
+	Date   string             `json:"date"`
+	NoteID primitive.ObjectID `json:"note_id"`
+	Title  string             `json:"title"`
+}
+
+// JournalCalendar lists the days with entries in a date range. Today is the
+// current date in the user's time zone.
+type JournalCalendar struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Today    string       `json:"today"`
+	Timezone string       `json:"timezone"`
+	Days     []JournalDay `json:"days"`
+}
+
+// JournalService keeps one note per calendar day for every user. Which day is
+// "today" is decided in the time zone of the user's profile.
+type JournalService struct {
+	notes       *NoteService
+	profileRepo *repository.ProfileRepository
+}
+
+func NewJournalService(notes *NoteService, profileRepo *repository.ProfileRepository) *JournalService {
+	return &JournalService{notes: notes, profileRepo: profileRepo}
+}
+
+// GetEntry returns the entry of a day, creating it (from the template when
+// templateID is set) if the day has none yet. date is yyyy-mm-dd or
+// "today".
+func (s *JournalService) GetEntry(ctx context.Context, userID, date, templateID string) (*models.Note, error) {
+	day, err := resolveDate(s.profileRepo, userID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := s.notes.repo.FindByJournalDate(ctx, authz.Owner(userID), day)
+	if err == nil {
+		return note, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	return s.createEntry(ctx, userID, day, templateID)
+}
+
+// PutEntry creates the entry of a day if needed and updates its title and
+// tags when given
+func (s *JournalService) PutEntry(ctx context.Context, userID, date string, title *string, tags []string, templateID string) (*models.Note, error) {
+	note, err := s.GetEntry(ctx, userID, date, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if title != nil && *title != "" {
+		updates["title"] = *title
+	}
+	if tags != nil {
+		updates["tags"] = tags
+	}
+	if len(updates) == 0 {
+		return note, nil
+	}
+
+	if err := s.notes.UpdateNote(ctx, note.ID.Hex(), userID, updates); err != nil {
+		return nil, err
+	}
+
+	return s.notes.repo.FindByID(ctx, note.ID, authz.Owner(userID))
+}
+
+// Calendar lists the days between from and to (inclusive, yyyy-mm-dd) that
+// have an entry. Empty bounds default to the current month.
+func (s *JournalService) Calendar(ctx context.Context, userID, from, to string) (*JournalCalendar, error) {
+	loc := userLocation(s.profileRepo, userID)
+	now := time.Now().In(loc)
+
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, -1)
+
+	var err error
+	if from != "" {
+		if start, err = time.Parse(journalDateLayout, from); err != nil {
+			return nil, ErrInvalidJournalDate
+		}
+		if to == "" {
+			end = start.AddDate(0, 1, -1)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(journalDateLayout, to); err != nil {
+			return nil, ErrInvalidJournalDate
+		}
+	}
+	if end.Before(start) || end.Sub(start) > maxCalendarDays*24*time.Hour {
+		return nil, ErrInvalidJournalRange
+	}
+
+	calendar := &JournalCalendar{
+		From:     start.Format(journalDateLayout),
+		To:       end.Format(journalDateLayout),
+		Today:    now.Format(journalDateLayout),
+		Timezone: loc.String(),
+		Days:     []JournalDay{},
+	}
+
+	notes, err := s.notes.repo.FindJournalEntries(ctx, authz.Owner(userID), calendar.From, calendar.To)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		calendar.Days = append(calendar.Days, JournalDay{
+			Date:   *note.JournalDate,
+			NoteID: note.ID,
+			Title:  note.Title,
+		})
+	}
+
+	return calendar, nil
+}
+
+func (s *JournalService) createEntry(ctx context.Context, userID, day, templateID string) (*models.Note, error) {
+	date, _ := time.Parse(journalDateLayout, day)
+
+	note := &models.Note{
+		UserID:      userID,
+		Title:       date.Format("Monday, January 2, 2006"),
+		JournalDate: &day,
+	}
+
+	if templateID != "" {
+		// Date variables refer to the entry's day, at the current time of day
+		loc := userLocation(s.profileRepo, userID)
+		now := time.Now().In(loc)
+		at := time.Date(date.Year(), date.Month(), date.Day(), now.Hour(), now.Minute(), 0, 0, loc)
+
+		template, err := s.notes.templates.Instantiate(ctx, templateID, userID, at)
+		if err != nil {
+			return nil, err
+		}
+		note.Blocks = template.Blocks
+		note.Tags = normalizeTags(template.Tags)
+	}
+
+	stored, err := s.notes.repo.CreateJournalEntry(ctx, note)
+	if err != nil {
+		return nil, err
+	}
+	s.notes.stats.Invalidate(userID)
+
+	if err := s.notes.linkRepo.ResolveTitle(ctx, userID, linkKey(stored.Title), stored.ID); err != nil {
+		return nil, err
+	}
+	if err := s.notes.indexLinks(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// resolveDate validates a yyyy-mm-dd date or turns "today" into the current
+// date in the user's time zone
+func resolveDate(profiles *repository.ProfileRepository, userID, date string) (string, error) {
+	if date == "today" {
+		return time.Now().In(userLocation(profiles, userID)).Format(journalDateLayout), nil
+	}
+
+	parsed, err := time.Parse(journalDateLayout, date)
+	if err != nil {
+		return "", ErrInvalidJournalDate
+	}
+	return parsed.Format(journalDateLayout), nil
+}
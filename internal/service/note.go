@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
+	"backend-journaling/internal/authz"
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
 
@@ -13,76 +15,159 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrBlockNotFound     = errors.New("block not found")
+	ErrInvalidBlockMove  = errors.New("invalid block move")
+	ErrInvalidBlockOrder = errors.New("invalid block order")
+	ErrBlockConflict     = errors.New("note blocks were modified concurrently, please retry")
+	ErrBlockNotImage     = errors.New("attachment_id can only be set on image blocks")
+)
+
+// maxBlockWriteAttempts bounds how often a structural block change is retried
+// after losing a race with another writer on the same note
+const maxBlockWriteAttempts = 5
+
 type NoteService struct {
-	repo *repository.NoteRepository
+	repo        *repository.NoteRepository
+	linkRepo    *repository.NoteLinkRepository
+	attachments *AttachmentService
+	templates   *TemplateService
+	access      *AccessService
+	comments    *repository.CommentRepository
+	stats       *StatsCache
 }
 
-func NewNoteService(repo *repository.NoteRepository) *NoteService {
-	return &NoteService{repo: repo}
+func NewNoteService(repo *repository.NoteRepository, linkRepo *repository.NoteLinkRepository, attachments *AttachmentService, templates *TemplateService, access *AccessService, comments *repository.CommentRepository, stats *StatsCache) *NoteService {
+	return &NoteService{repo: repo, linkRepo: linkRepo, attachments: attachments, templates: templates, access: access, comments: comments, stats: stats}
 }
 
-func (s *NoteService) CreateNote(ctx context.Context, userID string, title string, tags []string) (*models.Note, error) {
+// CreateNote creates a note, optionally from a template. With a template an
+// empty title takes the template's rendered title, the template's tags are
+// added to the given ones and its blocks are copied.
+func (s *NoteService) CreateNote(ctx context.Context, userID string, title string, tags []string, templateID string) (*models.Note, error) {
 	note := &models.Note{
 		UserID:   userID,
 		Title:    title,
-		Tags:     tags,
+		Tags:     normalizeTags(tags),
 		IsPinned: false,
 		Blocks:   []models.Block{},
 	}
 
+	if templateID != "" {
+		template, err := s.templates.Instantiate(ctx, templateID, userID, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if note.Title == "" {
+			note.Title = template.Title
+		}
+		note.Tags = normalizeTags(append(note.Tags, template.Tags...))
+		note.Blocks = template.Blocks
+	}
+
 	if err := s.repo.Create(ctx, note); err != nil {
 		return nil, err
 	}
+	s.stats.Invalidate(userID)
+
+	if err := s.linkRepo.ResolveTitle(ctx, userID, linkKey(note.Title), note.ID); err != nil {
+		return nil, err
+	}
+	if len(note.Blocks) > 0 {
+		if err := s.indexLinks(ctx, note); err != nil {
+			return nil, err
+		}
+	}
 
 	return note, nil
 }
 
+// GetNote returns a note the user owns or that is shared with them
 func (s *NoteService) GetNote(ctx context.Context, noteID, userID string) (*models.Note, error) {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+	objID, p, err := s.principal(ctx, noteID, userID, authz.ActionView)
 	if err != nil {
-		return nil, errors.New("invalid note id")
+		return nil, err
 	}
 
-	return s.repo.FindByID(ctx, objID, userID)
+	return s.repo.FindByID(ctx, objID, p)
 }
 
 func (s *NoteService) GetUserNotes(ctx context.Context, userID string) ([]models.Note, error) {
-	return s.repo.FindByUserID(ctx, userID)
+	return s.repo.FindByUserID(ctx, authz.Owner(userID))
 }
 
+// UpdateNote changes a note's title, tags or pin. Editors of a shared note
+// may change its title and tags; pinning is up to the owner.
 func (s *NoteService) UpdateNote(ctx context.Context, noteID, userID string, updates map[string]interface{}) error {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+	action := authz.ActionEdit
+	if _, ok := updates["is_pinned"]; ok {
+		action = authz.ActionManage
+	}
+
+	objID, p, err := s.principal(ctx, noteID, userID, action)
 	if err != nil {
-		return errors.New("invalid note id")
+		return err
 	}
 
-	return s.repo.Update(ctx, objID, userID, bson.M(updates))
-}
+	if tags, ok := updates["tags"].([]string); ok {
+		updates["tags"] = normalizeTags(tags)
+	}
 
-func (s *NoteService) DeleteNote(ctx context.Context, noteID, userID string) error {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+	title, renamed := updates["title"].(string)
+	if !renamed {
+		if err := s.repo.Update(ctx, objID, p, bson.M(updates)); err != nil {
+			return err
+		}
+		s.stats.Invalidate(p.OwnerID)
+		return nil
+	}
+
+	note, err := s.repo.FindByID(ctx, objID, p)
 	if err != nil {
-		return errors.New("invalid note id")
+		return err
 	}
 
-	return s.repo.Delete(ctx, objID, userID)
+	if err := s.repo.Update(ctx, objID, p, bson.M(updates)); err != nil {
+		return err
+	}
+	s.stats.Invalidate(p.OwnerID)
+
+	oldTitle := note.Title
+	note.Title = title
+	return s.renameLinks(ctx, note, oldTitle)
 }
 
-func (s *NoteService) AddBlock(ctx context.Context, noteID, userID string, blockType, contentMD string, items []models.TodoItem) (*models.Block, error) {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+// DeleteNote removes a note with its comments; links pointing at it become
+// dangling and the users it was shared with lose access
+func (s *NoteService) DeleteNote(ctx context.Context, noteID, userID string) error {
+	objID, p, err := s.principal(ctx, noteID, userID, authz.ActionManage)
 	if err != nil {
-		return nil, errors.New("invalid note id")
+		return err
 	}
 
-	note, err := s.repo.FindByID(ctx, objID, userID)
-	if err != nil {
-		return nil, err
+	if err := s.repo.Delete(ctx, objID, p); err != nil {
+		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
+	if err := s.linkRepo.DeleteForNote(ctx, objID, p.OwnerID); err != nil {
+		return err
+	}
+	if err := s.linkRepo.UnlinkTarget(ctx, objID, p.OwnerID); err != nil {
+		return err
+	}
+	s.access.Forget(ctx, models.ShareResourceNote, objID)
+	s.comments.DeleteForNote(ctx, objID)
+
+	return nil
+}
+
+// AddBlock adds a block under parentID at position. Image blocks must
+// reference an image attachment of the user; their content is the caption.
+func (s *NoteService) AddBlock(ctx context.Context, noteID, userID string, blockType, contentMD string, items []models.TodoItem, attachmentID *string, parentID *string, position int) (*models.Block, error) {
 	block := models.Block{
-		ID:    uuid.New().String(),
-		Type:  blockType,
-		Order: len(note.Blocks),
+		ID:   uuid.New().String(),
+		Type: blockType,
 	}
 
 	if blockType == "todo" {
@@ -91,61 +176,383 @@ func (s *NoteService) AddBlock(ctx context.Context, noteID, userID string, block
 		block.ContentMD = &contentMD
 	}
 
-	if err := s.repo.AddBlock(ctx, objID, userID, block); err != nil {
+	if blockType == "image" {
+		if attachmentID == nil {
+			return nil, ErrAttachmentNotFound
+		}
+		if _, err := s.attachments.GetImage(ctx, *attachmentID, userID); err != nil {
+			return nil, err
+		}
+		block.AttachmentID = attachmentID
+	}
+
+	var added models.Block
+	err := s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		if err := tree.insert(block, parentKey(parentID), position); err != nil {
+			return err
+		}
+		added = *tree.byID[block.ID]
+		added.Order = tree.position(block.ID)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &block, nil
+	return &added, nil
 }
 
 func (s *NoteService) UpdateBlock(ctx context.Context, noteID, userID, blockID string, updates map[string]interface{}) error {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+	objID, p, err := s.principal(ctx, noteID, userID, authz.ActionEdit)
 	if err != nil {
-		return errors.New("invalid note id")
+		return err
+	}
+
+	// A block's type never changes, so checking it before the write is safe
+	if attachmentID, ok := updates["attachment_id"].(string); ok {
+		note, err := s.repo.FindByID(ctx, objID, p)
+		if err != nil {
+			return err
+		}
+		block, ok := newBlockTree(note.Blocks).byID[blockID]
+		if !ok {
+			return mongo.ErrNoDocuments
+		}
+		if block.Type != "image" {
+			return ErrBlockNotImage
+		}
+		if _, err := s.attachments.GetImage(ctx, attachmentID, userID); err != nil {
+			return err
+		}
 	}
 
-	return s.repo.UpdateBlock(ctx, objID, userID, blockID, bson.M(updates))
+	if err := s.repo.UpdateBlock(ctx, objID, p, blockID, bson.M(updates)); err != nil {
+		return err
+	}
+
+	return s.reloadBlocks(ctx, objID, p)
 }
 
+// DeleteBlock removes a block together with its nested children
 func (s *NoteService) DeleteBlock(ctx context.Context, noteID, userID, blockID string) error {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+	return s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		return tree.remove(blockID)
+	})
+}
+
+// ReorderBlocks sets the order of the children of parentID (top-level blocks
+// when nil). blockOrder must list every one of those children exactly once.
+func (s *NoteService) ReorderBlocks(ctx context.Context, noteID, userID string, parentID *string, blockOrder []string) error {
+	return s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		return tree.reorder(parentKey(parentID), blockOrder)
+	})
+}
+
+// MoveBlock moves a block and its subtree under parentID (top level when nil)
+// at the given position; a negative position appends
+func (s *NoteService) MoveBlock(ctx context.Context, noteID, userID, blockID string, parentID *string, position int) error {
+	return s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		return tree.move(blockID, parentKey(parentID), position)
+	})
+}
+
+// IndentBlock nests a block under its previous sibling
+func (s *NoteService) IndentBlock(ctx context.Context, noteID, userID, blockID string) error {
+	return s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		return tree.indent(blockID)
+	})
+}
+
+// OutdentBlock lifts a block one level up, right after its current parent
+func (s *NoteService) OutdentBlock(ctx context.Context, noteID, userID, blockID string) error {
+	return s.mutateBlocks(ctx, noteID, userID, func(tree *blockTree) error {
+		return tree.outdent(blockID)
+	})
+}
+
+// GetBlockTree returns a note's blocks nested under their parents
+func (s *NoteService) GetBlockTree(ctx context.Context, noteID, userID string) ([]models.BlockNode, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
 	if err != nil {
-		return errors.New("invalid note id")
+		return nil, err
 	}
 
-	return s.repo.DeleteBlock(ctx, objID, userID, blockID)
+	return newBlockTree(note.Blocks).nodes(""), nil
 }
 
-func (s *NoteService) ReorderBlocks(ctx context.Context, noteID, userID string, blockOrder []string) error {
-	objID, err := primitive.ObjectIDFromHex(noteID)
+// TransferBlocks moves or copies blocks (with their children) from one note
+// into another under parentID at position. Both notes are written in a single
+// transaction so a failure never leaves blocks duplicated or lost. Copies get
+// fresh block IDs; moved blocks keep theirs and take their comments along.
+// Todo items keep their done state either way. The blocks written to the
+// target note are returned.
+func (s *NoteService) TransferBlocks(ctx context.Context, sourceNoteID, targetNoteID, userID string, blockIDs []string, parentID *string, position int, copyBlocks bool) ([]models.Block, error) {
+	sourceID, source, err := s.principal(ctx, sourceNoteID, userID, authz.ActionEdit)
 	if err != nil {
-		return errors.New("invalid note id")
+		return nil, err
 	}
 
-	note, err := s.repo.FindByID(ctx, objID, userID)
+	targetID, target, err := s.principal(ctx, targetNoteID, userID, authz.ActionEdit)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(blockIDs) == 0 {
+		return nil, ErrBlockNotFound
+	}
+
+	sameNote := sourceID == targetID
+	if sameNote && !copyBlocks {
+		return nil, ErrInvalidBlockMove
+	}
+
+	var transferred []models.Block
+	var moved []string
+	for attempt := 0; attempt < maxBlockWriteAttempts; attempt++ {
+		err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+			transferred, moved = nil, nil
+			written := make(map[string]bool)
+
+			sourceNote, err := s.repo.FindByID(ctx, sourceID, source)
+			if err != nil {
+				return err
+			}
+			sourceTree := newBlockTree(sourceNote.Blocks)
+
+			targetNote, targetTree := sourceNote, sourceTree
+			if !sameNote {
+				targetNote, err = s.repo.FindByID(ctx, targetID, target)
+				if err != nil {
+					return err
+				}
+				targetTree = newBlockTree(targetNote.Blocks)
+			}
+
+			subtrees, err := selectSubtrees(sourceTree, blockIDs)
+			if err != nil {
+				return err
+			}
+
+			if !copyBlocks {
+				for _, blocks := range subtrees {
+					if err := sourceTree.remove(blocks[0].ID); err != nil {
+						return err
+					}
+				}
+			}
+
+			for i, blocks := range subtrees {
+				if copyBlocks {
+					blocks = cloneBlocks(blocks)
+				}
+
+				at := position
+				if at >= 0 {
+					at += i
+				}
+				if err := targetTree.graft(blocks, parentKey(parentID), at); err != nil {
+					return err
+				}
+
+				for _, block := range blocks {
+					written[block.ID] = true
+					if !copyBlocks {
+						moved = append(moved, block.ID)
+					}
+				}
+			}
+
+			if !sameNote {
+				if err := s.repo.ReplaceBlocks(ctx, sourceID, source, sourceNote.Version, sourceTree.flatten()); err != nil {
+					return err
+				}
+			}
+
+			targetBlocks := targetTree.flatten()
+			for _, block := range targetBlocks {
+				if written[block.ID] {
+					transferred = append(transferred, block)
+				}
+			}
+			if err := s.repo.ReplaceBlocks(ctx, targetID, target, targetNote.Version, targetBlocks); err != nil {
+				return err
+			}
+
+			// Comment threads move with their blocks in the same transaction,
+			// so they are never left behind on the source note
+			if len(moved) == 0 {
+				return nil
+			}
+			return s.comments.MoveToNote(ctx, sourceID, targetID, target.OwnerID, moved)
+		})
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.reloadBlocks(ctx, targetID, target); err != nil {
+			return nil, err
+		}
+		if !sameNote {
+			if err := s.reloadBlocks(ctx, sourceID, source); err != nil {
+				return nil, err
+			}
+		}
+
+		return transferred, nil
+	}
+
+	return nil, ErrBlockConflict
+}
+
+// selectSubtrees returns the subtree of every requested block in request
+// order. Blocks nested inside another requested block travel with it and are
+// not transferred a second time.
+func selectSubtrees(tree *blockTree, blockIDs []string) ([][]models.Block, error) {
+	requested := make(map[string]bool, len(blockIDs))
+	for _, id := range blockIDs {
+		if !tree.has(id) {
+			return nil, ErrBlockNotFound
+		}
+		requested[id] = true
+	}
+
+	var subtrees [][]models.Block
+	seen := make(map[string]bool, len(blockIDs))
+	for _, id := range blockIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		nested := false
+		for ancestor := range requested {
+			if tree.isDescendant(id, ancestor) {
+				nested = true
+				break
+			}
+		}
+		if nested {
+			continue
+		}
+
+		subtrees = append(subtrees, tree.subtree(id))
+	}
+
+	return subtrees, nil
+}
+
+// cloneBlocks copies a subtree with fresh block IDs, remapping parent links
+// inside it
+func cloneBlocks(blocks []models.Block) []models.Block {
+	ids := make(map[string]string, len(blocks))
+	for _, block := range blocks {
+		ids[block.ID] = uuid.New().String()
+	}
+
+	clones := make([]models.Block, len(blocks))
+	for i, block := range blocks {
+		clone := block
+		clone.ID = ids[block.ID]
+		if block.ParentID != nil {
+			if newParent, ok := ids[*block.ParentID]; ok {
+				clone.ParentID = &newParent
+			}
+		}
+		if block.ContentMD != nil {
+			content := *block.ContentMD
+			clone.ContentMD = &content
+		}
+		if block.Items != nil {
+			clone.Items = append([]models.TodoItem(nil), block.Items...)
+		}
+		clones[i] = clone
 	}
 
-	blockMap := make(map[string]*models.Block)
-	for i := range note.Blocks {
-		blockMap[note.Blocks[i].ID] = &note.Blocks[i]
+	return clones
+}
+
+// mutateBlocks applies a structural change to a note's block tree using
+// optimistic concurrency: the note is re-read and the change re-applied
+// whenever another writer modified the blocks in between. The note's links
+// and comment anchors are refreshed once the write succeeds.
+func (s *NoteService) mutateBlocks(ctx context.Context, noteID, userID string, mutate func(tree *blockTree) error) error {
+	objID, p, err := s.principal(ctx, noteID, userID, authz.ActionEdit)
+	if err != nil {
+		return err
 	}
 
-	var reorderedBlocks []models.Block
-	for i, blockID := range blockOrder {
-		if block, exists := blockMap[blockID]; exists {
-			newBlock := *block
-			newBlock.Order = i
-			reorderedBlocks = append(reorderedBlocks, newBlock)
+	for attempt := 0; attempt < maxBlockWriteAttempts; attempt++ {
+		note, err := s.repo.FindByID(ctx, objID, p)
+		if err != nil {
+			return err
 		}
+
+		tree := newBlockTree(note.Blocks)
+		if err := mutate(tree); err != nil {
+			return err
+		}
+
+		note.Blocks = tree.flatten()
+		err = s.repo.ReplaceBlocks(ctx, objID, p, note.Version, note.Blocks)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.blocksWritten(ctx, note)
+	}
+
+	return ErrBlockConflict
+}
+
+// blocksWritten follows a successful block write: the owner's cached stats
+// are dropped, the note's links are re-indexed and comments anchored to
+// blocks it no longer has are marked orphaned (or restored when the block is
+// back)
+func (s *NoteService) blocksWritten(ctx context.Context, note *models.Note) error {
+	s.stats.Invalidate(note.UserID)
+
+	if err := s.indexLinks(ctx, note); err != nil {
+		return err
 	}
 
-	if len(reorderedBlocks) != len(note.Blocks) {
-		return errors.New("invalid block order")
+	ids := make([]string, len(note.Blocks))
+	for i, block := range note.Blocks {
+		ids[i] = block.ID
+	}
+	return s.comments.SyncOrphans(ctx, note.ID, ids)
+}
+
+// reloadBlocks reads a note back after a block write made without the full
+// note at hand and runs blocksWritten on it
+func (s *NoteService) reloadBlocks(ctx context.Context, noteID primitive.ObjectID, p authz.Principal) error {
+	note, err := s.repo.FindByID(ctx, noteID, p)
+	if err != nil {
+		return err
+	}
+
+	return s.blocksWritten(ctx, note)
+}
+
+// principal parses a note ID and resolves the user's principal for an action
+// on the note
+func (s *NoteService) principal(ctx context.Context, noteID, userID string, action authz.Action) (primitive.ObjectID, authz.Principal, error) {
+	objID, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return primitive.NilObjectID, authz.Principal{}, ErrInvalidNoteID
+	}
+
+	p, err := s.access.Note(ctx, userID, objID, action)
+	if err != nil {
+		return primitive.NilObjectID, authz.Principal{}, err
 	}
 
-	return s.repo.ReorderBlocks(ctx, objID, userID, reorderedBlocks)
+	return objID, p, nil
 }
 
 func IsNotFound(err error) bool {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"backend-journaling/internal/authz"
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
 
@@ -23,11 +24,32 @@ var (
 )
 
 type NoteGroupService struct {
-	repo *repository.NoteGroupRepository
+	repo   *repository.NoteGroupRepository
+	access *AccessService
+	stats  *StatsCache
 }
 
-func NewNoteGroupService(repo *repository.NoteGroupRepository) *NoteGroupService {
-	return &NoteGroupService{repo: repo}
+func NewNoteGroupService(repo *repository.NoteGroupRepository, access *AccessService, stats *StatsCache) *NoteGroupService {
+	return &NoteGroupService{repo: repo, access: access, stats: stats}
+}
+
+// principal resolves what a user may do with a group. Groups the user cannot
+// see are reported as not found.
+func (s *NoteGroupService) principal(ctx context.Context, groupID, userID string, action authz.Action) (primitive.ObjectID, authz.Principal, error) {
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return primitive.NilObjectID, authz.Principal{}, ErrInvalidGroupID
+	}
+
+	p, err := s.access.Group(ctx, userID, id, action)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, authz.Principal{}, ErrGroupNotFound
+		}
+		return primitive.NilObjectID, authz.Principal{}, err
+	}
+
+	return id, p, nil
 }
 
 // CreateGroup creates a new note group
@@ -49,18 +71,19 @@ func (s *NoteGroupService) CreateGroup(ctx context.Context, userID, name string,
 	if err := s.repo.Create(ctx, group); err != nil {
 		return nil, err
 	}
+	s.stats.Invalidate(userID)
 
 	return group, nil
 }
 
 // GetGroup gets a note group by ID
 func (s *NoteGroupService) GetGroup(ctx context.Context, groupID, userID string) (*models.NoteGroup, error) {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionView)
 	if err != nil {
-		return nil, ErrInvalidGroupID
+		return nil, err
 	}
 
-	group, err := s.repo.FindByID(ctx, id, userID)
+	group, err := s.repo.FindByID(ctx, id, p)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrGroupNotFound
@@ -73,7 +96,7 @@ func (s *NoteGroupService) GetGroup(ctx context.Context, groupID, userID string)
 
 // GetGroups gets all note groups for a user
 func (s *NoteGroupService) GetGroups(ctx context.Context, userID string, isPinned, isArchived *bool) ([]*models.NoteGroup, error) {
-	groups, err := s.repo.FindAll(ctx, userID, isPinned, isArchived)
+	groups, err := s.repo.FindAll(ctx, authz.Owner(userID), isPinned, isArchived)
 	if err != nil {
 		return nil, err
 	}
@@ -83,9 +106,9 @@ func (s *NoteGroupService) GetGroups(ctx context.Context, userID string, isPinne
 
 // UpdateGroup updates a note group
 func (s *NoteGroupService) UpdateGroup(ctx context.Context, groupID, userID string, name *string, description, color, icon *string) (*models.NoteGroup, error) {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionEdit)
 	if err != nil {
-		return nil, ErrInvalidGroupID
+		return nil, err
 	}
 
 	updates := bson.M{}
@@ -113,83 +136,81 @@ func (s *NoteGroupService) UpdateGroup(ctx context.Context, groupID, userID stri
 		return s.GetGroup(ctx, groupID, userID)
 	}
 
-	if err := s.repo.Update(ctx, id, userID, updates); err != nil {
+	if err := s.repo.Update(ctx, id, p, updates); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrGroupNotFound
 		}
 		return nil, err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return s.GetGroup(ctx, groupID, userID)
 }
 
 // PinGroup pins/unpins a note group
 func (s *NoteGroupService) PinGroup(ctx context.Context, groupID, userID string, isPinned bool) error {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionManage)
 	if err != nil {
-		return ErrInvalidGroupID
+		return err
 	}
 
 	updates := bson.M{"is_pinned": isPinned}
 
-	if err := s.repo.Update(ctx, id, userID, updates); err != nil {
+	if err := s.repo.Update(ctx, id, p, updates); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return ErrGroupNotFound
 		}
 		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return nil
 }
 
 // ArchiveGroup archives/unarchives a note group
 func (s *NoteGroupService) ArchiveGroup(ctx context.Context, groupID, userID string, isArchived bool) error {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionManage)
 	if err != nil {
-		return ErrInvalidGroupID
+		return err
 	}
 
 	updates := bson.M{"is_archived": isArchived}
 
-	if err := s.repo.Update(ctx, id, userID, updates); err != nil {
+	if err := s.repo.Update(ctx, id, p, updates); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return ErrGroupNotFound
 		}
 		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return nil
 }
 
 // DeleteGroup deletes a note group and removes group_id from all notes in the group
 func (s *NoteGroupService) DeleteGroup(ctx context.Context, groupID, userID string) error {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	// Check if group exists and may be deleted
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionManage)
 	if err != nil {
-		return ErrInvalidGroupID
-	}
-
-	// Check if group exists
-	_, err = s.repo.FindByID(ctx, id, userID)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return ErrGroupNotFound
-		}
 		return err
 	}
 
 	// Remove group_id from all notes in this group
-	if err := s.repo.RemoveGroupFromAllNotes(ctx, id, userID); err != nil {
+	if err := s.repo.RemoveGroupFromAllNotes(ctx, id, p); err != nil {
 		return err
 	}
 
 	// Delete the group
-	if err := s.repo.Delete(ctx, id, userID); err != nil {
+	if err := s.repo.Delete(ctx, id, p); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return ErrGroupNotFound
 		}
 		return err
 	}
 
+	s.access.Forget(ctx, models.ShareResourceGroup, id)
+	s.stats.Invalidate(p.OwnerID)
+
 	return nil
 }
 
@@ -200,27 +221,20 @@ func (s *NoteGroupService) AddNoteToGroup(ctx context.Context, noteID, groupID,
 		return ErrInvalidNoteID
 	}
 
-	gid, err := primitive.ObjectIDFromHex(groupID)
+	// Verify group exists and may be changed
+	gid, p, err := s.principal(ctx, groupID, userID, authz.ActionManage)
 	if err != nil {
-		return ErrInvalidGroupID
-	}
-
-	// Verify group exists
-	_, err = s.repo.FindByID(ctx, gid, userID)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return ErrGroupNotFound
-		}
 		return err
 	}
 
 	// Add note to group
-	if err := s.repo.AddNoteToGroup(ctx, nid, gid, userID); err != nil {
+	if err := s.repo.AddNoteToGroup(ctx, nid, gid, p); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return ErrNoteNotFound
 		}
 		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return nil
 }
@@ -232,13 +246,22 @@ func (s *NoteGroupService) RemoveNoteFromGroup(ctx context.Context, noteID, user
 		return ErrInvalidNoteID
 	}
 
+	p, err := s.access.Note(ctx, userID, nid, authz.ActionManage)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrNoteNotFound
+		}
+		return err
+	}
+
 	// Remove note from group
-	if err := s.repo.RemoveNoteFromGroup(ctx, nid, userID); err != nil {
+	if err := s.repo.RemoveNoteFromGroup(ctx, nid, p); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return ErrNoteNotFound
 		}
 		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return nil
 }
@@ -255,46 +278,30 @@ func (s *NoteGroupService) MoveNotesToGroup(ctx context.Context, noteIDs []strin
 		nids[i] = nid
 	}
 
-	// Convert group ID
-	gid, err := primitive.ObjectIDFromHex(newGroupID)
+	// Verify group exists and may be changed
+	gid, p, err := s.principal(ctx, newGroupID, userID, authz.ActionManage)
 	if err != nil {
-		return ErrInvalidGroupID
-	}
-
-	// Verify group exists
-	_, err = s.repo.FindByID(ctx, gid, userID)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return ErrGroupNotFound
-		}
 		return err
 	}
 
 	// Move notes to new group
-	if err := s.repo.MoveNotesToGroup(ctx, nids, gid, userID); err != nil {
+	if err := s.repo.MoveNotesToGroup(ctx, nids, gid, p); err != nil {
 		return err
 	}
+	s.stats.Invalidate(p.OwnerID)
 
 	return nil
 }
 
 // GetNotesInGroup gets all notes in a group
 func (s *NoteGroupService) GetNotesInGroup(ctx context.Context, groupID, userID string) ([]*models.Note, error) {
-	id, err := primitive.ObjectIDFromHex(groupID)
+	// Verify group exists and is visible
+	id, p, err := s.principal(ctx, groupID, userID, authz.ActionView)
 	if err != nil {
-		return nil, ErrInvalidGroupID
-	}
-
-	// Verify group exists
-	_, err = s.repo.FindByID(ctx, id, userID)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, ErrGroupNotFound
-		}
 		return nil, err
 	}
 
-	notes, err := s.repo.GetNotesInGroup(ctx, id, userID)
+	notes, err := s.repo.GetNotesInGroup(ctx, id, p)
 	if err != nil {
 		return nil, err
 	}
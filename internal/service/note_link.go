@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// wikiLinkPattern matches [[Note Title]], [[note:<id>]] and the aliased form
+// [[Note Title|shown text]]
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]+)(\|[^\[\]\n]*)?\]\]`)
+
+const (
+	noteIDLinkPrefix = "note:"
+	snippetRadius    = 60
+)
+
+// LinkReference is a link as seen from the note it points to (a backlink) or
+// a link that does not resolve (a dangling link)
+type LinkReference struct {
+	NoteID    primitive.ObjectID `json:"note_id"`
+	NoteTitle string             `json:"note_title"`
+	BlockID   string             `json:"block_id"`
+	Target    string             `json:"target"`
+	Snippet   string             `json:"snippet"`
+}
+
+// GetBacklinks lists the blocks of other notes that link to a note. On a
+// shared note only the linking notes the user can see are listed.
+func (s *NoteService) GetBacklinks(ctx context.Context, noteID, userID string) ([]LinkReference, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.linkRepo.FindByTarget(ctx, note.ID, note.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.linkReferences(ctx, userID, links)
+}
+
+// GetOutgoingLinks lists the links written in a note; unresolved links have
+// no target_note_id
+func (s *NoteService) GetOutgoingLinks(ctx context.Context, noteID, userID string) ([]models.NoteLink, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.linkRepo.FindBySource(ctx, note.ID, note.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if links == nil {
+		links = []models.NoteLink{}
+	}
+
+	return links, nil
+}
+
+// GetDanglingLinks lists every link of the user that points at a note that
+// does not exist
+func (s *NoteService) GetDanglingLinks(ctx context.Context, userID string) ([]LinkReference, error) {
+	links, err := s.linkRepo.FindDangling(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.linkReferences(ctx, userID, links)
+}
+
+func (s *NoteService) linkReferences(ctx context.Context, userID string, links []models.NoteLink) ([]LinkReference, error) {
+	refs := make([]LinkReference, 0, len(links))
+	if len(links) == 0 {
+		return refs, nil
+	}
+
+	seen := make(map[primitive.ObjectID]bool)
+	var ids []primitive.ObjectID
+	for _, link := range links {
+		if !seen[link.SourceNoteID] {
+			seen[link.SourceNoteID] = true
+			ids = append(ids, link.SourceNoteID)
+		}
+	}
+
+	titles, err := s.titles(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		title, ok := titles[link.SourceNoteID]
+		if !ok {
+			continue
+		}
+		refs = append(refs, LinkReference{
+			NoteID:    link.SourceNoteID,
+			NoteTitle: title,
+			BlockID:   link.BlockID,
+			Target:    link.Target,
+			Snippet:   link.Snippet,
+		})
+	}
+
+	return refs, nil
+}
+
+// titles looks up the titles of the notes among ids that the user can see.
+// The links of a note shared with the user may come from any note of its
+// owner, so those are checked one by one.
+func (s *NoteService) titles(ctx context.Context, userID string, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	notes, err := s.repo.FindByIDs(ctx, ids, authz.Owner(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make(map[primitive.ObjectID]string, len(ids))
+	for _, note := range notes {
+		titles[note.ID] = note.Title
+	}
+
+	for _, id := range ids {
+		if _, ok := titles[id]; ok {
+			continue
+		}
+		p, err := s.access.Note(ctx, userID, id, authz.ActionView)
+		if err != nil {
+			continue
+		}
+		if note, err := s.repo.FindByID(ctx, id, p); err == nil {
+			titles[id] = note.Title
+		}
+	}
+
+	return titles, nil
+}
+
+// indexLinks re-parses the links of a note and replaces its entries in the
+// link index. A title link is resolved to a note ID the first time it is
+// indexed and keeps that ID on later re-indexing, so it keeps pointing at the
+// same note when another note takes the title or the title changes in a way
+// renameLinks cannot follow.
+func (s *NoteService) indexLinks(ctx context.Context, note *models.Note) error {
+	existing, err := s.linkRepo.FindBySource(ctx, note.ID, note.UserID)
+	if err != nil {
+		return err
+	}
+
+	resolved := make(map[string]*primitive.ObjectID)
+	for _, link := range existing {
+		if link.TargetKey != "" && link.TargetNoteID != nil {
+			resolved[link.TargetKey] = link.TargetNoteID
+		}
+	}
+
+	var links []models.NoteLink
+
+	for _, block := range note.Blocks {
+		for _, text := range blockTexts(block) {
+			for _, match := range wikiLinkPattern.FindAllStringSubmatchIndex(text, -1) {
+				target := strings.TrimSpace(text[match[2]:match[3]])
+				if target == "" {
+					continue
+				}
+
+				link := models.NoteLink{
+					UserID:       note.UserID,
+					SourceNoteID: note.ID,
+					BlockID:      block.ID,
+					Target:       target,
+					Snippet:      linkSnippet(text, match[0], match[1]),
+				}
+
+				if hex, ok := noteIDLink(target); ok {
+					targetID, err := s.resolveNoteID(ctx, hex, note.UserID)
+					if err != nil {
+						return err
+					}
+					link.TargetNoteID = targetID
+				} else {
+					link.TargetKey = linkKey(target)
+					targetID, ok := resolved[link.TargetKey]
+					if !ok {
+						targetID, err = s.resolveTitle(ctx, target, note.UserID)
+						if err != nil {
+							return err
+						}
+						resolved[link.TargetKey] = targetID
+					}
+					link.TargetNoteID = targetID
+				}
+
+				links = append(links, link)
+			}
+		}
+	}
+
+	return s.linkRepo.ReplaceForNote(ctx, note.ID, note.UserID, links)
+}
+
+// renameLinks follows a title change: [[Old Title]] links that resolved to the
+// note are rewritten to the new title in the notes that contain them, and
+// dangling links that match the new title now resolve to the note
+func (s *NoteService) renameLinks(ctx context.Context, note *models.Note, oldTitle string) error {
+	oldKey := linkKey(oldTitle)
+	if oldKey != linkKey(note.Title) && canLinkTitle(note.Title) {
+		links, err := s.linkRepo.FindByTarget(ctx, note.ID, note.UserID)
+		if err != nil {
+			return err
+		}
+
+		sources := make(map[primitive.ObjectID]bool)
+		for _, link := range links {
+			if link.TargetKey == oldKey {
+				sources[link.SourceNoteID] = true
+			}
+		}
+
+		for sourceID := range sources {
+			err := s.mutateBlocks(ctx, sourceID.Hex(), note.UserID, func(tree *blockTree) error {
+				for _, block := range tree.byID {
+					rewriteBlockLinks(block, oldKey, note.Title)
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return err
+			}
+		}
+	}
+
+	return s.linkRepo.ResolveTitle(ctx, note.UserID, linkKey(note.Title), note.ID)
+}
+
+// resolveNoteID returns the ID of the user's note behind a [[note:<id>]]
+// link, nil when there is no such note
+func (s *NoteService) resolveNoteID(ctx context.Context, hex, userID string) (*primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, nil
+	}
+
+	note, err := s.repo.FindByID(ctx, objID, authz.Owner(userID))
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &note.ID, nil
+}
+
+// resolveTitle returns the ID of the user's note with a title, nil when there
+// is no such note
+func (s *NoteService) resolveTitle(ctx context.Context, title, userID string) (*primitive.ObjectID, error) {
+	note, err := s.repo.FindByTitle(ctx, authz.Owner(userID), title)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &note.ID, nil
+}
+
+// rewriteBlockLinks points [[title]] links whose title matches oldKey at
+// newTitle, keeping any alias
+func rewriteBlockLinks(block *models.Block, oldKey, newTitle string) {
+	rewrite := func(text string) string {
+		return wikiLinkPattern.ReplaceAllStringFunc(text, func(m string) string {
+			match := wikiLinkPattern.FindStringSubmatch(m)
+			if linkKey(match[1]) != oldKey {
+				return m
+			}
+			return "[[" + newTitle + match[2] + "]]"
+		})
+	}
+
+	if block.ContentMD != nil {
+		content := rewrite(*block.ContentMD)
+		block.ContentMD = &content
+	}
+	if block.Items != nil {
+		items := append([]models.TodoItem(nil), block.Items...)
+		for i := range items {
+			items[i].Text = rewrite(items[i].Text)
+		}
+		block.Items = items
+	}
+}
+
+func blockTexts(block models.Block) []string {
+	var texts []string
+	if block.ContentMD != nil {
+		texts = append(texts, *block.ContentMD)
+	}
+	for _, item := range block.Items {
+		texts = append(texts, item.Text)
+	}
+	return texts
+}
+
+func noteIDLink(target string) (string, bool) {
+	if len(target) > len(noteIDLinkPrefix) && strings.EqualFold(target[:len(noteIDLinkPrefix)], noteIDLinkPrefix) {
+		return strings.TrimSpace(target[len(noteIDLinkPrefix):]), true
+	}
+	return "", false
+}
+
+// linkKey is the case-insensitive form a title link is matched by
+func linkKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// canLinkTitle reports whether a title can be written inside [[ ]]
+func canLinkTitle(title string) bool {
+	return strings.TrimSpace(title) != "" && !strings.ContainsAny(title, "[]|\n")
+}
+
+// linkSnippet is the line around a link, shortened to a window around it
+func linkSnippet(text string, start, end int) string {
+	lineStart := strings.LastIndex(text[:start], "\n") + 1
+	lineEnd := len(text)
+	if i := strings.Index(text[end:], "\n"); i >= 0 {
+		lineEnd = end + i
+	}
+
+	from, to := lineStart, lineEnd
+	prefix, suffix := "", ""
+	if start-from > snippetRadius {
+		from = start - snippetRadius
+		prefix = "…"
+	}
+	if to-end > snippetRadius {
+		to = end + snippetRadius
+		suffix = "…"
+	}
+
+	// Keep the cut on UTF-8 boundaries
+	for from > lineStart && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < lineEnd && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	return prefix + strings.TrimSpace(text[from:to]) + suffix
+}
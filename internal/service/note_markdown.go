@@ -0,0 +1,158 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"backend-journaling/internal/markdown"
+	"backend-journaling/internal/models"
+)
+
+var (
+	ErrUnsupportedImport = errors.New("unsupported import file, expected a .md file or a .zip of .md files")
+	ErrImportTooLarge    = errors.New("import archive has too many or too large files")
+)
+
+const (
+	// maxImportFiles caps how many Markdown files a single zip may create
+	maxImportFiles = 200
+	// maxImportFileSize caps the uncompressed size of each imported file
+	maxImportFileSize = 5 << 20
+)
+
+// ExportMarkdown renders a note as a standalone Markdown document
+func (s *NoteService) ExportMarkdown(ctx context.Context, noteID, userID string) (*models.Note, string, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return note, markdown.Render(note), nil
+}
+
+// ImportMarkdown creates one note per Markdown document in the uploaded file,
+// which is either a single Markdown file or a zip archive of them
+func (s *NoteService) ImportMarkdown(ctx context.Context, userID, filename string, data []byte) ([]models.Note, error) {
+	var docs []*markdown.Document
+
+	if isZip(filename, data) {
+		parsed, err := parseMarkdownZip(data)
+		if err != nil {
+			return nil, err
+		}
+		docs = parsed
+	} else {
+		if !isMarkdownFile(filename) {
+			return nil, ErrUnsupportedImport
+		}
+		doc, err := markdown.Parse(data, titleFromFilename(filename))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	notes := make([]models.Note, 0, len(docs))
+	for _, doc := range docs {
+		note := &models.Note{
+			UserID: userID,
+			Title:  doc.Title,
+			Tags:   normalizeTags(doc.Tags),
+			Blocks: doc.Blocks,
+		}
+		if err := s.repo.Create(ctx, note); err != nil {
+			return nil, err
+		}
+		s.stats.Invalidate(userID)
+		notes = append(notes, *note)
+	}
+
+	// Resolve titles only once every note exists so that notes in the same
+	// archive can link to each other
+	for i := range notes {
+		if err := s.linkRepo.ResolveTitle(ctx, userID, linkKey(notes[i].Title), notes[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	for i := range notes {
+		if err := s.indexLinks(ctx, &notes[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return notes, nil
+}
+
+func parseMarkdownZip(data []byte) ([]*markdown.Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnsupportedImport
+	}
+
+	var docs []*markdown.Document
+	for _, file := range archive.File {
+		name := file.Name
+		if file.FileInfo().IsDir() || !isMarkdownFile(name) ||
+			strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+
+		if len(docs) == maxImportFiles {
+			return nil, ErrImportTooLarge
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > maxImportFileSize {
+			return nil, ErrImportTooLarge
+		}
+
+		doc, err := markdown.Parse(content, titleFromFilename(name))
+		if errors.Is(err, markdown.ErrEmptyDocument) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	if len(docs) == 0 {
+		return nil, ErrUnsupportedImport
+	}
+
+	return docs, nil
+}
+
+func isZip(filename string, data []byte) bool {
+	return strings.EqualFold(path.Ext(filename), ".zip") || bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+func isMarkdownFile(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".md", ".markdown", ".txt":
+		return true
+	}
+	return false
+}
+
+func titleFromFilename(filename string) string {
+	base := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	title := strings.TrimSuffix(base, path.Ext(base))
+	if title == "" || title == "." {
+		return "Imported note"
+	}
+	return title
+}
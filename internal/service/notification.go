@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/notify"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 100
+	// notificationExcerpt bounds quoted user text, such as a comment, in a
+	// notification body
+	notificationExcerpt = 200
+)
+
+var (
+	ErrNotificationNotFound      = errors.New("notification not found")
+	ErrInvalidNotificationID     = errors.New("invalid notification id")
+	ErrInvalidNotificationLimit  = errors.New("limit must be between 1 and 100")
+	ErrInvalidNotificationCursor = errors.New("before must be a notification id")
+)
+
+// NotificationService keeps the in-app notifications of users and wakes
+// their open notification streams on this instance when something changes.
+// It is the notifier of the in-app channel.
+type NotificationService struct {
+	repo *repository.NotificationRepository
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func NewNotificationService(repo *repository.NotificationRepository) *NotificationService {
+	return &NotificationService{
+		repo:        repo,
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Send adds a notification to a user's inbox. Notifications are a side
+// effect of other actions, so failures are not reported.
+func (s *NotificationService) Send(ctx context.Context, notification *models.Notification) {
+	if notification.UserID == "" {
+		return
+	}
+	if created, err := s.repo.Create(ctx, notification); err == nil && created {
+		s.wake(notification.UserID)
+	}
+}
+
+// Notify stores a message as an in-app notification. The message ID makes
+// a repeated delivery of the same message a no-op.
+func (s *NotificationService) Notify(ctx context.Context, msg notify.Message) error {
+	created, err := s.repo.Create(ctx, &models.Notification{
+		UserID:       msg.UserID,
+		Type:         msg.Type,
+		Title:        msg.Title,
+		Body:         msg.Body,
+		ResourceType: msg.ResourceType,
+		ResourceID:   msg.ResourceID,
+		Key:          msg.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if created {
+		s.wake(msg.UserID)
+	}
+	return nil
+}
+
+// ListNotifications lists a user's notifications newest first, only unread
+// ones when unreadOnly is set. Passing the id of the last notification of a
+// page as before returns the next page.
+func (s *NotificationService) ListNotifications(ctx context.Context, userID string, unreadOnly bool, before string, limit int) ([]models.Notification, error) {
+	if limit == 0 {
+		limit = defaultNotificationLimit
+	}
+	if limit < 1 || limit > maxNotificationLimit {
+		return nil, ErrInvalidNotificationLimit
+	}
+
+	var cursor *primitive.ObjectID
+	if before != "" {
+		id, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return nil, ErrInvalidNotificationCursor
+		}
+		cursor = &id
+	}
+
+	notifications, err := s.repo.FindByUserID(ctx, userID, unreadOnly, cursor, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	return notifications, nil
+}
+
+// NotificationsSince lists up to limit notifications of a user created after
+// the notification after, oldest first
+func (s *NotificationService) NotificationsSince(ctx context.Context, userID string, after primitive.ObjectID, limit int) ([]models.Notification, error) {
+	return s.repo.FindAfter(ctx, userID, after, int64(limit))
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	return s.repo.UnreadCount(ctx, userID)
+}
+
+// SetRead marks a notification read or unread
+func (s *NotificationService) SetRead(ctx context.Context, userID, notificationID string, read bool) (*models.Notification, error) {
+	id, err := primitive.ObjectIDFromHex(notificationID)
+	if err != nil {
+		return nil, ErrInvalidNotificationID
+	}
+
+	if err := s.repo.SetRead(ctx, id, userID, read); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotificationNotFound
+		}
+		return nil, err
+	}
+	s.wake(userID)
+
+	return s.repo.FindByID(ctx, id, userID)
+}
+
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID string) error {
+	if err := s.repo.MarkAllRead(ctx, userID); err != nil {
+		return err
+	}
+	s.wake(userID)
+	return nil
+}
+
+func (s *NotificationService) DeleteNotification(ctx context.Context, userID, notificationID string) error {
+	id, err := primitive.ObjectIDFromHex(notificationID)
+	if err != nil {
+		return ErrInvalidNotificationID
+	}
+
+	if err := s.repo.Delete(ctx, id, userID); err != nil {
+		if IsNotFound(err) {
+			return ErrNotificationNotFound
+		}
+		return err
+	}
+	s.wake(userID)
+	return nil
+}
+
+// Subscribe returns a channel that receives a signal whenever the user's
+// notifications change on this instance, and a function to unsubscribe.
+// Signals are coalesced, so a slow reader only sees one.
+func (s *NotificationService) Subscribe(userID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[chan struct{}]struct{})
+	}
+	s.subscribers[userID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers[userID], ch)
+		if len(s.subscribers[userID]) == 0 {
+			delete(s.subscribers, userID)
+		}
+	}
+}
+
+func (s *NotificationService) wake(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// excerpt shortens user text quoted in a notification
+func excerpt(text string) string {
+	if utf8.RuneCountInString(text) <= notificationExcerpt {
+		return text
+	}
+	return string([]rune(text)[:notificationExcerpt]) + "…"
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+// Positions order items that users arrange by hand. A position is a string of
+// base 62 digits compared byte by byte, read as a fraction, so a position
+// between any two others always exists and moving an item only rewrites that
+// item. Positions never end in the zero digit, which keeps room before them.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxPositionLength is how long positions may grow under repeated moves into
+// the same gap before the items are given fresh, short positions
+const maxPositionLength = 64
+
+// errPositionOrder means two neighbouring positions are equal or out of
+// order, as after concurrent moves; the items need fresh positions
+var errPositionOrder = errors.New("positions out of order")
+
+// positionsBetween returns n ascending positions strictly between after and
+// before. An empty after is the start and an empty before the end.
+func positionsBetween(after, before string, n int) ([]string, error) {
+	if before != "" && after >= before {
+		return nil, errPositionOrder
+	}
+	if !validPosition(after) || !validPosition(before) {
+		return nil, errPositionOrder
+	}
+
+	positions := make([]string, 0, n)
+	fillPositions(after, before, n, &positions)
+	return positions, nil
+}
+
+// fillPositions splits the gap in half for each middle item so positions
+// stay short however many are placed
+func fillPositions(after, before string, n int, positions *[]string) {
+	if n <= 0 {
+		return
+	}
+	if n == 1 {
+		*positions = append(*positions, positionBetween(after, before))
+		return
+	}
+
+	mid := positionBetween(after, before)
+	fillPositions(after, mid, n/2, positions)
+	*positions = append(*positions, mid)
+	fillPositions(mid, before, n-n/2-1, positions)
+}
+
+// positionBetween returns a position between after and before, which must
+// be valid and in order
+func positionBetween(after, before string) string {
+	if before == "" && after != "" {
+		// Appending steps the first digit up instead of halving the gap, so
+		// items added one after another keep short positions
+		if i := strings.IndexByte(positionDigits, after[0]); i < len(positionDigits)-1 {
+			return string(positionDigits[i+1])
+		}
+		return after[:1] + positionBetween(after[1:], "")
+	}
+	return midpoint(after, before)
+}
+
+func midpoint(after, before string) string {
+	if before != "" {
+		// Keep the prefix both share
+		n := 0
+		for n < len(before) && digitAt(after, n) == before[n] {
+			n++
+		}
+		if n > 0 {
+			return before[:n] + midpoint(after[min(n, len(after)):], before[n:])
+		}
+	}
+
+	low := 0
+	if after != "" {
+		low = strings.IndexByte(positionDigits, after[0])
+	}
+	high := len(positionDigits)
+	if before != "" {
+		high = strings.IndexByte(positionDigits, before[0])
+	}
+
+	if high-low > 1 {
+		return string(positionDigits[(low+high+1)/2])
+	}
+	if len(before) > 1 {
+		return before[:1]
+	}
+	rest := ""
+	if after != "" {
+		rest = after[1:]
+	}
+	return string(positionDigits[low]) + midpoint(rest, "")
+}
+
+func digitAt(position string, i int) byte {
+	if i < len(position) {
+		return position[i]
+	}
+	return positionDigits[0]
+}
+
+func validPosition(position string) bool {
+	for i := 0; i < len(position); i++ {
+		if strings.IndexByte(positionDigits, position[i]) < 0 {
+			return false
+		}
+	}
+	return position == "" || position[len(position)-1] != positionDigits[0]
+}
+
+// placeAmong finds the position of an item going to index at among siblings,
+// given their positions in order without the item. When the gap has no room
+// left, positions grew too long or a neighbour has no position yet, it
+// instead returns fresh positions for all siblings with the item inserted at
+// index at, to be written together.
+func placeAmong(siblings []string, at int) (string, []string, error) {
+	low, high := "", ""
+	if at > 0 {
+		low = siblings[at-1]
+	}
+	if at < len(siblings) {
+		high = siblings[at]
+	}
+
+	// Items that were never placed have no position to go next to
+	unplaced := (at > 0 && low == "") || (at < len(siblings) && high == "")
+	if !unplaced {
+		positions, err := positionsBetween(low, high, 1)
+		if err == nil && len(positions[0]) <= maxPositionLength {
+			return positions[0], nil, nil
+		}
+		if err != nil && !errors.Is(err, errPositionOrder) {
+			return "", nil, err
+		}
+	}
+
+	fresh, err := positionsBetween("", "", len(siblings)+1)
+	if err != nil {
+		return "", nil, err
+	}
+	return fresh[at], fresh, nil
+}
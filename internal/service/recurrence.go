@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/rrule"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPreviewOccurrences = 10
+	maxPreviewOccurrences     = 100
+)
+
+var (
+	ErrInvalidTimezone       = errors.New("timezone must be an IANA time zone name")
+	ErrRecurrenceNeedsDate   = errors.New("a repeating item needs a due date or deadline")
+	ErrRecurrenceEnded       = errors.New("the series has no further occurrence")
+	ErrNotRecurring          = errors.New("the item does not repeat")
+	ErrInvalidPreviewCount   = errors.New("count must be between 1 and 100")
+	ErrPreviewStartRequired  = errors.New("start is required")
+	ErrRecurrenceNeverOccurs = errors.New("the rule has no occurrence from this date")
+)
+
+// RecurrenceInput sets, changes or, with an empty RRule, stops the repetition
+// of a todo or task. An empty Timezone uses the profile's time zone.
+type RecurrenceInput struct {
+	RRule    *string
+	Timezone *string
+}
+
+func (in RecurrenceInput) empty() bool {
+	return in.RRule == nil && in.Timezone == nil
+}
+
+// RecurrencePreview lists upcoming occurrences of a rule
+type RecurrencePreview struct {
+	RRule       string      `json:"rrule"`
+	Timezone    string      `json:"timezone"`
+	Occurrences []time.Time `json:"occurrences"`
+}
+
+// RecurrenceService previews recurrence rules before they are saved
+type RecurrenceService struct {
+	profiles *repository.ProfileRepository
+}
+
+func NewRecurrenceService(profiles *repository.ProfileRepository) *RecurrenceService {
+	return &RecurrenceService{profiles: profiles}
+}
+
+// Preview lists up to count occurrences of a rule starting at start, after
+// the given moment when set. Start and after are read in the rule's time zone
+// when they carry no offset.
+func (s *RecurrenceService) Preview(userID, rule, timezone, start, after string, count int) (*RecurrencePreview, error) {
+	if count == 0 {
+		count = defaultPreviewOccurrences
+	}
+	if count < 1 || count > maxPreviewOccurrences {
+		return nil, ErrInvalidPreviewCount
+	}
+
+	parsed, err := rrule.Parse(rule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := recurrenceLocation(timezone, userLocation(s.profiles, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(start) == "" {
+		return nil, ErrPreviewStartRequired
+	}
+	from, _, err := parseDueDate(strings.TrimSpace(start), loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var since time.Time
+	if strings.TrimSpace(after) != "" {
+		if since, _, err = parseDueDate(strings.TrimSpace(after), loc); err != nil {
+			return nil, err
+		}
+	}
+
+	occurrences := []time.Time{}
+	parsed.Iterate(from, func(occurrence time.Time) bool {
+		if !occurrence.After(since) {
+			return true
+		}
+		occurrences = append(occurrences, occurrence)
+		return len(occurrences) < count
+	})
+
+	return &RecurrencePreview{RRule: parsed.String(), Timezone: loc.String(), Occurrences: occurrences}, nil
+}
+
+// newRecurrence starts a series on the first occurrence at or after from.
+// The local time of day of from is the time of every occurrence.
+func newRecurrence(rule string, loc *time.Location, from time.Time) (*models.Recurrence, error) {
+	parsed, err := rrule.Parse(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := parsed.All(from.In(loc), 1)
+	if len(occurrences) == 0 {
+		return nil, ErrRecurrenceNeverOccurs
+	}
+
+	return &models.Recurrence{
+		RRule:      parsed.String(),
+		Timezone:   loc.String(),
+		Start:      occurrences[0],
+		Occurrence: occurrences[0],
+		SeriesID:   primitive.NewObjectID(),
+	}, nil
+}
+
+// nextOccurrence returns the occurrence of a series after the given item's
+func nextOccurrence(rec *models.Recurrence) (time.Time, error) {
+	parsed, err := rrule.Parse(rec.RRule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(rec.Timezone)
+	if err != nil {
+		return time.Time{}, ErrInvalidTimezone
+	}
+
+	next, ok := parsed.Next(rec.Start.In(loc), rec.Occurrence)
+	if !ok {
+		return time.Time{}, ErrRecurrenceEnded
+	}
+	return next, nil
+}
+
+// recurrenceLocation loads a time zone name, falling back when empty
+func recurrenceLocation(name string, fallback *time.Location) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fallback, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// recurrenceFrom resolves the rule and time zone of a recurrence change
+// against the item's current recurrence; an empty rule means no repetition
+func recurrenceFrom(in RecurrenceInput, current *models.Recurrence, fallback *time.Location) (string, *time.Location, error) {
+	rule, zone := "", ""
+	if current != nil {
+		rule, zone = current.RRule, current.Timezone
+	}
+	if in.RRule != nil {
+		rule = strings.TrimSpace(*in.RRule)
+	}
+	if in.Timezone != nil {
+		zone = *in.Timezone
+	}
+
+	loc, err := recurrenceLocation(zone, fallback)
+	if err != nil {
+		return "", nil, err
+	}
+	return rule, loc, nil
+}
+
+// allDayStart is the start of an all-day due date's day in loc
+func allDayStart(due time.Time, loc *time.Location) time.Time {
+	due = due.UTC()
+	return time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, loc)
+}
+
+// occurrenceDue is the due date of a todo for an occurrence
+func occurrenceDue(occurrence time.Time, allDay bool) *models.FlexibleTime {
+	if allDay {
+		return &models.FlexibleTime{Time: time.Date(occurrence.Year(), occurrence.Month(), occurrence.Day(), 0, 0, 0, 0, time.UTC)}
+	}
+	return &models.FlexibleTime{Time: occurrence.UTC()}
+}
@@ -0,0 +1,472 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/notify"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxRemindersPerItem    = 10
+	maxReminderMessage     = 500
+	maxReminderBeforeMins  = 366 * 24 * 60
+	defaultReminderChannel = models.ChannelInApp
+)
+
+var (
+	ErrReminderNotFound        = errors.New("reminder not found")
+	ErrInvalidReminderID       = errors.New("invalid reminder id")
+	ErrInvalidReminderTarget   = errors.New("target_type must be todo, task or journal")
+	ErrReminderTargetRequired  = errors.New("target_id is required for todo and task reminders")
+	ErrReminderTargetNotFound  = errors.New("the todo or task to remind about does not exist")
+	ErrReminderDateRequired    = errors.New("date (yyyy-mm-dd) is required for journal reminders")
+	ErrReminderTimeRequired    = errors.New("set either remind_at or before_minutes")
+	ErrInvalidReminderTime     = errors.New("remind_at must be an ISO 8601 datetime")
+	ErrInvalidReminderOffset   = errors.New("before_minutes must be between 0 and 527040")
+	ErrReminderInPast          = errors.New("the reminder time has already passed")
+	ErrInvalidReminderChannel  = errors.New("channels must be in_app, email or webhook")
+	ErrReminderWebhookRequired = errors.New("webhook_url must be an http or https URL to use the webhook channel")
+	ErrReminderWebhookAddress  = errors.New("webhook_url must resolve to a public internet address")
+	ErrReminderMessageTooLong  = errors.New("message must be at most 500 characters")
+	ErrTooManyReminders        = errors.New("an item can have at most 10 reminders")
+	ErrReminderTargetImmutable = errors.New("the item of a reminder cannot be changed")
+	ErrReminderFilterNeedsType = errors.New("target_id needs target_type")
+)
+
+// ReminderInput creates or changes a reminder. RemindAt and BeforeMinutes
+// are exclusive; setting one on an update drops the other. A RemindAt
+// without an offset is read in the user's time zone.
+type ReminderInput struct {
+	TargetType    string
+	TargetID      string
+	Date          string
+	RemindAt      *string
+	BeforeMinutes *int
+	Message       *string
+	Channels      []string
+	WebhookURL    *string
+}
+
+// ReminderFilter narrows a reminder listing
+type ReminderFilter struct {
+	TargetType string
+	TargetID   string
+	Date       string
+	Status     string
+}
+
+// ReminderService manages reminders and keeps reminders relative to a due
+// date in step with it. Firing them is the ReminderScheduler's job.
+type ReminderService struct {
+	repo     *repository.ReminderRepository
+	todos    *repository.TodoRepository
+	tasks    *repository.TaskRepository
+	profiles *repository.ProfileRepository
+}
+
+func NewReminderService(repo *repository.ReminderRepository, todos *repository.TodoRepository, tasks *repository.TaskRepository, profiles *repository.ProfileRepository) *ReminderService {
+	return &ReminderService{repo: repo, todos: todos, tasks: tasks, profiles: profiles}
+}
+
+func (s *ReminderService) ListReminders(ctx context.Context, userID string, f ReminderFilter) ([]models.Reminder, error) {
+	filter := bson.M{}
+	if f.TargetType != "" {
+		if !validReminderTarget(f.TargetType) {
+			return nil, ErrInvalidReminderTarget
+		}
+		filter["target_type"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		if f.TargetType == "" {
+			return nil, ErrReminderFilterNeedsType
+		}
+		id, err := primitive.ObjectIDFromHex(f.TargetID)
+		if err != nil {
+			return nil, ErrReminderTargetNotFound
+		}
+		filter["target_id"] = id
+	}
+	if f.Date != "" {
+		filter["date"] = f.Date
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+
+	reminders, err := s.repo.FindByUserID(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if reminders == nil {
+		reminders = []models.Reminder{}
+	}
+	return reminders, nil
+}
+
+func (s *ReminderService) GetReminder(ctx context.Context, userID, reminderID string) (*models.Reminder, error) {
+	id, err := primitive.ObjectIDFromHex(reminderID)
+	if err != nil {
+		return nil, ErrInvalidReminderID
+	}
+
+	reminder, err := s.repo.FindByID(ctx, id, userID)
+	if IsNotFound(err) {
+		return nil, ErrReminderNotFound
+	}
+	return reminder, err
+}
+
+// CreateReminder attaches a reminder to a todo, task or journal day
+func (s *ReminderService) CreateReminder(ctx context.Context, userID string, in ReminderInput) (*models.Reminder, error) {
+	reminder := &models.Reminder{
+		UserID:     userID,
+		TargetType: in.TargetType,
+		Status:     models.ReminderPending,
+	}
+
+	loc := userLocation(s.profiles, userID)
+	switch in.TargetType {
+	case models.ReminderTargetTodo, models.ReminderTargetTask:
+		if in.TargetID == "" {
+			return nil, ErrReminderTargetRequired
+		}
+		id, err := primitive.ObjectIDFromHex(in.TargetID)
+		if err != nil {
+			return nil, ErrReminderTargetNotFound
+		}
+		reminder.TargetID = &id
+
+		count, err := s.repo.CountForTarget(ctx, userID, in.TargetType, id)
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxRemindersPerItem {
+			return nil, ErrTooManyReminders
+		}
+	case models.ReminderTargetJournal:
+		day, err := time.Parse(journalDateLayout, in.Date)
+		if err != nil {
+			return nil, ErrReminderDateRequired
+		}
+		reminder.Date = day.Format(journalDateLayout)
+	default:
+		return nil, ErrInvalidReminderTarget
+	}
+
+	if in.RemindAt == nil && in.BeforeMinutes == nil {
+		return nil, ErrReminderTimeRequired
+	}
+	if in.Channels == nil {
+		in.Channels = []string{defaultReminderChannel}
+	}
+	if err := applyReminderInput(ctx, reminder, in, loc); err != nil {
+		return nil, err
+	}
+
+	due, err := s.dueOf(ctx, reminder, loc)
+	if err != nil {
+		return nil, err
+	}
+	reminder.FireAt = fireTime(reminder, due)
+	if reminder.FireAt != nil && !reminder.FireAt.After(time.Now()) {
+		return nil, ErrReminderInPast
+	}
+
+	if err := s.repo.Create(ctx, reminder); err != nil {
+		return nil, err
+	}
+
+	return reminder, nil
+}
+
+// UpdateReminder changes a reminder and arms it again, so a reminder that
+// already fired fires once more at its new time
+func (s *ReminderService) UpdateReminder(ctx context.Context, userID, reminderID string, in ReminderInput) (*models.Reminder, error) {
+	reminder, err := s.GetReminder(ctx, userID, reminderID)
+	if err != nil {
+		return nil, err
+	}
+	if in.TargetType != "" || in.TargetID != "" || in.Date != "" {
+		return nil, ErrReminderTargetImmutable
+	}
+
+	loc := userLocation(s.profiles, userID)
+	if err := applyReminderInput(ctx, reminder, in, loc); err != nil {
+		return nil, err
+	}
+
+	due, err := s.dueOf(ctx, reminder, loc)
+	if err != nil {
+		return nil, err
+	}
+	reminder.FireAt = fireTime(reminder, due)
+	if reminder.FireAt != nil && !reminder.FireAt.After(time.Now()) {
+		return nil, ErrReminderInPast
+	}
+
+	set := bson.M{
+		"message":   reminder.Message,
+		"channels":  reminder.Channels,
+		"status":    models.ReminderPending,
+		"delivered": []string{},
+		"attempts":  0,
+	}
+	unset := bson.M{"last_error": "", "sent_at": "", "locked_by": "", "locked_until": ""}
+	if reminder.WebhookURL != "" {
+		set["webhook_url"] = reminder.WebhookURL
+	} else {
+		unset["webhook_url"] = ""
+	}
+	if reminder.RemindAt != nil {
+		set["remind_at"] = *reminder.RemindAt
+		unset["before_minutes"] = ""
+	} else {
+		set["before_minutes"] = *reminder.BeforeMinutes
+		unset["remind_at"] = ""
+	}
+	if reminder.FireAt != nil {
+		set["fire_at"] = *reminder.FireAt
+	} else {
+		unset["fire_at"] = ""
+	}
+
+	if err := s.repo.Update(ctx, reminder.ID, userID, set, unset); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrReminderNotFound
+		}
+		return nil, err
+	}
+
+	return s.repo.FindByID(ctx, reminder.ID, userID)
+}
+
+func (s *ReminderService) DeleteReminder(ctx context.Context, userID, reminderID string) error {
+	id, err := primitive.ObjectIDFromHex(reminderID)
+	if err != nil {
+		return ErrInvalidReminderID
+	}
+
+	err = s.repo.Delete(ctx, id, userID)
+	if IsNotFound(err) {
+		return ErrReminderNotFound
+	}
+	return err
+}
+
+// TodoMoved moves the relative reminders of a todo to its current due date
+func (s *ReminderService) TodoMoved(ctx context.Context, todo *models.Todo) {
+	loc := userLocation(s.profiles, todo.UserID)
+	s.repo.Retarget(ctx, todo.UserID, models.ReminderTargetTodo, todo.ID, todoDue(todo, loc))
+}
+
+// TaskMoved moves the relative reminders of a task to its current deadline
+func (s *ReminderService) TaskMoved(ctx context.Context, task *models.Task) {
+	s.repo.Retarget(ctx, task.UserID, models.ReminderTargetTask, task.ID, taskDue(task))
+}
+
+// TodoRepeated gives the todo of a series' next occurrence the relative
+// reminders of the todo before it
+func (s *ReminderService) TodoRepeated(ctx context.Context, previous, next *models.Todo) {
+	loc := userLocation(s.profiles, next.UserID)
+	s.carryOver(ctx, next.UserID, models.ReminderTargetTodo, previous.ID, next.ID, todoDue(next, loc))
+}
+
+// TaskRepeated gives the task of a series' next occurrence the relative
+// reminders of the task before it
+func (s *ReminderService) TaskRepeated(ctx context.Context, previous, next *models.Task) {
+	s.carryOver(ctx, next.UserID, models.ReminderTargetTask, previous.ID, next.ID, taskDue(next))
+}
+
+// TargetDeleted removes the reminders of a deleted todo or task
+func (s *ReminderService) TargetDeleted(ctx context.Context, userID, targetType string, targetID primitive.ObjectID) {
+	s.repo.DeleteForTarget(ctx, userID, targetType, targetID)
+}
+
+func (s *ReminderService) carryOver(ctx context.Context, userID, targetType string, from, to primitive.ObjectID, due *time.Time) {
+	reminders, err := s.repo.FindRelative(ctx, userID, targetType, from)
+	if err != nil {
+		return
+	}
+
+	for _, previous := range reminders {
+		reminder := &models.Reminder{
+			UserID:        userID,
+			TargetType:    targetType,
+			TargetID:      &to,
+			BeforeMinutes: previous.BeforeMinutes,
+			Message:       previous.Message,
+			Channels:      previous.Channels,
+			WebhookURL:    previous.WebhookURL,
+			Status:        models.ReminderPending,
+		}
+		reminder.FireAt = fireTime(reminder, due)
+		s.repo.Create(ctx, reminder)
+	}
+}
+
+// dueOf is the due moment of a reminder's item: the todo's due date or the
+// task's deadline, and the end of the day for journal days and all-day
+// todos. It is nil when the item has none.
+func (s *ReminderService) dueOf(ctx context.Context, reminder *models.Reminder, loc *time.Location) (*time.Time, error) {
+	switch reminder.TargetType {
+	case models.ReminderTargetTodo:
+		todo, err := s.todos.FindByID(ctx, *reminder.TargetID, reminder.UserID)
+		if IsNotFound(err) {
+			return nil, ErrReminderTargetNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return todoDue(todo, loc), nil
+	case models.ReminderTargetTask:
+		task, err := s.tasks.FindByID(ctx, *reminder.TargetID, reminder.UserID)
+		if IsNotFound(err) {
+			return nil, ErrReminderTargetNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return taskDue(task), nil
+	default:
+		return journalDue(reminder.Date, loc), nil
+	}
+}
+
+// applyReminderInput validates a reminder change and applies it
+func applyReminderInput(ctx context.Context, reminder *models.Reminder, in ReminderInput, loc *time.Location) error {
+	if in.RemindAt != nil && in.BeforeMinutes != nil {
+		return ErrReminderTimeRequired
+	}
+	if in.RemindAt != nil {
+		at, dateOnly, err := parseDueDate(strings.TrimSpace(*in.RemindAt), loc)
+		if err != nil || dateOnly {
+			return ErrInvalidReminderTime
+		}
+		at = at.UTC()
+		reminder.RemindAt = &at
+		reminder.BeforeMinutes = nil
+	}
+	if in.BeforeMinutes != nil {
+		if *in.BeforeMinutes < 0 || *in.BeforeMinutes > maxReminderBeforeMins {
+			return ErrInvalidReminderOffset
+		}
+		before := *in.BeforeMinutes
+		reminder.BeforeMinutes = &before
+		reminder.RemindAt = nil
+	}
+
+	if in.Message != nil {
+		message := strings.TrimSpace(*in.Message)
+		if utf8.RuneCountInString(message) > maxReminderMessage {
+			return ErrReminderMessageTooLong
+		}
+		reminder.Message = message
+	}
+
+	if in.WebhookURL != nil {
+		reminder.WebhookURL = strings.TrimSpace(*in.WebhookURL)
+	}
+	if in.Channels != nil {
+		channels := []string{}
+		seen := map[string]bool{}
+		for _, channel := range in.Channels {
+			switch channel {
+			case models.ChannelInApp, models.ChannelEmail, models.ChannelWebhook:
+			default:
+				return ErrInvalidReminderChannel
+			}
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+		if len(channels) == 0 {
+			return ErrInvalidReminderChannel
+		}
+		reminder.Channels = channels
+	}
+
+	webhook := false
+	for _, channel := range reminder.Channels {
+		webhook = webhook || channel == models.ChannelWebhook
+	}
+	if webhook && !validWebhookURL(reminder.WebhookURL) {
+		return ErrReminderWebhookRequired
+	}
+	// Webhooks must not reach into the server's own network
+	if webhook && notify.CheckWebhookURL(ctx, reminder.WebhookURL) != nil {
+		return ErrReminderWebhookAddress
+	}
+	if !webhook {
+		reminder.WebhookURL = ""
+	}
+
+	return nil
+}
+
+// fireTime is when a reminder fires for an item due at due
+func fireTime(reminder *models.Reminder, due *time.Time) *time.Time {
+	if reminder.RemindAt != nil {
+		at := *reminder.RemindAt
+		return &at
+	}
+	if due == nil || reminder.BeforeMinutes == nil {
+		return nil
+	}
+	at := due.Add(-time.Duration(*reminder.BeforeMinutes) * time.Minute)
+	return &at
+}
+
+func todoDue(todo *models.Todo, loc *time.Location) *time.Time {
+	if todo.DueDate == nil || todo.DueDate.IsZero() {
+		return nil
+	}
+	due := todo.DueDate.Time
+	if todo.AllDay {
+		due = allDayStart(due, loc).AddDate(0, 0, 1)
+	}
+	return &due
+}
+
+func taskDue(task *models.Task) *time.Time {
+	if task.Deadline.IsZero() {
+		return nil
+	}
+	due := task.Deadline
+	return &due
+}
+
+func journalDue(date string, loc *time.Location) *time.Time {
+	day, err := time.ParseInLocation(journalDateLayout, date, loc)
+	if err != nil {
+		return nil
+	}
+	due := day.AddDate(0, 0, 1)
+	return &due
+}
+
+func validReminderTarget(targetType string) bool {
+	switch targetType {
+	case models.ReminderTargetTodo, models.ReminderTargetTask, models.ReminderTargetJournal:
+		return true
+	}
+	return false
+}
+
+func validWebhookURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"backend-journaling/config"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/notify"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// remindersPerTick bounds the reminders an instance fires per poll
+	remindersPerTick    = 100
+	reminderSendTimeout = 30 * time.Second
+	maxReminderBackoff  = time.Hour
+)
+
+// ReminderScheduler fires due reminders through the notifiers of their
+// channels. Reminders live in MongoDB, so none are lost on a restart, and
+// every firing is leased to one instance, so running several instances does
+// not fire a reminder twice. A channel that fails is retried with backoff
+// without resending to the channels that succeeded.
+type ReminderScheduler struct {
+	repo        *repository.ReminderRepository
+	todos       *repository.TodoRepository
+	tasks       *repository.TaskRepository
+	users       *repository.UserRepository
+	profiles    *repository.ProfileRepository
+	notifiers   map[string]notify.Notifier
+	instance    string
+	interval    time.Duration
+	lease       time.Duration
+	maxAttempts int
+}
+
+func NewReminderScheduler(repo *repository.ReminderRepository, todos *repository.TodoRepository, tasks *repository.TaskRepository, users *repository.UserRepository, profiles *repository.ProfileRepository, notifiers map[string]notify.Notifier, cfg *config.Config) *ReminderScheduler {
+	maxAttempts := cfg.Reminder.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &ReminderScheduler{
+		repo:        repo,
+		todos:       todos,
+		tasks:       tasks,
+		users:       users,
+		profiles:    profiles,
+		notifiers:   notifiers,
+		instance:    instanceID(),
+		interval:    cfg.Reminder.PollInterval,
+		lease:       cfg.Reminder.Lease,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run fires due reminders until ctx is cancelled
+func (s *ReminderScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.fireDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fireDue fires the reminders that are due now
+func (s *ReminderScheduler) fireDue(ctx context.Context) {
+	for i := 0; i < remindersPerTick && ctx.Err() == nil; i++ {
+		reminder, err := s.repo.Claim(ctx, s.instance, time.Now(), s.lease)
+		if err != nil {
+			if !IsNotFound(err) && ctx.Err() == nil {
+				log.Printf("reminders: claim failed: %v", err)
+			}
+			return
+		}
+		s.fire(ctx, reminder)
+	}
+}
+
+// fire delivers a claimed reminder to the channels that have not got it yet
+// and records the outcome
+func (s *ReminderScheduler) fire(ctx context.Context, reminder *models.Reminder) {
+	msg, open, err := s.compose(ctx, reminder)
+	if err != nil {
+		s.retry(ctx, reminder, err)
+		return
+	}
+	if !open {
+		// The item was completed or deleted since the reminder was set
+		s.release(ctx, reminder, bson.M{"status": models.ReminderCancelled}, nil)
+		return
+	}
+
+	delivered := map[string]bool{}
+	for _, channel := range reminder.Delivered {
+		delivered[channel] = true
+	}
+
+	var failures []string
+	for _, channel := range reminder.Channels {
+		if delivered[channel] {
+			continue
+		}
+		// Every send starts with a fresh lease, so a slow channel does not
+		// let another instance take the reminder over midway
+		held, err := s.repo.Renew(ctx, reminder.ID, s.instance, s.lease)
+		if err != nil || !held {
+			s.leaseLost(reminder, "renewing lease", err)
+			return
+		}
+		if err := s.send(ctx, channel, msg); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", channel, err))
+			continue
+		}
+		// A delivery that is not recorded would be sent again by whoever
+		// fires the reminder next, so stop here and leave it to them;
+		// receivers drop the duplicate by its message ID
+		recorded, err := s.repo.RecordDelivery(ctx, reminder.ID, s.instance, channel)
+		if err != nil || !recorded {
+			s.leaseLost(reminder, "recording delivery to "+channel, err)
+			return
+		}
+	}
+
+	if len(failures) > 0 {
+		s.retry(ctx, reminder, errors.New(strings.Join(failures, "; ")))
+		return
+	}
+
+	set := bson.M{
+		"status":   models.ReminderSent,
+		"sent_at":  time.Now(),
+		"attempts": reminder.Attempts + 1,
+		"fired":    reminder.Fired + 1,
+	}
+	s.release(ctx, reminder, set, bson.M{"last_error": ""})
+}
+
+// release ends the lease on a reminder with its outcome. A failed release
+// leaves the reminder sending until the lease runs out, when it is fired
+// again.
+func (s *ReminderScheduler) release(ctx context.Context, reminder *models.Reminder, set, unset bson.M) {
+	released, err := s.repo.Release(ctx, reminder.ID, s.instance, set, unset)
+	if err != nil || !released {
+		s.leaseLost(reminder, "releasing", err)
+	}
+}
+
+// leaseLost logs why the scheduler stopped handling a reminder: the update
+// failed, or the lease was lost because the reminder was changed or taken
+// over meanwhile
+func (s *ReminderScheduler) leaseLost(reminder *models.Reminder, step string, err error) {
+	if err != nil {
+		log.Printf("reminders: reminder %s: %s failed: %v", reminder.ID.Hex(), step, err)
+		return
+	}
+	log.Printf("reminders: reminder %s: lease lost while %s", reminder.ID.Hex(), step)
+}
+
+func (s *ReminderScheduler) send(ctx context.Context, channel string, msg notify.Message) error {
+	notifier, ok := s.notifiers[channel]
+	if !ok {
+		return errors.New("channel is not configured")
+	}
+
+	// A send must end while the lease renewed for it still holds
+	ctx, cancel := context.WithTimeout(ctx, min(reminderSendTimeout, s.lease/2))
+	defer cancel()
+
+	return notifier.Notify(ctx, msg)
+}
+
+// retry schedules another attempt after a failed one, backing off from one
+// minute, or gives up after the last attempt
+func (s *ReminderScheduler) retry(ctx context.Context, reminder *models.Reminder, cause error) {
+	attempts := reminder.Attempts + 1
+	set := bson.M{"attempts": attempts, "last_error": cause.Error()}
+
+	if attempts >= s.maxAttempts {
+		set["status"] = models.ReminderFailed
+		set["fired"] = reminder.Fired + 1
+	} else {
+		backoff := time.Minute << (attempts - 1)
+		if backoff > maxReminderBackoff || backoff <= 0 {
+			backoff = maxReminderBackoff
+		}
+		set["status"] = models.ReminderPending
+		set["fire_at"] = time.Now().Add(backoff)
+	}
+
+	s.release(ctx, reminder, set, nil)
+}
+
+// compose builds the message of a reminder. It reports false when the item
+// is done or gone and the reminder no longer applies.
+func (s *ReminderScheduler) compose(ctx context.Context, reminder *models.Reminder) (notify.Message, bool, error) {
+	loc := userLocation(s.profiles, reminder.UserID)
+	msg := notify.Message{
+		ID:           fmt.Sprintf("%s-%d", reminder.ID.Hex(), reminder.Fired),
+		UserID:       reminder.UserID,
+		Type:         models.NotificationReminder,
+		ResourceType: reminder.TargetType,
+		CreatedAt:    time.Now(),
+		WebhookURL:   reminder.WebhookURL,
+	}
+
+	switch reminder.TargetType {
+	case models.ReminderTargetTodo:
+		todo, err := s.todos.FindByID(ctx, *reminder.TargetID, reminder.UserID)
+		if IsNotFound(err) {
+			return msg, false, nil
+		}
+		if err != nil {
+			return msg, false, err
+		}
+		if todo.Done {
+			return msg, false, nil
+		}
+		msg.ResourceID = todo.ID.Hex()
+		msg.Title = "Reminder: " + todo.Title
+		msg.Body = "No due date"
+		if due := todo.DueDate; due != nil && !due.IsZero() {
+			if todo.AllDay {
+				msg.Body = "Due " + due.UTC().Format("Monday, January 2, 2006")
+			} else {
+				msg.Body = "Due " + formatReminderTime(due.Time, loc)
+			}
+		}
+	case models.ReminderTargetTask:
+		task, err := s.tasks.FindByID(ctx, *reminder.TargetID, reminder.UserID)
+		if IsNotFound(err) {
+			return msg, false, nil
+		}
+		if err != nil {
+			return msg, false, err
+		}
+		if task.Status == "done" {
+			return msg, false, nil
+		}
+		msg.ResourceID = task.ID.Hex()
+		msg.Title = "Reminder: " + task.Title
+		msg.Body = "No deadline"
+		if !task.Deadline.IsZero() {
+			msg.Body = "Deadline " + formatReminderTime(task.Deadline, loc)
+		}
+	default:
+		day, _ := time.Parse(journalDateLayout, reminder.Date)
+		msg.ResourceID = reminder.Date
+		msg.Title = "Journal reminder for " + day.Format("Monday, January 2, 2006")
+		msg.Body = "Take a moment to write your journal entry."
+	}
+
+	if reminder.Message != "" {
+		msg.Body = reminder.Message
+	}
+
+	for _, channel := range reminder.Channels {
+		if channel != models.ChannelEmail {
+			continue
+		}
+		id, err := uuid.Parse(reminder.UserID)
+		if err != nil {
+			return msg, false, err
+		}
+		user, err := s.users.FindByID(id)
+		if err != nil {
+			return msg, false, err
+		}
+		msg.Email = user.Email
+	}
+
+	return msg, true, nil
+}
+
+func formatReminderTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("Monday, January 2, 2006 at 15:04") + " (" + loc.String() + ")"
+}
+
+// instanceID names this server instance in reminder leases
+func instanceID() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/render"
+)
+
+func noteView(note *models.Note) render.NoteView {
+	return render.NoteView{
+		Note:   note,
+		Blocks: newBlockTree(note.Blocks).nodes(""),
+	}
+}
+
+// ExportHTML renders a note as a standalone sanitized HTML page
+func (s *NoteService) ExportHTML(ctx context.Context, noteID, userID string) (*models.Note, []byte, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := render.NoteHTML(noteView(note))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return note, content, nil
+}
+
+// ExportPDF renders a note as a PDF document
+func (s *NoteService) ExportPDF(ctx context.Context, noteID, userID string) (*models.Note, []byte, error) {
+	note, err := s.GetNote(ctx, noteID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := render.NotePDF(noteView(note))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return note, content, nil
+}
+
+// ExportHTML renders a note group and all of its notes as one HTML page
+func (s *NoteGroupService) ExportHTML(ctx context.Context, groupID, userID string) (*models.NoteGroup, []byte, error) {
+	view, err := s.groupView(ctx, groupID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := render.GroupHTML(view)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return view.Group, content, nil
+}
+
+// ExportPDF renders a note group as a PDF with a table of contents
+func (s *NoteGroupService) ExportPDF(ctx context.Context, groupID, userID string) (*models.NoteGroup, []byte, error) {
+	view, err := s.groupView(ctx, groupID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := render.GroupPDF(view)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return view.Group, content, nil
+}
+
+// groupView loads a group with its notes in the order they were written
+func (s *NoteGroupService) groupView(ctx context.Context, groupID, userID string) (render.GroupView, error) {
+	notes, err := s.GetNotesInGroup(ctx, groupID, userID)
+	if err != nil {
+		return render.GroupView{}, err
+	}
+
+	group, err := s.GetGroup(ctx, groupID, userID)
+	if err != nil {
+		return render.GroupView{}, err
+	}
+
+	return newGroupView(group, notes), nil
+}
+
+// newGroupView arranges a group's notes in the order they were written
+func newGroupView(group *models.NoteGroup, notes []*models.Note) render.GroupView {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+	})
+
+	views := make([]render.NoteView, 0, len(notes))
+	for _, note := range notes {
+		views = append(views, noteView(note))
+	}
+
+	return render.GroupView{Group: group, Notes: views}
+}
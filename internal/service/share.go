@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/render"
+	"backend-journaling/internal/repository"
+	"backend-journaling/pkg/password"
+	"backend-journaling/pkg/token"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrShareNotFound         = errors.New("share link not found")
+	ErrShareExpired          = errors.New("share link has expired")
+	ErrSharePasswordRequired = errors.New("share link is password protected")
+	ErrInvalidSharePassword  = errors.New("invalid share link password")
+	ErrInvalidShareExpiry    = errors.New("expires_at must be in the future")
+	ErrInvalidShareResource  = errors.New("resource type must be note or group")
+	ErrSharePasswordTooLong  = errors.New("share link password is too long")
+)
+
+// SharePublicPath is where share links point to
+const SharePublicPath = "/api/v1/public/%s"
+
+// maxSharePasswordLength bounds the input hashed for a share link password
+const maxSharePasswordLength = 128
+
+// ShareSettings configures the link of a note or group. ExpiresAt nil means
+// the link never expires. Password nil keeps the current password, an empty
+// one removes it.
+type ShareSettings struct {
+	ExpiresAt *time.Time
+	Password  *string
+}
+
+// ShareLinkView is a share link as its owner sees it
+type ShareLinkView struct {
+	models.ShareLink
+	Title       string `json:"title"`
+	Path        string `json:"path"`
+	HasPassword bool   `json:"has_password"`
+	Expired     bool   `json:"expired"`
+}
+
+// PublicBlock is a block stripped of everything but what a reader sees
+type PublicBlock struct {
+	Type      string           `json:"type"`
+	ContentMD *string          `json:"content_md,omitempty"`
+	Items     []PublicTodoItem `json:"items,omitempty"`
+	Children  []PublicBlock    `json:"children"`
+}
+
+// PublicTodoItem is a todo item without its ID
+type PublicTodoItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// PublicNote is the public rendering of a shared note; it carries no IDs or
+// owner information
+type PublicNote struct {
+	Title     string        `json:"title"`
+	Tags      []string      `json:"tags"`
+	Blocks    []PublicBlock `json:"blocks"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type PublicGroup struct {
+	Name        string       `json:"name"`
+	Description *string      `json:"description,omitempty"`
+	Notes       []PublicNote `json:"notes"`
+}
+
+// SharedItem is what a share link serves: a note or a group with its notes
+type SharedItem struct {
+	Type  string       `json:"type"`
+	Note  *PublicNote  `json:"note,omitempty"`
+	Group *PublicGroup `json:"group,omitempty"`
+}
+
+// ShareService publishes notes and note groups through unguessable public
+// links and serves them to readers without an account
+type ShareService struct {
+	repo      *repository.ShareLinkRepository
+	noteRepo  *repository.NoteRepository
+	groupRepo *repository.NoteGroupRepository
+}
+
+func NewShareService(repo *repository.ShareLinkRepository, noteRepo *repository.NoteRepository, groupRepo *repository.NoteGroupRepository) *ShareService {
+	return &ShareService{
+		repo:      repo,
+		noteRepo:  noteRepo,
+		groupRepo: groupRepo,
+	}
+}
+
+// ListShares returns the user's share links. Links whose note or group was
+// deleted in the meantime are removed.
+func (s *ShareService) ListShares(ctx context.Context, userID string) ([]ShareLinkView, error) {
+	links, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]ShareLinkView, 0, len(links))
+	for i := range links {
+		title, err := s.resourceTitle(ctx, &links[i])
+		if IsNotFound(err) {
+			s.repo.Delete(ctx, links[i].ID, userID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, shareLinkView(&links[i], title))
+	}
+
+	return views, nil
+}
+
+// GetShare returns the link of a note or group
+func (s *ShareService) GetShare(ctx context.Context, userID, resourceType, resourceID string) (*ShareLinkView, error) {
+	link, title, err := s.find(ctx, userID, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, ErrShareNotFound
+	}
+
+	view := shareLinkView(link, title)
+	return &view, nil
+}
+
+// PutShare publishes a note or group, or changes the settings of its link.
+// The token of an existing link is kept so URLs already handed out keep
+// working.
+func (s *ShareService) PutShare(ctx context.Context, userID, resourceType, resourceID string, settings ShareSettings) (*ShareLinkView, bool, error) {
+	if settings.ExpiresAt != nil && !settings.ExpiresAt.After(time.Now()) {
+		return nil, false, ErrInvalidShareExpiry
+	}
+	if settings.Password != nil && len(*settings.Password) > maxSharePasswordLength {
+		return nil, false, ErrSharePasswordTooLong
+	}
+
+	link, title, err := s.find(ctx, userID, resourceType, resourceID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var passwordHash *string
+	if settings.Password != nil && *settings.Password != "" {
+		hash, err := password.Hash(*settings.Password)
+		if err != nil {
+			return nil, false, err
+		}
+		passwordHash = &hash
+	}
+
+	if link == nil {
+		resourceObjID, _ := primitive.ObjectIDFromHex(resourceID)
+		shareToken, err := token.Generate()
+		if err != nil {
+			return nil, false, err
+		}
+
+		link = &models.ShareLink{
+			UserID:       userID,
+			ResourceType: resourceType,
+			ResourceID:   resourceObjID,
+			Token:        shareToken,
+			PasswordHash: passwordHash,
+			ExpiresAt:    settings.ExpiresAt,
+		}
+		if err := s.repo.Create(ctx, link); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				// Shared concurrently; apply the settings to that link
+				return s.PutShare(ctx, userID, resourceType, resourceID, settings)
+			}
+			return nil, false, err
+		}
+
+		view := shareLinkView(link, title)
+		return &view, true, nil
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	if settings.ExpiresAt != nil {
+		set["expires_at"] = *settings.ExpiresAt
+	} else {
+		unset["expires_at"] = ""
+	}
+	if settings.Password != nil {
+		if passwordHash != nil {
+			set["password_hash"] = *passwordHash
+		} else {
+			unset["password_hash"] = ""
+		}
+	}
+
+	if err := s.repo.Update(ctx, link.ID, userID, set, unset); err != nil {
+		return nil, false, err
+	}
+
+	link, err = s.repo.FindByResource(ctx, userID, resourceType, link.ResourceID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	view := shareLinkView(link, title)
+	return &view, false, nil
+}
+
+// RevokeShare deletes the link of a note or group; its URL stops working
+func (s *ShareService) RevokeShare(ctx context.Context, userID, resourceType, resourceID string) error {
+	link, _, err := s.find(ctx, userID, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		return ErrShareNotFound
+	}
+
+	return s.repo.Delete(ctx, link.ID, userID)
+}
+
+// View returns the public JSON rendering of a shared item and counts the view
+func (s *ShareService) View(ctx context.Context, shareToken, pass string) (*SharedItem, error) {
+	link, note, group, err := s.open(ctx, shareToken, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &SharedItem{Type: link.ResourceType}
+	if note != nil {
+		public := publicNote(noteView(note))
+		item.Note = &public
+	} else {
+		item.Group = &PublicGroup{
+			Name:        group.Group.Name,
+			Description: group.Group.Description,
+			Notes:       make([]PublicNote, 0, len(group.Notes)),
+		}
+		for _, view := range group.Notes {
+			item.Group.Notes = append(item.Group.Notes, publicNote(view))
+		}
+	}
+
+	return item, nil
+}
+
+// ViewHTML returns the sanitized HTML page of a shared item and counts the
+// view
+func (s *ShareService) ViewHTML(ctx context.Context, shareToken, pass string) ([]byte, error) {
+	_, note, group, err := s.open(ctx, shareToken, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	if note != nil {
+		return render.NoteHTML(noteView(note))
+	}
+	return render.GroupHTML(*group)
+}
+
+// open checks a link's expiry and password and loads what it shares; exactly
+// one of the returned note and group is set
+func (s *ShareService) open(ctx context.Context, shareToken, pass string) (*models.ShareLink, *models.Note, *render.GroupView, error) {
+	if shareToken == "" {
+		return nil, nil, nil, ErrShareNotFound
+	}
+
+	link, err := s.repo.FindByToken(ctx, shareToken)
+	if IsNotFound(err) {
+		return nil, nil, nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now()
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(now) {
+		return nil, nil, nil, ErrShareExpired
+	}
+	if link.PasswordHash != nil {
+		if pass == "" {
+			return nil, nil, nil, ErrSharePasswordRequired
+		}
+		valid, err := password.Verify(pass, *link.PasswordHash)
+		if err != nil || !valid {
+			return nil, nil, nil, ErrInvalidSharePassword
+		}
+	}
+
+	var note *models.Note
+	var group *render.GroupView
+	if link.ResourceType == models.ShareResourceNote {
+		note, err = s.noteRepo.FindByID(ctx, link.ResourceID, authz.Owner(link.UserID))
+	} else {
+		group, err = s.groupView(ctx, link)
+	}
+	if IsNotFound(err) {
+		s.repo.Delete(ctx, link.ID, link.UserID)
+		return nil, nil, nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	s.repo.RecordView(ctx, link.ID, now)
+	return link, note, group, nil
+}
+
+func (s *ShareService) groupView(ctx context.Context, link *models.ShareLink) (*render.GroupView, error) {
+	group, err := s.groupRepo.FindByID(ctx, link.ResourceID, authz.Owner(link.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.groupRepo.GetNotesInGroup(ctx, link.ResourceID, authz.Owner(link.UserID))
+	if err != nil {
+		return nil, err
+	}
+	view := newGroupView(group, notes)
+	return &view, nil
+}
+
+// find verifies that the user owns the note or group and returns its link,
+// nil when it is not shared, together with its title
+func (s *ShareService) find(ctx context.Context, userID, resourceType, resourceID string) (*models.ShareLink, string, error) {
+	var objID primitive.ObjectID
+	var title string
+	var err error
+
+	switch resourceType {
+	case models.ShareResourceNote:
+		if objID, err = primitive.ObjectIDFromHex(resourceID); err != nil {
+			return nil, "", ErrInvalidNoteID
+		}
+		note, err := s.noteRepo.FindByID(ctx, objID, authz.Owner(userID))
+		if IsNotFound(err) {
+			return nil, "", ErrNoteNotFound
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		title = note.Title
+	case models.ShareResourceGroup:
+		if objID, err = primitive.ObjectIDFromHex(resourceID); err != nil {
+			return nil, "", ErrInvalidGroupID
+		}
+		group, err := s.groupRepo.FindByID(ctx, objID, authz.Owner(userID))
+		if IsNotFound(err) {
+			return nil, "", ErrGroupNotFound
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		title = group.Name
+	default:
+		return nil, "", ErrInvalidShareResource
+	}
+
+	link, err := s.repo.FindByResource(ctx, userID, resourceType, objID)
+	if IsNotFound(err) {
+		return nil, title, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return link, title, nil
+}
+
+func (s *ShareService) resourceTitle(ctx context.Context, link *models.ShareLink) (string, error) {
+	if link.ResourceType == models.ShareResourceNote {
+		note, err := s.noteRepo.FindByID(ctx, link.ResourceID, authz.Owner(link.UserID))
+		if err != nil {
+			return "", err
+		}
+		return note.Title, nil
+	}
+
+	group, err := s.groupRepo.FindByID(ctx, link.ResourceID, authz.Owner(link.UserID))
+	if err != nil {
+		return "", err
+	}
+	return group.Name, nil
+}
+
+func shareLinkView(link *models.ShareLink, title string) ShareLinkView {
+	return ShareLinkView{
+		ShareLink:   *link,
+		Title:       title,
+		Path:        fmt.Sprintf(SharePublicPath, link.Token),
+		HasPassword: link.PasswordHash != nil,
+		Expired:     link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()),
+	}
+}
+
+func publicNote(view render.NoteView) PublicNote {
+	tags := view.Note.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return PublicNote{
+		Title:     view.Note.Title,
+		Tags:      tags,
+		Blocks:    publicBlocks(view.Blocks),
+		UpdatedAt: view.Note.UpdatedAt,
+	}
+}
+
+func publicBlocks(nodes []models.BlockNode) []PublicBlock {
+	blocks := make([]PublicBlock, 0, len(nodes))
+	for _, node := range nodes {
+		blocks = append(blocks, PublicBlock{
+			Type:      node.Type,
+			ContentMD: node.ContentMD,
+			Items:     publicItems(node.Items),
+			Children:  publicBlocks(node.Children),
+		})
+	}
+	return blocks
+}
+
+func publicItems(items []models.TodoItem) []PublicTodoItem {
+	if len(items) == 0 {
+		return nil
+	}
+	public := make([]PublicTodoItem, len(items))
+	for i, item := range items {
+		public[i] = PublicTodoItem{Text: item.Text, Done: item.Done}
+	}
+	return public
+}
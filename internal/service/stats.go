@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"backend-journaling/config"
+	"backend-journaling/internal/repository"
+)
+
+var ErrInvalidStatsGrouping = errors.New("group_by must be day or week")
+
+const (
+	StatsGroupByDay  = "day"
+	StatsGroupByWeek = "week"
+
+	// defaultStatsWeeks is the range covered by weekly stats when no dates
+	// are given
+	defaultStatsWeeks = 12
+	topTagsLimit      = 10
+)
+
+// WordCount is how many words were written in a day or in a week starting on
+// Monday; Period is the date of the day or of that Monday
+type WordCount struct {
+	Period string `json:"period"`
+	Words  int    `json:"words"`
+	Notes  int    `json:"notes"`
+}
+
+type CompletionStats struct {
+	Total          int     `json:"total"`
+	Done           int     `json:"done"`
+	Open           int     `json:"open"`
+	Overdue        int     `json:"overdue"`
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// Stats is the writing and productivity dashboard of a user
+type Stats struct {
+	From             string                  `json:"from"`
+	To               string                  `json:"to"`
+	GroupBy          string                  `json:"group_by"`
+	Timezone         string                  `json:"timezone"`
+	Words            []WordCount             `json:"words"`
+	TotalWords       int                     `json:"total_words"`
+	JournalingStreak Streak                  `json:"journaling_streak"`
+	TopTags          []TagSummary            `json:"top_tags"`
+	NotesPerGroup    []repository.GroupCount `json:"notes_per_group"`
+	Tasks            CompletionStats         `json:"tasks"`
+	Todos            CompletionStats         `json:"todos"`
+	GeneratedAt      time.Time               `json:"generated_at"`
+}
+
+type statsCacheEntry struct {
+	stats     *Stats
+	expiresAt time.Time
+}
+
+// StatsCache holds the computed stats per user until they expire or the
+// user's data changes. The services that write notes, groups, tags, tasks and
+// todos call Invalidate with the ID of the user owning the changed data.
+type StatsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string]statsCacheEntry
+	// generations counts the invalidations per user so that stats computed
+	// while a write happened are not cached
+	generations map[string]uint64
+}
+
+func NewStatsCache(cfg *config.Config) *StatsCache {
+	return &StatsCache{
+		ttl:         cfg.Stats.CacheTTL,
+		entries:     make(map[string]map[string]statsCacheEntry),
+		generations: make(map[string]uint64),
+	}
+}
+
+// StatsService computes dashboard statistics, cached per user in a
+// StatsCache
+type StatsService struct {
+	repo        *repository.StatsRepository
+	tags        *TagService
+	profileRepo *repository.ProfileRepository
+	cache       *StatsCache
+}
+
+func NewStatsService(repo *repository.StatsRepository, tags *TagService, profileRepo *repository.ProfileRepository, cache *StatsCache) *StatsService {
+	return &StatsService{
+		repo:        repo,
+		tags:        tags,
+		profileRepo: profileRepo,
+		cache:       cache,
+	}
+}
+
+// GetStats returns the dashboard for words written between from and to
+// (yyyy-mm-dd) per day or per week. Without dates it covers the last 30 days,
+// or the last 12 weeks when grouped by week. Days are taken in the time zone
+// of the user's profile.
+func (s *StatsService) GetStats(ctx context.Context, userID, groupBy, from, to string) (*Stats, error) {
+	if groupBy == "" {
+		groupBy = StatsGroupByDay
+	}
+	if groupBy != StatsGroupByDay && groupBy != StatsGroupByWeek {
+		return nil, ErrInvalidStatsGrouping
+	}
+
+	loc := userLocation(s.profileRepo, userID)
+	now := time.Now().In(loc)
+	today := now.Format(journalDateLayout)
+
+	var start, end string
+	if groupBy == StatsGroupByWeek && from == "" && to == "" {
+		day, _ := time.Parse(journalDateLayout, today)
+		start = weekStart(day).AddDate(0, 0, -7*(defaultStatsWeeks-1)).Format(journalDateLayout)
+		end = today
+	} else {
+		var err error
+		if start, end, err = trackingRange(from, to, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// The current day is part of the key so cached streaks roll over at
+	// midnight in the user's time zone
+	key := groupBy + "|" + start + "|" + end + "|" + today
+	stats, generation := s.cache.get(userID, key)
+	if stats != nil {
+		return stats, nil
+	}
+
+	stats, err := s.compute(ctx, userID, groupBy, start, end, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.store(userID, key, stats, generation)
+	return stats, nil
+}
+
+// Invalidate drops the cached stats of a user; call it after the user's
+// notes, groups, tags, tasks or todos change
+func (c *StatsCache) Invalidate(userID string) {
+	c.mu.Lock()
+	delete(c.entries, userID)
+	c.generations[userID]++
+	c.mu.Unlock()
+}
+
+func (s *StatsService) compute(ctx context.Context, userID, groupBy, start, end string, loc *time.Location) (*Stats, error) {
+	now := time.Now().In(loc)
+	first, _ := time.Parse(journalDateLayout, start)
+	last, _ := time.Parse(journalDateLayout, end)
+
+	stats := &Stats{
+		From:        start,
+		To:          end,
+		GroupBy:     groupBy,
+		Timezone:    loc.String(),
+		Words:       []WordCount{},
+		GeneratedAt: now,
+	}
+
+	startTime := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	endTime := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, loc)
+	days, err := s.repo.WordsPerDay(ctx, userID, start, end, loc.String(), startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every period of the range is listed, including the ones without notes
+	periods := make(map[string]int)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		label := statsPeriod(day, groupBy)
+		if _, ok := periods[label]; !ok {
+			periods[label] = len(stats.Words)
+			stats.Words = append(stats.Words, WordCount{Period: label})
+		}
+	}
+	for _, day := range days {
+		date, err := time.Parse(journalDateLayout, day.Date)
+		if err != nil {
+			continue
+		}
+		if i, ok := periods[statsPeriod(date, groupBy)]; ok {
+			stats.Words[i].Words += day.Words
+			stats.Words[i].Notes += day.Notes
+			stats.TotalWords += day.Words
+		}
+	}
+
+	active, err := s.repo.ActiveDays(ctx, userID, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	today := now.Format(journalDateLayout)
+	stats.JournalingStreak = streak(active, today, today)
+
+	if stats.TopTags, err = s.tags.ListTags(ctx, userID, "", topTagsLimit); err != nil {
+		return nil, err
+	}
+
+	if stats.NotesPerGroup, err = s.repo.NotesPerGroup(ctx, userID); err != nil {
+		return nil, err
+	}
+	if stats.NotesPerGroup == nil {
+		stats.NotesPerGroup = []repository.GroupCount{}
+	}
+
+	tasks, err := s.repo.TaskCounts(ctx, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	stats.Tasks = completionStats(tasks)
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	todos, err := s.repo.TodoCounts(ctx, userID, now, day)
+	if err != nil {
+		return nil, err
+	}
+	stats.Todos = completionStats(todos)
+
+	return stats, nil
+}
+
+// get returns the cached stats for key, if still fresh, and the user's
+// current cache generation
+func (c *StatsCache) get(userID, key string) (*Stats, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID][key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, c.generations[userID]
+	}
+	return entry.stats, c.generations[userID]
+}
+
+// store caches stats unless the user's data changed since generation
+func (c *StatsCache) store(userID, key string, stats *Stats, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[userID] != generation {
+		return
+	}
+
+	entries, ok := c.entries[userID]
+	if !ok {
+		entries = make(map[string]statsCacheEntry)
+		c.entries[userID] = entries
+	}
+
+	now := time.Now()
+	for k, entry := range entries {
+		if now.After(entry.expiresAt) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = statsCacheEntry{stats: stats, expiresAt: now.Add(c.ttl)}
+}
+
+func completionStats(counts *repository.CompletionCounts) CompletionStats {
+	stats := CompletionStats{
+		Total:   counts.Total,
+		Done:    counts.Done,
+		Open:    counts.Total - counts.Done,
+		Overdue: counts.Overdue,
+	}
+	if counts.Total > 0 {
+		stats.CompletionRate = round(float64(counts.Done)/float64(counts.Total), 3)
+	}
+	return stats
+}
+
+// statsPeriod is the label of the day or week a day is counted in
+func statsPeriod(day time.Time, groupBy string) string {
+	if groupBy == StatsGroupByWeek {
+		day = weekStart(day)
+	}
+	return day.Format(journalDateLayout)
+}
+
+// weekStart is the Monday of the week a day falls in
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
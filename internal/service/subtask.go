@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxTaskDepth is how many levels of subtasks a top-level task can have
+	maxTaskDepth           = 5
+	maxSubtasks            = 100
+	maxChecklistItems      = 100
+	maxChecklistTextLength = 500
+)
+
+// CreateSubtask adds a subtask at the end of a task's subtasks. A subtask is
+// a task of its own with its own status, deadline and reminders.
+func (s *TaskService) CreateSubtask(ctx context.Context, userID, parentID, title, descriptionMD, priority string, deadline time.Time, tags []string, autoComplete bool, repeat RecurrenceInput) (*models.Task, error) {
+	parent, err := s.findTask(ctx, userID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(parent.Ancestors) >= maxTaskDepth {
+		return nil, ErrTaskTooDeep
+	}
+
+	siblings, err := s.repo.FindSubtasks(ctx, userID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(siblings) >= maxSubtasks {
+		return nil, ErrTooManySubtasks
+	}
+	position, err := s.slot(ctx, userID, siblings, len(siblings))
+	if err != nil {
+		return nil, err
+	}
+
+	task := &models.Task{
+		UserID:       userID,
+		Title:        title,
+		Status:       "todo",
+		Priority:     priority,
+		Deadline:     deadline,
+		Tags:         tags,
+		ParentID:     &parent.ID,
+		Ancestors:    append(append([]primitive.ObjectID{}, parent.Ancestors...), parent.ID),
+		Position:     position,
+		AutoComplete: autoComplete,
+	}
+	if descriptionMD != "" {
+		task.DescriptionMD = &descriptionMD
+	}
+
+	if err := s.create(ctx, task, repeat); err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+// ListSubtasks returns the direct subtasks of a task in their order
+func (s *TaskService) ListSubtasks(ctx context.Context, userID, taskID string) ([]models.Task, error) {
+	parent, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	subtasks, err := s.repo.FindSubtasks(ctx, userID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withProgress(ctx, userID, taskPointers(subtasks)); err != nil {
+		return nil, err
+	}
+
+	return subtasks, nil
+}
+
+// ReorderSubtasks sets the order of a task's subtasks; order must list each
+// of them exactly once
+func (s *TaskService) ReorderSubtasks(ctx context.Context, userID, taskID string, order []string) ([]models.Task, error) {
+	parent, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := s.repo.FindSubtasks(ctx, userID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) != len(subtasks) {
+		return nil, ErrInvalidSubtaskOrder
+	}
+
+	expected := make(map[string]primitive.ObjectID, len(subtasks))
+	for _, subtask := range subtasks {
+		expected[subtask.ID.Hex()] = subtask.ID
+	}
+	ids := make([]primitive.ObjectID, 0, len(order))
+	for _, id := range order {
+		objID, ok := expected[id]
+		if !ok {
+			return nil, ErrInvalidSubtaskOrder
+		}
+		delete(expected, id)
+		ids = append(ids, objID)
+	}
+
+	positions, err := positionsBetween("", "", len(ids))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Place(ctx, userID, placements(ids, positions)); err != nil {
+		return nil, err
+	}
+
+	return s.ListSubtasks(ctx, userID, taskID)
+}
+
+// MoveSubtask puts a subtask right after the subtask afterID, right before
+// the subtask beforeID, or last when neither is set
+func (s *TaskService) MoveSubtask(ctx context.Context, userID, taskID, subtaskID string, afterID, beforeID *string) (*models.Task, error) {
+	if afterID != nil && beforeID != nil {
+		return nil, ErrAmbiguousPlacement
+	}
+
+	parent, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := s.repo.FindSubtasks(ctx, userID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtask *models.Task
+	others := make([]models.Task, 0, len(subtasks))
+	for i := range subtasks {
+		if subtasks[i].ID.Hex() == subtaskID {
+			subtask = &subtasks[i]
+			continue
+		}
+		others = append(others, subtasks[i])
+	}
+	if subtask == nil {
+		return nil, ErrSubtaskNotFound
+	}
+
+	// at is where the subtask goes among the others
+	at := len(others)
+	if anchor := firstNonNil(afterID, beforeID); anchor != nil {
+		at = -1
+		for i, other := range others {
+			if other.ID.Hex() == *anchor {
+				at = i
+			}
+		}
+		if at < 0 {
+			return nil, ErrInvalidPlacement
+		}
+		if afterID != nil {
+			at++
+		}
+	}
+
+	position, err := s.slot(ctx, userID, others, at)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Place(ctx, userID, []repository.Placement{{ID: subtask.ID, Position: position}}); err != nil {
+		return nil, err
+	}
+
+	return s.GetTask(ctx, subtask.ID.Hex(), userID)
+}
+
+// AddChecklistItem appends an item to a task's checklist
+func (s *TaskService) AddChecklistItem(ctx context.Context, userID, taskID, text string) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if len(task.Checklist) >= maxChecklistItems {
+		return nil, ErrChecklistFull
+	}
+	text, err = checklistText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	item := models.TodoItem{ID: uuid.New().String(), Text: text}
+	if err := s.repo.AddChecklistItem(ctx, task.ID, userID, item); err != nil {
+		return nil, err
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// UpdateChecklistItem changes the text of a checklist item or ticks it;
+// ticking the last open item may complete the task
+func (s *TaskService) UpdateChecklistItem(ctx context.Context, userID, taskID, itemID string, text *string, done *bool) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	if text != nil {
+		value, err := checklistText(*text)
+		if err != nil {
+			return nil, err
+		}
+		set["text"] = value
+	}
+	if done != nil {
+		set["done"] = *done
+	}
+
+	if err := s.repo.UpdateChecklistItem(ctx, task.ID, userID, itemID, set); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrChecklistItemNotFound
+		}
+		return nil, err
+	}
+	if done != nil && *done {
+		if err := s.rollUp(ctx, userID, &task.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// DeleteChecklistItem removes a checklist item; removing the last open item
+// may complete the task
+func (s *TaskService) DeleteChecklistItem(ctx context.Context, userID, taskID, itemID string) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RemoveChecklistItem(ctx, task.ID, userID, itemID); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrChecklistItemNotFound
+		}
+		return nil, err
+	}
+	if err := s.rollUp(ctx, userID, &task.ID); err != nil {
+		return nil, err
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// ReorderChecklist sets the order of a task's checklist; order must list
+// each item exactly once
+func (s *TaskService) ReorderChecklist(ctx context.Context, userID, taskID string, order []string) (*models.Task, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) != len(task.Checklist) {
+		return nil, ErrInvalidChecklistOrder
+	}
+
+	items := make(map[string]models.TodoItem, len(task.Checklist))
+	for _, item := range task.Checklist {
+		items[item.ID] = item
+	}
+	checklist := make([]models.TodoItem, 0, len(order))
+	for _, id := range order {
+		item, ok := items[id]
+		if !ok {
+			return nil, ErrInvalidChecklistOrder
+		}
+		delete(items, id)
+		checklist = append(checklist, item)
+	}
+
+	if err := s.repo.ReplaceChecklist(ctx, task.ID, userID, checklist); err != nil {
+		if IsNotFound(err) {
+			// The checklist changed since it was read
+			return nil, ErrInvalidChecklistOrder
+		}
+		return nil, err
+	}
+
+	return s.GetTask(ctx, taskID, userID)
+}
+
+// rollUp completes the task id when it completes itself and all of its
+// subtasks and checklist items are done. Completing it rolls up further to
+// its own parent. Reopening a subtask never reopens its parent.
+func (s *TaskService) rollUp(ctx context.Context, userID string, id *primitive.ObjectID) error {
+	if id == nil {
+		return nil
+	}
+
+	task, err := s.repo.FindByID(ctx, *id, userID)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !task.AutoComplete || task.Status == "done" {
+		return nil
+	}
+
+	if err := s.withProgress(ctx, userID, []*models.Task{task}); err != nil {
+		return err
+	}
+	if task.Progress == nil || task.Progress.Done < task.Progress.Total {
+		return nil
+	}
+
+	after, err := s.transition(ctx, task, "done", true, nil, nil)
+	if errors.Is(err, ErrTaskMoved) {
+		// Another request changed the task first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return after(ctx)
+}
+
+// withProgress fills in the progress of tasks that have subtasks or a
+// checklist
+func (s *TaskService) withProgress(ctx context.Context, userID string, tasks []*models.Task) error {
+	ids := make([]primitive.ObjectID, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	counts, err := s.repo.SubtaskCounts(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		subtasks := counts[task.ID]
+		progress := models.TaskProgress{
+			SubtasksDone:   subtasks.Done,
+			SubtasksTotal:  subtasks.Total,
+			ChecklistTotal: len(task.Checklist),
+		}
+		for _, item := range task.Checklist {
+			if item.Done {
+				progress.ChecklistDone++
+			}
+		}
+		progress.Done = progress.SubtasksDone + progress.ChecklistDone
+		progress.Total = progress.SubtasksTotal + progress.ChecklistTotal
+
+		task.Progress = nil
+		if progress.Total > 0 {
+			task.Progress = &progress
+		}
+	}
+
+	return nil
+}
+
+// positionAfter finds a position right after a subtask among its siblings
+func (s *TaskService) positionAfter(ctx context.Context, task *models.Task) (string, error) {
+	siblings, err := s.repo.FindSubtasks(ctx, task.UserID, *task.ParentID)
+	if err != nil {
+		return "", err
+	}
+
+	at := len(siblings)
+	for i, sibling := range siblings {
+		if sibling.ID == task.ID {
+			at = i + 1
+		}
+	}
+
+	return s.slot(ctx, task.UserID, siblings, at)
+}
+
+// slot finds the position of a subtask going to index at among siblings,
+// giving the siblings fresh positions first when there is no room left
+func (s *TaskService) slot(ctx context.Context, userID string, siblings []models.Task, at int) (string, error) {
+	positions := make([]string, len(siblings))
+	for i, sibling := range siblings {
+		positions[i] = sibling.Position
+	}
+
+	position, fresh, err := placeAmong(positions, at)
+	if err != nil || fresh == nil {
+		return position, err
+	}
+
+	writes := make([]repository.Placement, len(siblings))
+	for i, sibling := range siblings {
+		j := i
+		if i >= at {
+			j++
+		}
+		writes[i] = repository.Placement{ID: sibling.ID, Position: fresh[j]}
+	}
+	if err := s.repo.Place(ctx, userID, writes); err != nil {
+		return "", err
+	}
+
+	return position, nil
+}
+
+func (s *TaskService) findTask(ctx context.Context, userID, taskID string) (*models.Task, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, ErrInvalidTaskID
+	}
+
+	return s.repo.FindByID(ctx, objID, userID)
+}
+
+func checklistText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrChecklistTextRequired
+	}
+	if utf8.RuneCountInString(text) > maxChecklistTextLength {
+		return "", ErrChecklistTextTooLong
+	}
+	return text, nil
+}
+
+// freshChecklist copies a checklist for the next occurrence of a task, with
+// new ids and every item open
+func freshChecklist(checklist []models.TodoItem) []models.TodoItem {
+	if len(checklist) == 0 {
+		return nil
+	}
+
+	fresh := make([]models.TodoItem, len(checklist))
+	for i, item := range checklist {
+		fresh[i] = models.TodoItem{ID: uuid.New().String(), Text: item.Text}
+	}
+	return fresh
+}
+
+func taskPointers(tasks []models.Task) []*models.Task {
+	pointers := make([]*models.Task, len(tasks))
+	for i := range tasks {
+		pointers[i] = &tasks[i]
+	}
+	return pointers
+}
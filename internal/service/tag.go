@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTagExists       = errors.New("tag already exists")
+	ErrInvalidTagName  = errors.New("invalid tag name")
+	ErrInvalidTagColor = errors.New("invalid tag color")
+)
+
+var tagColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// TagSummary is a tag with how often it is used
+type TagSummary struct {
+	Name      string  `json:"name"`
+	Color     *string `json:"color,omitempty"`
+	NoteCount int     `json:"note_count"`
+	TaskCount int     `json:"task_count"`
+	Count     int     `json:"count"`
+}
+
+type TagService struct {
+	repo  *repository.TagRepository
+	stats *StatsCache
+}
+
+func NewTagService(repo *repository.TagRepository, stats *StatsCache) *TagService {
+	return &TagService{repo: repo, stats: stats}
+}
+
+// tagIndex is the user's tags keyed by normalised name, together with the raw
+// spellings stored in notes and tasks for each of them
+type tagIndex struct {
+	tags     map[string]*TagSummary
+	variants map[string][]string
+}
+
+// ListTags returns the user's tags ordered by usage. A non-empty prefix limits
+// the result to tags starting with it and limit caps its length when positive.
+func (s *TagService) ListTags(ctx context.Context, userID, prefix string, limit int) ([]TagSummary, error) {
+	index, err := s.index(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = normalizeTag(prefix)
+	tags := make([]TagSummary, 0, len(index.tags))
+	for name, tag := range index.tags {
+		if strings.HasPrefix(name, prefix) {
+			tags = append(tags, *tag)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+
+	if limit > 0 && len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	return tags, nil
+}
+
+// UpdateTag renames a tag and/or changes its colour. Renaming rewrites every
+// note and task carrying the tag in one transaction; renaming onto a tag that
+// already exists is refused, use MergeTags instead. An empty colour clears it.
+func (s *TagService) UpdateTag(ctx context.Context, userID, name string, newName, color *string) (*TagSummary, error) {
+	name = normalizeTag(name)
+
+	index, err := s.index(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := index.tags[name]; !ok {
+		return nil, ErrTagNotFound
+	}
+
+	if color != nil && *color != "" && !tagColorPattern.MatchString(*color) {
+		return nil, ErrInvalidTagColor
+	}
+
+	target := name
+	if newName != nil {
+		target = normalizeTag(*newName)
+		if target == "" {
+			return nil, ErrInvalidTagName
+		}
+		if _, exists := index.tags[target]; exists && target != name {
+			return nil, ErrTagExists
+		}
+
+		// Renaming onto the same name still normalises stored spellings
+		if err := s.rename(ctx, userID, index, []string{name}, target); err != nil {
+			return nil, err
+		}
+	}
+
+	if color != nil {
+		var value *string
+		if *color != "" {
+			lower := strings.ToLower(*color)
+			value = &lower
+		}
+		if _, err := s.repo.SetColor(ctx, userID, target, value); err != nil {
+			return nil, err
+		}
+		s.stats.Invalidate(userID)
+	}
+
+	return s.summary(ctx, userID, target)
+}
+
+// MergeTags folds the source tags into target, which is created if it does
+// not exist yet, and returns the merged tag
+func (s *TagService) MergeTags(ctx context.Context, userID string, sources []string, target string) (*TagSummary, error) {
+	target = normalizeTag(target)
+	if target == "" {
+		return nil, ErrInvalidTagName
+	}
+
+	index, err := s.index(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{target}
+	for _, source := range normalizeTags(sources) {
+		if _, ok := index.tags[source]; !ok {
+			return nil, ErrTagNotFound
+		}
+		if source != target {
+			names = append(names, source)
+		}
+	}
+	if len(names) == 1 {
+		return nil, ErrInvalidTagName
+	}
+
+	if err := s.rename(ctx, userID, index, names, target); err != nil {
+		return nil, err
+	}
+
+	return s.summary(ctx, userID, target)
+}
+
+// rename rewrites every raw spelling of names to target in notes, tasks and
+// tag metadata within one transaction
+func (s *TagService) rename(ctx context.Context, userID string, index *tagIndex, names []string, target string) error {
+	var from, metadata []string
+	for _, name := range names {
+		from = append(from, index.variants[name]...)
+		if name != target {
+			metadata = append(metadata, name)
+		}
+	}
+
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		if len(from) > 0 {
+			if err := s.repo.ReplaceInDocuments(ctx, userID, from, target); err != nil {
+				return err
+			}
+		}
+		if len(metadata) == 0 {
+			return nil
+		}
+		return s.repo.Rename(ctx, userID, metadata, target)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.stats.Invalidate(userID)
+	return nil
+}
+
+func (s *TagService) summary(ctx context.Context, userID, name string) (*TagSummary, error) {
+	index, err := s.index(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, ok := index.tags[name]
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+	return tag, nil
+}
+
+func (s *TagService) index(ctx context.Context, userID string) (*tagIndex, error) {
+	index := &tagIndex{
+		tags:     make(map[string]*TagSummary),
+		variants: make(map[string][]string),
+	}
+
+	entry := func(raw string) *TagSummary {
+		name := normalizeTag(raw)
+		if name == "" {
+			return nil
+		}
+
+		tag, ok := index.tags[name]
+		if !ok {
+			tag = &TagSummary{Name: name}
+			index.tags[name] = tag
+		}
+
+		known := false
+		for _, variant := range index.variants[name] {
+			if variant == raw {
+				known = true
+				break
+			}
+		}
+		if !known && raw != "" {
+			index.variants[name] = append(index.variants[name], raw)
+		}
+		return tag
+	}
+
+	notes, err := s.repo.NoteUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range notes {
+		if tag := entry(usage.Name); tag != nil {
+			tag.NoteCount += usage.Count
+			tag.Count += usage.Count
+		}
+	}
+
+	tasks, err := s.repo.TaskUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range tasks {
+		if tag := entry(usage.Name); tag != nil {
+			tag.TaskCount += usage.Count
+			tag.Count += usage.Count
+		}
+	}
+
+	metadata, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	for _, meta := range metadata {
+		name := normalizeTag(meta.Name)
+		if name == "" {
+			continue
+		}
+		tag, ok := index.tags[name]
+		if !ok {
+			tag = &TagSummary{Name: name}
+			index.tags[name] = tag
+		}
+		tag.Color = meta.Color
+	}
+
+	return index, nil
+}
+
+// normalizeTag lowercases a tag and collapses its whitespace
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// normalizeTags normalises a tag list, dropping empty tags and duplicates
+// while keeping the original order
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"regexp"
+	"time"
 
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
@@ -11,61 +13,369 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrInvalidTaskID     = errors.New("invalid task id")
+	ErrInvalidTaskStatus = errors.New("status must be 1-32 lowercase letters, digits or underscores, starting with a letter")
+	// ErrTaskTooDeep caps how far subtasks nest
+	ErrTaskTooDeep           = errors.New("subtasks cannot be nested deeper")
+	ErrTooManySubtasks       = errors.New("task has too many subtasks")
+	ErrSubtaskNotFound       = errors.New("subtask not found")
+	ErrInvalidSubtaskOrder   = errors.New("order must list every subtask exactly once")
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
+	ErrChecklistTextRequired = errors.New("checklist item text is required")
+	ErrChecklistTextTooLong  = errors.New("checklist item text is too long")
+	ErrChecklistFull         = errors.New("checklist has too many items")
+	ErrInvalidChecklistOrder = errors.New("order must list every checklist item exactly once")
+)
+
+// Statuses beyond todo, in_progress and done name custom board columns
+var taskStatusPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
 type TaskService struct {
-	repo *repository.TaskRepository
+	repo          *repository.TaskRepository
+	activity      *repository.TaskActivityRepository
+	boards        *repository.BoardRepository
+	locks         *repository.LockRepository
+	profiles      *repository.ProfileRepository
+	reminders     *ReminderService
+	notifications *NotificationService
+	time          *TimeService
+	stats         *StatsCache
 }
 
-func NewTaskService(repo *repository.TaskRepository) *TaskService {
-	return &TaskService{repo: repo}
+func NewTaskService(repo *repository.TaskRepository, activity *repository.TaskActivityRepository, boards *repository.BoardRepository, locks *repository.LockRepository, profiles *repository.ProfileRepository, reminders *ReminderService, notifications *NotificationService, time *TimeService, stats *StatsCache) *TaskService {
+	return &TaskService{repo: repo, activity: activity, boards: boards, locks: locks, profiles: profiles, reminders: reminders, notifications: notifications, time: time, stats: stats}
 }
 
-func (s *TaskService) CreateTask(ctx context.Context, userID, title, descriptionMD, status, priority string, tags []string) (*models.Task, error) {
+// CreateTask creates a task. A repeating task starts its series on the first
+// occurrence at or after its deadline, which becomes its deadline.
+func (s *TaskService) CreateTask(ctx context.Context, userID, title, descriptionMD, status, priority string, deadline time.Time, tags []string, autoComplete bool, repeat RecurrenceInput) (*models.Task, error) {
 	task := &models.Task{
-		UserID:   userID,
-		Title:    title,
-		Status:   status,
-		Priority: priority,
-		Tags:     tags,
+		UserID:       userID,
+		Title:        title,
+		Status:       status,
+		Priority:     priority,
+		Deadline:     deadline,
+		Tags:         tags,
+		AutoComplete: autoComplete,
 	}
 
 	if descriptionMD != "" {
 		task.DescriptionMD = &descriptionMD
 	}
 
-	if err := s.repo.Create(ctx, task); err != nil {
+	if err := s.create(ctx, task, repeat); err != nil {
 		return nil, err
 	}
 
 	return task, nil
 }
 
+func (s *TaskService) create(ctx context.Context, task *models.Task, repeat RecurrenceInput) error {
+	if !repeat.empty() {
+		if err := repeatTask(task, repeat, userLocation(s.profiles, task.UserID)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.Create(ctx, task); err != nil {
+		return err
+	}
+	s.stats.Invalidate(task.UserID)
+	return nil
+}
+
 func (s *TaskService) GetTask(ctx context.Context, taskID, userID string) (*models.Task, error) {
 	objID, err := primitive.ObjectIDFromHex(taskID)
 	if err != nil {
-		return nil, errors.New("invalid task id")
+		return nil, ErrInvalidTaskID
 	}
 
-	return s.repo.FindByID(ctx, objID, userID)
+	task, err := s.repo.FindByID(ctx, objID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withProgress(ctx, userID, []*models.Task{task}); err != nil {
+		return nil, err
+	}
+
+	return task, nil
 }
 
-func (s *TaskService) GetUserTasks(ctx context.Context, userID string) ([]models.Task, error) {
-	return s.repo.FindByUserID(ctx, userID)
+// GetUserTasks lists the user's top-level tasks, or all of them including
+// subtasks
+func (s *TaskService) GetUserTasks(ctx context.Context, userID string, includeSubtasks bool) ([]models.Task, error) {
+	tasks, err := s.repo.FindByUserID(ctx, userID, includeSubtasks)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withProgress(ctx, userID, taskPointers(tasks)); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
 }
 
-func (s *TaskService) UpdateTask(ctx context.Context, taskID, userID string, updates map[string]interface{}) error {
+// UpdateTask changes a task. Changing the deadline of a repeating task
+// reschedules only this occurrence; changing its rule or time zone starts a
+// new series from its deadline. Moving a repeating task to done creates the
+// task of the next occurrence. A status change is checked against the
+// workflow before anything is written, and the other changes are only kept
+// when the status change succeeds.
+func (s *TaskService) UpdateTask(ctx context.Context, taskID, userID string, updates map[string]interface{}, repeat RecurrenceInput) error {
 	objID, err := primitive.ObjectIDFromHex(taskID)
 	if err != nil {
-		return errors.New("invalid task id")
+		return ErrInvalidTaskID
 	}
 
-	return s.repo.Update(ctx, objID, userID, bson.M(updates))
+	set := bson.M(updates)
+	unset := bson.M{}
+
+	if minutes, ok := set["estimate_minutes"].(int); ok {
+		if err := validEstimate(minutes); err != nil {
+			return err
+		}
+		if minutes == 0 {
+			delete(set, "estimate_minutes")
+			unset["estimate_minutes"] = ""
+		}
+	}
+
+	status, changesStatus := set["status"].(string)
+	if changesStatus {
+		if !validTaskStatus(status) {
+			return ErrInvalidTaskStatus
+		}
+		// The status changes last, through the workflow
+		delete(set, "status")
+	}
+
+	if changesStatus || !repeat.empty() {
+		task, err := s.repo.FindByID(ctx, objID, userID)
+		if err != nil {
+			return err
+		}
+		if changesStatus {
+			if err := checkTransition(task.Status, status); err != nil {
+				return err
+			}
+		}
+
+		if !repeat.empty() {
+			if deadline, ok := set["deadline"].(time.Time); ok {
+				task.Deadline = deadline
+			}
+
+			if err := repeatTask(task, repeat, userLocation(s.profiles, userID)); err != nil {
+				return err
+			}
+			if task.Recurrence != nil {
+				set["recurrence"] = task.Recurrence
+				set["deadline"] = task.Deadline
+			} else {
+				unset["recurrence"] = ""
+			}
+		}
+	}
+
+	var after followUp
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		after = nil
+		if err := s.repo.Update(ctx, objID, userID, set, unset); err != nil {
+			return err
+		}
+		if !changesStatus {
+			return nil
+		}
+
+		// Read the task again so completing it sees the changes above
+		task, err := s.repo.FindByID(ctx, objID, userID)
+		if err != nil {
+			return err
+		}
+		var unsetPosition bson.M
+		if task.ParentID == nil && status != task.Status {
+			// The task goes to the top of its new board column
+			unsetPosition = bson.M{"position": ""}
+		}
+		after, err = s.transition(ctx, task, status, false, nil, unsetPosition)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.stats.Invalidate(userID)
+	if deadline, ok := set["deadline"].(time.Time); ok {
+		s.reminders.TaskMoved(ctx, &models.Task{ID: objID, UserID: userID, Deadline: deadline})
+	}
+	if after != nil {
+		if err := after(ctx); err != nil {
+			return err
+		}
+	}
+
+	if autoComplete, ok := set["auto_complete"].(bool); ok && autoComplete {
+		return s.rollUp(ctx, userID, &objID)
+	}
+	return nil
+}
+
+// SkipOccurrence moves a repeating task on to the next occurrence of its
+// series without completing it
+func (s *TaskService) SkipOccurrence(ctx context.Context, taskID, userID string) (*models.Task, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, ErrInvalidTaskID
+	}
+
+	task, err := s.repo.FindByID(ctx, objID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Recurrence == nil {
+		return nil, ErrNotRecurring
+	}
+
+	next, err := nextOccurrence(task.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	task.Recurrence.Occurrence = next
+	task.Deadline = next
+	set := bson.M{"recurrence": task.Recurrence, "deadline": next}
+	if err := s.repo.Update(ctx, objID, userID, set, nil); err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(userID)
+	s.reminders.TaskMoved(ctx, task)
+
+	return s.repo.FindByID(ctx, objID, userID)
+}
+
+// completed follows up on a task that has just moved to done: the tasks
+// waiting for it may be unblocked, and a parent that completes itself may be
+// done as well
+func (s *TaskService) completed(ctx context.Context, task *models.Task) error {
+	if err := s.prerequisiteChanged(ctx, task); err != nil {
+		return err
+	}
+
+	return s.rollUp(ctx, task.UserID, task.ParentID)
+}
+
+// nextTask builds the task of the next occurrence of a completed task, or
+// returns nil when the series has no further occurrences. A repeating
+// subtask repeats under the same parent, right after itself, with its
+// checklist unticked; its own subtasks are not copied.
+func (s *TaskService) nextTask(ctx context.Context, task *models.Task) (*models.Task, error) {
+	if task.Recurrence == nil {
+		return nil, nil
+	}
+
+	next, err := nextOccurrence(task.Recurrence)
+	if errors.Is(err, ErrRecurrenceEnded) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence := *task.Recurrence
+	recurrence.Occurrence = next
+
+	nextTask := &models.Task{
+		UserID:        task.UserID,
+		Title:         task.Title,
+		DescriptionMD: task.DescriptionMD,
+		Status:        "todo",
+		Priority:      task.Priority,
+		Deadline:      next,
+		Tags:          task.Tags,
+		Recurrence:    &recurrence,
+		ParentID:      task.ParentID,
+		Ancestors:     task.Ancestors,
+		Checklist:     freshChecklist(task.Checklist),
+		AutoComplete:  task.AutoComplete,
+	}
+	if task.ParentID != nil {
+		position, err := s.positionAfter(ctx, task)
+		if err != nil {
+			return nil, err
+		}
+		nextTask.Position = position
+	}
+	return nextTask, nil
 }
 
 func (s *TaskService) DeleteTask(ctx context.Context, taskID, userID string) error {
 	objID, err := primitive.ObjectIDFromHex(taskID)
 	if err != nil {
-		return errors.New("invalid task id")
+		return ErrInvalidTaskID
+	}
+
+	task, err := s.repo.FindByID(ctx, objID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Subtasks and the time tracked on them go with their task, in the same
+	// transaction so a failure cannot leave them behind without a parent
+	var descendants []primitive.ObjectID
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, objID, userID); err != nil {
+			return err
+		}
+		var err error
+		if descendants, err = s.repo.DeleteDescendants(ctx, objID, userID); err != nil {
+			return err
+		}
+		return s.time.TasksDeleted(ctx, userID, append(descendants, objID))
+	})
+	if err != nil {
+		return err
+	}
+	s.stats.Invalidate(userID)
+	s.reminders.TargetDeleted(ctx, userID, models.ReminderTargetTask, objID)
+	for _, id := range descendants {
+		s.reminders.TargetDeleted(ctx, userID, models.ReminderTargetTask, id)
+	}
+	deleted := append(descendants, objID)
+	s.activity.DeleteByTasks(ctx, userID, deleted)
+	if err := s.dropDependencies(ctx, userID, deleted); err != nil {
+		return err
+	}
+
+	// Removing the last open subtask may leave its parent complete
+	return s.rollUp(ctx, userID, task.ParentID)
+}
+
+func validTaskStatus(status string) bool {
+	return taskStatusPattern.MatchString(status)
+}
+
+// repeatTask applies a recurrence change to a task. A new series starts on
+// the first occurrence at or after the deadline, which moves there; an empty
+// rule stops the repetition.
+func repeatTask(task *models.Task, in RecurrenceInput, profileLoc *time.Location) error {
+	rule, loc, err := recurrenceFrom(in, task.Recurrence, profileLoc)
+	if err != nil {
+		return err
+	}
+	if rule == "" {
+		task.Recurrence = nil
+		return nil
+	}
+	if task.Deadline.IsZero() {
+		return ErrRecurrenceNeedsDate
+	}
+
+	recurrence, err := newRecurrence(rule, loc, task.Deadline)
+	if err != nil {
+		return err
 	}
+	task.Recurrence = recurrence
+	task.Deadline = recurrence.Occurrence
 
-	return s.repo.Delete(ctx, objID, userID)
+	return nil
 }
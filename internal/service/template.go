@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrTemplateNotFound    = errors.New("template not found")
+	ErrInvalidTemplateName = errors.New("template name is required")
+	ErrBuiltInTemplate     = errors.New("built-in templates cannot be changed")
+)
+
+// templateVariablePattern matches {{name}}, allowing spaces inside the braces
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_.]+)\s*\}\}`)
+
+// Template is a user template or one of the built-in templates
+type Template struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Title       string         `json:"title"`
+	Tags        []string       `json:"tags"`
+	Blocks      []models.Block `json:"blocks"`
+	BuiltIn     bool           `json:"built_in"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+}
+
+// TemplateInput describes a new template. When NoteID is set the blocks are
+// copied from that note, and its title and tags are used unless given.
+type TemplateInput struct {
+	Name        string
+	Description string
+	Title       string
+	Tags        []string
+	Blocks      []models.Block
+	NoteID      string
+}
+
+// TemplateUpdate holds the fields of a template to change; nil fields are
+// left as they are
+type TemplateUpdate struct {
+	Name        *string
+	Description *string
+	Title       *string
+	Tags        []string
+	Blocks      []models.Block
+}
+
+type TemplateService struct {
+	repo        *repository.NoteTemplateRepository
+	noteRepo    *repository.NoteRepository
+	userRepo    *repository.UserRepository
+	profileRepo *repository.ProfileRepository
+}
+
+func NewTemplateService(repo *repository.NoteTemplateRepository, noteRepo *repository.NoteRepository, userRepo *repository.UserRepository, profileRepo *repository.ProfileRepository) *TemplateService {
+	return &TemplateService{
+		repo:        repo,
+		noteRepo:    noteRepo,
+		userRepo:    userRepo,
+		profileRepo: profileRepo,
+	}
+}
+
+// ListTemplates returns the built-in templates followed by the user's own
+func (s *TemplateService) ListTemplates(ctx context.Context, userID string) ([]Template, error) {
+	stored, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]Template, 0, len(builtInTemplates)+len(stored))
+	templates = append(templates, builtInTemplates...)
+	for i := range stored {
+		templates = append(templates, *templateView(&stored[i]))
+	}
+
+	return templates, nil
+}
+
+func (s *TemplateService) GetTemplate(ctx context.Context, templateID, userID string) (*Template, error) {
+	if strings.HasPrefix(templateID, builtInTemplatePrefix) {
+		for i := range builtInTemplates {
+			if builtInTemplates[i].ID == templateID {
+				template := builtInTemplates[i]
+				return &template, nil
+			}
+		}
+		return nil, ErrTemplateNotFound
+	}
+
+	template, err := s.find(ctx, templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return templateView(template), nil
+}
+
+// CreateTemplate saves a new template, either from the given blocks or from
+// the block structure of an existing note
+func (s *TemplateService) CreateTemplate(ctx context.Context, userID string, input TemplateInput) (*Template, error) {
+	template := &models.NoteTemplate{
+		UserID:      userID,
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Title:       input.Title,
+		Tags:        normalizeTags(input.Tags),
+		Blocks:      templateBlocks(input.Blocks),
+	}
+
+	if input.NoteID != "" {
+		objID, err := primitive.ObjectIDFromHex(input.NoteID)
+		if err != nil {
+			return nil, ErrInvalidNoteID
+		}
+		note, err := s.noteRepo.FindByID(ctx, objID, authz.Owner(userID))
+		if err != nil {
+			return nil, err
+		}
+
+		template.Blocks = templateBlocks(cloneBlocks(note.Blocks))
+		if template.Title == "" {
+			template.Title = note.Title
+		}
+		if input.Tags == nil {
+			template.Tags = normalizeTags(note.Tags)
+		}
+		if template.Name == "" {
+			template.Name = strings.TrimSpace(note.Title)
+		}
+	}
+
+	if template.Name == "" {
+		return nil, ErrInvalidTemplateName
+	}
+
+	if err := s.repo.Create(ctx, template); err != nil {
+		return nil, err
+	}
+
+	return templateView(template), nil
+}
+
+func (s *TemplateService) UpdateTemplate(ctx context.Context, templateID, userID string, update TemplateUpdate) (*Template, error) {
+	if strings.HasPrefix(templateID, builtInTemplatePrefix) {
+		return nil, ErrBuiltInTemplate
+	}
+
+	template, err := s.find(ctx, templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bson.M{}
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, ErrInvalidTemplateName
+		}
+		fields["name"] = name
+	}
+	if update.Description != nil {
+		fields["description"] = strings.TrimSpace(*update.Description)
+	}
+	if update.Title != nil {
+		fields["title"] = *update.Title
+	}
+	if update.Tags != nil {
+		fields["tags"] = normalizeTags(update.Tags)
+	}
+	if update.Blocks != nil {
+		fields["blocks"] = templateBlocks(update.Blocks)
+	}
+	if len(fields) == 0 {
+		return templateView(template), nil
+	}
+
+	if err := s.repo.Update(ctx, template.ID, userID, fields); err != nil {
+		return nil, err
+	}
+
+	return s.GetTemplate(ctx, templateID, userID)
+}
+
+func (s *TemplateService) DeleteTemplate(ctx context.Context, templateID, userID string) error {
+	if strings.HasPrefix(templateID, builtInTemplatePrefix) {
+		return ErrBuiltInTemplate
+	}
+
+	template, err := s.find(ctx, templateID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, template.ID, userID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrTemplateNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Instantiate renders a template for a new note: variables in the title,
+// block content and todo items are filled in and the blocks get fresh IDs.
+// at is the moment date variables refer to; the zero time means now in the
+// user's time zone.
+func (s *TemplateService) Instantiate(ctx context.Context, templateID, userID string, at time.Time) (*Template, error) {
+	template, err := s.GetTemplate(ctx, templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := s.variables(userID, at)
+	render := func(text string) string {
+		return templateVariablePattern.ReplaceAllStringFunc(text, func(m string) string {
+			name := templateVariablePattern.FindStringSubmatch(m)[1]
+			if value, ok := variables[strings.ToLower(name)]; ok {
+				return value
+			}
+			// Unknown variables are left for the user to fill in
+			return m
+		})
+	}
+
+	template.Title = strings.TrimSpace(render(template.Title))
+	template.Tags = append([]string(nil), template.Tags...)
+	template.Blocks = cloneBlocks(template.Blocks)
+	for i := range template.Blocks {
+		block := &template.Blocks[i]
+		if block.ContentMD != nil {
+			content := render(*block.ContentMD)
+			block.ContentMD = &content
+		}
+		for j := range block.Items {
+			block.Items[j].ID = uuid.New().String()
+			block.Items[j].Text = render(block.Items[j].Text)
+		}
+	}
+
+	return template, nil
+}
+
+// variables are the values template placeholders are replaced with
+func (s *TemplateService) variables(userID string, at time.Time) map[string]string {
+	if at.IsZero() {
+		at = time.Now().In(userLocation(s.profileRepo, userID))
+	}
+
+	variables := map[string]string{
+		"date":    at.Format(journalDateLayout),
+		"time":    at.Format("15:04"),
+		"weekday": at.Weekday().String(),
+		"month":   at.Month().String(),
+		"year":    at.Format("2006"),
+	}
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return variables
+	}
+
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return variables
+	}
+	variables["user.email"] = user.Email
+
+	// The display name falls back from the profile's full name to the
+	// username and finally the local part of the email address
+	name := strings.Split(user.Email, "@")[0]
+	if user.Username != nil && *user.Username != "" {
+		name = *user.Username
+	}
+	if profile, err := s.profileRepo.FindByUserID(id); err == nil && profile.FullName != nil && *profile.FullName != "" {
+		name = *profile.FullName
+	}
+	variables["user.name"] = name
+
+	return variables
+}
+
+func (s *TemplateService) find(ctx context.Context, templateID, userID string) (*models.NoteTemplate, error) {
+	objID, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return nil, ErrTemplateNotFound
+	}
+
+	template, err := s.repo.FindByID(ctx, objID, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTemplateNotFound
+	}
+	return template, err
+}
+
+func templateView(template *models.NoteTemplate) *Template {
+	return &Template{
+		ID:          template.ID.Hex(),
+		Name:        template.Name,
+		Description: template.Description,
+		Title:       template.Title,
+		Tags:        template.Tags,
+		Blocks:      template.Blocks,
+		CreatedAt:   &template.CreatedAt,
+		UpdatedAt:   &template.UpdatedAt,
+	}
+}
+
+// templateBlocks tidies blocks sent for a template: missing IDs are filled in
+// and the structure is normalised the same way note blocks are
+func templateBlocks(blocks []models.Block) []models.Block {
+	if len(blocks) == 0 {
+		return []models.Block{}
+	}
+
+	blocks = append([]models.Block(nil), blocks...)
+	for i := range blocks {
+		if blocks[i].ID == "" {
+			blocks[i].ID = uuid.New().String()
+		}
+	}
+
+	return newBlockTree(blocks).flatten()
+}
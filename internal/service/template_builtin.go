@@ -0,0 +1,109 @@
+package service
+
+import (
+	"strconv"
+
+	"backend-journaling/internal/models"
+)
+
+// builtInTemplatePrefix marks the IDs of the templates that ship with the
+// server, so they can never collide with the ObjectIDs of user templates
+const builtInTemplatePrefix = "builtin:"
+
+// builtInTemplates are available to every user. Block IDs only need to be
+// unique within a template since instantiating a template assigns new ones.
+var builtInTemplates = []Template{
+	{
+		ID:          builtInTemplatePrefix + "daily-review",
+		Name:        "Daily review",
+		Description: "Look back on the day: highlights, what could have gone better and the plan for tomorrow.",
+		Title:       "Daily review – {{weekday}}, {{date}}",
+		Tags:        []string{"daily review"},
+		Blocks: []models.Block{
+			templateBlock("heading", "Highlights", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "What could have gone better", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Tomorrow", nil),
+			templateBlock("todo", "", []string{"", "", ""}),
+		},
+	},
+	{
+		ID:          builtInTemplatePrefix + "meeting-notes",
+		Name:        "Meeting notes",
+		Description: "Attendees, agenda, notes and action items of a meeting.",
+		Title:       "Meeting – {{date}}",
+		Tags:        []string{"meeting"},
+		Blocks: []models.Block{
+			templateBlock("paragraph", "**Date:** {{weekday}}, {{date}} {{time}}\n**Notes by:** {{user.name}}", nil),
+			templateBlock("heading", "Attendees", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Agenda", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Notes", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Action items", nil),
+			templateBlock("todo", "", []string{""}),
+		},
+	},
+	{
+		ID:          builtInTemplatePrefix + "gratitude-list",
+		Name:        "Gratitude list",
+		Description: "Three things you are grateful for today.",
+		Title:       "Grateful – {{date}}",
+		Tags:        []string{"gratitude"},
+		Blocks: []models.Block{
+			templateBlock("heading", "Today I am grateful for", nil),
+			templateBlock("paragraph", "1. \n2. \n3. ", nil),
+			templateBlock("heading", "Why", nil),
+			templateBlock("paragraph", "", nil),
+		},
+	},
+	{
+		ID:          builtInTemplatePrefix + "weekly-review",
+		Name:        "Weekly review",
+		Description: "Wins, lessons and priorities for the coming week.",
+		Title:       "Weekly review – {{date}}",
+		Tags:        []string{"weekly review"},
+		Blocks: []models.Block{
+			templateBlock("heading", "Wins", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Lessons", nil),
+			templateBlock("paragraph", "", nil),
+			templateBlock("heading", "Priorities for next week", nil),
+			templateBlock("todo", "", []string{"", "", ""}),
+		},
+	},
+}
+
+func init() {
+	for i := range builtInTemplates {
+		builtInTemplates[i].BuiltIn = true
+		builtInTemplates[i].Blocks = numberTemplateBlocks(builtInTemplates[i].Blocks)
+	}
+}
+
+func templateBlock(blockType, content string, items []string) models.Block {
+	block := models.Block{Type: blockType}
+	if blockType == "todo" {
+		for _, text := range items {
+			block.Items = append(block.Items, models.TodoItem{Text: text})
+		}
+	} else {
+		block.ContentMD = &content
+	}
+	return block
+}
+
+// numberTemplateBlocks gives the blocks of a built-in template their IDs and
+// order; built-in templates are flat lists of top-level blocks
+func numberTemplateBlocks(blocks []models.Block) []models.Block {
+	for i := range blocks {
+		blocks[i].ID = "b" + strconv.Itoa(i+1)
+		blocks[i].Order = i
+		for j := range blocks[i].Items {
+			blocks[i].Items[j].ID = blocks[i].ID + "-" + strconv.Itoa(j+1)
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,595 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTimeEntryNoteLength = 500
+	// maxTimeEntryDuration caps an entry made or edited by hand
+	maxTimeEntryDuration = 24 * time.Hour
+	// maxEstimateMinutes caps a task estimate at 1000 hours
+	maxEstimateMinutes = 60000
+	// timeEntrySkew lets a manual entry end slightly after the server's
+	// clock, for clients whose clocks run ahead
+	timeEntrySkew = time.Minute
+)
+
+var (
+	ErrInvalidTimeEntryID     = errors.New("invalid time entry id")
+	ErrTimeEntryNotFound      = errors.New("time entry not found")
+	ErrTimerRunning           = errors.New("another timer was started at the same time")
+	ErrNoRunningTimer         = errors.New("no timer is running on this task")
+	ErrTimerNotStopped        = errors.New("stop the timer before setting its end")
+	ErrTimeEntryStartRequired = errors.New("started_at is required")
+	ErrTimeEntryEndRequired   = errors.New("give either ended_at or duration_minutes")
+	ErrInvalidTimeEntrySpan   = errors.New("a time entry must end after it starts")
+	ErrTimeEntryTooLong       = errors.New("a time entry can be at most 24 hours")
+	ErrTimeEntryInFuture      = errors.New("a time entry cannot be in the future")
+	ErrTimeEntryNoteTooLong   = errors.New("note is too long")
+	ErrInvalidEstimate        = errors.New("estimate_minutes must be between 0 and 60000")
+)
+
+// TimeEntryInput sets the span and note of a time entry. A span is given as
+// started_at with either ended_at or a duration.
+type TimeEntryInput struct {
+	StartedAt       *time.Time
+	EndedAt         *time.Time
+	DurationMinutes *int
+	Note            *string
+}
+
+// TaskTime compares the time tracked on a task with its estimate
+type TaskTime struct {
+	TaskID          primitive.ObjectID `json:"task_id"`
+	EstimateMinutes *int               `json:"estimate_minutes,omitempty"`
+	TrackedSeconds  int64              `json:"tracked_seconds"`
+	// RemainingSeconds is negative once the task runs over its estimate
+	RemainingSeconds *int64             `json:"remaining_seconds,omitempty"`
+	OverEstimate     bool               `json:"over_estimate"`
+	Running          *models.TimeEntry  `json:"running,omitempty"`
+	Entries          []models.TimeEntry `json:"entries"`
+}
+
+// Timesheet sums up a week of tracked time per day, Monday first, by task
+// and by tag
+type Timesheet struct {
+	WeekStart    string          `json:"week_start"`
+	WeekEnd      string          `json:"week_end"`
+	Timezone     string          `json:"timezone"`
+	Days         []string        `json:"days"`
+	DaySeconds   []int64         `json:"day_seconds"`
+	TotalSeconds int64           `json:"total_seconds"`
+	Tasks        []TimesheetTask `json:"tasks"`
+	Tags         []TimesheetTag  `json:"tags"`
+}
+
+type TimesheetTask struct {
+	TaskID       primitive.ObjectID `json:"task_id"`
+	Title        string             `json:"title"`
+	Tags         []string           `json:"tags"`
+	DaySeconds   []int64            `json:"day_seconds"`
+	TotalSeconds int64              `json:"total_seconds"`
+}
+
+// TimesheetTag sums up the time of the tasks with a tag; the time of
+// untagged tasks goes under the empty tag
+type TimesheetTag struct {
+	Tag          string  `json:"tag"`
+	DaySeconds   []int64 `json:"day_seconds"`
+	TotalSeconds int64   `json:"total_seconds"`
+}
+
+type TimeService struct {
+	repo     *repository.TimeEntryRepository
+	tasks    *repository.TaskRepository
+	profiles *repository.ProfileRepository
+}
+
+func NewTimeService(repo *repository.TimeEntryRepository, tasks *repository.TaskRepository, profiles *repository.ProfileRepository) *TimeService {
+	return &TimeService{repo: repo, tasks: tasks, profiles: profiles}
+}
+
+// GetTaskTime returns the entries of a task, latest first, with the time
+// tracked on it against its estimate
+func (s *TimeService) GetTaskTime(ctx context.Context, userID, taskID string) (*TaskTime, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.repo.FindByTask(ctx, userID, task.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TaskTime{TaskID: task.ID, EstimateMinutes: task.EstimateMinutes, Entries: []models.TimeEntry{}}
+	now := time.Now()
+	for i := range entries {
+		elapsed(&entries[i], now)
+		result.TrackedSeconds += entries[i].DurationSeconds
+		if entries[i].Running {
+			running := entries[i]
+			result.Running = &running
+		}
+	}
+	result.Entries = append(result.Entries, entries...)
+
+	if task.EstimateMinutes != nil {
+		remaining := int64(*task.EstimateMinutes)*60 - result.TrackedSeconds
+		result.RemainingSeconds = &remaining
+		result.OverEstimate = remaining < 0
+	}
+
+	return result, nil
+}
+
+// StartTimer starts a timer on a task. A timer running on another task is
+// stopped first; one already running on this task is returned as it is.
+func (s *TimeService) StartTimer(ctx context.Context, userID, taskID string, note *string) (*models.TimeEntry, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if note, err = timeEntryNote(note); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	running, err := s.repo.FindRunning(ctx, userID)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	if running != nil {
+		if running.TaskID == task.ID {
+			elapsed(running, now)
+			return running, nil
+		}
+		if err := s.stop(ctx, running, now); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &models.TimeEntry{
+		UserID:    userID,
+		TaskID:    task.ID,
+		StartedAt: now,
+		Running:   true,
+		Note:      note,
+	}
+	if err := s.repo.Create(ctx, entry); err != nil {
+		if errors.Is(err, repository.ErrTimerRunning) {
+			return nil, ErrTimerRunning
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// StopTimer stops the timer running on a task
+func (s *TimeService) StopTimer(ctx context.Context, userID, taskID string) (*models.TimeEntry, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := s.repo.FindRunning(ctx, userID)
+	if IsNotFound(err) || (err == nil && running.TaskID != task.ID) {
+		return nil, ErrNoRunningTimer
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.stop(ctx, running, time.Now()); err != nil {
+		return nil, err
+	}
+	return running, nil
+}
+
+// GetTimer returns the user's running timer, or nil when none runs
+func (s *TimeService) GetTimer(ctx context.Context, userID string) (*models.TimeEntry, error) {
+	running, err := s.repo.FindRunning(ctx, userID)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed(running, time.Now())
+	return running, nil
+}
+
+// AddEntry records time spent on a task by hand
+func (s *TimeService) AddEntry(ctx context.Context, userID, taskID string, in TimeEntryInput) (*models.TimeEntry, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if in.StartedAt == nil {
+		return nil, ErrTimeEntryStartRequired
+	}
+	if (in.EndedAt == nil) == (in.DurationMinutes == nil) {
+		return nil, ErrTimeEntryEndRequired
+	}
+	note, err := timeEntryNote(in.Note)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := timeEntrySpan(*in.StartedAt, in)
+	if err := checkTimeEntrySpan(start, end, time.Now()); err != nil {
+		return nil, err
+	}
+
+	entry := &models.TimeEntry{
+		UserID:          userID,
+		TaskID:          task.ID,
+		StartedAt:       start,
+		EndedAt:         &end,
+		DurationSeconds: durationSeconds(start, end),
+		Manual:          true,
+		Note:            note,
+	}
+	if err := s.repo.Create(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// UpdateEntry changes the span or note of an entry. A running timer can
+// only have its start and note changed.
+func (s *TimeService) UpdateEntry(ctx context.Context, userID, taskID, entryID string, in TimeEntryInput) (*models.TimeEntry, error) {
+	entry, err := s.findEntry(ctx, userID, taskID, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if in.EndedAt != nil && in.DurationMinutes != nil {
+		return nil, ErrTimeEntryEndRequired
+	}
+	note, err := timeEntryNote(in.Note)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	start := entry.StartedAt
+	if in.StartedAt != nil {
+		start = *in.StartedAt
+	}
+	set := bson.M{"started_at": start}
+	unset := bson.M{}
+
+	if entry.Running {
+		if in.EndedAt != nil || in.DurationMinutes != nil {
+			return nil, ErrTimerNotStopped
+		}
+		if start.After(now) {
+			return nil, ErrTimeEntryInFuture
+		}
+	} else {
+		end := *entry.EndedAt
+		if in.EndedAt != nil || in.DurationMinutes != nil {
+			start, end = timeEntrySpan(start, in)
+		}
+		if err := checkTimeEntrySpan(start, end, now); err != nil {
+			return nil, err
+		}
+		set["ended_at"] = end
+		set["duration_seconds"] = durationSeconds(start, end)
+	}
+
+	if in.Note != nil {
+		if note == nil {
+			unset["note"] = ""
+		} else {
+			set["note"] = *note
+		}
+	}
+
+	if err := s.repo.Update(ctx, entry.ID, userID, set, unset); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.FindByID(ctx, entry.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	elapsed(updated, now)
+	return updated, nil
+}
+
+// DeleteEntry deletes an entry, a running timer included
+func (s *TimeService) DeleteEntry(ctx context.Context, userID, taskID, entryID string) error {
+	entry, err := s.findEntry(ctx, userID, taskID, entryID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, entry.ID, userID)
+}
+
+// TasksDeleted removes the time tracked on deleted tasks
+func (s *TimeService) TasksDeleted(ctx context.Context, userID string, taskIDs []primitive.ObjectID) error {
+	return s.repo.DeleteByTasks(ctx, userID, taskIDs)
+}
+
+// Timesheet sums up the week around a yyyy-mm-dd day in the user's time
+// zone, by default this week. Time is counted on the day it was spent, so
+// an entry past midnight is split across two days, and a running timer
+// counts up to now.
+func (s *TimeService) Timesheet(ctx context.Context, userID, week string) (*Timesheet, error) {
+	loc := userLocation(s.profiles, userID)
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if week != "" {
+		var err error
+		if day, err = time.ParseInLocation(journalDateLayout, week, loc); err != nil {
+			return nil, ErrInvalidJournalDate
+		}
+	}
+	start := weekStart(day)
+	end := start.AddDate(0, 0, 7)
+
+	entries, err := s.repo.FindBetween(ctx, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var taskIDs []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	for _, entry := range entries {
+		if !seen[entry.TaskID] {
+			seen[entry.TaskID] = true
+			taskIDs = append(taskIDs, entry.TaskID)
+		}
+	}
+	found, err := s.tasks.FindByIDs(ctx, userID, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make(map[primitive.ObjectID]models.Task, len(found))
+	for _, task := range found {
+		tasks[task.ID] = task
+	}
+
+	sheet := &Timesheet{
+		WeekStart:  start.Format(journalDateLayout),
+		WeekEnd:    end.AddDate(0, 0, -1).Format(journalDateLayout),
+		Timezone:   loc.String(),
+		Days:       make([]string, 7),
+		DaySeconds: make([]int64, 7),
+		Tasks:      []TimesheetTask{},
+		Tags:       []TimesheetTag{},
+	}
+	for i := range sheet.Days {
+		sheet.Days[i] = start.AddDate(0, 0, i).Format(journalDateLayout)
+	}
+
+	taskRows := make(map[primitive.ObjectID]int)
+	tagRows := make(map[string]int)
+	for _, entry := range entries {
+		until := now
+		if entry.EndedAt != nil {
+			until = *entry.EndedAt
+		}
+
+		for i := range sheet.Days {
+			seconds := overlapSeconds(entry.StartedAt, until, start.AddDate(0, 0, i), start.AddDate(0, 0, i+1))
+			if seconds == 0 {
+				continue
+			}
+			sheet.DaySeconds[i] += seconds
+			sheet.TotalSeconds += seconds
+
+			task := tasks[entry.TaskID]
+			row, ok := taskRows[entry.TaskID]
+			if !ok {
+				row = len(sheet.Tasks)
+				taskRows[entry.TaskID] = row
+				sheet.Tasks = append(sheet.Tasks, TimesheetTask{
+					TaskID:     entry.TaskID,
+					Title:      task.Title,
+					Tags:       task.Tags,
+					DaySeconds: make([]int64, 7),
+				})
+			}
+			sheet.Tasks[row].DaySeconds[i] += seconds
+			sheet.Tasks[row].TotalSeconds += seconds
+
+			tags := normalizeTags(task.Tags)
+			if len(tags) == 0 {
+				tags = []string{""}
+			}
+			for _, tag := range tags {
+				row, ok := tagRows[tag]
+				if !ok {
+					row = len(sheet.Tags)
+					tagRows[tag] = row
+					sheet.Tags = append(sheet.Tags, TimesheetTag{Tag: tag, DaySeconds: make([]int64, 7)})
+				}
+				sheet.Tags[row].DaySeconds[i] += seconds
+				sheet.Tags[row].TotalSeconds += seconds
+			}
+		}
+	}
+
+	sort.SliceStable(sheet.Tasks, func(i, j int) bool {
+		return sheet.Tasks[i].TotalSeconds > sheet.Tasks[j].TotalSeconds
+	})
+	sort.SliceStable(sheet.Tags, func(i, j int) bool {
+		if sheet.Tags[i].TotalSeconds != sheet.Tags[j].TotalSeconds {
+			return sheet.Tags[i].TotalSeconds > sheet.Tags[j].TotalSeconds
+		}
+		return sheet.Tags[i].Tag < sheet.Tags[j].Tag
+	})
+
+	return sheet, nil
+}
+
+// TimesheetCSV writes a timesheet as CSV, one row per task and day with
+// tracked time
+func TimesheetCSV(sheet *Timesheet) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"date", "task_id", "task", "tags", "hours"})
+	for i, day := range sheet.Days {
+		for _, task := range sheet.Tasks {
+			if task.DaySeconds[i] == 0 {
+				continue
+			}
+			writer.Write([]string{
+				day,
+				task.TaskID.Hex(),
+				csvCell(task.Title),
+				csvCell(strings.Join(task.Tags, ";")),
+				strconv.FormatFloat(float64(task.DaySeconds[i])/3600, 'f', 2, 64),
+			})
+		}
+	}
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+func (s *TimeService) findTask(ctx context.Context, userID, taskID string) (*models.Task, error) {
+	id, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, ErrInvalidTaskID
+	}
+
+	return s.tasks.FindByID(ctx, id, userID)
+}
+
+// findEntry loads an entry of a task
+func (s *TimeService) findEntry(ctx context.Context, userID, taskID, entryID string) (*models.TimeEntry, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(entryID)
+	if err != nil {
+		return nil, ErrInvalidTimeEntryID
+	}
+
+	entry, err := s.repo.FindByID(ctx, id, userID)
+	if IsNotFound(err) || (err == nil && entry.TaskID != task.ID) {
+		return nil, ErrTimeEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// stop ends a running timer at a moment; a timer stopped concurrently is
+// left as the other request stopped it
+func (s *TimeService) stop(ctx context.Context, entry *models.TimeEntry, at time.Time) error {
+	if at.Before(entry.StartedAt) {
+		at = entry.StartedAt
+	}
+	duration := durationSeconds(entry.StartedAt, at)
+	if _, err := s.repo.Stop(ctx, entry.ID, entry.UserID, at, duration); err != nil {
+		return err
+	}
+
+	entry.Running = false
+	entry.EndedAt = &at
+	entry.DurationSeconds = duration
+	return nil
+}
+
+// validEstimate checks a task estimate; 0 clears it
+func validEstimate(minutes int) error {
+	if minutes < 0 || minutes > maxEstimateMinutes {
+		return ErrInvalidEstimate
+	}
+	return nil
+}
+
+// elapsed fills in the duration of a running timer so far
+func elapsed(entry *models.TimeEntry, now time.Time) {
+	if entry.Running && now.After(entry.StartedAt) {
+		entry.DurationSeconds = durationSeconds(entry.StartedAt, now)
+	}
+}
+
+// timeEntrySpan works out the span of an entry from its start and either
+// an end or a duration
+func timeEntrySpan(start time.Time, in TimeEntryInput) (time.Time, time.Time) {
+	if in.DurationMinutes != nil {
+		return start, start.Add(time.Duration(*in.DurationMinutes) * time.Minute)
+	}
+	return start, *in.EndedAt
+}
+
+func checkTimeEntrySpan(start, end, now time.Time) error {
+	if !end.After(start) {
+		return ErrInvalidTimeEntrySpan
+	}
+	if end.Sub(start) > maxTimeEntryDuration {
+		return ErrTimeEntryTooLong
+	}
+	if end.After(now.Add(timeEntrySkew)) {
+		return ErrTimeEntryInFuture
+	}
+	return nil
+}
+
+// timeEntryNote trims a note; an empty note is no note
+func timeEntryNote(note *string) (*string, error) {
+	if note == nil {
+		return nil, nil
+	}
+	trimmed := strings.TrimSpace(*note)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(trimmed) > maxTimeEntryNoteLength {
+		return nil, ErrTimeEntryNoteTooLong
+	}
+	return &trimmed, nil
+}
+
+func durationSeconds(start, end time.Time) int64 {
+	return int64(end.Sub(start) / time.Second)
+}
+
+// overlapSeconds is how much of [start, end) falls in [from, to)
+func overlapSeconds(start, end, from, to time.Time) int64 {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return durationSeconds(start, end)
+}
+
+// csvCell keeps spreadsheet apps from reading user text as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
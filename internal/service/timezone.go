@@ -0,0 +1,29 @@
+package service
+
+import (
+	"time"
+
+	"backend-journaling/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// userLocation returns the time zone set in the user's profile, falling back
+// to UTC when the profile has none or it is not a valid IANA zone name
+func userLocation(profiles *repository.ProfileRepository, userID string) *time.Location {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return time.UTC
+	}
+
+	profile, err := profiles.FindByUserID(id)
+	if err != nil || profile.Timezone == nil || *profile.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(*profile.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
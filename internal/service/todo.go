@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
@@ -11,25 +14,113 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Smart views over the open todos of a user, computed in their time zone
+const (
+	TodoViewToday    = "today"
+	TodoViewOverdue  = "overdue"
+	TodoViewUpcoming = "upcoming"
+	TodoViewNoDate   = "no_date"
+)
+
+var (
+	ErrInvalidDueDate  = errors.New("due_date must be a date (yyyy-mm-dd) or an ISO 8601 datetime")
+	ErrInvalidDueTime  = errors.New("due_time must be HH:MM")
+	ErrDueTimeAllDay   = errors.New("an all-day todo cannot have a due time")
+	ErrDueDateRequired = errors.New("due_date is required to set due_time or all_day")
+	ErrInvalidTodoView = errors.New("view must be today, overdue, upcoming or no_date")
+	ErrTodoNotFound    = errors.New("todo not found")
+	ErrInvalidTodoID   = errors.New("invalid todo id")
+	ErrTodoIDsRequired = errors.New("todo_ids is required")
+	ErrTooManyTodos    = errors.New("at most 100 todos can be moved at once")
+	ErrTodoListNeeded  = errors.New("list_id is required to move todos from different lists")
+)
+
+// TodoDue is a due date change as sent by the client. Date is a day or a
+// datetime; an empty Date clears the due date. A day without a Time is an
+// all-day todo unless AllDay says otherwise. Time and AllDay alone adjust the
+// current due date.
+type TodoDue struct {
+	Date   *string
+	Time   *string
+	AllDay *bool
+}
+
+func (d TodoDue) empty() bool {
+	return d.Date == nil && d.Time == nil && d.AllDay == nil
+}
+
+// TodoPlacement is where todos are moved: into the list ListID, right after
+// the todo AfterID or right before the todo BeforeID. Without an anchor they
+// go to the end of the list; without a list, to the list of the anchor.
+type TodoPlacement struct {
+	ListID   *string
+	AfterID  *string
+	BeforeID *string
+}
+
+// TodoView is one of the smart views of a user's todos
+type TodoView struct {
+	View     string        `json:"view"`
+	Date     string        `json:"date"`
+	Timezone string        `json:"timezone"`
+	Todos    []models.Todo `json:"todos"`
+}
+
 type TodoService struct {
-	repo *repository.TodoRepository
+	repo      *repository.TodoRepository
+	lists     *TodoListService
+	profiles  *repository.ProfileRepository
+	reminders *ReminderService
+	stats     *StatsCache
 }
 
-func NewTodoService(repo *repository.TodoRepository) *TodoService {
-	return &TodoService{repo: repo}
+func NewTodoService(repo *repository.TodoRepository, lists *TodoListService, profiles *repository.ProfileRepository, reminders *ReminderService, stats *StatsCache) *TodoService {
+	return &TodoService{repo: repo, lists: lists, profiles: profiles, reminders: reminders, stats: stats}
 }
 
-func (s *TodoService) CreateTodo(ctx context.Context, userID, title, priority string, dueDate interface{}) (*models.Todo, error) {
+// CreateTodo creates a todo at the end of a list, the default list when
+// listID is not set. A repeating todo starts its series on the first
+// occurrence at or after its due date, which becomes its due date.
+func (s *TodoService) CreateTodo(ctx context.Context, userID, title, priority string, listID *string, due TodoDue, repeat RecurrenceInput) (*models.Todo, error) {
+	list, err := s.lists.resolve(ctx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+
 	todo := &models.Todo{
 		UserID:   userID,
+		ListID:   &list.ID,
 		Title:    title,
 		Done:     false,
 		Priority: priority,
 	}
 
+	loc := userLocation(s.profiles, userID)
+	if !due.empty() {
+		dueDate, allDay, err := resolveDue(nil, false, due, loc)
+		if err != nil {
+			return nil, err
+		}
+		todo.DueDate = dueDate
+		todo.AllDay = allDay
+	}
+
+	if !repeat.empty() {
+		if err := repeatTodo(todo, repeat, loc); err != nil {
+			return nil, err
+		}
+	}
+
+	positions, err := s.lists.slots(ctx, userID, list.ID, nil, false, 1, nil)
+	if err != nil {
+		return nil, err
+	}
+	todo.Position = positions[0]
+
 	if err := s.repo.Create(ctx, todo); err != nil {
 		return nil, err
 	}
+	s.stats.Invalidate(userID)
 
 	return todo, nil
 }
@@ -47,13 +138,175 @@ func (s *TodoService) GetUserTodos(ctx context.Context, userID string) ([]models
 	return s.repo.FindByUserID(ctx, userID)
 }
 
-func (s *TodoService) UpdateTodo(ctx context.Context, todoID, userID string, updates map[string]interface{}) error {
+// UpdateTodo changes a todo. Changing the due date of a repeating todo
+// reschedules only this occurrence; changing its rule or time zone starts a
+// new series from its due date. Completing a repeating todo creates the todo
+// of the next occurrence.
+func (s *TodoService) UpdateTodo(ctx context.Context, todoID, userID string, updates map[string]interface{}, due TodoDue, repeat RecurrenceInput) error {
 	objID, err := primitive.ObjectIDFromHex(todoID)
 	if err != nil {
 		return errors.New("invalid todo id")
 	}
 
-	return s.repo.Update(ctx, objID, userID, bson.M(updates))
+	set := bson.M(updates)
+	unset := bson.M{}
+
+	complete := false
+	if done, ok := set["done"].(bool); ok && done {
+		complete = true
+		delete(set, "done")
+	}
+
+	// moved is the todo with its new due date, when that changes
+	var moved *models.Todo
+	if !due.empty() || !repeat.empty() {
+		todo, err := s.repo.FindByID(ctx, objID, userID)
+		if err != nil {
+			return err
+		}
+		moved = todo
+
+		loc := userLocation(s.profiles, userID)
+		if !due.empty() {
+			todo.DueDate, todo.AllDay, err = resolveDue(todo.DueDate, todo.AllDay, due, loc)
+			if err != nil {
+				return err
+			}
+		}
+		if !repeat.empty() {
+			if err := repeatTodo(todo, repeat, loc); err != nil {
+				return err
+			}
+			if todo.Recurrence != nil {
+				set["recurrence"] = todo.Recurrence
+			} else {
+				unset["recurrence"] = ""
+			}
+		}
+
+		if todo.DueDate != nil {
+			set["due_date"] = todo.DueDate
+		} else {
+			unset["due_date"] = ""
+		}
+		set["all_day"] = todo.AllDay
+	}
+
+	if err := s.repo.Update(ctx, objID, userID, set, unset); err != nil {
+		return err
+	}
+	s.stats.Invalidate(userID)
+	if moved != nil {
+		s.reminders.TodoMoved(ctx, moved)
+	}
+
+	if complete {
+		return s.complete(ctx, objID, userID)
+	}
+	return nil
+}
+
+// SkipOccurrence moves a repeating todo on to the next occurrence of its
+// series without completing it
+func (s *TodoService) SkipOccurrence(ctx context.Context, todoID, userID string) (*models.Todo, error) {
+	objID, err := primitive.ObjectIDFromHex(todoID)
+	if err != nil {
+		return nil, errors.New("invalid todo id")
+	}
+
+	todo, err := s.repo.FindByID(ctx, objID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if todo.Recurrence == nil {
+		return nil, ErrNotRecurring
+	}
+
+	next, err := nextOccurrence(todo.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	todo.Recurrence.Occurrence = next
+	todo.DueDate = occurrenceDue(next, todo.AllDay)
+	set := bson.M{"recurrence": todo.Recurrence, "due_date": todo.DueDate}
+	if err := s.repo.Update(ctx, objID, userID, set, nil); err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(userID)
+	s.reminders.TodoMoved(ctx, todo)
+
+	return s.repo.FindByID(ctx, objID, userID)
+}
+
+// complete marks a todo done and, when it repeats, creates the todo of the
+// next occurrence. A series without further occurrences simply ends. Both
+// writes happen in one transaction, so a failure never leaves a completed
+// todo without its next occurrence.
+func (s *TodoService) complete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	var todo, nextTodo *models.Todo
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		todo, nextTodo = nil, nil
+
+		changed, err := s.repo.MarkDone(ctx, id, userID)
+		if err != nil || !changed {
+			return err
+		}
+		if todo, err = s.repo.FindByID(ctx, id, userID); err != nil {
+			return err
+		}
+		if nextTodo, err = s.nextTodo(ctx, todo); err != nil || nextTodo == nil {
+			return err
+		}
+		return s.repo.Create(ctx, nextTodo)
+	})
+	if err != nil || todo == nil {
+		return err
+	}
+
+	s.stats.Invalidate(userID)
+	if nextTodo != nil {
+		s.reminders.TodoRepeated(ctx, todo, nextTodo)
+	}
+	return nil
+}
+
+// nextTodo builds the todo of the next occurrence of a repeating todo, or
+// returns nil when it does not repeat any more
+func (s *TodoService) nextTodo(ctx context.Context, todo *models.Todo) (*models.Todo, error) {
+	if todo.Recurrence == nil {
+		return nil, nil
+	}
+
+	next, err := nextOccurrence(todo.Recurrence)
+	if errors.Is(err, ErrRecurrenceEnded) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence := *todo.Recurrence
+	recurrence.Occurrence = next
+
+	nextTodo := &models.Todo{
+		UserID:     todo.UserID,
+		ListID:     todo.ListID,
+		Title:      todo.Title,
+		Priority:   todo.Priority,
+		DueDate:    occurrenceDue(next, todo.AllDay),
+		AllDay:     todo.AllDay,
+		Recurrence: &recurrence,
+	}
+	// The next occurrence takes the place of this one in its list
+	if todo.ListID != nil {
+		positions, err := s.lists.slots(ctx, todo.UserID, *todo.ListID, todo, false, 1, nil)
+		if err != nil {
+			return nil, err
+		}
+		nextTodo.Position = positions[0]
+	}
+	return nextTodo, nil
 }
 
 func (s *TodoService) DeleteTodo(ctx context.Context, todoID, userID string) error {
@@ -62,5 +315,293 @@ func (s *TodoService) DeleteTodo(ctx context.Context, todoID, userID string) err
 		return errors.New("invalid todo id")
 	}
 
-	return s.repo.Delete(ctx, objID, userID)
+	if err := s.repo.Delete(ctx, objID, userID); err != nil {
+		return err
+	}
+	s.stats.Invalidate(userID)
+	s.reminders.TargetDeleted(ctx, userID, models.ReminderTargetTodo, objID)
+
+	return nil
+}
+
+// MoveTodos moves todos, in the given order, to a place in a list. It serves
+// both dragging one todo within its list and moving many between lists; only
+// the moved todos are written.
+func (s *TodoService) MoveTodos(ctx context.Context, userID string, todoIDs []string, to TodoPlacement) ([]models.Todo, error) {
+	if len(todoIDs) == 0 {
+		return nil, ErrTodoIDsRequired
+	}
+	if len(todoIDs) > maxTodoMove {
+		return nil, ErrTooManyTodos
+	}
+	if to.AfterID != nil && to.BeforeID != nil {
+		return nil, ErrAmbiguousPlacement
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(todoIDs))
+	seen := make(map[primitive.ObjectID]bool)
+	for _, todoID := range todoIDs {
+		id, err := primitive.ObjectIDFromHex(todoID)
+		if err != nil {
+			return nil, ErrInvalidTodoID
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	// Files older todos into the default list first
+	if _, err := s.lists.defaultList(ctx, userID); err != nil {
+		return nil, err
+	}
+	todos, err := s.repo.FindByIDs(ctx, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(todos) != len(ids) {
+		return nil, ErrTodoNotFound
+	}
+
+	var anchor *models.Todo
+	if anchorID := firstNonNil(to.AfterID, to.BeforeID); anchorID != nil {
+		id, err := primitive.ObjectIDFromHex(*anchorID)
+		if err != nil || seen[id] {
+			return nil, ErrInvalidPlacement
+		}
+		anchor, err = s.repo.FindByID(ctx, id, userID)
+		if err != nil {
+			if IsNotFound(err) {
+				return nil, ErrInvalidPlacement
+			}
+			return nil, err
+		}
+	}
+
+	var listID primitive.ObjectID
+	switch {
+	case to.ListID != nil:
+		list, err := s.lists.find(ctx, userID, *to.ListID)
+		if err != nil {
+			return nil, err
+		}
+		listID = list.ID
+	case anchor != nil:
+		listID = *anchor.ListID
+	default:
+		for _, todo := range todos {
+			if *todo.ListID != *todos[0].ListID {
+				return nil, ErrTodoListNeeded
+			}
+		}
+		listID = *todos[0].ListID
+	}
+	if anchor != nil && *anchor.ListID != listID {
+		return nil, ErrInvalidPlacement
+	}
+
+	positions, err := s.lists.slots(ctx, userID, listID, anchor, to.BeforeID != nil, len(ids), ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Place(ctx, userID, listID, placements(ids, positions)); err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(userID)
+
+	moved, err := s.repo.FindByIDs(ctx, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[primitive.ObjectID]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	sort.Slice(moved, func(i, j int) bool { return index[moved[i].ID] < index[moved[j].ID] })
+
+	return moved, nil
+}
+
+// GetView returns the open todos of a smart view. Days follow the time zone
+// of the user's profile: overdue todos were due before today, upcoming ones
+// are due after it.
+func (s *TodoService) GetView(ctx context.Context, userID, view string) (*TodoView, error) {
+	loc := userLocation(s.profiles, userID)
+	now := time.Now().In(loc)
+
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+
+	var todos []models.Todo
+	var err error
+	switch view {
+	case TodoViewToday:
+		todos, err = s.repo.FindOpenDue(ctx, userID, start, end, day, nextDay)
+	case TodoViewOverdue:
+		todos, err = s.repo.FindOpenDue(ctx, userID, time.Time{}, start, time.Time{}, day)
+	case TodoViewUpcoming:
+		todos, err = s.repo.FindOpenDue(ctx, userID, end, time.Time{}, nextDay, time.Time{})
+	case TodoViewNoDate:
+		todos, err = s.repo.FindOpenUndated(ctx, userID)
+	default:
+		return nil, ErrInvalidTodoView
+	}
+	if err != nil {
+		return nil, err
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+	sortByDue(todos, loc)
+
+	return &TodoView{
+		View:     view,
+		Date:     start.Format("2006-01-02"),
+		Timezone: loc.String(),
+		Todos:    todos,
+	}, nil
+}
+
+// repeatTodo applies a recurrence change to a todo. A new series starts on
+// the first occurrence at or after the due date, which moves there; an empty
+// rule stops the repetition.
+func repeatTodo(todo *models.Todo, in RecurrenceInput, profileLoc *time.Location) error {
+	rule, loc, err := recurrenceFrom(in, todo.Recurrence, profileLoc)
+	if err != nil {
+		return err
+	}
+	if rule == "" {
+		todo.Recurrence = nil
+		return nil
+	}
+	if todo.DueDate == nil {
+		return ErrRecurrenceNeedsDate
+	}
+
+	from := todo.DueDate.Time
+	if todo.AllDay {
+		from = allDayStart(from, loc)
+	}
+
+	recurrence, err := newRecurrence(rule, loc, from)
+	if err != nil {
+		return err
+	}
+	todo.Recurrence = recurrence
+	todo.DueDate = occurrenceDue(recurrence.Occurrence, todo.AllDay)
+
+	return nil
+}
+
+// sortByDue orders todos by due day in loc, all-day todos first within a day
+// and timed ones by time
+func sortByDue(todos []models.Todo, loc *time.Location) {
+	key := func(todo models.Todo) (string, bool, time.Time) {
+		if todo.DueDate == nil {
+			return "", true, todo.CreatedAt
+		}
+		if todo.AllDay {
+			return todo.DueDate.UTC().Format("2006-01-02"), true, todo.CreatedAt
+		}
+		return todo.DueDate.In(loc).Format("2006-01-02"), false, todo.DueDate.Time
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		dayI, allDayI, atI := key(todos[i])
+		dayJ, allDayJ, atJ := key(todos[j])
+		if dayI != dayJ {
+			return dayI < dayJ
+		}
+		if allDayI != allDayJ {
+			return allDayI
+		}
+		return atI.Before(atJ)
+	})
+}
+
+// resolveDue applies a due date change to the current due date of a todo.
+// Days and datetimes without an offset are read in loc; all-day todos are
+// stored as midnight UTC of their day.
+func resolveDue(current *models.FlexibleTime, currentAllDay bool, due TodoDue, loc *time.Location) (*models.FlexibleTime, bool, error) {
+	if due.AllDay != nil && *due.AllDay && due.Time != nil && *due.Time != "" {
+		return nil, false, ErrDueTimeAllDay
+	}
+
+	// The day the change applies to and the time of day it keeps, if any
+	var day time.Time
+	var at *time.Time
+	switch {
+	case due.Date != nil && strings.TrimSpace(*due.Date) == "":
+		if (due.Time != nil && *due.Time != "") || (due.AllDay != nil && *due.AllDay) {
+			return nil, false, ErrDueDateRequired
+		}
+		return nil, false, nil
+	case due.Date != nil:
+		parsed, dateOnly, err := parseDueDate(strings.TrimSpace(*due.Date), loc)
+		if err != nil {
+			return nil, false, err
+		}
+		day = parsed
+		if !dateOnly {
+			at = &parsed
+		}
+	case current != nil && currentAllDay:
+		day = time.Date(current.UTC().Year(), current.UTC().Month(), current.UTC().Day(), 0, 0, 0, 0, loc)
+	case current != nil:
+		local := current.In(loc)
+		day, at = local, &local
+	default:
+		return nil, false, ErrDueDateRequired
+	}
+
+	if due.Time != nil && *due.Time != "" {
+		clock, err := time.Parse("15:04", *due.Time)
+		if err != nil {
+			return nil, false, ErrInvalidDueTime
+		}
+		timed := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		at = &timed
+	} else if due.Time != nil {
+		// An empty due_time drops the time of day
+		at = nil
+	}
+
+	allDay := at == nil
+	if due.AllDay != nil {
+		allDay = *due.AllDay
+	}
+
+	if allDay {
+		date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		return &models.FlexibleTime{Time: date}, true, nil
+	}
+	if at == nil {
+		// A timed todo needs a time; without one it is due at the start of
+		// its day
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+		at = &start
+	}
+
+	return &models.FlexibleTime{Time: at.UTC()}, false, nil
+}
+
+// parseDueDate reads a day (yyyy-mm-dd) or a datetime. Datetimes without an
+// offset are read in loc; the returned day is in loc either way.
+func parseDueDate(value string, loc *time.Location) (time.Time, bool, error) {
+	if day, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return day, true, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), false, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, false, nil
+		}
+	}
+
+	return time.Time{}, false, ErrInvalidDueDate
 }
@@ -0,0 +1,467 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultTodoListName names the list a user's todos start in
+	defaultTodoListName   = "Inbox"
+	maxTodoListNameLength = 100
+	// maxTodoMove bounds the todos moved in one request
+	maxTodoMove = 100
+)
+
+var (
+	ErrTodoListNotFound     = errors.New("todo list not found")
+	ErrInvalidTodoListID    = errors.New("invalid todo list id")
+	ErrTodoListNameRequired = errors.New("list name is required")
+	ErrTodoListNameTooLong  = errors.New("list name is too long")
+	ErrInvalidTodoListColor = errors.New("color must be a hex color such as #ff8800")
+	ErrDefaultTodoList      = errors.New("the default list cannot be deleted")
+	ErrAmbiguousPlacement   = errors.New("set only one of after_id and before_id")
+	ErrInvalidPlacement     = errors.New("after_id and before_id must be another item of the target list")
+)
+
+// TodoListService keeps the todo lists of users and the order of the todos
+// in them. Lists and todos are ordered by fractional positions, so moving one
+// only writes that one.
+type TodoListService struct {
+	repo  *repository.TodoListRepository
+	todos *repository.TodoRepository
+	stats *StatsCache
+}
+
+func NewTodoListService(repo *repository.TodoListRepository, todos *repository.TodoRepository, stats *StatsCache) *TodoListService {
+	return &TodoListService{repo: repo, todos: todos, stats: stats}
+}
+
+// ListLists returns the user's lists in their order
+func (s *TodoListService) ListLists(ctx context.Context, userID string) ([]models.TodoList, error) {
+	if _, err := s.defaultList(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	lists, err := s.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if lists == nil {
+		lists = []models.TodoList{}
+	}
+	return lists, nil
+}
+
+func (s *TodoListService) GetList(ctx context.Context, userID, listID string) (*models.TodoList, error) {
+	return s.find(ctx, userID, listID)
+}
+
+// CreateList adds a list after the user's other lists
+func (s *TodoListService) CreateList(ctx context.Context, userID, name string, color *string) (*models.TodoList, error) {
+	name, err := todoListName(name)
+	if err != nil {
+		return nil, err
+	}
+	color, err = todoListColor(color)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := s.ListLists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &models.TodoList{UserID: userID, Name: name, Color: color}
+	position, fresh, err := placeAmong(listPositions(lists), len(lists))
+	if err != nil {
+		return nil, err
+	}
+	if fresh != nil {
+		if err := s.repo.Place(ctx, userID, placements(listIDs(lists), fresh)); err != nil {
+			return nil, err
+		}
+	}
+	list.Position = position
+
+	if err := s.repo.Create(ctx, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// UpdateList renames a list or changes its colour; an empty colour clears it
+func (s *TodoListService) UpdateList(ctx context.Context, userID, listID string, name, color *string) (*models.TodoList, error) {
+	list, err := s.find(ctx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	if name != nil {
+		value, err := todoListName(*name)
+		if err != nil {
+			return nil, err
+		}
+		set["name"] = value
+	}
+	if color != nil {
+		value, err := todoListColor(color)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			set["color"] = *value
+		} else {
+			unset["color"] = ""
+		}
+	}
+
+	if err := s.repo.Update(ctx, list.ID, userID, set, unset); err != nil {
+		if IsNotFound(err) {
+			return nil, ErrTodoListNotFound
+		}
+		return nil, err
+	}
+
+	return s.repo.FindByID(ctx, list.ID, userID)
+}
+
+// MoveList puts a list right after the list afterID, right before the list
+// beforeID, or last when neither is set
+func (s *TodoListService) MoveList(ctx context.Context, userID, listID string, afterID, beforeID *string) (*models.TodoList, error) {
+	if afterID != nil && beforeID != nil {
+		return nil, ErrAmbiguousPlacement
+	}
+
+	list, err := s.find(ctx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := s.ListLists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	others := make([]models.TodoList, 0, len(lists))
+	for _, other := range lists {
+		if other.ID != list.ID {
+			others = append(others, other)
+		}
+	}
+
+	// at is where the list goes among the others
+	at := len(others)
+	if anchor := firstNonNil(afterID, beforeID); anchor != nil {
+		at = -1
+		for i, other := range others {
+			if other.ID.Hex() == *anchor {
+				at = i
+			}
+		}
+		if at < 0 {
+			return nil, ErrInvalidPlacement
+		}
+		if afterID != nil {
+			at++
+		}
+	}
+
+	position, fresh, err := placeAmong(listPositions(others), at)
+	if err != nil {
+		return nil, err
+	}
+
+	writes := []repository.Placement{{ID: list.ID, Position: position}}
+	if fresh != nil {
+		// fresh has the list at index at and the others around it
+		ordered := append(others[:at:at], *list)
+		writes = placements(listIDs(append(ordered, others[at:]...)), fresh)
+	}
+	if err := s.repo.Place(ctx, userID, writes); err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByID(ctx, list.ID, userID)
+}
+
+// DeleteList removes a list. Its todos move to the end of the default list.
+func (s *TodoListService) DeleteList(ctx context.Context, userID, listID string) error {
+	list, err := s.find(ctx, userID, listID)
+	if err != nil {
+		return err
+	}
+	if list.IsDefault {
+		return ErrDefaultTodoList
+	}
+
+	fallback, err := s.defaultList(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	todos, err := s.todos.FindByList(ctx, userID, list.ID)
+	if err != nil {
+		return err
+	}
+	if len(todos) > 0 {
+		ids := make([]primitive.ObjectID, len(todos))
+		for i, todo := range todos {
+			ids[i] = todo.ID
+		}
+		positions, err := s.slots(ctx, userID, fallback.ID, nil, false, len(ids), ids)
+		if err != nil {
+			return err
+		}
+		if err := s.todos.Place(ctx, userID, fallback.ID, placements(ids, positions)); err != nil {
+			return err
+		}
+		s.stats.Invalidate(userID)
+	}
+
+	if err := s.repo.Delete(ctx, list.ID, userID); err != nil {
+		if IsNotFound(err) {
+			return ErrTodoListNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListTodos returns the todos of a list in their order
+func (s *TodoListService) ListTodos(ctx context.Context, userID, listID string) ([]models.Todo, error) {
+	list, err := s.find(ctx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := s.todos.FindByList(ctx, userID, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+	return todos, nil
+}
+
+// resolve returns the list a todo goes to: the given one, or else the
+// default list
+func (s *TodoListService) resolve(ctx context.Context, userID string, listID *string) (*models.TodoList, error) {
+	if listID == nil || *listID == "" {
+		return s.defaultList(ctx, userID)
+	}
+	return s.find(ctx, userID, *listID)
+}
+
+func (s *TodoListService) find(ctx context.Context, userID, listID string) (*models.TodoList, error) {
+	id, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return nil, ErrInvalidTodoListID
+	}
+
+	// Make sure older todos have been filed before a list is shown
+	if _, err := s.defaultList(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	list, err := s.repo.FindByID(ctx, id, userID)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrTodoListNotFound
+		}
+		return nil, err
+	}
+	return list, nil
+}
+
+// defaultList returns the user's default list, creating it the first time.
+// Todos that belong to no list, made before lists existed, are filed at its
+// end, oldest first.
+func (s *TodoListService) defaultList(ctx context.Context, userID string) (*models.TodoList, error) {
+	list, err := s.repo.EnsureDefault(ctx, &models.TodoList{
+		UserID:    userID,
+		Name:      defaultTodoListName,
+		Position:  positionBetween("", ""),
+		IsDefault: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unlisted, err := s.todos.FindUnlisted(ctx, userID)
+	if err != nil || len(unlisted) == 0 {
+		return list, err
+	}
+
+	ids := make([]primitive.ObjectID, len(unlisted))
+	for i, todo := range unlisted {
+		ids[i] = todo.ID
+	}
+	positions, err := s.slots(ctx, userID, list.ID, nil, false, len(ids), ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.todos.Place(ctx, userID, list.ID, placements(ids, positions)); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// slots finds n positions in a list: right before anchor when before is set,
+// right after it otherwise, or at the end of the list without an anchor. The
+// todos in moving are being placed and are not neighbours. When the gap has
+// no room left, as after concurrent moves, the list gets fresh positions
+// first.
+func (s *TodoListService) slots(ctx context.Context, userID string, listID primitive.ObjectID, anchor *models.Todo, before bool, n int, moving []primitive.ObjectID) ([]string, error) {
+	for respaced := false; ; respaced = true {
+		low, high, err := s.gap(ctx, userID, listID, anchor, before, moving)
+		if err != nil {
+			return nil, err
+		}
+
+		positions, err := positionsBetween(low, high, n)
+		if err == nil && (respaced || len(positions[n-1]) <= maxPositionLength) {
+			return positions, nil
+		}
+		if respaced || (err != nil && !errors.Is(err, errPositionOrder)) {
+			return nil, err
+		}
+
+		if err := s.respaceTodos(ctx, userID, listID); err != nil {
+			return nil, err
+		}
+		if anchor != nil {
+			if anchor, err = s.todos.FindByID(ctx, anchor.ID, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// gap returns the positions a placement goes between. A neighbour without a
+// position, left from before lists existed, is reported as out of order.
+func (s *TodoListService) gap(ctx context.Context, userID string, listID primitive.ObjectID, anchor *models.Todo, before bool, moving []primitive.ObjectID) (string, string, error) {
+	var neighbour *models.Todo
+	var err error
+	if anchor == nil {
+		neighbour, err = s.todos.Last(ctx, userID, listID, moving)
+	} else {
+		neighbour, err = s.todos.Neighbour(ctx, userID, listID, anchor, before, moving)
+	}
+	if err != nil && !IsNotFound(err) {
+		return "", "", err
+	}
+
+	if (anchor != nil && anchor.Position == "") || (neighbour != nil && neighbour.Position == "") {
+		return "", "", errPositionOrder
+	}
+
+	low, high := "", ""
+	switch {
+	case anchor == nil:
+		if neighbour != nil {
+			low = neighbour.Position
+		}
+	case before:
+		high = anchor.Position
+		if neighbour != nil {
+			low = neighbour.Position
+		}
+	default:
+		low = anchor.Position
+		if neighbour != nil {
+			high = neighbour.Position
+		}
+	}
+	return low, high, nil
+}
+
+// respaceTodos gives the todos of a list fresh, evenly spread positions in
+// their current order
+func (s *TodoListService) respaceTodos(ctx context.Context, userID string, listID primitive.ObjectID) error {
+	todos, err := s.todos.FindByList(ctx, userID, listID)
+	if err != nil || len(todos) == 0 {
+		return err
+	}
+
+	ids := make([]primitive.ObjectID, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	positions, err := positionsBetween("", "", len(ids))
+	if err != nil {
+		return err
+	}
+
+	return s.todos.Place(ctx, userID, listID, placements(ids, positions))
+}
+
+func placements(ids []primitive.ObjectID, positions []string) []repository.Placement {
+	result := make([]repository.Placement, len(ids))
+	for i, id := range ids {
+		result[i] = repository.Placement{ID: id, Position: positions[i]}
+	}
+	return result
+}
+
+func listPositions(lists []models.TodoList) []string {
+	positions := make([]string, len(lists))
+	for i, list := range lists {
+		positions[i] = list.Position
+	}
+	return positions
+}
+
+func listIDs(lists []models.TodoList) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, len(lists))
+	for i, list := range lists {
+		ids[i] = list.ID
+	}
+	return ids
+}
+
+func todoListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrTodoListNameRequired
+	}
+	if utf8.RuneCountInString(name) > maxTodoListNameLength {
+		return "", ErrTodoListNameTooLong
+	}
+	return name, nil
+}
+
+// todoListColor validates a colour; an empty one means none
+func todoListColor(color *string) (*string, error) {
+	if color == nil || *color == "" {
+		return nil, nil
+	}
+	if !tagColorPattern.MatchString(*color) {
+		return nil, ErrInvalidTodoListColor
+	}
+	lower := strings.ToLower(*color)
+	return &lower, nil
+}
+
+func firstNonNil(values ...*string) *string {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
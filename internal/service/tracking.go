@@ -0,0 +1,384 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"backend-journaling/internal/authz"
+	"backend-journaling/internal/models"
+	"backend-journaling/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrHabitNotFound     = errors.New("habit not found")
+	ErrInvalidHabit      = errors.New("habit needs a name and a kind of boolean or numeric")
+	ErrInvalidHabitValue = errors.New("invalid habit value")
+	ErrInvalidMood       = errors.New("mood must be between 1 and 5")
+	ErrInvalidEnergy     = errors.New("energy must be between 1 and 5")
+	ErrInvalidSleep      = errors.New("sleep hours must be between 0 and 24")
+	ErrTooManyEmotions   = errors.New("too many emotion labels")
+)
+
+const (
+	// maxEmotions bounds how many emotion labels one day can carry
+	maxEmotions = 10
+	// defaultTrackingDays is the range covered when no dates are given
+	defaultTrackingDays = 30
+)
+
+// DailyLogInput is the full set of tracked fields for a day; fields left nil
+// are not tracked that day. Habit values are booleans for boolean habits and
+// numbers for numeric ones, keyed by habit ID.
+type DailyLogInput struct {
+	Mood       *int
+	Emotions   []string
+	Energy     *int
+	SleepHours *float64
+	Habits     map[string]interface{}
+}
+
+// TrackedDay is a day's log together with the journal entry of that day, if
+// there is one
+type TrackedDay struct {
+	models.DailyLog
+	NoteID *primitive.ObjectID `json:"note_id,omitempty"`
+}
+
+// TrackingSeries is the logs of the days in a date range that have one
+type TrackingSeries struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Timezone string       `json:"timezone"`
+	Days     []TrackedDay `json:"days"`
+}
+
+// TrackingService records mood, energy, sleep and custom habits per day and
+// summarises them over date ranges
+type TrackingService struct {
+	logRepo     *repository.DailyLogRepository
+	habitRepo   *repository.HabitRepository
+	noteRepo    *repository.NoteRepository
+	profileRepo *repository.ProfileRepository
+}
+
+func NewTrackingService(logRepo *repository.DailyLogRepository, habitRepo *repository.HabitRepository, noteRepo *repository.NoteRepository, profileRepo *repository.ProfileRepository) *TrackingService {
+	return &TrackingService{
+		logRepo:     logRepo,
+		habitRepo:   habitRepo,
+		noteRepo:    noteRepo,
+		profileRepo: profileRepo,
+	}
+}
+
+func (s *TrackingService) GetHabits(ctx context.Context, userID string) ([]models.Habit, error) {
+	habits, err := s.habitRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if habits == nil {
+		habits = []models.Habit{}
+	}
+
+	return habits, nil
+}
+
+func (s *TrackingService) CreateHabit(ctx context.Context, userID, name, kind string, unit *string, target *float64) (*models.Habit, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || (kind != models.HabitKindBoolean && kind != models.HabitKindNumeric) {
+		return nil, ErrInvalidHabit
+	}
+	if kind == models.HabitKindBoolean {
+		unit, target = nil, nil
+	}
+	if target != nil && !validHabitValue(*target) {
+		return nil, ErrInvalidHabitValue
+	}
+
+	habit := &models.Habit{
+		UserID: userID,
+		Name:   name,
+		Kind:   kind,
+		Unit:   unit,
+		Target: target,
+	}
+
+	if err := s.habitRepo.Create(ctx, habit); err != nil {
+		return nil, err
+	}
+
+	return habit, nil
+}
+
+// UpdateHabit changes a habit's name, unit, target or archived flag. The kind
+// of a habit cannot change since its recorded values depend on it.
+func (s *TrackingService) UpdateHabit(ctx context.Context, habitID, userID string, updates map[string]interface{}) (*models.Habit, error) {
+	habit, err := s.findHabit(ctx, habitID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := updates["name"].(string); ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, ErrInvalidHabit
+		}
+		updates["name"] = name
+	}
+	if habit.Kind == models.HabitKindBoolean {
+		delete(updates, "unit")
+		delete(updates, "target")
+	}
+	if target, ok := updates["target"].(float64); ok && !validHabitValue(target) {
+		return nil, ErrInvalidHabitValue
+	}
+
+	if len(updates) > 0 {
+		if err := s.habitRepo.Update(ctx, habit.ID, userID, bson.M(updates)); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.habitRepo.FindByID(ctx, habit.ID, userID)
+}
+
+// DeleteHabit removes a habit together with its values in every daily log;
+// archive a habit instead to keep its history
+func (s *TrackingService) DeleteHabit(ctx context.Context, habitID, userID string) error {
+	habit, err := s.findHabit(ctx, habitID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.habitRepo.Delete(ctx, habit.ID, userID); err != nil {
+		return err
+	}
+
+	return s.logRepo.RemoveHabit(ctx, userID, habit.ID.Hex())
+}
+
+// GetDay returns the log of a day; date is yyyy-mm-dd or "today"
+func (s *TrackingService) GetDay(ctx context.Context, userID, date string) (*TrackedDay, error) {
+	day, err := resolveDate(s.profileRepo, userID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := s.logRepo.FindByDate(ctx, userID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.trackedDay(ctx, log), nil
+}
+
+// PutDay records the tracked fields of a day, replacing what was recorded
+// before
+func (s *TrackingService) PutDay(ctx context.Context, userID, date string, input DailyLogInput) (*TrackedDay, error) {
+	day, err := resolveDate(s.profileRepo, userID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	field := func(name string, value interface{}, empty bool) {
+		if empty {
+			unset[name] = ""
+		} else {
+			set[name] = value
+		}
+	}
+
+	if input.Mood != nil && (*input.Mood < 1 || *input.Mood > 5) {
+		return nil, ErrInvalidMood
+	}
+	field("mood", input.Mood, input.Mood == nil)
+
+	if input.Energy != nil && (*input.Energy < 1 || *input.Energy > 5) {
+		return nil, ErrInvalidEnergy
+	}
+	field("energy", input.Energy, input.Energy == nil)
+
+	if input.SleepHours != nil && !(*input.SleepHours >= 0 && *input.SleepHours <= 24) {
+		return nil, ErrInvalidSleep
+	}
+	field("sleep_hours", input.SleepHours, input.SleepHours == nil)
+
+	emotions := normalizeTags(input.Emotions)
+	if len(emotions) > maxEmotions {
+		return nil, ErrTooManyEmotions
+	}
+	field("emotions", emotions, len(emotions) == 0)
+
+	habits, err := s.habitValues(ctx, userID, input.Habits)
+	if err != nil {
+		return nil, err
+	}
+	field("habits", habits, len(habits) == 0)
+
+	log, err := s.logRepo.Upsert(ctx, userID, day, set, unset)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.trackedDay(ctx, log), nil
+}
+
+func (s *TrackingService) DeleteDay(ctx context.Context, userID, date string) error {
+	day, err := resolveDate(s.profileRepo, userID, date)
+	if err != nil {
+		return err
+	}
+
+	return s.logRepo.Delete(ctx, userID, day)
+}
+
+// GetSeries returns the logged days between from and to (inclusive,
+// yyyy-mm-dd), defaulting to the last 30 days in the user's time zone
+func (s *TrackingService) GetSeries(ctx context.Context, userID, from, to string) (*TrackingSeries, error) {
+	loc := userLocation(s.profileRepo, userID)
+	start, end, err := trackingRange(from, to, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+
+	series := &TrackingSeries{
+		From:     start,
+		To:       end,
+		Timezone: loc.String(),
+		Days:     []TrackedDay{},
+	}
+
+	logs, err := s.logRepo.FindRange(ctx, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]primitive.ObjectID)
+	notes, err := s.noteRepo.FindJournalEntries(ctx, authz.Owner(userID), start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		entries[*note.JournalDate] = note.ID
+	}
+
+	for _, log := range logs {
+		day := TrackedDay{DailyLog: log}
+		if noteID, ok := entries[log.Date]; ok {
+			day.NoteID = &noteID
+		}
+		series.Days = append(series.Days, day)
+	}
+
+	return series, nil
+}
+
+// habitValues validates the habit values of a day against the user's habits
+// and converts them to their stored form
+func (s *TrackingService) habitValues(ctx context.Context, userID string, input map[string]interface{}) (map[string]float64, error) {
+	values := make(map[string]float64, len(input))
+	if len(input) == 0 {
+		return values, nil
+	}
+
+	habits, err := s.habitRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	kinds := make(map[string]string, len(habits))
+	for _, habit := range habits {
+		kinds[habit.ID.Hex()] = habit.Kind
+	}
+
+	for habitID, raw := range input {
+		kind, ok := kinds[habitID]
+		if !ok {
+			return nil, ErrHabitNotFound
+		}
+
+		switch value := raw.(type) {
+		case nil:
+			continue
+		case bool:
+			if kind != models.HabitKindBoolean {
+				return nil, ErrInvalidHabitValue
+			}
+			values[habitID] = 0
+			if value {
+				values[habitID] = 1
+			}
+		case float64:
+			if !validHabitValue(value) || (kind == models.HabitKindBoolean && value != 0 && value != 1) {
+				return nil, ErrInvalidHabitValue
+			}
+			values[habitID] = value
+		default:
+			return nil, ErrInvalidHabitValue
+		}
+	}
+
+	return values, nil
+}
+
+func (s *TrackingService) trackedDay(ctx context.Context, log *models.DailyLog) *TrackedDay {
+	day := &TrackedDay{DailyLog: *log}
+	if note, err := s.noteRepo.FindByJournalDate(ctx, authz.Owner(log.UserID), log.Date); err == nil {
+		day.NoteID = &note.ID
+	}
+	return day
+}
+
+func (s *TrackingService) findHabit(ctx context.Context, habitID, userID string) (*models.Habit, error) {
+	objID, err := primitive.ObjectIDFromHex(habitID)
+	if err != nil {
+		return nil, ErrHabitNotFound
+	}
+
+	habit, err := s.habitRepo.FindByID(ctx, objID, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrHabitNotFound
+	}
+	return habit, err
+}
+
+func validHabitValue(value float64) bool {
+	return value >= 0 && !math.IsInf(value, 0) && !math.IsNaN(value)
+}
+
+// trackingRange validates a yyyy-mm-dd range; empty bounds default to the 30
+// days ending today, or 30 days from/to the one bound given
+func trackingRange(from, to string, now time.Time) (string, string, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, 1-defaultTrackingDays)
+	end := today
+
+	var err error
+	if from != "" {
+		if start, err = time.Parse(journalDateLayout, from); err != nil {
+			return "", "", ErrInvalidJournalDate
+		}
+		if to == "" {
+			end = start.AddDate(0, 0, defaultTrackingDays-1)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(journalDateLayout, to); err != nil {
+			return "", "", ErrInvalidJournalDate
+		}
+		if from == "" {
+			start = end.AddDate(0, 0, 1-defaultTrackingDays)
+		}
+	}
+	if end.Before(start) || end.Sub(start) > maxCalendarDays*24*time.Hour {
+		return "", "", ErrInvalidJournalRange
+	}
+
+	return start.Format(journalDateLayout), end.Format(journalDateLayout), nil
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"backend-journaling/internal/models"
+)
+
+// minCorrelationSamples is how many days with both values a correlation needs
+// before it is reported
+const minCorrelationSamples = 5
+
+// MetricStats summarises one tracked number over a date range
+type MetricStats struct {
+	Days    int      `json:"days"`
+	Average *float64 `json:"average,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+}
+
+// Streak is a run of consecutive days. Current is the run ending on the last
+// day of the range; a day that is still in progress does not break it.
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+type EmotionCount struct {
+	Emotion string `json:"emotion"`
+	Count   int    `json:"count"`
+}
+
+// HabitSummary is how a habit went over a date range and how mood relates to
+// it. Correlations are Pearson coefficients between -1 and 1.
+type HabitSummary struct {
+	HabitID         string   `json:"habit_id"`
+	Name            string   `json:"name"`
+	Kind            string   `json:"kind"`
+	DaysDone        int      `json:"days_done"`
+	CompletionRate  float64  `json:"completion_rate"`
+	Average         *float64 `json:"average,omitempty"`
+	Streak          Streak   `json:"streak"`
+	MoodCorrelation *float64 `json:"mood_correlation,omitempty"`
+	MoodWhenDone    *float64 `json:"mood_when_done,omitempty"`
+	MoodWhenNotDone *float64 `json:"mood_when_not_done,omitempty"`
+}
+
+// TrackingSummary aggregates the daily logs of a date range
+type TrackingSummary struct {
+	From                  string         `json:"from"`
+	To                    string         `json:"to"`
+	Timezone              string         `json:"timezone"`
+	DaysLogged            int            `json:"days_logged"`
+	LoggingStreak         Streak         `json:"logging_streak"`
+	Mood                  MetricStats    `json:"mood"`
+	MoodDistribution      map[int]int    `json:"mood_distribution"`
+	Energy                MetricStats    `json:"energy"`
+	SleepHours            MetricStats    `json:"sleep_hours"`
+	Emotions              []EmotionCount `json:"emotions"`
+	SleepMoodCorrelation  *float64       `json:"sleep_mood_correlation,omitempty"`
+	EnergyMoodCorrelation *float64       `json:"energy_mood_correlation,omitempty"`
+	Habits                []HabitSummary `json:"habits"`
+}
+
+// GetSummary computes averages, streaks and habit/mood correlations for the
+// days between from and to. Averages and correlations only use the range;
+// streaks look at all history up to its end.
+func (s *TrackingService) GetSummary(ctx context.Context, userID, from, to string) (*TrackingSummary, error) {
+	loc := userLocation(s.profileRepo, userID)
+	now := time.Now().In(loc)
+	start, end, err := trackingRange(from, to, now)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.logRepo.FindRange(ctx, userID, "", end)
+	if err != nil {
+		return nil, err
+	}
+	habits, err := s.habitRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []models.DailyLog
+	for _, log := range history {
+		if log.Date >= start {
+			logs = append(logs, log)
+		}
+	}
+
+	summary := &TrackingSummary{
+		From:             start,
+		To:               end,
+		Timezone:         loc.String(),
+		DaysLogged:       len(logs),
+		MoodDistribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0},
+		Emotions:         []EmotionCount{},
+		Habits:           []HabitSummary{},
+	}
+
+	today := now.Format(journalDateLayout)
+	summary.LoggingStreak = streak(logDates(history, func(models.DailyLog) bool { return true }), end, today)
+
+	var mood, energy, sleep []float64
+	var sleepPairs, energyPairs [][2]float64
+	emotions := make(map[string]int)
+	for _, log := range logs {
+		if log.Mood != nil {
+			mood = append(mood, float64(*log.Mood))
+			summary.MoodDistribution[*log.Mood]++
+		}
+		if log.Energy != nil {
+			energy = append(energy, float64(*log.Energy))
+			if log.Mood != nil {
+				energyPairs = append(energyPairs, [2]float64{float64(*log.Energy), float64(*log.Mood)})
+			}
+		}
+		if log.SleepHours != nil {
+			sleep = append(sleep, *log.SleepHours)
+			if log.Mood != nil {
+				sleepPairs = append(sleepPairs, [2]float64{*log.SleepHours, float64(*log.Mood)})
+			}
+		}
+		for _, emotion := range log.Emotions {
+			emotions[emotion]++
+		}
+	}
+
+	summary.Mood = metricStats(mood)
+	summary.Energy = metricStats(energy)
+	summary.SleepHours = metricStats(sleep)
+	summary.SleepMoodCorrelation = correlation(sleepPairs)
+	summary.EnergyMoodCorrelation = correlation(energyPairs)
+
+	for emotion, count := range emotions {
+		summary.Emotions = append(summary.Emotions, EmotionCount{Emotion: emotion, Count: count})
+	}
+	sort.Slice(summary.Emotions, func(i, j int) bool {
+		if summary.Emotions[i].Count != summary.Emotions[j].Count {
+			return summary.Emotions[i].Count > summary.Emotions[j].Count
+		}
+		return summary.Emotions[i].Emotion < summary.Emotions[j].Emotion
+	})
+
+	for _, habit := range habits {
+		if habit.IsArchived {
+			continue
+		}
+		summary.Habits = append(summary.Habits, habitSummary(habit, logs, history, end, today))
+	}
+
+	return summary, nil
+}
+
+func habitSummary(habit models.Habit, logs, history []models.DailyLog, end, today string) HabitSummary {
+	id := habit.ID.Hex()
+	done := func(log models.DailyLog) bool {
+		value, ok := log.Habits[id]
+		if !ok {
+			return false
+		}
+		if habit.Kind == models.HabitKindNumeric && habit.Target != nil {
+			return value >= *habit.Target
+		}
+		return value > 0
+	}
+
+	summary := HabitSummary{
+		HabitID: id,
+		Name:    habit.Name,
+		Kind:    habit.Kind,
+		Streak:  streak(logDates(history, done), end, today),
+	}
+
+	var values, moodDone, moodNotDone []float64
+	var pairs [][2]float64
+	for _, log := range logs {
+		value, recorded := log.Habits[id]
+		if done(log) {
+			summary.DaysDone++
+		}
+		if recorded {
+			values = append(values, value)
+		}
+		if log.Mood == nil {
+			continue
+		}
+
+		mood := float64(*log.Mood)
+		if habit.Kind == models.HabitKindBoolean {
+			// A day without a value counts as not done
+			if done(log) {
+				moodDone = append(moodDone, mood)
+				pairs = append(pairs, [2]float64{1, mood})
+			} else {
+				moodNotDone = append(moodNotDone, mood)
+				pairs = append(pairs, [2]float64{0, mood})
+			}
+		} else if recorded {
+			pairs = append(pairs, [2]float64{value, mood})
+		}
+	}
+
+	if len(logs) > 0 {
+		summary.CompletionRate = round(float64(summary.DaysDone)/float64(len(logs)), 3)
+	}
+	if habit.Kind == models.HabitKindNumeric {
+		summary.Average = metricStats(values).Average
+	} else {
+		summary.MoodWhenDone = metricStats(moodDone).Average
+		summary.MoodWhenNotDone = metricStats(moodNotDone).Average
+	}
+	summary.MoodCorrelation = correlation(pairs)
+
+	return summary
+}
+
+// streak measures runs of consecutive days in dates (yyyy-mm-dd, sorted) up
+// to end. When end is today and today is not in dates yet, the current streak
+// is counted up to yesterday.
+func streak(dates []string, end, today string) Streak {
+	var result Streak
+	var run int
+	var previous time.Time
+	seen := make(map[string]bool, len(dates))
+
+	for _, day := range dates {
+		date, err := time.Parse(journalDateLayout, day)
+		if err != nil || day > end || seen[day] {
+			continue
+		}
+		seen[day] = true
+
+		if !previous.IsZero() && date.Sub(previous) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		previous = date
+		result.Longest = max(result.Longest, run)
+	}
+
+	last, err := time.Parse(journalDateLayout, end)
+	if err != nil {
+		return result
+	}
+	if end == today && !seen[end] {
+		last = last.AddDate(0, 0, -1)
+	}
+	for seen[last.Format(journalDateLayout)] {
+		result.Current++
+		last = last.AddDate(0, 0, -1)
+	}
+
+	return result
+}
+
+// logDates lists the dates of the logs matching ok
+func logDates(logs []models.DailyLog, ok func(models.DailyLog) bool) []string {
+	var dates []string
+	for _, log := range logs {
+		if ok(log) {
+			dates = append(dates, log.Date)
+		}
+	}
+	return dates
+}
+
+func metricStats(values []float64) MetricStats {
+	stats := MetricStats{Days: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sum, low, high := 0.0, values[0], values[0]
+	for _, value := range values {
+		sum += value
+		low = math.Min(low, value)
+		high = math.Max(high, value)
+	}
+
+	average := round(sum/float64(len(values)), 2)
+	stats.Average, stats.Min, stats.Max = &average, &low, &high
+	return stats
+}
+
+// correlation is the Pearson coefficient of the pairs, or nil when there are
+// too few of them or either side does not vary
+func correlation(pairs [][2]float64) *float64 {
+	if len(pairs) < minCorrelationSamples {
+		return nil
+	}
+
+	var sumX, sumY float64
+	for _, pair := range pairs {
+		sumX += pair[0]
+		sumY += pair[1]
+	}
+	n := float64(len(pairs))
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for _, pair := range pairs {
+		dx, dy := pair[0]-meanX, pair[1]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+
+	r := round(cov/math.Sqrt(varX*varY), 3)
+	return &r
+}
+
+func round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"backend-journaling/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The task workflow. A task starts in todo, is worked on in in_progress or
+// any custom board status, and ends in done:
+//
+//	todo        -> active
+//	active      -> active, todo, done
+//	done        -> active, todo
+//
+// where active is in_progress or a custom status. Staying in the same status
+// is always allowed. The shortcut from todo straight to done is refused,
+// unless the task completes itself from its subtasks.
+
+var (
+	// ErrInvalidTransition is wrapped with the statuses involved, e.g.
+	// "invalid status transition: todo to done"
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrTaskMoved means the task changed status while it was being changed
+	ErrTaskMoved = errors.New("task was changed by another request")
+)
+
+// TaskFlow is how long a task took. Lead time runs from creation to
+// completion; cycle time from when work first started to completion.
+type TaskFlow struct {
+	TaskID           primitive.ObjectID `json:"task_id"`
+	Title            string             `json:"title"`
+	Status           string             `json:"status"`
+	CreatedAt        time.Time          `json:"created_at"`
+	StartedAt        *time.Time         `json:"started_at,omitempty"`
+	CompletedAt      *time.Time         `json:"completed_at,omitempty"`
+	LeadTimeSeconds  *int64             `json:"lead_time_seconds,omitempty"`
+	CycleTimeSeconds *int64             `json:"cycle_time_seconds,omitempty"`
+}
+
+// TaskHistory is a task's activity log with the flow derived from it
+type TaskHistory struct {
+	TaskFlow
+	Activity []models.TaskActivity `json:"activity"`
+}
+
+// FlowSummary sums up lead or cycle times
+type FlowSummary struct {
+	Count          int   `json:"count"`
+	AverageSeconds int64 `json:"average_seconds"`
+	MedianSeconds  int64 `json:"median_seconds"`
+}
+
+// FlowReport covers the tasks completed in a range of days
+type FlowReport struct {
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	Timezone  string      `json:"timezone"`
+	Completed int         `json:"completed"`
+	LeadTime  FlowSummary `json:"lead_time"`
+	CycleTime FlowSummary `json:"cycle_time"`
+	Tasks     []TaskFlow  `json:"tasks"`
+}
+
+// allowedTransitions lists the stages each stage may move on to
+var allowedTransitions = map[string]map[string]bool{
+	"todo":   {"active": true},
+	"active": {"active": true, "todo": true, "done": true},
+	"done":   {"active": true, "todo": true},
+}
+
+// followUp is the part of a status change that must only run once the
+// change is committed, such as notifications and cache invalidation
+type followUp func(ctx context.Context) error
+
+// checkTransition refuses the status changes the workflow does not allow
+func checkTransition(from, to string) error {
+	if !validTaskStatus(to) {
+		return ErrInvalidTaskStatus
+	}
+	if from == to || allowedTransitions[workflowStage(from)][workflowStage(to)] {
+		return nil
+	}
+	if from == "todo" && to == "done" {
+		return fmt.Errorf("%w: %s to %s; start the task first", ErrInvalidTransition, from, to)
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+}
+
+// workflowStage maps a status to its stage in the workflow
+func workflowStage(status string) string {
+	if activeStatus(status) {
+		return "active"
+	}
+	return status
+}
+
+// transition moves a task to the status to, applying set and unset in the
+// same write, and logs the change. Moving to done stamps completed_at;
+// reopening clears it. The status change, its activity entry and the task of
+// a repeating task's next occurrence are written in one transaction, which
+// joins the caller's if there is one, after the WIP limits of the boards
+// showing the task are checked. Automatic transitions skip the workflow and
+// WIP checks.
+//
+// The follow-up on the change is returned rather than run: the caller runs
+// it after its outermost transaction has committed, so a retried
+// transaction does not notify twice.
+func (s *TaskService) transition(ctx context.Context, task *models.Task, to string, automatic bool, set, unset bson.M) (followUp, error) {
+	from := task.Status
+	if !automatic {
+		if err := checkTransition(from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	fields := bson.M{"status": to}
+	for key, value := range set {
+		fields[key] = value
+	}
+	remove := bson.M{}
+	for key, value := range unset {
+		remove[key] = value
+	}
+	if to != from {
+		if to == "done" {
+			fields["completed_at"] = now
+		} else if from == "done" {
+			remove["completed_at"] = ""
+		}
+	}
+
+	var next *models.Task
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		next = nil
+
+		if !automatic && to != from {
+			if err := s.checkWIP(ctx, task, to); err != nil {
+				return err
+			}
+		}
+		changed, err := s.repo.SetStatus(ctx, task.ID, task.UserID, from, fields, remove)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return ErrTaskMoved
+		}
+		if to == from {
+			return nil
+		}
+
+		err = s.activity.Create(ctx, &models.TaskActivity{
+			TaskID:    task.ID,
+			UserID:    task.UserID,
+			ActorID:   task.UserID,
+			Type:      models.TaskActivityStatusChanged,
+			From:      from,
+			To:        to,
+			Automatic: automatic,
+			CreatedAt: now,
+		})
+		if err != nil || to != "done" {
+			return err
+		}
+
+		if next, err = s.nextTask(ctx, task); err != nil || next == nil {
+			return err
+		}
+		return s.repo.Create(ctx, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changed := *task
+	changed.Status = to
+	if to == "done" {
+		changed.CompletedAt = &now
+	}
+	return func(ctx context.Context) error {
+		s.stats.Invalidate(changed.UserID)
+		if to == from {
+			return nil
+		}
+		if next != nil {
+			s.reminders.TaskRepeated(ctx, &changed, next)
+		}
+
+		if from == "done" {
+			// Reopening blocks the tasks waiting for it again
+			return s.prerequisiteChanged(ctx, &changed)
+		}
+		if to != "done" {
+			return nil
+		}
+		return s.completed(ctx, &changed)
+	}, nil
+}
+
+// checkWIP refuses to move a task into a status whose column has reached
+// its WIP limit on any board showing the task. The moves into a status are
+// locked against each other first, so concurrent moves cannot pass a limit
+// together: the one that retries counts the column again.
+func (s *TaskService) checkWIP(ctx context.Context, task *models.Task, to string) error {
+	boards, err := s.boards.FindByUserID(ctx, task.UserID)
+	if err != nil {
+		return err
+	}
+
+	locked := false
+	for i := range boards {
+		board := &boards[i]
+		if !onBoard(board, task) {
+			continue
+		}
+		for _, column := range board.Columns {
+			if column.Status != to || column.WIPLimit == nil {
+				continue
+			}
+			if !locked {
+				if err := s.locks.Lock(ctx, statusLockScope(task.UserID, to)); err != nil {
+					return err
+				}
+				locked = true
+			}
+			count, err := s.repo.CountColumn(ctx, task.UserID, to, board.Tag, task.ID)
+			if err != nil {
+				return err
+			}
+			if count >= int64(*column.WIPLimit) {
+				return ErrWIPLimitReached
+			}
+		}
+	}
+	return nil
+}
+
+// statusLockScope names the lock on the moves of a user's tasks into a
+// status. Columns map to statuses, which are shared by all of the user's
+// boards.
+func statusLockScope(userID, status string) string {
+	return "status:" + userID + ":" + status
+}
+
+// GetHistory returns a task's activity log, oldest first, with its lead and
+// cycle time
+func (s *TaskService) GetHistory(ctx context.Context, userID, taskID string) (*TaskHistory, error) {
+	task, err := s.findTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := s.activity.FindByTask(ctx, userID, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	if activity == nil {
+		activity = []models.TaskActivity{}
+	}
+
+	var started *time.Time
+	for _, entry := range activity {
+		if entry.Type == models.TaskActivityStatusChanged && activeStatus(entry.To) {
+			at := entry.CreatedAt
+			started = &at
+			break
+		}
+	}
+
+	return &TaskHistory{TaskFlow: taskFlow(task, started), Activity: activity}, nil
+}
+
+// FlowReport sums up the lead and cycle times of the tasks completed between
+// two yyyy-mm-dd days in the user's time zone, by default the last 30 days
+func (s *TaskService) FlowReport(ctx context.Context, userID, from, to string) (*FlowReport, error) {
+	loc := userLocation(s.profiles, userID)
+	start, end, err := trackingRange(from, to, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+	first, _ := time.ParseInLocation(journalDateLayout, start, loc)
+	last, _ := time.ParseInLocation(journalDateLayout, end, loc)
+
+	tasks, err := s.repo.FindCompleted(ctx, userID, first, last.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	starts, err := s.activity.FirstMoves(ctx, userID, ids, []string{"todo", "done"})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FlowReport{From: start, To: end, Timezone: loc.String(), Completed: len(tasks), Tasks: make([]TaskFlow, 0, len(tasks))}
+	var leadTimes, cycleTimes []int64
+	for i := range tasks {
+		var started *time.Time
+		if at, ok := starts[tasks[i].ID]; ok {
+			started = &at
+		}
+		flow := taskFlow(&tasks[i], started)
+		if flow.LeadTimeSeconds != nil {
+			leadTimes = append(leadTimes, *flow.LeadTimeSeconds)
+		}
+		if flow.CycleTimeSeconds != nil {
+			cycleTimes = append(cycleTimes, *flow.CycleTimeSeconds)
+		}
+		report.Tasks = append(report.Tasks, flow)
+	}
+	report.LeadTime = summarizeFlow(leadTimes)
+	report.CycleTime = summarizeFlow(cycleTimes)
+
+	return report, nil
+}
+
+// activeStatus reports whether a status means the task is being worked on
+func activeStatus(status string) bool {
+	return status != "todo" && status != "done"
+}
+
+func taskFlow(task *models.Task, started *time.Time) TaskFlow {
+	flow := TaskFlow{
+		TaskID:      task.ID,
+		Title:       task.Title,
+		Status:      task.Status,
+		CreatedAt:   task.CreatedAt,
+		StartedAt:   started,
+		CompletedAt: task.CompletedAt,
+	}
+	if task.CompletedAt == nil {
+		return flow
+	}
+
+	lead := int64(task.CompletedAt.Sub(task.CreatedAt).Seconds())
+	flow.LeadTimeSeconds = &lead
+	if started != nil && !started.After(*task.CompletedAt) {
+		cycle := int64(task.CompletedAt.Sub(*started).Seconds())
+		flow.CycleTimeSeconds = &cycle
+	}
+	return flow
+}
+
+func summarizeFlow(seconds []int64) FlowSummary {
+	summary := FlowSummary{Count: len(seconds)}
+	if len(seconds) == 0 {
+		return summary
+	}
+
+	sort.Slice(seconds, func(i, j int) bool { return seconds[i] < seconds[j] })
+	var total int64
+	for _, value := range seconds {
+		total += value
+	}
+	summary.AverageSeconds = total / int64(len(seconds))
+
+	mid := len(seconds) / 2
+	summary.MedianSeconds = seconds[mid]
+	if len(seconds)%2 == 0 {
+		summary.MedianSeconds = (seconds[mid-1] + seconds[mid]) / 2
+	}
+	return summary
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     error
+	}{
+		{"todo", "in_progress", nil},
+		{"todo", "review", nil},
+		{"todo", "todo", nil},
+		{"in_progress", "review", nil},
+		{"review", "in_progress", nil},
+		{"in_progress", "todo", nil},
+		{"in_progress", "done", nil},
+		{"review", "done", nil},
+		{"done", "in_progress", nil},
+		{"done", "review", nil},
+		{"done", "todo", nil},
+		{"done", "done", nil},
+
+		{"todo", "done", ErrInvalidTransition},
+		{"todo", "In Progress", ErrInvalidTaskStatus},
+		{"in_progress", "", ErrInvalidTaskStatus},
+		{"done", "9lives", ErrInvalidTaskStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			err := checkTransition(tt.from, tt.to)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("checkTransition(%q, %q) = %v, want nil", tt.from, tt.to, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("checkTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+			}
+		})
+	}
+}
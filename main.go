@@ -14,10 +14,13 @@ import (
 	"backend-journaling/internal/database"
 	"backend-journaling/internal/handlers"
 	"backend-journaling/internal/middleware"
+	"backend-journaling/internal/models"
 	"backend-journaling/internal/repository"
 	"backend-journaling/internal/service"
 	"backend-journaling/pkg/email"
 	"backend-journaling/pkg/jwt"
+	"backend-journaling/pkg/notify"
+	"backend-journaling/pkg/storage"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -64,6 +67,25 @@ func main() {
 		cfg.SMTP.FromName,
 	)
 
+	var blobStorage storage.Storage
+	switch cfg.Storage.Driver {
+	case "s3":
+		blobStorage, err = storage.NewS3Storage(
+			cfg.Storage.S3Endpoint,
+			cfg.Storage.S3Bucket,
+			cfg.Storage.S3Region,
+			cfg.Storage.S3AccessKey,
+			cfg.Storage.S3SecretKey,
+		)
+	case "local":
+		blobStorage, err = storage.NewLocalStorage(cfg.Storage.LocalPath)
+	default:
+		err = fmt.Errorf("unknown STORAGE_DRIVER %q", cfg.Storage.Driver)
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	otpRepo := repository.NewOTPRepository(db)
 	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
@@ -71,10 +93,68 @@ func main() {
 	profileRepo := repository.NewProfileRepository(db)
 
 	noteRepo := repository.NewNoteRepository(mongoDatabase)
+	noteLinkRepo := repository.NewNoteLinkRepository(mongoDatabase)
 	todoRepo := repository.NewTodoRepository(mongoDatabase)
+	todoListRepo := repository.NewTodoListRepository(mongoDatabase)
+	boardRepo := repository.NewBoardRepository(mongoDatabase)
+	taskActivityRepo := repository.NewTaskActivityRepository(mongoDatabase)
+	timeEntryRepo := repository.NewTimeEntryRepository(mongoDatabase)
 	taskRepo := repository.NewTaskRepository(mongoDatabase)
+	lockRepo := repository.NewLockRepository(mongoDatabase)
 	noteGroupRepo := repository.NewNoteGroupRepository(mongoDatabase)
+	tagRepo := repository.NewTagRepository(mongoDatabase)
+	attachmentRepo := repository.NewAttachmentRepository(mongoDatabase)
+	templateRepo := repository.NewNoteTemplateRepository(mongoDatabase)
+	dailyLogRepo := repository.NewDailyLogRepository(mongoDatabase)
+	habitRepo := repository.NewHabitRepository(mongoDatabase)
+	statsRepo := repository.NewStatsRepository(mongoDatabase)
+	shareLinkRepo := repository.NewShareLinkRepository(mongoDatabase)
+	collaboratorRepo := repository.NewCollaboratorRepository(mongoDatabase)
+	commentRepo := repository.NewCommentRepository(mongoDatabase)
+	reminderRepo := repository.NewReminderRepository(mongoDatabase)
+	notificationRepo := repository.NewNotificationRepository(mongoDatabase)
+
+	if err := noteRepo.EnsureJournalIndex(context.Background()); err != nil {
+		log.Fatalf("Failed to create journal index: %v", err)
+	}
+	if err := dailyLogRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create daily log indexes: %v", err)
+	}
+	if err := shareLinkRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create share link indexes: %v", err)
+	}
+	if err := collaboratorRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create collaborator indexes: %v", err)
+	}
+	if err := commentRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create comment indexes: %v", err)
+	}
+	if err := reminderRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create reminder indexes: %v", err)
+	}
+	if err := notificationRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create notification indexes: %v", err)
+	}
+	if err := todoRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create todo indexes: %v", err)
+	}
+	if err := taskRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create task indexes: %v", err)
+	}
+	if err := todoListRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create todo list indexes: %v", err)
+	}
+	if err := boardRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create board indexes: %v", err)
+	}
+	if err := taskActivityRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create task activity indexes: %v", err)
+	}
+	if err := timeEntryRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to create time entry indexes: %v", err)
+	}
 
+	notificationService := service.NewNotificationService(notificationRepo)
 	authService := service.NewAuthService(
 		userRepo,
 		otpRepo,
@@ -82,20 +162,63 @@ func main() {
 		authEventRepo,
 		jwtManager,
 		emailSender,
+		notificationService,
 		cfg,
 	)
 
-	noteService := service.NewNoteService(noteRepo)
-	todoService := service.NewTodoService(todoRepo)
-	taskService := service.NewTaskService(taskRepo)
-	noteGroupService := service.NewNoteGroupService(noteGroupRepo)
+	statsCache := service.NewStatsCache(cfg)
+	accessService := service.NewAccessService(noteRepo, noteGroupRepo, collaboratorRepo)
+	attachmentService := service.NewAttachmentService(attachmentRepo, blobStorage, cfg)
+	templateService := service.NewTemplateService(templateRepo, noteRepo, userRepo, profileRepo)
+	noteService := service.NewNoteService(noteRepo, noteLinkRepo, attachmentService, templateService, accessService, commentRepo, statsCache)
+	reminderService := service.NewReminderService(reminderRepo, todoRepo, taskRepo, profileRepo)
+	todoListService := service.NewTodoListService(todoListRepo, todoRepo, statsCache)
+	todoService := service.NewTodoService(todoRepo, todoListService, profileRepo, reminderService, statsCache)
+	recurrenceService := service.NewRecurrenceService(profileRepo)
+	timeService := service.NewTimeService(timeEntryRepo, taskRepo, profileRepo)
+	taskService := service.NewTaskService(taskRepo, taskActivityRepo, boardRepo, lockRepo, profileRepo, reminderService, notificationService, timeService, statsCache)
+	boardService := service.NewBoardService(boardRepo, taskService)
+	noteGroupService := service.NewNoteGroupService(noteGroupRepo, accessService, statsCache)
+	tagService := service.NewTagService(tagRepo, statsCache)
+	journalService := service.NewJournalService(noteService, profileRepo)
+	trackingService := service.NewTrackingService(dailyLogRepo, habitRepo, noteRepo, profileRepo)
+	statsService := service.NewStatsService(statsRepo, tagService, profileRepo, statsCache)
+	shareService := service.NewShareService(shareLinkRepo, noteRepo, noteGroupRepo)
+	collabService := service.NewCollabService(noteService)
+	collaboratorService := service.NewCollaboratorService(collaboratorRepo, accessService, noteRepo, noteGroupRepo, userRepo, notificationService, collabService)
+	commentService := service.NewCommentService(commentRepo, noteService, accessService, userRepo, notificationService)
+
+	reminderScheduler := service.NewReminderScheduler(reminderRepo, todoRepo, taskRepo, userRepo, profileRepo, map[string]notify.Notifier{
+		models.ChannelInApp:   notificationService,
+		models.ChannelEmail:   notify.NewEmailNotifier(emailSender),
+		models.ChannelWebhook: notify.NewWebhookNotifier(cfg.Reminder.WebhookSecret, cfg.Reminder.WebhookTimeout),
+	}, cfg)
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go reminderScheduler.Run(schedulerCtx)
 
 	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userRepo, profileRepo, authService)
+	userHandler := handlers.NewUserHandler(userRepo, profileRepo, authService, attachmentService)
 	noteHandler := handlers.NewNoteHandler(noteService)
 	todoHandler := handlers.NewTodoHandler(todoService)
+	todoListHandler := handlers.NewTodoListHandler(todoListService)
 	taskHandler := handlers.NewTaskHandler(taskService)
+	timeHandler := handlers.NewTimeHandler(timeService)
+	boardHandler := handlers.NewBoardHandler(boardService)
+	recurrenceHandler := handlers.NewRecurrenceHandler(recurrenceService)
 	noteGroupHandler := handlers.NewNoteGroupHandler(noteGroupService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
+	journalHandler := handlers.NewJournalHandler(journalService)
+	templateHandler := handlers.NewTemplateHandler(templateService)
+	trackingHandler := handlers.NewTrackingHandler(trackingService)
+	statsHandler := handlers.NewStatsHandler(statsService)
+	shareHandler := handlers.NewShareHandler(shareService)
+	collaboratorHandler := handlers.NewCollaboratorHandler(collaboratorService)
+	commentHandler := handlers.NewCommentHandler(commentService)
+	reminderHandler := handlers.NewReminderHandler(reminderService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	collabHandler := handlers.NewCollabHandler(collabService, cfg.CORS.AllowedOrigins)
 
 	r := chi.NewRouter()
 
@@ -156,13 +279,75 @@ func main() {
 			r.Use(middleware.Authenticate(jwtManager))
 			r.Get("/", noteHandler.GetNotes)
 			r.Post("/", noteHandler.CreateNote)
+			r.Post("/import", noteHandler.ImportNotes)
+			r.Get("/dangling-links", noteHandler.GetDanglingLinks)
 			r.Get("/{id}", noteHandler.GetNote)
+			r.Get("/{id}/export", noteHandler.ExportNote)
+			r.Get("/{id}/links", noteHandler.GetLinks)
+			r.Get("/{id}/backlinks", noteHandler.GetBacklinks)
 			r.Patch("/{id}", noteHandler.UpdateNote)
 			r.Delete("/{id}", noteHandler.DeleteNote)
 			r.Post("/{id}/blocks", noteHandler.AddBlock)
 			r.Patch("/{id}/blocks/{blockId}", noteHandler.UpdateBlock)
 			r.Delete("/{id}/blocks/{blockId}", noteHandler.DeleteBlock)
 			r.Patch("/{id}/blocks/order", noteHandler.ReorderBlocks)
+			r.Get("/{id}/blocks/tree", noteHandler.GetBlockTree)
+			r.Post("/{id}/blocks/transfer", noteHandler.TransferBlocks)
+			r.Post("/{id}/blocks/{blockId}/move", noteHandler.MoveBlock)
+			r.Post("/{id}/blocks/{blockId}/indent", noteHandler.IndentBlock)
+			r.Post("/{id}/blocks/{blockId}/outdent", noteHandler.OutdentBlock)
+			r.Get("/{id}/share", shareHandler.GetNoteShare)
+			r.Put("/{id}/share", shareHandler.PutNoteShare)
+			r.Delete("/{id}/share", shareHandler.DeleteNoteShare)
+			r.Get("/{id}/collaborators", collaboratorHandler.GetNoteCollaborators)
+			r.Post("/{id}/collaborators", collaboratorHandler.AddNoteCollaborator)
+			r.Patch("/{id}/collaborators/{userId}", collaboratorHandler.UpdateNoteCollaborator)
+			r.Delete("/{id}/collaborators/{userId}", collaboratorHandler.RemoveNoteCollaborator)
+			r.Get("/{id}/comments", commentHandler.GetComments)
+			r.Post("/{id}/comments", commentHandler.CreateComment)
+			r.Patch("/{id}/comments/{commentId}", commentHandler.UpdateComment)
+			r.Delete("/{id}/comments/{commentId}", commentHandler.DeleteComment)
+			r.Post("/{id}/comments/{commentId}/resolve", commentHandler.ResolveComment)
+			r.Post("/{id}/comments/{commentId}/unresolve", commentHandler.UnresolveComment)
+		})
+
+		// Live collaborative editing of a note over WebSocket (authenticated,
+		// the token may be passed as a subprotocol)
+		r.With(middleware.AuthenticateWebSocket(jwtManager)).Get("/notes/{id}/ws", collabHandler.Connect)
+
+		// Journal endpoints (authenticated)
+		r.Route("/journal", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/calendar", journalHandler.GetCalendar)
+			r.Get("/{date}", journalHandler.GetEntry)
+			r.Put("/{date}", journalHandler.PutEntry)
+		})
+
+		// Mood & habit tracking endpoints (authenticated)
+		r.Route("/tracking", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/habits", trackingHandler.GetHabits)
+			r.Post("/habits", trackingHandler.CreateHabit)
+			r.Patch("/habits/{id}", trackingHandler.UpdateHabit)
+			r.Delete("/habits/{id}", trackingHandler.DeleteHabit)
+			r.Get("/days", trackingHandler.GetDays)
+			r.Get("/days/{date}", trackingHandler.GetDay)
+			r.Put("/days/{date}", trackingHandler.PutDay)
+			r.Delete("/days/{date}", trackingHandler.DeleteDay)
+			r.Get("/summary", trackingHandler.GetSummary)
+		})
+
+		// Stats endpoint (authenticated)
+		r.With(middleware.Authenticate(jwtManager)).Get("/stats", statsHandler.GetStats)
+
+		// Templates endpoints (authenticated)
+		r.Route("/templates", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", templateHandler.GetTemplates)
+			r.Post("/", templateHandler.CreateTemplate)
+			r.Get("/{id}", templateHandler.GetTemplate)
+			r.Patch("/{id}", templateHandler.UpdateTemplate)
+			r.Delete("/{id}", templateHandler.DeleteTemplate)
 		})
 
 		// Todos endpoints (authenticated)
@@ -170,18 +355,125 @@ func main() {
 			r.Use(middleware.Authenticate(jwtManager))
 			r.Get("/", todoHandler.GetTodos)
 			r.Post("/", todoHandler.CreateTodo)
+			r.Get("/views/{view}", todoHandler.GetTodoView)
+			r.Post("/move", todoHandler.MoveTodos)
 			r.Patch("/{id}", todoHandler.UpdateTodo)
+			r.Post("/{id}/skip", todoHandler.SkipTodoOccurrence)
+			r.Post("/{id}/move", todoHandler.MoveTodo)
 			r.Delete("/{id}", todoHandler.DeleteTodo)
 		})
 
+		// Todo lists endpoints (authenticated)
+		r.Route("/todo-lists", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", todoListHandler.GetLists)
+			r.Post("/", todoListHandler.CreateList)
+			r.Get("/{id}", todoListHandler.GetList)
+			r.Patch("/{id}", todoListHandler.UpdateList)
+			r.Delete("/{id}", todoListHandler.DeleteList)
+			r.Post("/{id}/move", todoListHandler.MoveList)
+			r.Get("/{id}/todos", todoListHandler.GetListTodos)
+		})
+
 		// Tasks endpoints (authenticated)
 		r.Route("/tasks", func(r chi.Router) {
 			r.Use(middleware.Authenticate(jwtManager))
 			r.Get("/", taskHandler.GetTasks)
 			r.Post("/", taskHandler.CreateTask)
+			r.Get("/flow", taskHandler.GetFlowReport)
+			r.Get("/graph", taskHandler.GetDependencyGraph)
 			r.Get("/{id}", taskHandler.GetTask)
 			r.Patch("/{id}", taskHandler.UpdateTask)
+			r.Post("/{id}/skip", taskHandler.SkipTaskOccurrence)
 			r.Delete("/{id}", taskHandler.DeleteTask)
+			r.Get("/{id}/activity", taskHandler.GetTaskActivity)
+			r.Get("/{id}/dependencies", taskHandler.GetDependencies)
+			r.Post("/{id}/dependencies", taskHandler.AddDependency)
+			r.Delete("/{id}/dependencies/{prerequisiteId}", taskHandler.RemoveDependency)
+			r.Get("/{id}/time", timeHandler.GetTaskTime)
+			r.Post("/{id}/time", timeHandler.AddTimeEntry)
+			r.Post("/{id}/time/start", timeHandler.StartTimer)
+			r.Post("/{id}/time/stop", timeHandler.StopTimer)
+			r.Patch("/{id}/time/{entryId}", timeHandler.UpdateTimeEntry)
+			r.Delete("/{id}/time/{entryId}", timeHandler.DeleteTimeEntry)
+			r.Get("/{id}/subtasks", taskHandler.GetSubtasks)
+			r.Post("/{id}/subtasks", taskHandler.CreateSubtask)
+			r.Patch("/{id}/subtasks/order", taskHandler.ReorderSubtasks)
+			r.Post("/{id}/subtasks/{subtaskId}/move", taskHandler.MoveSubtask)
+			r.Post("/{id}/checklist", taskHandler.AddChecklistItem)
+			r.Patch("/{id}/checklist/order", taskHandler.ReorderChecklist)
+			r.Patch("/{id}/checklist/{itemId}", taskHandler.UpdateChecklistItem)
+			r.Delete("/{id}/checklist/{itemId}", taskHandler.DeleteChecklistItem)
+		})
+
+		// Timesheet endpoints (authenticated)
+		r.Route("/timesheets", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", timeHandler.GetTimesheet)
+			r.Get("/export", timeHandler.ExportTimesheet)
+			r.Get("/timer", timeHandler.GetTimer)
+		})
+
+		// Kanban boards endpoints (authenticated)
+		r.Route("/boards", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", boardHandler.GetBoards)
+			r.Post("/", boardHandler.CreateBoard)
+			r.Get("/{id}", boardHandler.GetBoard)
+			r.Patch("/{id}", boardHandler.UpdateBoard)
+			r.Delete("/{id}", boardHandler.DeleteBoard)
+			r.Post("/{id}/move", boardHandler.MoveTask)
+		})
+
+		// Recurrence preview (authenticated)
+		r.With(middleware.Authenticate(jwtManager)).Post("/recurrence/preview", recurrenceHandler.Preview)
+
+		// Reminders endpoints (authenticated)
+		r.Route("/reminders", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", reminderHandler.GetReminders)
+			r.Post("/", reminderHandler.CreateReminder)
+			r.Get("/{id}", reminderHandler.GetReminder)
+			r.Patch("/{id}", reminderHandler.UpdateReminder)
+			r.Delete("/{id}", reminderHandler.DeleteReminder)
+		})
+
+		// In-app notifications endpoints (authenticated). The stream accepts
+		// the token as a query parameter because EventSource cannot send
+		// headers.
+		r.Route("/notifications", func(r chi.Router) {
+			r.With(middleware.AuthenticateEventStream(jwtManager)).Get("/stream", notificationHandler.Stream)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Authenticate(jwtManager))
+				r.Get("/", notificationHandler.GetNotifications)
+				r.Get("/unread-count", notificationHandler.GetUnreadCount)
+				r.Post("/read-all", notificationHandler.MarkAllRead)
+				r.Patch("/{id}", notificationHandler.UpdateNotification)
+				r.Delete("/{id}", notificationHandler.DeleteNotification)
+			})
+		})
+
+		// Tags endpoints (authenticated)
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(middleware.Authenticate(jwtManager))
+			r.Get("/", tagHandler.GetTags)
+			r.Post("/merge", tagHandler.MergeTags)
+			r.Patch("/{name}", tagHandler.UpdateTag)
+		})
+
+		// Attachments endpoints (authenticated, except signed downloads)
+		r.Route("/attachments", func(r chi.Router) {
+			r.Get("/{id}/content", attachmentHandler.DownloadAttachment)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Authenticate(jwtManager))
+				r.Get("/", attachmentHandler.GetAttachments)
+				r.Post("/", attachmentHandler.UploadAttachment)
+				r.Get("/usage", attachmentHandler.GetUsage)
+				r.Get("/{id}", attachmentHandler.GetAttachment)
+				r.Delete("/{id}", attachmentHandler.DeleteAttachment)
+			})
 		})
 
 		// Note Groups endpoints (authenticated)
@@ -198,6 +490,28 @@ func main() {
 			r.Delete("/notes/{noteId}", noteGroupHandler.RemoveNoteFromGroup)
 			r.Post("/{id}/move-notes", noteGroupHandler.MoveNotesToGroup)
 			r.Get("/{id}/notes", noteGroupHandler.GetNotesInGroup)
+			r.Get("/{id}/export", noteGroupHandler.ExportGroup)
+			r.Get("/{id}/share", shareHandler.GetGroupShare)
+			r.Put("/{id}/share", shareHandler.PutGroupShare)
+			r.Delete("/{id}/share", shareHandler.DeleteGroupShare)
+			r.Get("/{id}/collaborators", collaboratorHandler.GetGroupCollaborators)
+			r.Post("/{id}/collaborators", collaboratorHandler.AddGroupCollaborator)
+			r.Patch("/{id}/collaborators/{userId}", collaboratorHandler.UpdateGroupCollaborator)
+			r.Delete("/{id}/collaborators/{userId}", collaboratorHandler.RemoveGroupCollaborator)
+		})
+
+		// Shared items endpoint (authenticated)
+		r.With(middleware.Authenticate(jwtManager)).Get("/shares", shareHandler.GetShares)
+
+		// Notes and groups other users shared with the user (authenticated)
+		r.With(middleware.Authenticate(jwtManager)).Get("/shared-with-me", collaboratorHandler.GetSharedWithMe)
+
+		// Public share links (unauthenticated, rate limited against password
+		// guessing)
+		r.Route("/public", func(r chi.Router) {
+			r.Use(middleware.RateLimit(60, time.Minute))
+			r.Get("/{token}", shareHandler.ViewShare)
+			r.Post("/{token}", shareHandler.ViewShare)
 		})
 	})
 
@@ -222,6 +536,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopScheduler()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -2,7 +2,9 @@ package email
 
 import (
 	"fmt"
+	"html"
 	"net/smtp"
+	"strings"
 )
 
 type Sender interface {
@@ -30,8 +32,18 @@ func NewSMTPSender(host string, port int, username, password, fromEmail, fromNam
 }
 
 func (s *SMTPSender) SendOTP(to, otp, purpose string) error {
-	subject := s.getSubject(purpose)
-	body := s.getBody(otp, purpose)
+	return s.send(to, s.getSubject(purpose), s.getBody(otp, purpose))
+}
+
+// SendNotification emails a notification such as a reminder. The text is
+// escaped and its line breaks kept.
+func (s *SMTPSender) SendNotification(to, subject, text string) error {
+	return s.send(to, subject, s.getNotificationBody(subject, text))
+}
+
+func (s *SMTPSender) send(to, subject, body string) error {
+	// Subjects may carry user text; line breaks would start new headers
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
 
 	message := fmt.Sprintf("From: %s <%s>\r\n", s.fromName, s.fromEmail)
 	message += fmt.Sprintf("To: %s\r\n", to)
@@ -95,3 +107,23 @@ func (s *SMTPSender) getBody(otp, purpose string) string {
 </html>
 `, action, otp)
 }
+
+func (s *SMTPSender) getNotificationBody(subject, text string) string {
+	paragraph := strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>%s</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin: 20px 0;">
+        <h2 style="color: #007bff; margin-top: 0;">%s</h2>
+        <p>%s</p>
+    </div>
+</body>
+</html>
+`, html.EscapeString(subject), html.EscapeString(subject), paragraph)
+}
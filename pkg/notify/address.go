@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// ErrPrivateAddress is returned for webhooks that point at the server's own
+// network instead of the public internet
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// nonPublicNets are the special purpose ranges the net package has no
+// predicate for: "this network", carrier-grade NAT (which also hosts some
+// cloud metadata services) and benchmarking
+var nonPublicNets = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("198.18.0.0/15"),
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// PublicIP reports whether a webhook may be delivered to ip. Loopback,
+// private, link-local (which includes the 169.254.169.254 metadata
+// endpoint), multicast and unspecified addresses are refused.
+func PublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNets {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckWebhookURL resolves the host of a webhook URL and refuses it when any
+// of its addresses is not public. The notifier checks the address it
+// connects to again, since DNS may answer differently by then.
+func CheckWebhookURL(ctx context.Context, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !PublicIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !PublicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialPublic refuses connections to non-public addresses. It runs after
+// name resolution, for every address the dialer tries.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
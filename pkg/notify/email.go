@@ -0,0 +1,23 @@
+package notify
+
+import "context"
+
+// Mailer sends a plain notification email
+type Mailer interface {
+	SendNotification(to, subject, body string) error
+}
+
+type EmailNotifier struct {
+	mailer Mailer
+}
+
+func NewEmailNotifier(mailer Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.Email == "" {
+		return ErrNoRecipient
+	}
+	return n.mailer.SendNotification(msg.Email, msg.Title, msg.Body)
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoRecipient  = errors.New("the user has no email address")
+	ErrNoWebhookURL = errors.New("no webhook URL to deliver to")
+)
+
+// Message is a notification for one user
+type Message struct {
+	// ID stays the same when a delivery is retried, so receivers can drop
+	// duplicates
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Type         string    `json:"type"`
+	Title        string    `json:"title"`
+	Body         string    `json:"body"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	ResourceID   string    `json:"resource_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Email and WebhookURL address the email and webhook channels
+	Email      string `json:"-"`
+	WebhookURL string `json:"-"`
+}
+
+// Notifier delivers messages over one channel
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts messages as JSON. When a secret is set, the body is
+// signed with HMAC-SHA256 in the X-Signature-256 header ("sha256=<hex>").
+type WebhookNotifier struct {
+	client *http.Client
+	secret string
+}
+
+// NewWebhookNotifier delivers to public addresses only; see PublicIP
+func NewWebhookNotifier(secret string, timeout time.Duration) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be the address checked instead of the webhook's
+	transport.Proxy = nil
+
+	return &WebhookNotifier{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// A redirect is reported as a failed delivery rather than
+			// followed to wherever it points
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		secret: secret,
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.WebhookURL == "" {
+		return ErrNoWebhookURL
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-ID", msg.ID)
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,613 @@
+// Package rrule parses RFC 5545 recurrence rules and expands them into
+// occurrences. It supports the parts used for day based schedules: FREQ
+// (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY,
+// BYMONTH, BYSETPOS and WKST. Occurrences keep the wall clock time of the
+// start in its location, so they stay at the same local time across DST.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRule     = errors.New("invalid recurrence rule")
+	ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+)
+
+// maxPeriods bounds the periods scanned for occurrences, so rules that can
+// never match (such as February 30) end instead of looping forever
+const maxPeriods = 100000
+
+type Frequency int
+
+const (
+	Yearly Frequency = iota
+	Monthly
+	Weekly
+	Daily
+)
+
+var frequencyNames = map[Frequency]string{
+	Yearly:  "YEARLY",
+	Monthly: "MONTHLY",
+	Weekly:  "WEEKLY",
+	Daily:   "DAILY",
+}
+
+var weekdayNames = map[time.Weekday]string{
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+	time.Sunday:    "SU",
+}
+
+// WeekdayNum is a BYDAY entry: a weekday, optionally the Nth (or with a
+// negative N, the Nth last) of the month or year
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a parsed RRULE
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+
+	// untilFloating marks an UNTIL without a UTC designator, read in the
+	// location of the start
+	untilFloating bool
+}
+
+// Parse reads a rule such as "FREQ=MONTHLY;BYDAY=-1FR". A leading "RRULE:"
+// is accepted.
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimSpace(value)
+	if len(value) >= 6 && strings.EqualFold(value[:6], "RRULE:") {
+		value = value[6:]
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := make(map[string]bool)
+	hasFreq := false
+
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		val = strings.ToUpper(strings.TrimSpace(val))
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s given twice", ErrInvalidRule, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			hasFreq = true
+			rule.Freq, err = parseFrequency(val)
+		case "INTERVAL":
+			rule.Interval, err = parseInt(key, val, 1, 10000)
+		case "COUNT":
+			rule.Count, err = parseInt(key, val, 1, 100000)
+		case "UNTIL":
+			err = rule.parseUntil(val)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(val)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseIntList(key, val, 1, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(key, val, 1, 12)
+			for _, m := range months {
+				if m < 0 {
+					err = fmt.Errorf("%w: BYMONTH %d", ErrInvalidRule, m)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			rule.BySetPos, err = parseIntList(key, val, 1, 366)
+		case "WKST":
+			var day WeekdayNum
+			day, err = parseWeekday(val)
+			if err == nil && day.N != 0 {
+				err = fmt.Errorf("%w: WKST %s", ErrInvalidRule, val)
+			}
+			rule.WeekStart = day.Weekday
+		case "BYHOUR", "BYMINUTE", "BYSECOND", "BYYEARDAY", "BYWEEKNO":
+			err = fmt.Errorf("%w: %s", ErrUnsupportedRule, key)
+		default:
+			err = fmt.Errorf("%w: unknown part %s", ErrInvalidRule, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasFreq {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot be combined", ErrInvalidRule)
+	}
+	if len(rule.BySetPos) > 0 && len(rule.ByDay) == 0 && len(rule.ByMonthDay) == 0 && len(rule.ByMonth) == 0 {
+		return nil, fmt.Errorf("%w: BYSETPOS needs another BY part", ErrInvalidRule)
+	}
+	if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+		return nil, fmt.Errorf("%w: BYMONTHDAY cannot be used with FREQ=WEEKLY", ErrInvalidRule)
+	}
+	for _, day := range rule.ByDay {
+		if day.N == 0 {
+			continue
+		}
+		if rule.Freq == Weekly || rule.Freq == Daily {
+			return nil, fmt.Errorf("%w: numbered BYDAY needs FREQ=MONTHLY or YEARLY", ErrInvalidRule)
+		}
+		if rule.Freq == Monthly && (day.N > 5 || day.N < -5) {
+			return nil, fmt.Errorf("%w: BYDAY %d is out of range for a month", ErrInvalidRule, day.N)
+		}
+	}
+
+	return rule, nil
+}
+
+// String formats the rule in canonical form, without the "RRULE:" prefix
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + frequencyNames[r.Freq]}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.untilFloating {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = weekdayNames[day.Weekday]
+			if day.N != 0 {
+				days[i] = strconv.Itoa(day.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Iterate calls fn with every occurrence from start onwards, in order, until
+// fn returns false or the rule ends. Occurrences are in start's location. The
+// start itself is only an occurrence when it matches the rule.
+func (r *Rule) Iterate(start time.Time, fn func(time.Time) bool) {
+	loc := start.Location()
+	hour, min, sec := start.Clock()
+	until := r.Until
+	if r.untilFloating {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, loc)
+	}
+
+	first := civil(start.Year(), start.Month(), start.Day())
+	count := 0
+
+	for period := 0; period < maxPeriods; period++ {
+		days, ok := r.period(first, period)
+		if !ok {
+			return
+		}
+		for _, day := range days {
+			t := time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, start.Nanosecond(), loc)
+			if t.Before(start) {
+				continue
+			}
+			if !until.IsZero() && t.After(until) {
+				return
+			}
+			if !fn(t) {
+				return
+			}
+			count++
+			if r.Count > 0 && count >= r.Count {
+				return
+			}
+		}
+	}
+}
+
+// Next returns the first occurrence strictly after t
+func (r *Rule) Next(start, t time.Time) (time.Time, bool) {
+	var next time.Time
+	r.Iterate(start, func(occurrence time.Time) bool {
+		if occurrence.After(t) {
+			next = occurrence
+			return false
+		}
+		return true
+	})
+	return next, !next.IsZero()
+}
+
+// All returns up to limit occurrences from start onwards
+func (r *Rule) All(start time.Time, limit int) []time.Time {
+	var occurrences []time.Time
+	if limit <= 0 {
+		return occurrences
+	}
+	r.Iterate(start, func(occurrence time.Time) bool {
+		occurrences = append(occurrences, occurrence)
+		return len(occurrences) < limit
+	})
+	return occurrences
+}
+
+// period returns the matching days of the nth period after the one holding
+// first, as UTC midnights in order
+func (r *Rule) period(first time.Time, n int) ([]time.Time, bool) {
+	var days []time.Time
+
+	switch r.Freq {
+	case Yearly:
+		year := first.Year() + n*r.Interval
+		if year > 9999 {
+			return nil, false
+		}
+		days = r.yearDays(year, first)
+	case Monthly:
+		index := int(first.Month()) - 1 + n*r.Interval
+		year, month := first.Year()+index/12, time.Month(index%12+1)
+		if year > 9999 {
+			return nil, false
+		}
+		if r.monthAllowed(month) {
+			days = r.monthDays(year, month, first)
+		}
+	case Weekly:
+		offset := (int(first.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := first.AddDate(0, 0, n*7*r.Interval-offset)
+		if weekStart.Year() > 9999 {
+			return nil, false
+		}
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if r.weekdayMatches(day, first) && r.monthAllowed(day.Month()) {
+				days = append(days, day)
+			}
+		}
+	case Daily:
+		day := first.AddDate(0, 0, n*r.Interval)
+		if day.Year() > 9999 {
+			return nil, false
+		}
+		if r.monthAllowed(day.Month()) && r.monthDayMatches(day) && r.weekdayAllowed(day) {
+			days = append(days, day)
+		}
+	}
+
+	return r.setPos(days), true
+}
+
+func (r *Rule) yearDays(year int, first time.Time) []time.Time {
+	if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if day, ok := validDate(year, first.Month(), first.Day()); ok {
+			return []time.Time{day}
+		}
+		return nil
+	}
+
+	months := r.ByMonth
+	if len(months) == 0 {
+		months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	}
+
+	var days []time.Time
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, month := range months {
+			days = append(days, r.monthDaysByNumber(year, month)...)
+		}
+	case len(r.ByDay) > 0 && len(r.ByMonth) > 0:
+		for _, month := range months {
+			days = append(days, expandByDay(r.ByDay, civil(year, month, 1), civil(year, month+1, 0))...)
+		}
+	case len(r.ByDay) > 0:
+		days = expandByDay(r.ByDay, civil(year, 1, 1), civil(year, 12, 31))
+	default:
+		for _, month := range months {
+			if day, ok := validDate(year, month, first.Day()); ok {
+				days = append(days, day)
+			}
+		}
+	}
+
+	return sortDays(days)
+}
+
+func (r *Rule) monthDays(year int, month time.Month, first time.Time) []time.Time {
+	switch {
+	case len(r.ByMonthDay) > 0:
+		return sortDays(r.monthDaysByNumber(year, month))
+	case len(r.ByDay) > 0:
+		return expandByDay(r.ByDay, civil(year, month, 1), civil(year, month+1, 0))
+	default:
+		if day, ok := validDate(year, month, first.Day()); ok {
+			return []time.Time{day}
+		}
+		return nil
+	}
+}
+
+// monthDaysByNumber resolves BYMONTHDAY in a month, limited by BYDAY
+func (r *Rule) monthDaysByNumber(year int, month time.Month) []time.Time {
+	length := civil(year, month+1, 0).Day()
+
+	var days []time.Time
+	for _, n := range r.ByMonthDay {
+		if n < 0 {
+			n = length + n + 1
+		}
+		if n < 1 || n > length {
+			continue
+		}
+		day := civil(year, month, n)
+		if r.weekdayAllowed(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+func (r *Rule) monthAllowed(month time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) monthDayMatches(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := civil(day.Year(), day.Month()+1, 0).Day()
+	for _, n := range r.ByMonthDay {
+		if n == day.Day() || (n < 0 && length+n+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdayAllowed reports whether BYDAY, ignoring ordinals, allows the day
+func (r *Rule) weekdayAllowed(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdayMatches picks the days of a weekly period: BYDAY, or the weekday of
+// the start
+func (r *Rule) weekdayMatches(day, first time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return day.Weekday() == first.Weekday()
+	}
+	return r.weekdayAllowed(day)
+}
+
+func (r *Rule) setPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+
+	var picked []time.Time
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) {
+			picked = append(picked, days[i])
+		}
+	}
+	return sortDays(picked)
+}
+
+// expandByDay lists the days in [from, to] matching BYDAY; numbered entries
+// count from the start (or end) of the range
+func expandByDay(byDay []WeekdayNum, from, to time.Time) []time.Time {
+	var days []time.Time
+	for _, d := range byDay {
+		switch {
+		case d.N == 0:
+			day := from.AddDate(0, 0, (int(d.Weekday)-int(from.Weekday())+7)%7)
+			for ; !day.After(to); day = day.AddDate(0, 0, 7) {
+				days = append(days, day)
+			}
+		case d.N > 0:
+			day := from.AddDate(0, 0, (int(d.Weekday)-int(from.Weekday())+7)%7+(d.N-1)*7)
+			if !day.After(to) {
+				days = append(days, day)
+			}
+		default:
+			day := to.AddDate(0, 0, -((int(to.Weekday())-int(d.Weekday)+7)%7)+(d.N+1)*7)
+			if !day.Before(from) {
+				days = append(days, day)
+			}
+		}
+	}
+	return sortDays(days)
+}
+
+// sortDays sorts days and drops duplicates
+func sortDays(days []time.Time) []time.Time {
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	unique := days[:0]
+	for i, day := range days {
+		if i == 0 || !day.Equal(days[i-1]) {
+			unique = append(unique, day)
+		}
+	}
+	return unique
+}
+
+// civil is a calendar day as UTC midnight; out of range values normalise like
+// time.Date, so day 0 is the last day of the previous month
+func civil(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func validDate(year int, month time.Month, day int) (time.Time, bool) {
+	date := civil(year, month, day)
+	return date, date.Month() == month
+}
+
+func (r *Rule) parseUntil(val string) error {
+	layouts := []struct {
+		layout   string
+		floating bool
+	}{
+		{"20060102T150405Z", false},
+		{"20060102T150405", true},
+		{"20060102", true},
+	}
+	for _, l := range layouts {
+		t, err := time.Parse(l.layout, val)
+		if err != nil {
+			continue
+		}
+		if l.layout == "20060102" {
+			// A date bound includes the whole day
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		r.Until, r.untilFloating = t, l.floating
+		return nil
+	}
+	return fmt.Errorf("%w: UNTIL %s", ErrInvalidRule, val)
+}
+
+func parseFrequency(val string) (Frequency, error) {
+	for freq, name := range frequencyNames {
+		if name == val {
+			return freq, nil
+		}
+	}
+	switch val {
+	case "HOURLY", "MINUTELY", "SECONDLY":
+		return 0, fmt.Errorf("%w: FREQ=%s", ErrUnsupportedRule, val)
+	}
+	return 0, fmt.Errorf("%w: FREQ=%s", ErrInvalidRule, val)
+}
+
+func parseByDay(val string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(val, ",") {
+		day, err := parseWeekday(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func parseWeekday(val string) (WeekdayNum, error) {
+	if len(val) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: weekday %q", ErrInvalidRule, val)
+	}
+
+	name, number := val[len(val)-2:], val[:len(val)-2]
+	for weekday, n := range weekdayNames {
+		if n != name {
+			continue
+		}
+		if number == "" {
+			return WeekdayNum{Weekday: weekday}, nil
+		}
+		num, err := strconv.Atoi(number)
+		if err != nil || num == 0 || num > 53 || num < -53 {
+			return WeekdayNum{}, fmt.Errorf("%w: weekday %q", ErrInvalidRule, val)
+		}
+		return WeekdayNum{Weekday: weekday, N: num}, nil
+	}
+	return WeekdayNum{}, fmt.Errorf("%w: weekday %q", ErrInvalidRule, val)
+}
+
+func parseInt(key, val string, min, max int) (int, error) {
+	n, err := strconv.Atoi(val)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%w: %s=%s", ErrInvalidRule, key, val)
+	}
+	return n, nil
+}
+
+// parseIntList reads a list of values in [-max, -min] or [min, max]
+func parseIntList(key, val string, min, max int) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(val, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || n == 0 || n > max || n < -max || (n > 0 && n < min) || (n < 0 && -n < min) {
+			return nil, fmt.Errorf("%w: %s=%s", ErrInvalidRule, key, val)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func joinInts(list []int) string {
+	parts := make([]string, len(list))
+	for i, n := range list {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,183 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		limit int
+		want  []string
+	}{
+		{
+			name:  "last friday of the month",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 4,
+			want:  []string{"2024-01-26 09:00", "2024-02-23 09:00", "2024-03-29 09:00", "2024-04-26 09:00"},
+		},
+		{
+			name:  "day 31 skips short months",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 4,
+			want:  []string{"2024-01-31 09:00", "2024-03-31 09:00", "2024-05-31 09:00", "2024-07-31 09:00"},
+		},
+		{
+			name:  "count stops the series",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 10,
+			want:  []string{"2024-01-01 09:00", "2024-01-02 09:00", "2024-01-03 09:00"},
+		},
+		{
+			name:  "utc until is inclusive",
+			rule:  "FREQ=DAILY;UNTIL=20240103T090000Z",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 10,
+			want:  []string{"2024-01-01 09:00", "2024-01-02 09:00", "2024-01-03 09:00"},
+		},
+		{
+			name:  "date until covers the whole day",
+			rule:  "FREQ=DAILY;UNTIL=20240103",
+			start: time.Date(2024, 1, 1, 18, 30, 0, 0, time.UTC),
+			limit: 10,
+			want:  []string{"2024-01-01 18:30", "2024-01-02 18:30", "2024-01-03 18:30"},
+		},
+		{
+			name:  "every other week",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 5,
+			want:  []string{"2024-01-01 09:00", "2024-01-03 09:00", "2024-01-15 09:00", "2024-01-17 09:00", "2024-01-29 09:00"},
+		},
+		{
+			name:  "last workday of the month",
+			rule:  "RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 3,
+			want:  []string{"2024-01-31 09:00", "2024-02-29 09:00", "2024-03-29 09:00"},
+		},
+		{
+			name:  "start outside the rule is skipped",
+			rule:  "FREQ=WEEKLY;BYDAY=FR",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			limit: 2,
+			want:  []string{"2024-01-05 09:00", "2024-01-12 09:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			got := rule.All(tt.start, tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %d", len(got), got, len(tt.want))
+			}
+			for i, occurrence := range got {
+				if s := occurrence.Format("2006-01-02 15:04"); s != tt.want[i] {
+					t.Errorf("occurrence %d = %s, want %s", i, s, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAllKeepsWallClockAcrossDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		start    time.Time
+		rule     string
+		want     []string
+	}{
+		{
+			name:     "spring forward in Berlin",
+			location: "Europe/Berlin",
+			start:    time.Date(2024, 3, 30, 9, 0, 0, 0, time.UTC),
+			rule:     "FREQ=DAILY;COUNT=3",
+			want:     []string{"2024-03-30 09:00 +0100", "2024-03-31 09:00 +0200", "2024-04-01 09:00 +0200"},
+		},
+		{
+			name:     "fall back in New York",
+			location: "America/New_York",
+			start:    time.Date(2024, 11, 2, 9, 0, 0, 0, time.UTC),
+			rule:     "FREQ=DAILY;UNTIL=20241104",
+			want:     []string{"2024-11-02 09:00 -0400", "2024-11-03 09:00 -0500", "2024-11-04 09:00 -0500"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Fatalf("LoadLocation(%q): %v", tt.location, err)
+			}
+			start := time.Date(tt.start.Year(), tt.start.Month(), tt.start.Day(), tt.start.Hour(), tt.start.Minute(), 0, 0, loc)
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			got := rule.All(start, 10)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %d", len(got), got, len(tt.want))
+			}
+			for i, occurrence := range got {
+				if s := occurrence.Format("2006-01-02 15:04 -0700"); s != tt.want[i] {
+					t.Errorf("occurrence %d = %s, want %s", i, s, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	rule, err := Parse("FREQ=MONTHLY;BYDAY=-1FR;COUNT=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	next, ok := rule.Next(start, time.Date(2024, 1, 26, 9, 0, 0, 0, time.UTC))
+	if !ok || !next.Equal(time.Date(2024, 2, 23, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Next after first = %v, %v", next, ok)
+	}
+	if next, ok := rule.Next(start, next); ok {
+		t.Fatalf("Next after COUNT = %v, want none", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want error
+	}{
+		{"", ErrInvalidRule},
+		{"INTERVAL=2", ErrInvalidRule},
+		{"FREQ=YEARLY;FREQ=DAILY", ErrInvalidRule},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20240101", ErrInvalidRule},
+		{"FREQ=WEEKLY;BYDAY=-1FR", ErrInvalidRule},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", ErrInvalidRule},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ErrInvalidRule},
+		{"FREQ=MONTHLY;BYSETPOS=1", ErrInvalidRule},
+		{"FREQ=HOURLY", ErrUnsupportedRule},
+		{"FREQ=DAILY;BYHOUR=9", ErrUnsupportedRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			if _, err := Parse(tt.rule); !errors.Is(err, tt.want) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.rule, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "eu-central-1"
+)
+
+// s3Stub is an in-memory S3 endpoint that checks the signature of every
+// request
+type s3Stub struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]s3Object
+}
+
+type s3Object struct {
+	body        []byte
+	contentType string
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifySignature(r); err != nil {
+		s.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			s.t.Errorf("PUT %s: read %d bytes, Content-Length %d", r.URL.Path, len(body), r.ContentLength)
+		}
+		s.objects[r.URL.Path] = s3Object{body: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		object, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.body)
+	case http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature recomputes the Signature Version 4 of a request the way
+// S3 does and compares it with the Authorization header
+func verifySignature(r *http.Request) error {
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return errors.New("missing X-Amz-Date")
+	}
+	date := amzDate[:8]
+	scope := date + "/" + testRegion + "/s3/aws4_request"
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" +
+		payloadHash
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{date, testRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + hex.EncodeToString(key)
+	if got := r.Header.Get("Authorization"); got != want {
+		return errors.New("signature mismatch: " + got)
+	}
+	return nil
+}
+
+func newS3Stub(t *testing.T) (*S3Storage, *s3Stub) {
+	t.Helper()
+
+	stub := &s3Stub{t: t, objects: make(map[string]s3Object)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	s3, err := NewS3Storage(server.URL+"/", "uploads", testRegion, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return s3, stub
+}
+
+func TestS3StoragePutGetDelete(t *testing.T) {
+	s3, stub := newS3Stub(t)
+	ctx := context.Background()
+
+	content := "hello world"
+	if err := s3.Put(ctx, "users/1/a file.txt", strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	object, ok := stub.objects["/uploads/users/1/a file.txt"]
+	if !ok {
+		t.Fatalf("object not stored under a path-style key, have %v", stub.objects)
+	}
+	if object.contentType != "text/plain" {
+		t.Errorf("content type = %q", object.contentType)
+	}
+
+	body, err := s3.Get(ctx, "/users/1/a file.txt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != content {
+		t.Errorf("Get = %q, want %q", data, content)
+	}
+
+	if err := s3.Delete(ctx, "users/1/a file.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s3.Get(ctx, "users/1/a file.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+
+	// Deleting a missing object is not an error
+	if err := s3.Delete(ctx, "users/1/a file.txt"); err != nil {
+		t.Errorf("Delete of missing object: %v", err)
+	}
+}
+
+func TestS3StorageErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	s3, err := NewS3Storage(server.URL, "uploads", "", testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+
+	err = s3.Put(context.Background(), "key", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put = %v, want an error carrying the S3 response", err)
+	}
+}
+
+func TestNewS3StorageValidates(t *testing.T) {
+	if _, err := NewS3Storage("not a url", "bucket", "", "", ""); err == nil {
+		t.Error("expected an error for an invalid endpoint")
+	}
+	if _, err := NewS3Storage("http://localhost:9000", "", "", "", ""); err == nil {
+		t.Error("expected an error for a missing bucket")
+	}
+}